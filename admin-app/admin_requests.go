@@ -22,6 +22,14 @@ type AddPageRequest struct {
 	// Link of the page
 	// in: body
 	Link string `json:"link"`
+	// Blocks the page is built from, the page is
+	// rendered from the Markdown content without them
+	// in: body
+	Blocks []common.Block `json:"blocks"`
+	// Id of the parent page, the page is added
+	// at the top level without it
+	// in: body
+	ParentId int `json:"parent_id"`
 }
 
 // swagger:parameters deletePostRequest DeletePostRequest
@@ -60,6 +68,18 @@ type DeleteSchemaBinding struct {
 	Id string `uri:"Uuid" binding:"required"`
 }
 
+// swagger:parameters changeCardSchemaRequest ChangeCardSchemaRequest
+type ChangeCardSchemaRequest struct {
+	// New JSON schema, stored as the next version
+	// in: body
+	// required: true
+	JsonSchema json.RawMessage `json:"schema" swaggertype:"object"`
+	// JSON patch applied to every card of the schema. When
+	// given, even empty, the cards move to the new version
+	// in: body
+	Transform []common.PatchOperation `json:"transform"`
+}
+
 // swagger:parameters addPostRequest AddPostRequest
 type AddPostRequest struct {
 	// Title of the post
@@ -74,6 +94,35 @@ type AddPostRequest struct {
 	Content string `json:"content"`
 }
 
+// swagger:parameters previewRequest PreviewRequest
+type PreviewRequest struct {
+	// Title of the post
+	// in: body
+	Title string `json:"title"`
+	// Markdown content of the post, shortcodes included
+	// in: body
+	// required: true
+	Content string `json:"content" binding:"required"`
+}
+
+// swagger:parameters addPreviewRequest AddPreviewRequest
+type AddPreviewRequest struct {
+	// Title of the draft
+	// in: body
+	// required: true
+	Title string `json:"title" binding:"required"`
+	// Excerpt of the draft
+	// in: body
+	Excerpt string `json:"excerpt"`
+	// Markdown content of the draft, shortcodes included
+	// in: body
+	// required: true
+	Content string `json:"content" binding:"required"`
+	// Hours the link works for, 24 by default
+	// in: body
+	Hours int `json:"hours" binding:"min=0,max=168"`
+}
+
 // swagger:parameters changePostRequest ChangePostRequest
 type ChangePostRequest struct {
 	// ID of the post
@@ -106,11 +155,15 @@ type ChangePageRequest struct {
 	// Content of the page
 	// in: body
 	Content string `json:"content"`
+	// New blocks of the page, left unchanged when missing
+	// and removed when empty
+	// in: body
+	Blocks []common.Block `json:"blocks"`
 }
 
 // swagger:parameters addCardRequest AddCardRequest
 type AddCardRequest struct {
-	// Image location URL
+	// File name of the image in the media directory
 	// in: body
 	Image string `json:"image_location"`
 	// Schema name
@@ -126,15 +179,13 @@ type ChangeCardRequest struct {
 	// ID of the card
 	// in: body
 	Id string `json:"id"`
-	// Image location URL
+	// File name of the image in the media directory,
+	// the image is left as is when empty
 	// in: body
 	ImageLocation string `json:"image_location"`
 	// JSON data of the card
 	// in: body
 	JsonData string `json:"json_data"`
-	// JSON schema name
-	// in: body
-	SchemaName string `json:"json_schema"`
 }
 
 // swagger:parameters deleteCardRequest DeleteCardRequest
@@ -152,10 +203,17 @@ type GetCardRequest struct {
 	Schema string `uri:"schema" binding:"required"`
 	// Limit number of cards to return
 	// in: query
-	Limit uint32 `uri:"limit"`
-	// Page number for pagination
+	Limit uint32 `uri:"limit" form:"limit"`
+	// Page number for pagination, starting at 1
+	// in: query
+	Page uint32 `uri:"page" form:"page"`
+	// Top level field of the card data to sort by,
+	// the cards are in position order without it
+	// in: query
+	Sort string `form:"sort"`
+	// Sorts in descending order
 	// in: query
-	Page uint32 `uri:"page"`
+	Desc bool `form:"desc"`
 }
 
 // swagger:parameters addCardSchemaRequest AddCardSchemaRequest
@@ -209,3 +267,96 @@ func (c *AddCardSchemaRequest) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// swagger:parameters grantSiteRequest GrantSiteRequest
+type GrantSiteRequest struct {
+	// ID of the user getting access to the site
+	// in: body
+	// required: true
+	UserId uint `json:"user_id" binding:"required"`
+}
+
+// swagger:parameters addMenuRequest AddMenuRequest
+type AddMenuRequest struct {
+	// in: body
+	// required: true
+	Name string `json:"name" binding:"required"`
+	// `header`, `footer` or empty to not show the menu,
+	// the menu placed there before is unplaced
+	// in: body
+	Location string `json:"location"`
+}
+
+// swagger:parameters changeMenuRequest ChangeMenuRequest
+type ChangeMenuRequest struct {
+	// in: body
+	// required: true
+	Id int `json:"id" binding:"required"`
+	// in: body
+	// required: true
+	Name string `json:"name" binding:"required"`
+	// in: body
+	Location string `json:"location"`
+}
+
+// swagger:parameters menuItemRequest MenuItemRequest
+type MenuItemRequest struct {
+	// Item the new item goes under, zero for the top level.
+	// Ignored when changing an item, it's moved with the
+	// order endpoint.
+	// in: body
+	ParentId int `json:"parent_id"`
+	// `url`, `page`, `post`, `gallery` or `schema`
+	// in: body
+	// required: true
+	Type string `json:"type" binding:"required"`
+	// URL, page or post id, gallery name or schema uuid
+	// in: body
+	// required: true
+	Target string `json:"target" binding:"required"`
+	// Empty to show the title of the linked content
+	// in: body
+	Label string `json:"label"`
+	// in: body
+	Title string `json:"title"`
+	// Shown unless set to false
+	// in: body
+	Visible *bool `json:"visible"`
+}
+
+type MenuItemPosition struct {
+	Id       int `json:"id" binding:"required"`
+	ParentId int `json:"parent_id"`
+	Position int `json:"position"`
+}
+
+// swagger:parameters moveMenuItemsRequest MoveMenuItemsRequest
+type MoveMenuItemsRequest struct {
+	// New parent and position of the moved items
+	// in: body
+	// required: true
+	Items []MenuItemPosition `json:"items" binding:"required,dive"`
+}
+
+type PagePosition struct {
+	Id       int `json:"id" binding:"required"`
+	ParentId int `json:"parent_id"`
+	Position int `json:"position"`
+}
+
+// swagger:parameters movePagesRequest MovePagesRequest
+type MovePagesRequest struct {
+	// New parent and position of the moved pages
+	// in: body
+	// required: true
+	Pages []PagePosition `json:"pages" binding:"required,dive"`
+}
+
+type MenuItemBinding struct {
+	// in: path
+	// required: true
+	MenuId int `uri:"id" binding:"required"`
+	// in: path
+	// required: true
+	ItemId int `uri:"item_id" binding:"required"`
+}
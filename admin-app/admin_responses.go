@@ -1,6 +1,12 @@
 package admin_app
 
-import "github.com/rbc33/gocms/common"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+)
 
 // swagger:response PageResponse
 type PageResponse struct {
@@ -70,6 +76,13 @@ type CardIdResponse struct {
 	Id string `json:"id"`
 }
 
+// swagger:response GetCardsResponse
+type GetCardsResponse struct {
+	Cards []common.Card `json:"cards"`
+	// Number of cards of the schema
+	Total int `json:"total"`
+}
+
 // swagger:response CardSchemaResponse
 type CardSchemaResponse struct {
 	// UUID of the card schema
@@ -82,8 +95,119 @@ type GetSchemaasResponse struct {
 	Schemas []common.CardSchema `json:"schemas"`
 }
 
+// swagger:response CardSchemaVersionResponse
+type CardSchemaVersionResponse struct {
+	// UUID of the card schema
+	Id string `json:"uuid"`
+	// Version created by the change
+	Version int `json:"version"`
+	// Whether the cards were moved to the new version
+	Migrated bool `json:"migrated"`
+}
+
+// swagger:response CheckCardSchemaResponse
+type CheckCardSchemaResponse struct {
+	// Cards that would fail the new schema
+	Failures []common.CardFailure `json:"failures"`
+}
+
+// swagger:response GetSchemaVersionsResponse
+type GetSchemaVersionsResponse struct {
+	Versions []common.CardSchemaVersion `json:"versions"`
+}
+
 // swagger:response DeletePageResponse
 type DeletePageResponse struct {
 	// UUID of the deleted page
 	Id string `json:"uuid"`
 }
+
+// swagger:response ImportResponse
+type ImportResponse struct {
+	// Number of posts created
+	Posts int `json:"posts"`
+	// Number of pages created
+	Pages int `json:"pages"`
+	// Number of images stored in the media directory
+	Images int `json:"images"`
+	// Number of permalinks created for the old URLs
+	Permalinks int `json:"permalinks"`
+	// Drafts and pages that already existed
+	Skipped int `json:"skipped"`
+	// Items or images that could not be imported
+	Failed []string `json:"failed"`
+}
+
+// swagger:response SiteResponse
+type SiteResponse struct {
+	// ID of the site
+	Id int `json:"id"`
+	// Name of the site
+	Name string `json:"name"`
+	// Hosts the site is served from
+	Hosts []string `json:"hosts"`
+}
+
+// swagger:response GetSitesResponse
+type GetSitesResponse struct {
+	// Sites the user can manage
+	Sites []SiteResponse `json:"sites"`
+}
+
+// swagger:response SettingsResponse
+type SettingsResponse struct {
+	// Value of every editable setting of the site,
+	// but the write-only ones
+	Settings map[string]json.RawMessage `json:"settings" swaggertype:"object"`
+	// Settings changed from the admin-app, the rest
+	// come from the config file
+	Overridden []string `json:"overridden"`
+}
+
+// swagger:response MenuResponse
+type MenuResponse struct {
+	Id int `json:"id"`
+}
+
+// swagger:response GetMenusResponse
+type GetMenusResponse struct {
+	Menus []common.Menu `json:"menus"`
+}
+
+// swagger:response PreviewLinkResponse
+type PreviewLinkResponse struct {
+	Uuid string `json:"uuid"`
+	// Path of the preview on the public site
+	Url       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Content where a shortcode is used
+type ShortcodeContent struct {
+	// `post`, `page` or `card`
+	Type string `json:"type"`
+	// Id of the post, link of the page or uuid of the card
+	Id string `json:"id"`
+	// Title of the post or page, title of the schema for cards
+	Title string `json:"title"`
+}
+
+type ShortcodeUsage struct {
+	Name string `json:"name"`
+	// Lua plugin of the shortcode, empty when the
+	// content uses a shortcode missing in the config
+	Plugin  string             `json:"plugin"`
+	Content []ShortcodeContent `json:"content"`
+}
+
+// swagger:response GetShortcodesResponse
+type GetShortcodesResponse struct {
+	Shortcodes []ShortcodeUsage `json:"shortcodes"`
+}
+
+// swagger:response PluginErrorsResponse
+type PluginErrorsResponse struct {
+	Msg string `json:"msg"`
+	// What went wrong with each plugin call
+	Errors []*plugins.PluginError `json:"errors"`
+}
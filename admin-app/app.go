@@ -1,10 +1,10 @@
 package admin_app
 
 import (
-	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rbc33/gocms/auth"
@@ -12,29 +12,46 @@ import (
 	"github.com/rbc33/gocms/database"
 	"github.com/rbc33/gocms/middlewares"
 	"github.com/rbc33/gocms/plugins"
-	lua "github.com/yuin/gopher-lua"
 
 	_ "github.com/rbc33/gocms/docs"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-func LoadShortcodesHandlers(shortcodes []common.Shortcode) (map[string]*lua.LState, error) {
-	shorcodes_handlers := make(map[string]*lua.LState, 0)
-	for _, shortcode := range shortcodes {
-		// Read the Lua State
-		state := lua.NewState()
-		err := state.DoFile(shortcode.Plugin)
-		if err != nil {
-			return map[string]*lua.LState{}, fmt.Errorf("could not load %s: %v", shortcode.Name, err)
-		}
-		shorcodes_handlers[shortcode.Name] = state
+func LoadShortcodesHandlers(shortcodes []common.Shortcode) (plugins.ShortcodeHandlers, error) {
+	return plugins.LoadShortcodeHandlers(shortcodes)
+}
+
+// Lua pools of the shortcodes, swapped when
+// the config is reloaded
+type shortcodeRegistry struct {
+	handlers atomic.Pointer[plugins.ShortcodeHandlers]
+}
+
+func makeShortcodeRegistry(handlers plugins.ShortcodeHandlers) *shortcodeRegistry {
+	registry := &shortcodeRegistry{}
+	registry.handlers.Store(&handlers)
+	return registry
+}
+
+func (registry *shortcodeRegistry) Handlers() plugins.ShortcodeHandlers {
+	return *registry.handlers.Load()
+}
+
+// The plugins are loaded again even if the config did not
+// change, their scripts may have. Calls running on the
+// previous pools finish before they are closed.
+func (registry *shortcodeRegistry) reload(previous *common.AppSettings, settings *common.AppSettings) {
+	handlers, err := LoadShortcodesHandlers(settings.Shortcodes)
+	if err != nil {
+		log.Printf("could not reload shortcodes, keeping the previous ones: %v", err)
+		return
 	}
-	return shorcodes_handlers, nil
+	registry.handlers.Swap(&handlers).Close()
 }
 
-func SetupRoutes(settings common.AppSettings, shortcode_handlers map[string]*lua.LState, database database.Database, hooks map[string]plugins.Hook) *gin.Engine {
-	// func SetupRoutes(settings common.AppSettings, shortcode_handlers map[string]*lua.LState, database database.Database) *gin.Engine {
+// The hooks are reloaded with the settings, nil runs no plugins
+func SetupRoutes(settings common.AppSettings, shortcode_handlers plugins.ShortcodeHandlers, database database.Database, hooks *plugins.Hooks) *gin.Engine {
 
 	gin.SetMode(gin.ReleaseMode)
 
@@ -42,10 +59,18 @@ func SetupRoutes(settings common.AppSettings, shortcode_handlers map[string]*lua
 	r.MaxMultipartMemory = 1
 	r.Use(CORSMiddleware())
 
-	post_hook, ok := hooks["add_post"]
-	if !ok {
-		log.Fatalf("could not find add_post hook")
+	invalidator := MakeCacheInvalidator(settings)
+	shortcodes := makeShortcodeRegistry(shortcode_handlers)
+	common.OnSettingsReload(shortcodes.reload)
+
+	if hooks == nil {
+		hooks = &plugins.Hooks{}
 	}
+	common.OnSettingsReload(func(previous *common.AppSettings, settings *common.AppSettings) {
+		if err := hooks.Reload(settings.Plugins); err != nil {
+			log.Printf("could not reload plugins, keeping the previous ones: %v", err)
+		}
+	})
 
 	// Public routes
 	r.GET("/swagger/*any", func(c *gin.Context) {
@@ -58,47 +83,127 @@ func SetupRoutes(settings common.AppSettings, shortcode_handlers map[string]*lua
 		r.POST("/register", auth.CreateRegisterHandler(database))
 	}
 	r.POST("/login", auth.LoginHandler(database))
+	// Scripts of the admin pages
+	r.Static("/static", "./static")
 
 	// Protected routes group with JWT middleware
-	protected := r.Group("/")
-	protected.Use(middlewares.JwtAuthMiddleware()) // replace with your actual middleware function
+	authenticated := r.Group("/")
+	authenticated.Use(middlewares.JwtAuthMiddleware()) // replace with your actual middleware function
+	authenticated.GET("/user", auth.GetCurrentUserHandler(database))
+	authenticated.GET("/sites", getSitesHandler(database))
+
+	// Content routes only manage the sites the user was granted
+	protected := authenticated.Group("/")
+	protected.Use(requireSiteAccess(database))
+	protected.POST("/sites/users", postSiteUserHandler(database))
 
 	// Move posts routes inside protected group
 	posts := protected.Group("/posts")
 	{
 		posts.GET("", getPostsHandler(database))
 		posts.GET("/:id", getPostHandler(database))
-		posts.POST("", postPostHandler(database, shortcode_handlers, post_hook.(*plugins.PostHook)))
-		posts.PUT("", putPostHandler(database))
-		posts.DELETE("", deletePostHandler(database))
+		posts.POST("", postPostHandler(database, hooks, invalidator))
+		posts.PUT("", putPostHandler(database, hooks, invalidator))
+		posts.DELETE("", deletePostHandler(database, invalidator))
 	}
 
+	// Drafts rendered like the site without saving them
+	protected.POST("/preview", postPreviewPageHandler(database, shortcodes))
+	protected.POST("/previews", postPreviewLinkHandler(database))
+
+	// Content using each shortcode, they are expanded by the app
+	protected.GET("/shortcodes", getShortcodesHandler(database))
+
 	// Move pages routes inside protected group
 	pages := protected.Group("/pages")
 	{
 		pages.GET("", getPagesHandler(database))
-		pages.POST("", postPageHandler(database))
-		pages.PUT("", putPageHandler(database))
-		pages.DELETE("", deletePageHandler(database))
+		pages.POST("", postPageHandler(database, hooks, invalidator))
+		pages.PUT("", putPageHandler(database, hooks, invalidator))
+		pages.PUT("/order", putPagesOrderHandler(database, invalidator))
+		pages.DELETE("", deletePageHandler(database, invalidator))
+	}
+
+	// Menus shown in the layout, the items link to the site content
+	menus := protected.Group("/menus")
+	{
+		menus.GET("", getMenusHandler(database))
+		menus.GET("/:id", getMenuHandler(database))
+		menus.POST("", postMenuHandler(database, invalidator))
+		menus.PUT("", putMenuHandler(database, invalidator))
+		menus.DELETE("/:id", deleteMenuHandler(database, invalidator))
+		menus.POST("/:id/items", postMenuItemHandler(database, invalidator))
+		menus.PUT("/:id/items/:item_id", putMenuItemHandler(database, invalidator))
+		menus.DELETE("/:id/items/:item_id", deleteMenuItemHandler(database, invalidator))
+		menus.PUT("/:id/order", putMenuOrderHandler(database, invalidator))
 	}
 
 	// Similarly, move other routes inside protected group
 
-	protected.POST("/images", postImageHandler())
-	protected.DELETE("/images/:name", deleteImageHandler())
+	protected.POST("/images", postImageHandler(hooks, invalidator))
+	protected.DELETE("/images/:name", deleteImageHandler(invalidator))
 
 	protected.GET("/cards/:schema", getCardHandler(database))
 	protected.GET("/cards/:schema/:limit/:page", getCardHandler(database))
-	protected.POST("/card-schemas", postSchemaHandler(database))
+	protected.POST("/card-schemas", postSchemaHandler(database, invalidator))
 	protected.GET("/card-schemas", getSchemasHandler(database))
-	protected.DELETE("/card-schemas", deleteCardSchemaHandler(database))
+	protected.DELETE("/card-schemas", deleteCardSchemaHandler(database, invalidator))
 	protected.GET("/card-schemas/:id", getSchemaHandler(database))
+	protected.PUT("/card-schemas/:id", putSchemaHandler(database, invalidator))
+	protected.POST("/card-schemas/:id/check", checkSchemaHandler(database))
+	protected.GET("/card-schemas/:id/versions", getSchemaVersionsHandler(database))
 
-	protected.POST("/cards", postCardHandler(database))
-	protected.PUT("/card", putCardHandler(database))
-	protected.DELETE("/card", deleteCardHandler(database))
+	protected.POST("/cards", postCardHandler(database, invalidator))
+	protected.PUT("/card", putCardHandler(database, invalidator))
+	protected.DELETE("/card", deleteCardHandler(database, invalidator))
 	protected.POST("/permalinks/:permalink/:post_id", postPermalinkHandler(database))
-	protected.GET("/user", auth.GetCurrentUserHandler(database))
+	protected.POST("/cache/purge", postCachePurgeHandler(invalidator))
+	protected.POST("/import", postImportHandler(database, invalidator))
+	protected.GET("/backup", getBackupHandler(database))
+	protected.GET("/settings", getSettingsHandler(database))
+	protected.GET("/settings/schema", getSettingsSchemaHandler())
+	protected.PUT("/settings", putSettingsHandler(database, invalidator))
+	protected.DELETE("/settings/:name", deleteSettingHandler(database, invalidator))
+
+	// Admin pages, the session is kept in a cookie
+	r.GET("/ui/login", getLoginPageHandler())
+	r.POST("/ui/login", postLoginHandler(database))
+	ui := r.Group("/ui")
+	ui.Use(sessionMiddleware(), requireSiteAccess(database), csrfMiddleware())
+	{
+		ui.GET("", getDashboardHandler(database))
+		ui.POST("/logout", postLogoutHandler())
+		ui.POST("/preview", postPreviewHandler(shortcodes))
+
+		ui.GET("/posts", getPostsPageHandler(database))
+		ui.GET("/posts/new", getPostEditorHandler(database))
+		ui.GET("/posts/:id/edit", getPostEditorHandler(database))
+		ui.POST("/posts", savePostEditorHandler(database, hooks, invalidator))
+		ui.POST("/posts/:id", savePostEditorHandler(database, hooks, invalidator))
+		ui.DELETE("/posts/:id", deletePostRowHandler(database, invalidator))
+
+		ui.GET("/pages", getPagesPageHandler(database))
+		ui.GET("/pages/new", getPageEditorHandler(database))
+		ui.GET("/pages/:link/edit", getPageEditorHandler(database))
+		ui.POST("/pages", savePageEditorHandler(database, hooks, invalidator))
+		ui.POST("/pages/:link", savePageEditorHandler(database, hooks, invalidator))
+		ui.DELETE("/pages/:link", deletePageRowHandler(database, invalidator))
+
+		ui.GET("/media", getMediaPageHandler())
+		ui.GET("/images/data/*filepath", getMediaFileHandler())
+		ui.POST("/media", postMediaHandler(hooks, invalidator))
+		ui.DELETE("/media/:name", deleteMediaHandler(invalidator))
+
+		// Forms made from the card schemas
+		ui.GET("/card-schemas", getSchemasPageHandler(database))
+		ui.GET("/cards/:schema", getCardsPageHandler(database))
+		ui.GET("/cards/:schema/new", getCardFormPageHandler(database))
+		ui.GET("/cards/:schema/:id/edit", getCardFormPageHandler(database))
+		ui.POST("/cards/:schema/form", postCardFormHandler(database))
+		ui.POST("/cards/:schema", saveCardFormHandler(database, invalidator))
+		ui.POST("/cards/:schema/:id", saveCardFormHandler(database, invalidator))
+		ui.DELETE("/cards/:schema/:id", deleteCardRowHandler(database, invalidator))
+	}
 
 	return r
 }
@@ -108,7 +213,7 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+common.SITE_HEADER)
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,69 @@
+package admin_app
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/backup"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+// Backups read the tables directly, so they need
+// the SQL connection behind the interface
+func sqlDatabase(db database.Database) (database.SqlDatabase, bool) {
+	sql_database, ok := db.(*database.SqlDatabase)
+	if !ok {
+		return database.SqlDatabase{}, false
+	}
+	return *sql_database, true
+}
+
+// @Summary      Download a site backup
+// @Description  Returns a zip archive with a JSON-lines dump of the content of the site, the media files, the galleries and a manifest with checksums. The user accounts and the other sites are left out. Restore it with `gocms-admin restore`.
+// @Tags         backup
+// @Produce      application/zip
+// @Security     BearerAuth
+// @Success      200 {file} file "Backup archive"
+// @Failure      500 {object} common.ErrorResponse "The backup could not be created"
+// @Router       /backup [get]
+func getBackupHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		sql_database, ok := sqlDatabase(database)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, common.MsgErrorRes("backups require a SQL database"))
+			return
+		}
+
+		// Written to a file first so a failure can
+		// still be reported with an error status
+		archive, err := os.CreateTemp("", "gocms-backup-*.zip")
+		if err != nil {
+			log.Error().Msgf("could not create backup file: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not create backup", err))
+			return
+		}
+		defer os.Remove(archive.Name())
+		defer archive.Close()
+
+		// Editors only get the site they manage, whole
+		// backups are made with `gocms-admin backup`
+		site := c.MustGet(SITE_KEY).(common.Site)
+		_, err = backup.WriteBackup(sql_database, backup.BackupOptions{
+			ImageDirectory: common.SiteImageDirectory(site.Id),
+			Galleries:      site.Galleries,
+			SiteId:         site.Id,
+		}, archive)
+		if err != nil {
+			log.Error().Msgf("could not write backup: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not create backup", err))
+			return
+		}
+
+		c.FileAttachment(archive.Name(), fmt.Sprintf("gocms-backup-%s.zip", time.Now().UTC().Format("20060102-150405")))
+	}
+}
@@ -0,0 +1,115 @@
+package admin_app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rs/zerolog/log"
+)
+
+// Publishes cache invalidation messages to the app
+// whenever content is changed through the admin-app.
+type CacheInvalidator interface {
+	Invalidate(request common.CacheInvalidationRequest) error
+}
+
+// Sends the invalidation to the app's `/cache/invalidate`
+// endpoint, authenticated with the shared cache secret.
+type HttpCacheInvalidator struct {
+	Url    string
+	Secret string
+	client *http.Client
+}
+
+func (invalidator *HttpCacheInvalidator) Invalidate(request common.CacheInvalidationRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	http_request, err := http.NewRequest(http.MethodPost, invalidator.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	http_request.Header.Set("Content-Type", "application/json")
+	http_request.Header.Set(common.CACHE_SECRET_HEADER, invalidator.Secret)
+
+	response, err := invalidator.client.Do(http_request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("cache invalidation returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Used when no `cache_invalidate_url` is configured.
+type NoopCacheInvalidator struct{}
+
+func (invalidator NoopCacheInvalidator) Invalidate(request common.CacheInvalidationRequest) error {
+	return nil
+}
+
+func MakeCacheInvalidator(settings common.AppSettings) CacheInvalidator {
+	if settings.CacheInvalidateUrl == "" {
+		return NoopCacheInvalidator{}
+	}
+
+	return &HttpCacheInvalidator{
+		Url:    settings.CacheInvalidateUrl,
+		Secret: settings.CacheSecret,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// The content change already succeeded at this point, so
+// a failed invalidation is only logged: the cached pages
+// will still expire on their own.
+func invalidateTags(invalidator CacheInvalidator, tags ...string) {
+	err := invalidator.Invalidate(common.CacheInvalidationRequest{Tags: tags})
+	if err != nil {
+		log.Warn().Msgf("could not invalidate cache tags %v: %v", tags, err)
+	}
+}
+
+// @Summary      Purge the app cache
+// @Description  Purges cached pages in the app by tag, by path or all of them.
+// @Tags         cache
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        purge body common.CacheInvalidationRequest true "Tags and paths to purge"
+// @Success      200 {object} common.CacheInvalidationRequest
+// @Failure      400 {object} common.ErrorResponse "Invalid request body"
+// @Failure      502 {object} common.ErrorResponse "The app could not be reached"
+// @Router       /cache/purge [post]
+func postCachePurgeHandler(invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		var purge_request common.CacheInvalidationRequest
+		if err := c.ShouldBindJSON(&purge_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		if !purge_request.All && len(purge_request.Tags) == 0 && len(purge_request.Paths) == 0 {
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes("nothing to purge, give `tags`, `paths` or `all`"))
+			return
+		}
+
+		if err := invalidator.Invalidate(purge_request); err != nil {
+			log.Error().Msgf("could not purge cache: %v", err)
+			c.JSON(http.StatusBadGateway, common.ErrorRes("could not purge cache", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, purge_request)
+	}
+}
@@ -0,0 +1,454 @@
+package admin_app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/gin-gonic/gin"
+	"github.com/kaptinlin/jsonschema"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	admin_views "github.com/rbc33/gocms/views/admin"
+	"github.com/rs/zerolog/log"
+)
+
+// Cards shown on each page of the admin card list
+const CARD_LIST_PAGE_SIZE = 20
+
+func renderAdminHtml(c *gin.Context, status int, component templ.Component) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := component.Render(c.Request.Context(), c.Writer); err != nil {
+		log.Error().Msgf("could not render admin page: %v", err)
+	}
+}
+
+func renderAdminPage(c *gin.Context, title string, content templ.Component) {
+	renderAdminHtml(c, http.StatusOK, admin_views.MakeAdminLayout(title, c.GetString(CSRF_KEY), content))
+}
+
+// Images of the media directory the image fields can pick from
+func mediaImages(directory string) []string {
+	entries, err := os.ReadDir(directory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}
+	} else if err != nil {
+		log.Warn().Msgf("could not list the media directory: %v", err)
+		return []string{}
+	}
+	images := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && allowed_extensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			images = append(images, entry.Name())
+		}
+	}
+	return images
+}
+
+// Card images are file names of the media directory, the
+// ones the image fields pick from. Empty for no image.
+func checkCardImage(directory string, image string) error {
+	if image == "" {
+		return nil
+	}
+	if filepath.Base(image) != image || image == "." || image == ".." {
+		return fmt.Errorf("image `%s` is not a file name of the media directory", image)
+	}
+	image_stat, err := os.Stat(filepath.Join(directory, image))
+	if err != nil || !image_stat.Mode().IsRegular() {
+		return fmt.Errorf("image `%s` does not exist", image)
+	}
+	return nil
+}
+
+// Validation errors of the card data by JSON pointer,
+// errors of the whole card are under ""
+func cardDataErrors(json_data []byte, json_schema string) (map[string]string, error) {
+	schema, err := jsonschema.NewCompiler().Compile([]byte(json_schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile the json_schema from db: %v", err)
+	}
+	var data map[string]any
+	if err = json.Unmarshal(json_data, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse card json : %v", err)
+	}
+
+	errors := make(map[string]string)
+	var collect func(list jsonschema.List)
+	collect = func(list jsonschema.List) {
+		for _, message := range list.Errors {
+			if errors[list.InstanceLocation] != "" {
+				errors[list.InstanceLocation] += ", "
+			}
+			errors[list.InstanceLocation] += message
+		}
+		for _, detail := range list.Details {
+			collect(detail)
+		}
+	}
+	if result := schema.Validate(data); !result.IsValid() {
+		collect(*result.ToList())
+	}
+	return errors, nil
+}
+
+// The schema the card was written with, the latest
+// version for new cards
+func cardFormSchema(database database.Database, schema common.CardSchema, card common.Card) string {
+	if card.Id == "" {
+		return schema.Schema
+	}
+	versions, err := database.GetCardSchemaVersions(schema.Uuid)
+	if err != nil {
+		log.Warn().Msgf("could not get the versions of schema %s: %v", schema.Uuid, err)
+		return schema.Schema
+	}
+	for _, version := range versions {
+		if version.Version == card.SchemaVersion {
+			return version.Schema
+		}
+	}
+	return schema.Schema
+}
+
+// First text of the card data, to tell the cards apart
+func cardSummary(json_schema string, card common.Card) string {
+	var data map[string]any
+	if err := json.Unmarshal([]byte(card.Content), &data); err != nil {
+		return card.Id
+	}
+	fields, err := common.CardFormFields(json_schema, data, nil, nil)
+	if err != nil {
+		return card.Id
+	}
+	for _, field := range fields {
+		if field.Type == common.FORM_FIELD_TEXT && field.Value != "" {
+			return field.Value
+		}
+	}
+	return card.Id
+}
+
+// Schema of the `:schema` param and the card of the `:id`
+// param, answers the request when one isn't found
+func cardFormTarget(c *gin.Context, database database.Database, card_id string) (common.CardSchema, common.Card, bool) {
+	schema_uuid := c.Param("schema")
+	schema, err := database.GetCardSchema(schema_uuid)
+	if err != nil {
+		log.Warn().Msgf("could not get card schema %s: %v", schema_uuid, err)
+		c.JSON(http.StatusNotFound, common.ErrorRes("card schema not found", err))
+		return common.CardSchema{}, common.Card{}, false
+	}
+	schema.Uuid = schema_uuid
+	if card_id == "" {
+		return schema, common.Card{}, true
+	}
+
+	card, err := database.GetCard(card_id)
+	if err != nil || card.Schema != schema_uuid {
+		log.Warn().Msgf("could not get card %s: %v", card_id, err)
+		c.JSON(http.StatusNotFound, common.MsgErrorRes("card not found"))
+		return common.CardSchema{}, common.Card{}, false
+	}
+	return schema, card, true
+}
+
+func makeCardForm(c *gin.Context, schema common.CardSchema, card common.Card, json_schema string, data any, errors map[string]string) (admin_views.CardForm, error) {
+	images := mediaImages(siteImageDirectory(c))
+	fields, err := common.CardFormFields(json_schema, data, errors, images)
+	if err != nil {
+		return admin_views.CardForm{}, err
+	}
+	form := admin_views.CardForm{
+		Schema: schema,
+		CardId: card.Id,
+		Image:  card.Image,
+		Images: images,
+		Fields: fields,
+		Errors: []string{},
+	}
+	if errors[""] != "" {
+		form.Errors = append(form.Errors, errors[""])
+	}
+	return form, nil
+}
+
+// @Summary      Card schemas page
+// @Description  Lists the card schemas with links to their cards.
+// @Tags         admin_ui
+// @Produce      html
+// @Success      200 {string} string "HTML page"
+// @Router       /ui/card-schemas [get]
+func getSchemasPageHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		schemas, err := database.GetCardSchemas(0, 0)
+		if err != nil {
+			log.Error().Msgf("could not get card schemas: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get card schemas", err))
+			return
+		}
+		renderAdminPage(c, "Card schemas", admin_views.MakeSchemaList(schemas))
+	}
+}
+
+// @Summary      Cards page
+// @Description  Lists the cards of a schema with links to edit and delete them.
+// @Tags         admin_ui
+// @Produce      html
+// @Param        schema path string true "Card schema UUID"
+// @Param        page query int false "Page number, starting at 1"
+// @Success      200 {string} string "HTML page"
+// @Failure      404 {object} common.ErrorResponse "Schema not found"
+// @Router       /ui/cards/{schema} [get]
+func getCardsPageHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		schema, _, ok := cardFormTarget(c, database, "")
+		if !ok {
+			return
+		}
+
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes("invalid page"))
+			return
+		}
+		cards, total, err := database.GetCards(schema.Uuid, common.CardQuery{Limit: CARD_LIST_PAGE_SIZE, Offset: (page - 1) * CARD_LIST_PAGE_SIZE})
+		if err != nil {
+			log.Error().Msgf("could not get cards: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get cards", err))
+			return
+		}
+
+		list := admin_views.CardList{
+			Schema: schema,
+			Cards:  []admin_views.CardRow{},
+			Page:   page,
+			Pages:  (total + CARD_LIST_PAGE_SIZE - 1) / CARD_LIST_PAGE_SIZE,
+		}
+		for _, card := range cards {
+			list.Cards = append(list.Cards, admin_views.CardRow{Id: card.Id, Image: card.Image, Summary: cardSummary(schema.Schema, card)})
+		}
+		renderAdminPage(c, schema.Title, admin_views.MakeCardList(list))
+	}
+}
+
+// @Summary      Card form page
+// @Description  Form made from the card schema, empty for new cards or with the values of the card being edited.
+// @Tags         admin_ui
+// @Produce      html
+// @Param        schema path string true "Card schema UUID"
+// @Param        id path string false "Card UUID"
+// @Success      200 {string} string "HTML page"
+// @Failure      404 {object} common.ErrorResponse "Schema or card not found"
+// @Router       /ui/cards/{schema}/new [get]
+// @Router       /ui/cards/{schema}/{id}/edit [get]
+func getCardFormPageHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		schema, card, ok := cardFormTarget(c, database, c.Param("id"))
+		if !ok {
+			return
+		}
+
+		var data any
+		if card.Content != "" {
+			decoder := json.NewDecoder(strings.NewReader(card.Content))
+			decoder.UseNumber()
+			if err := decoder.Decode(&data); err != nil {
+				log.Warn().Msgf("could not parse card %s: %v", card.Id, err)
+			}
+		}
+		form, err := makeCardForm(c, schema, card, cardFormSchema(database, schema, card), data, nil)
+		if err != nil {
+			log.Error().Msgf("could not make card form: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not make card form", err))
+			return
+		}
+
+		title := "New " + schema.Title
+		if card.Id != "" {
+			title = "Edit " + schema.Title
+		}
+		renderAdminPage(c, title, admin_views.MakeCardForm(form))
+	}
+}
+
+// @Summary      Card form
+// @Description  Renders the submitted card form again, adding the array item named by `_add` or removing the one named by `_remove`.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        schema path string true "Card schema UUID"
+// @Success      200 {string} string "HTML form"
+// @Failure      404 {object} common.ErrorResponse "Schema or card not found"
+// @Router       /ui/cards/{schema}/form [post]
+func postCardFormHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid form", err))
+			return
+		}
+		schema, card, ok := cardFormTarget(c, database, c.PostForm("_card"))
+		if !ok {
+			return
+		}
+		json_schema := cardFormSchema(database, schema, card)
+
+		errors := make(map[string]string)
+		data, err := common.CardFormData(json_schema, c.Request.PostForm, true)
+		if err == nil {
+			data, err = changeFormItems(json_schema, data, c.PostForm("_add"), c.PostForm("_remove"))
+		}
+		if err != nil {
+			errors[""] = err.Error()
+		}
+
+		card.Image = c.PostForm("image_location")
+		form, err := makeCardForm(c, schema, card, json_schema, data, errors)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not make card form", err))
+			return
+		}
+		renderAdminHtml(c, http.StatusOK, admin_views.MakeCardForm(form))
+	}
+}
+
+// Adds an item to the array at `add` or removes
+// the array item at `remove`, both JSON pointers
+func changeFormItems(json_schema string, data map[string]any, add string, remove string) (map[string]any, error) {
+	operations := []common.PatchOperation{}
+	if add != "" {
+		item, err := common.CardFormNewItem(json_schema, add)
+		if err != nil {
+			return data, err
+		}
+		item_json, _ := json.Marshal(item)
+		operations = append(operations, common.PatchOperation{Op: common.PATCH_ADD, Path: add + "/-", Value: item_json})
+	}
+	if remove != "" {
+		operations = append(operations, common.PatchOperation{Op: common.PATCH_REMOVE, Path: remove})
+	}
+	if len(operations) == 0 {
+		return data, nil
+	}
+
+	data_json, err := json.Marshal(data)
+	if err != nil {
+		return data, err
+	}
+	patched, err := common.ApplyPatch(string(data_json), operations)
+	if err != nil {
+		return data, err
+	}
+	changed := map[string]any{}
+	decoder := json.NewDecoder(strings.NewReader(patched))
+	decoder.UseNumber()
+	return changed, decoder.Decode(&changed)
+}
+
+// @Summary      Save a card form
+// @Description  Adds the card of the form, or changes the card of the `id` param. The card is checked against its schema
+// @Description  and the form comes back with the errors, otherwise htmx is redirected to the card list.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        schema path string true "Card schema UUID"
+// @Param        id path string false "Card UUID"
+// @Success      200 {string} string "HTML form with the errors, or an `HX-Redirect` header"
+// @Failure      404 {object} common.ErrorResponse "Schema or card not found"
+// @Router       /ui/cards/{schema} [post]
+// @Router       /ui/cards/{schema}/{id} [post]
+func saveCardFormHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid form", err))
+			return
+		}
+		schema, card, ok := cardFormTarget(c, database, c.Param("id"))
+		if !ok {
+			return
+		}
+		json_schema := cardFormSchema(database, schema, card)
+		card.Image = c.PostForm("image_location")
+
+		errors := make(map[string]string)
+		data, err := common.CardFormData(json_schema, c.Request.PostForm, false)
+		var json_data []byte
+		if err == nil {
+			json_data, err = json.Marshal(data)
+		}
+		if err == nil {
+			errors, err = cardDataErrors(json_data, json_schema)
+		}
+		if err != nil {
+			errors = map[string]string{"": err.Error()}
+		}
+		if err = checkCardImage(siteImageDirectory(c), card.Image); err != nil {
+			errors[""] = err.Error()
+		}
+
+		if len(errors) == 0 {
+			if card.Id == "" {
+				_, err = database.AddCard(card.Image, schema.Uuid, string(json_data))
+			} else {
+				// "No image" clears the image of the card
+				err = database.ChangeCard(card.Id, &card.Image, string(json_data))
+			}
+			if err == nil {
+				invalidateTags(invalidator, common.SchemaCacheTag(schema.Uuid), common.CACHE_TAG_CARDS)
+				c.Header("HX-Redirect", "/ui/cards/"+url.PathEscape(schema.Uuid))
+				c.Status(http.StatusOK)
+				return
+			}
+			log.Error().Msgf("failed to save card: %v", err)
+			errors[""] = fmt.Sprintf("could not save card: %v", err)
+		}
+
+		// The form keeps what was typed
+		form_data, _ := common.CardFormData(json_schema, c.Request.PostForm, true)
+		form, err := makeCardForm(c, schema, card, json_schema, form_data, errors)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not make card form", err))
+			return
+		}
+		renderAdminHtml(c, http.StatusOK, admin_views.MakeCardForm(form))
+	}
+}
+
+// @Summary      Delete a card from the card list
+// @Description  Deletes the card, htmx removes its row with the empty response.
+// @Tags         admin_ui
+// @Param        schema path string true "Card schema UUID"
+// @Param        id path string true "Card UUID"
+// @Success      200 {string} string "Empty response"
+// @Failure      404 {object} common.ErrorResponse "Schema or card not found"
+// @Router       /ui/cards/{schema}/{id} [delete]
+func deleteCardRowHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		schema, card, ok := cardFormTarget(c, database, c.Param("id"))
+		if !ok {
+			return
+		}
+		if err := database.DeleteCard(card.Id); err != nil {
+			log.Error().Msgf("failed to delete card: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not delete card", err))
+			return
+		}
+		invalidateTags(invalidator, common.SchemaCacheTag(schema.Uuid), common.CACHE_TAG_CARDS)
+		c.String(http.StatusOK, "")
+	}
+}
@@ -24,8 +24,9 @@ import (
 // @Success      200 {object} CardIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or schema"
 // @Router       /card-schemas [post]
-func postSchemaHandler(database database.Database) func(*gin.Context) {
+func postSchemaHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var add_schema_request AddCardSchemaRequest
 		if c.Request.Body == nil {
 			c.JSON(http.StatusBadRequest, common.MsgErrorRes("no request body provided"))
@@ -65,6 +66,7 @@ func postSchemaHandler(database database.Database) func(*gin.Context) {
 			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add card schema", err))
 			return
 		}
+		invalidateTags(invalidator, common.CACHE_TAG_SCHEMAS)
 
 		c.JSON(http.StatusOK, CardIdResponse{
 			id,
@@ -84,6 +86,7 @@ func postSchemaHandler(database database.Database) func(*gin.Context) {
 // @Router       /card-schemas/{id} [get]
 func getSchemaHandler(database database.Database) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		// localhost:8080/post/{id}
 		var card_schema common.CardSchemaIdBinding
 		if err := c.ShouldBindUri(&card_schema); err != nil {
@@ -105,10 +108,10 @@ func getSchemaHandler(database database.Database) func(*gin.Context) {
 		}
 
 		c.JSON(http.StatusOK, common.CardSchema{
-			Uuid:   card_schema.Id,
-			Cards:  schema.Cards,
-			Title:  schema.Title,
-			Schema: schema.Schema,
+			Uuid:      card_schema.Id,
+			Title:     schema.Title,
+			Schema:    schema.Schema,
+			CardCount: schema.CardCount,
 		})
 	}
 }
@@ -126,6 +129,7 @@ func getSchemaHandler(database database.Database) func(*gin.Context) {
 // @Router       /card-schemas [get]
 func getSchemasHandler(database database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		// Lee offset y limit de la query (?offset=0&limit=10)
 		// Un valor de 0 para el límite significa "sin límite".
 		offsetStr := c.DefaultQuery("offset", "0")
@@ -183,8 +187,9 @@ func checkSchemaValues(add_schema_request AddCardSchemaRequest) error {
 // @Success      200 {object} map[string]string "Deleted schema ID"
 // @Failure      400 {object} common.ErrorResponse "Invalid request or deletion error"
 // @Router       /card-schemas [delete]
-func deleteCardSchemaHandler(database database.Database) func(*gin.Context) {
+func deleteCardSchemaHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var delete_schema_request DeleteSchemaBinding
 		decoder := json.NewDecoder(c.Request.Body)
 		decoder.DisallowUnknownFields()
@@ -207,9 +212,151 @@ func deleteCardSchemaHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		invalidateTags(invalidator, common.SchemaCacheTag(delete_schema_request.Id), common.CACHE_TAG_SCHEMAS)
 
 		c.JSON(http.StatusOK, gin.H{
 			"id": delete_schema_request.Id,
 		})
 	}
 }
+
+// Binds the schema id and the change, the schema
+// must compile before it's stored or checked
+func bindSchemaChange(c *gin.Context) (string, ChangeCardSchemaRequest, error) {
+	var card_schema common.CardSchemaIdBinding
+	if err := c.ShouldBindUri(&card_schema); err != nil {
+		return "", ChangeCardSchemaRequest{}, fmt.Errorf("could not get schema id: %v", err)
+	}
+
+	var change_schema_request ChangeCardSchemaRequest
+	if c.Request.Body == nil {
+		return "", ChangeCardSchemaRequest{}, fmt.Errorf("no request body provided")
+	}
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&change_schema_request); err != nil {
+		return "", ChangeCardSchemaRequest{}, fmt.Errorf("invalid request body: %v", err)
+	}
+
+	if len(change_schema_request.JsonSchema) == 0 {
+		return "", ChangeCardSchemaRequest{}, fmt.Errorf("`schema` cannot be empty")
+	}
+	schema_compiler := jsonschema.NewCompiler()
+	if _, err := schema_compiler.Compile(change_schema_request.JsonSchema); err != nil {
+		return "", ChangeCardSchemaRequest{}, fmt.Errorf("`schema` is invalid: %v", err)
+	}
+	for i, operation := range change_schema_request.Transform {
+		switch operation.Op {
+		case common.PATCH_ADD, common.PATCH_REMOVE, common.PATCH_REPLACE, common.PATCH_MOVE, common.PATCH_COPY:
+		default:
+			return "", ChangeCardSchemaRequest{}, fmt.Errorf("`transform` operation %d has an unknown op `%s`", i, operation.Op)
+		}
+	}
+
+	return card_schema.Id, change_schema_request, nil
+}
+
+// @Summary      Update a card schema
+// @Description  Stores the schema as a new version. Cards are validated against the version they
+// @Description  were written with, unless a transform is given: it's applied to every card and the
+// @Description  cards move to the new version. Nothing changes if one of them fails.
+// @Tags         card_schema
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path string true "Card schema UUID"
+// @Param        schema body ChangeCardSchemaRequest true "New schema and card transform"
+// @Success      200 {object} CardSchemaVersionResponse
+// @Failure      400 {object} common.ErrorResponse "Invalid schema or cards that can't be migrated"
+// @Router       /card-schemas/{id} [put]
+func putSchemaHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		id, change_schema_request, err := bindSchemaChange(c)
+		if err != nil {
+			log.Warn().Msgf("invalid schema change: %v", err)
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes(err.Error()))
+			return
+		}
+
+		version, err := database.ChangeCardSchema(id, string(change_schema_request.JsonSchema), change_schema_request.Transform)
+		if err != nil {
+			log.Error().Msgf("failed to change card schema: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not change card schema", err))
+			return
+		}
+		invalidateTags(invalidator, common.SchemaCacheTag(id), common.CACHE_TAG_SCHEMAS, common.CACHE_TAG_CARDS)
+
+		c.JSON(http.StatusOK, CardSchemaVersionResponse{
+			Id:       id,
+			Version:  version,
+			Migrated: change_schema_request.Transform != nil,
+		})
+	}
+}
+
+// @Summary      Check a card schema change
+// @Description  Dry run of a schema update with a transform, lists the cards that would fail the new schema.
+// @Tags         card_schema
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path string true "Card schema UUID"
+// @Param        schema body ChangeCardSchemaRequest true "New schema and card transform"
+// @Success      200 {object} CheckCardSchemaResponse
+// @Failure      400 {object} common.ErrorResponse "Invalid schema"
+// @Router       /card-schemas/{id}/check [post]
+func checkSchemaHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		id, change_schema_request, err := bindSchemaChange(c)
+		if err != nil {
+			log.Warn().Msgf("invalid schema change: %v", err)
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes(err.Error()))
+			return
+		}
+
+		failures, err := database.CheckCardSchema(id, string(change_schema_request.JsonSchema), change_schema_request.Transform)
+		if err != nil {
+			log.Error().Msgf("failed to check card schema: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not check card schema", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, CheckCardSchemaResponse{Failures: failures})
+	}
+}
+
+// @Summary      Get the versions of a card schema
+// @Description  Lists every version of the card schema, the first one first.
+// @Tags         card_schema
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path string true "Card schema UUID"
+// @Success      200 {object} GetSchemaVersionsResponse
+// @Failure      400 {object} common.ErrorResponse "Invalid schema ID"
+// @Failure      404 {object} common.ErrorResponse "Schema not found"
+// @Router       /card-schemas/{id}/versions [get]
+func getSchemaVersionsHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var card_schema common.CardSchemaIdBinding
+		if err := c.ShouldBindUri(&card_schema); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get schema id", err))
+			return
+		}
+
+		versions, err := database.GetCardSchemaVersions(card_schema.Id)
+		if err != nil {
+			log.Error().Msgf("could not get schema versions: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get schema versions", err))
+			return
+		}
+		if len(versions) == 0 {
+			c.JSON(http.StatusNotFound, common.MsgErrorRes("card schema not found"))
+			return
+		}
+
+		c.JSON(http.StatusOK, GetSchemaVersionsResponse{Versions: versions})
+	}
+}
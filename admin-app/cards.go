@@ -18,16 +18,24 @@ import (
 // @Produce      json
 // @Security     BearerAuth
 // @Param        schema path string true "schema UUID"
-// @Success      200 {object} GetCardRequest
+// @Param        limit query int false "Cards per page"
+// @Param        page query int false "Page number, starting at 1"
+// @Param        sort query string false "Top level field of the card data to sort by"
+// @Param        desc query bool false "Sort in descending order"
+// @Success      200 {object} GetCardsResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid post ID"
 // @Failure      404 {object} common.ErrorResponse "Post not found"
 // @Router       /cards/{schema} [get]
 func getCardHandler(database database.Database) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 
 		var get_card_request GetCardRequest
 
 		err := c.ShouldBindUri(&get_card_request)
+		if err == nil {
+			err = c.ShouldBindQuery(&get_card_request)
+		}
 		if err != nil {
 			log.Error().Msgf("could not bind url params: %v", err)
 			c.JSON(http.StatusBadRequest, common.MsgErrorRes("invalid card request, missing information"))
@@ -50,17 +58,22 @@ func getCardHandler(database database.Database) func(*gin.Context) {
 		page := get_card_request.Page
 		if (get_card_request.Limit == 0) && (get_card_request.Page == 0) {
 			limit = 10
-			page = 0
+			page = 1
 		}
 
-		cards, err := database.GetCards(get_card_request.Schema, int(limit), int(page))
+		cards, total, err := database.GetCards(get_card_request.Schema, common.CardQuery{
+			Limit:      int(limit),
+			Offset:     int((page - 1) * limit),
+			SortBy:     get_card_request.Sort,
+			Descending: get_card_request.Desc,
+		})
 		if err != nil {
 			log.Error().Msgf("could not get cards: %v", err)
-			c.JSON(http.StatusBadRequest, common.MsgErrorRes("invalid card schema uuid"))
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get cards", err))
 			return
 		}
 
-		c.JSON(http.StatusOK, cards)
+		c.JSON(http.StatusOK, GetCardsResponse{Cards: cards, Total: total})
 	}
 }
 
@@ -74,8 +87,9 @@ func getCardHandler(database database.Database) func(*gin.Context) {
 // @Success      200 {object} CardIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or missing data"
 // @Router       /cards [post]
-func postCardHandler(database database.Database) func(*gin.Context) {
+func postCardHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var add_card_request AddCardRequest
 		if c.Request.Body == nil {
 			c.JSON(http.StatusBadRequest, common.MsgErrorRes("no request body provided"))
@@ -111,6 +125,9 @@ func postCardHandler(database database.Database) func(*gin.Context) {
 		// log.Info().Msgf("schema en post: %v", schema)
 
 		err = validateCardAgainstSchema(add_card_request.Content, schema.Schema)
+		if err == nil {
+			err = checkCardImage(siteImageDirectory(c), add_card_request.Image)
+		}
 		if err != nil {
 			log.Error().Msgf("%v", err.Error())
 			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add card", err))
@@ -127,6 +144,7 @@ func postCardHandler(database database.Database) func(*gin.Context) {
 			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add card", err))
 			return
 		}
+		invalidateTags(invalidator, common.SchemaCacheTag(add_card_request.Schema))
 
 		c.JSON(http.StatusOK, CardIdResponse{
 			id,
@@ -171,8 +189,9 @@ func validateCardAgainstSchema(card_data string, json_schema string) error {
 // @Success      200 {object} CardIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or could not change card"
 // @Router       /cards [put]
-func putCardHandler(database database.Database) func(*gin.Context) {
+func putCardHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var change_card_request ChangeCardRequest
 		decoder := json.NewDecoder(c.Request.Body)
 		decoder.DisallowUnknownFields()
@@ -187,12 +206,19 @@ func putCardHandler(database database.Database) func(*gin.Context) {
 			return
 		}
 
-		err = database.ChangeCard(
-			change_card_request.Id,
-			change_card_request.ImageLocation,
-			change_card_request.JsonData,
-			change_card_request.SchemaName,
-		)
+		// An empty image leaves the image of the card as is
+		var image_location *string
+		if change_card_request.ImageLocation != "" {
+			image_location = &change_card_request.ImageLocation
+			err = checkCardImage(siteImageDirectory(c), change_card_request.ImageLocation)
+		}
+		if err == nil {
+			err = database.ChangeCard(
+				change_card_request.Id,
+				image_location,
+				change_card_request.JsonData,
+			)
+		}
 		if err != nil {
 			log.Error().Msgf("failed to change card: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -201,6 +227,7 @@ func putCardHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		invalidateTags(invalidator, common.CACHE_TAG_CARDS)
 
 		c.JSON(http.StatusOK, gin.H{
 			"id": change_card_request.Id,
@@ -218,8 +245,9 @@ func putCardHandler(database database.Database) func(*gin.Context) {
 // @Failure      400 {object} common.ErrorResponse "Invalid ID provided"
 // @Failure      404 {object} common.ErrorResponse "Card not found"
 // @Router       /cards [delete]
-func deleteCardHandler(database database.Database) func(*gin.Context) {
+func deleteCardHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var delete_card_request DeleteCardRequest
 		decoder := json.NewDecoder(c.Request.Body)
 		decoder.DisallowUnknownFields()
@@ -243,6 +271,7 @@ func deleteCardHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		invalidateTags(invalidator, common.CACHE_TAG_CARDS)
 
 		c.JSON(http.StatusOK, gin.H{
 			"id": delete_card_request.Id,
@@ -0,0 +1,393 @@
+package admin_app
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
+	admin_views "github.com/rbc33/gocms/views/admin"
+	"github.com/rs/zerolog/log"
+)
+
+// Posts shown on each page of the admin post list
+const POST_LIST_PAGE_SIZE = 20
+
+// Latest posts shown in the dashboard
+const DASHBOARD_POSTS = 5
+
+func markdownPreview(content string) string {
+	return string(common.MdToHTML([]byte(content)))
+}
+
+// @Summary      Admin dashboard
+// @Description  Latest posts, pages and links to the editors.
+// @Tags         admin_ui
+// @Produce      html
+// @Success      200 {string} string "HTML page"
+// @Failure      303 {string} string "Redirect to the login page without a session"
+// @Router       /ui [get]
+func getDashboardHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		posts, err := database.GetPosts(DASHBOARD_POSTS, 0)
+		if err != nil {
+			log.Error().Msgf("could not get posts: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get posts", err))
+			return
+		}
+		pages, err := database.GetPageTree()
+		if err != nil {
+			log.Error().Msgf("could not get pages: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get pages", err))
+			return
+		}
+		renderAdminPage(c, "Dashboard", admin_views.MakeDashboard(admin_views.Dashboard{Posts: posts, Pages: pages}))
+	}
+}
+
+// @Summary      Markdown preview
+// @Description  Renders the Markdown `content` the way the site renders posts, shortcodes included.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        content formData string false "Markdown content"
+// @Success      200 {string} string "HTML of the content"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Router       /ui/preview [post]
+func postPreviewHandler(shortcodes *shortcodeRegistry) func(*gin.Context) {
+	return func(c *gin.Context) {
+		preview, plugin_errors := renderPostContent(c.Request.Context(), c.PostForm("content"), shortcodes.Handlers())
+		// Shortcodes that failed are left out of the preview
+		notices := ""
+		for _, plugin_error := range plugin_errors {
+			notices += fmt.Sprintf(`<p class="text-red-700">%s</p>`, html.EscapeString(plugin_error.Error()))
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(notices+preview))
+	}
+}
+
+// @Summary      Posts page
+// @Description  Lists the posts with links to edit and delete them.
+// @Tags         admin_ui
+// @Produce      html
+// @Param        page query int false "Page number, starting at 1"
+// @Success      200 {string} string "HTML page"
+// @Failure      400 {object} common.ErrorResponse "Invalid page"
+// @Router       /ui/posts [get]
+func getPostsPageHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes("invalid page"))
+			return
+		}
+
+		// One more post tells if there is a next page
+		posts, err := database.GetPosts(POST_LIST_PAGE_SIZE+1, (page-1)*POST_LIST_PAGE_SIZE)
+		if err != nil {
+			log.Error().Msgf("could not get posts: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get posts", err))
+			return
+		}
+		list := admin_views.PostList{Posts: posts, Page: page}
+		if len(posts) > POST_LIST_PAGE_SIZE {
+			list.Posts = posts[:POST_LIST_PAGE_SIZE]
+			list.HasNext = true
+		}
+		renderAdminPage(c, "Posts", admin_views.MakePostList(list))
+	}
+}
+
+// Id of the `:id` param, answers the request when it isn't valid
+func postIdParam(c *gin.Context) (int, bool) {
+	var post_binding common.PostIdBinding
+	if err := c.ShouldBindUri(&post_binding); err != nil || post_binding.Id < 0 {
+		c.JSON(http.StatusBadRequest, common.MsgErrorRes("invalid post id"))
+		return 0, false
+	}
+	return post_binding.Id, true
+}
+
+// @Summary      Post editor page
+// @Description  Editor of a new post, or of the post being edited, with the preview of its Markdown.
+// @Tags         admin_ui
+// @Produce      html
+// @Param        id path int false "Post ID"
+// @Success      200 {string} string "HTML page"
+// @Failure      404 {object} common.ErrorResponse "Post not found"
+// @Router       /ui/posts/new [get]
+// @Router       /ui/posts/{id}/edit [get]
+func getPostEditorHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		editor := admin_views.PostEditor{}
+		title := "New post"
+		if c.Param("id") != "" {
+			id, ok := postIdParam(c)
+			if !ok {
+				return
+			}
+			post, err := database.GetPost(id)
+			if err != nil {
+				log.Warn().Msgf("could not get post %d: %v", id, err)
+				c.JSON(http.StatusNotFound, common.ErrorRes("post not found", err))
+				return
+			}
+			post.Id = id
+			editor.Post = post
+			editor.Preview = markdownPreview(post.Content)
+			title = "Edit post"
+		}
+		renderAdminPage(c, title, admin_views.MakePostEditor(editor))
+	}
+}
+
+// @Summary      Save a post editor
+// @Description  Adds the post of the editor, or changes the post of the `id` param. Posts missing data come back
+// @Description  with the error, otherwise htmx is redirected to the post list.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        id path int false "Post ID"
+// @Param        title formData string true "Title"
+// @Param        excerpt formData string true "Excerpt"
+// @Param        content formData string true "Markdown content"
+// @Success      200 {string} string "HTML editor with the error, or an `HX-Redirect` header"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Router       /ui/posts [post]
+// @Router       /ui/posts/{id} [post]
+func savePostEditorHandler(database database.Database, hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		post := common.Post{
+			Title:   c.PostForm("title"),
+			Excerpt: c.PostForm("excerpt"),
+			Content: c.PostForm("content"),
+		}
+		if c.Param("id") != "" {
+			id, ok := postIdParam(c)
+			if !ok {
+				return
+			}
+			post.Id = id
+		}
+
+		// The editor keeps what was typed when the save fails,
+		// the plugins change a copy of it
+		saved := post
+		err := checkRequiredData(AddPostRequest{Title: post.Title, Excerpt: post.Excerpt, Content: post.Content})
+		if err == nil {
+			err = hooks.Run(c.Request.Context(), plugins.EVENT_BEFORE_POST_SAVE, &saved)
+		}
+		if err == nil && post.Id == 0 {
+			saved.Id, err = database.AddPost(saved.Title, saved.Excerpt, saved.Content)
+			if err == nil {
+				invalidateTags(invalidator, common.CACHE_TAG_POSTS)
+			}
+		} else if err == nil {
+			err = database.ChangePost(post.Id, saved.Title, saved.Excerpt, saved.Content)
+			if err == nil {
+				invalidateTags(invalidator, common.PostCacheTag(post.Id), common.CACHE_TAG_POSTS, common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id))
+			}
+		}
+		if err == nil {
+			runAfterHooks(c, hooks, plugins.EVENT_AFTER_POST_SAVE, &saved)
+			c.Header("HX-Redirect", "/ui/posts")
+			c.Status(http.StatusOK)
+			return
+		}
+
+		log.Warn().Msgf("could not save post: %v", err)
+		editor := admin_views.PostEditor{
+			Post:    post,
+			Preview: markdownPreview(post.Content),
+			Error:   fmt.Sprintf("could not save post: %v", err),
+		}
+		renderAdminHtml(c, http.StatusOK, admin_views.MakePostEditor(editor))
+	}
+}
+
+// @Summary      Delete a post from the post list
+// @Description  Deletes the post, htmx removes its row with the empty response.
+// @Tags         admin_ui
+// @Param        id path int true "Post ID"
+// @Success      200 {string} string "Empty response"
+// @Failure      400 {object} common.ErrorResponse "Invalid post ID"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Router       /ui/posts/{id} [delete]
+func deletePostRowHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		id, ok := postIdParam(c)
+		if !ok {
+			return
+		}
+		if err := database.DeletePost(id); err != nil {
+			log.Error().Msgf("failed to delete post: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not delete post", err))
+			return
+		}
+		invalidateTags(invalidator, common.PostCacheTag(id), common.CACHE_TAG_POSTS, common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id))
+		c.String(http.StatusOK, "")
+	}
+}
+
+// @Summary      Pages page
+// @Description  Lists the pages with their paths and links to edit and delete them.
+// @Tags         admin_ui
+// @Produce      html
+// @Success      200 {string} string "HTML page"
+// @Router       /ui/pages [get]
+func getPagesPageHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		pages, err := database.GetPageTree()
+		if err != nil {
+			log.Error().Msgf("could not get pages: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get pages", err))
+			return
+		}
+		renderAdminPage(c, "Pages", admin_views.MakePageList(pages))
+	}
+}
+
+// @Summary      Page editor page
+// @Description  Editor of a new page, or of the page being edited, with the preview of its Markdown.
+// @Tags         admin_ui
+// @Produce      html
+// @Param        link path string false "Page link"
+// @Success      200 {string} string "HTML page"
+// @Failure      404 {object} common.ErrorResponse "Page not found"
+// @Router       /ui/pages/new [get]
+// @Router       /ui/pages/{link}/edit [get]
+func getPageEditorHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		editor := admin_views.PageEditor{Link: c.Param("link")}
+		title := "New page"
+		if editor.Link != "" {
+			page, err := database.GetPage(editor.Link)
+			if err != nil {
+				log.Warn().Msgf("could not get page %s: %v", editor.Link, err)
+				c.JSON(http.StatusNotFound, common.ErrorRes("page not found", err))
+				return
+			}
+			editor.Page = page
+			editor.Preview = markdownPreview(editor.Page.Content)
+			title = "Edit page"
+		} else {
+			parents, err := database.GetPageTree()
+			if err != nil {
+				log.Error().Msgf("could not get pages: %v", err)
+				c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get pages", err))
+				return
+			}
+			editor.Parents = parents
+		}
+		renderAdminPage(c, title, admin_views.MakePageEditor(editor))
+	}
+}
+
+// @Summary      Save a page editor
+// @Description  Adds the page of the editor, or changes the page of the `link` param keeping its blocks. Pages with
+// @Description  invalid data come back with the error, otherwise htmx is redirected to the page list.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        link path string false "Link of the page being edited"
+// @Param        title formData string true "Title"
+// @Param        link formData string true "New link of the page"
+// @Param        content formData string false "Markdown content"
+// @Param        parent_id formData int false "Parent of a new page"
+// @Success      200 {string} string "HTML editor with the error, or an `HX-Redirect` header"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Failure      404 {object} common.ErrorResponse "Page not found"
+// @Router       /ui/pages [post]
+// @Router       /ui/pages/{link} [post]
+func savePageEditorHandler(database database.Database, hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		editor := admin_views.PageEditor{Link: c.Param("link")}
+		if editor.Link != "" {
+			page, err := database.GetPage(editor.Link)
+			if err != nil {
+				log.Warn().Msgf("could not get page %s: %v", editor.Link, err)
+				c.JSON(http.StatusNotFound, common.ErrorRes("page not found", err))
+				return
+			}
+			editor.Page = page
+		}
+		editor.Page.Title = c.PostForm("title")
+		editor.Page.Link = c.PostForm("link")
+		editor.Page.Content = c.PostForm("content")
+		if editor.Link == "" {
+			editor.Page.ParentId, _ = strconv.Atoi(c.PostForm("parent_id"))
+		}
+
+		page := editor.Page
+		err := checkRequiredPageData(AddPageRequest{Title: page.Title, Content: page.Content, Link: page.Link, Blocks: page.Blocks})
+		if err == nil {
+			err = hooks.Run(c.Request.Context(), plugins.EVENT_BEFORE_PAGE_SAVE, &page)
+		}
+		if err == nil && editor.Link == "" {
+			page.Id, err = database.AddPage(page.Title, page.Content, page.Link, page.Blocks, page.ParentId)
+			if err == nil {
+				invalidateTags(invalidator, common.PageCacheTag(page.Link), common.CACHE_TAG_PAGES)
+			}
+		} else if err == nil {
+			err = database.ChangePage(editor.Page.Id, page.Title, page.Content, page.Link, page.Blocks)
+			if err == nil {
+				invalidateTags(
+					invalidator,
+					common.PageIdCacheTag(page.Id),
+					common.PageCacheTag(editor.Link),
+					common.PageCacheTag(page.Link),
+					common.CACHE_TAG_PAGES,
+					common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id),
+				)
+			}
+		}
+		if err == nil {
+			runAfterHooks(c, hooks, plugins.EVENT_AFTER_PAGE_SAVE, &page)
+			c.Header("HX-Redirect", "/ui/pages")
+			c.Status(http.StatusOK)
+			return
+		}
+
+		log.Warn().Msgf("could not save page: %v", err)
+		if editor.Link == "" {
+			editor.Parents, _ = database.GetPageTree()
+		}
+		editor.Preview = markdownPreview(page.Content)
+		editor.Error = fmt.Sprintf("could not save page: %v", err)
+		renderAdminHtml(c, http.StatusOK, admin_views.MakePageEditor(editor))
+	}
+}
+
+// @Summary      Delete a page from the page list
+// @Description  Deletes the page, htmx removes its row with the empty response.
+// @Tags         admin_ui
+// @Param        link path string true "Page link"
+// @Success      200 {string} string "Empty response"
+// @Failure      400 {object} common.ErrorResponse "Could not delete the page"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Router       /ui/pages/{link} [delete]
+func deletePageRowHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		link := c.Param("link")
+		if err := database.DeletePage(link); err != nil {
+			log.Error().Msgf("failed to delete page: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not delete page", err))
+			return
+		}
+		invalidateTags(invalidator, common.PageCacheTag(link), common.CACHE_TAG_PAGES, common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id))
+		c.String(http.StatusOK, "")
+	}
+}
@@ -0,0 +1,31 @@
+package admin_app
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rs/zerolog/log"
+)
+
+// Plugins raise errors in the before events to refuse the
+// content, those are answered with the plugin that did it
+func pluginErrorResponse(c *gin.Context, msg string, err error) {
+	log.Warn().Msgf("%s: %v", msg, err)
+	var plugin_error *plugins.PluginError
+	if errors.As(err, &plugin_error) {
+		c.JSON(http.StatusUnprocessableEntity, PluginErrorsResponse{Msg: msg, Errors: []*plugins.PluginError{plugin_error}})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, common.ErrorRes(msg, err))
+}
+
+// The content is already saved after the event, so the
+// errors of its plugins are only logged
+func runAfterHooks(c *gin.Context, hooks *plugins.Hooks, event string, data any) {
+	if err := hooks.Run(c.Request.Context(), event, data); err != nil {
+		log.Error().Msgf("%s plugins failed: %v", event, err)
+	}
+}
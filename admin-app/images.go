@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"image"
 	_ "image/gif"
@@ -16,6 +17,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rbc33/gocms/common"
 	"github.com/rbc33/gocms/metadata"
+	"github.com/rbc33/gocms/plugins"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/image/draw"
 )
@@ -105,9 +107,10 @@ func resizeImage(srcPath string, width int, height int) error {
 // @Param        excerpt formData string false "A brief description of the image"
 // @Success      200 {object} ImageIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid input, file type, or size"
+// @Failure      422 {object} PluginErrorsResponse "A plugin refused the image"
 // @Failure      500 {object} common.ErrorResponse "Server error while saving file"
 // @Router       /images [post]
-func postImageHandler() func(*gin.Context) {
+func postImageHandler(hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
 		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 10*1000000)
 		form, err := c.MultipartForm()
@@ -126,67 +129,26 @@ func postImageHandler() func(*gin.Context) {
 			return
 		}
 
-		file := file_array[0]
-		file_content_type := file.Header.Get("content-type")
-		_, ok := allowed_content_types[file_content_type]
-		if !ok {
-			log.Error().Msgf("file type not supported")
-			c.JSON(http.StatusBadRequest, common.MsgErrorRes("file type not supported"))
-			return
-		}
-
-		detected_content_type, err := getContentType(file)
-		if err != nil || detected_content_type != file_content_type {
-			log.Error().Msgf("the provided file does not match the provided content type")
-			c.JSON(http.StatusBadRequest, common.MsgErrorRes("provided file content is not allowed"))
-			return
-		}
-
-		uuid, err := uuid.New()
-		if err != nil {
-			log.Error().Msgf("could not create the UUID: %v", err)
-			c.JSON(http.StatusInternalServerError, common.ErrorRes("cannot create unique identifier", err))
-			return
-		}
-
-		ext := filepath.Ext(file.Filename)
-		// check ext is supported
-		_, ok = allowed_extensions[ext]
-		if ext == "" || !ok {
-			log.Error().Msgf("file extension is not supported %v", err)
-			c.JSON(http.StatusBadRequest, common.ErrorRes("file extension is not supported", err))
-			return
-		}
-
-		filename := fmt.Sprintf("%s%s", uuid.String(), ext)
-		image_path := filepath.Join(common.Settings.ImageDirectory, filename)
-		err = c.SaveUploadedFile(file, image_path)
-		if err != nil {
-			log.Error().Msgf("could not save file: %v", err)
-			c.JSON(http.StatusInternalServerError, common.ErrorRes("failed to upload image", err))
-			return
-		}
-
-		// Generate Json from metadata
+		// Stored in the metadata of the image
 		excerpt_text_array := form.Value["excerpt"]
 		excerpt := "unknown"
 		if len(excerpt_text_array) > 0 {
 			excerpt = excerpt_text_array[0]
 		}
-		name := file.Filename[:len(file.Filename)-len(ext)]
-		metadata.GenerateJson(filename, name, excerpt)
-
-		// Resize image to 477px width
-		err = resizeImage(image_path, 477, 620)
-		if err != nil {
-			log.Error().Msgf("could not resize image: %v", err)
-			os.Remove(image_path)
+		id, status, err := saveImage(c, hooks, file_array[0], excerpt)
+		if status == http.StatusUnprocessableEntity {
+			pluginErrorResponse(c, "a plugin refused the image", err)
+			return
+		} else if err != nil {
+			c.JSON(status, common.MsgErrorRes(err.Error()))
 			return
 		}
 
+		invalidateTags(invalidator, common.CACHE_TAG_IMAGES)
+
 		// End saving to filesystem
 		c.JSON(http.StatusOK, ImageIdResponse{
-			Id: uuid.String(),
+			Id: id,
 		})
 	}
 }
@@ -200,8 +162,9 @@ func postImageHandler() func(*gin.Context) {
 // @Param        name path string true "Image filename to delete"
 // @Success      200 {object} ImageIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid or missing filename"
+// @Failure      404 {object} common.ErrorResponse "Image not found"
 // @Router       /images/{name} [delete]
-func deleteImageHandler() func(*gin.Context) {
+func deleteImageHandler(invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
 		var delete_image_binding DeleteImageRequest
 		err := c.ShouldBindUri(&delete_image_binding)
@@ -210,21 +173,14 @@ func deleteImageHandler() func(*gin.Context) {
 			return
 		}
 
-		image_path := filepath.Join(common.Settings.ImageDirectory, delete_image_binding.Name)
-		ext := filepath.Ext(image_path)
-		// Fix json_name calculation: replace extension with ".json"
-		json_name := image_path[:len(image_path)-len(ext)] + ".json"
-
-		err = os.Remove(image_path)
-		if err != nil {
-			log.Warn().Msgf("could not delete stored image file: %v", err)
-			// No return because we have to remove the database entry nonetheless.
-		}
-		err = os.Remove(json_name)
-		if err != nil {
-			log.Warn().Msgf("could not delete stored json file: %v", err)
-			// No return because we have to remove the database entry nonetheless.
+		// Only the images of the site, never other files
+		directory := siteImageDirectory(c)
+		if !slices.Contains(mediaImages(directory), delete_image_binding.Name) {
+			c.JSON(http.StatusNotFound, common.MsgErrorRes("image not found"))
+			return
 		}
+		removeImage(directory, delete_image_binding.Name)
+		invalidateTags(invalidator, common.CACHE_TAG_IMAGES)
 
 		c.JSON(http.StatusOK, ImageIdResponse{
 			delete_image_binding.Name,
@@ -232,6 +188,93 @@ func deleteImageHandler() func(*gin.Context) {
 	}
 }
 
+// Saves the uploaded image to the media directory with its
+// metadata, returns the UUID of the image or the status and
+// error to answer with. The image_upload plugins can change
+// its title and excerpt, or refuse it.
+func saveImage(c *gin.Context, hooks *plugins.Hooks, file *multipart.FileHeader, excerpt string) (string, int, error) {
+	file_content_type := file.Header.Get("content-type")
+	_, ok := allowed_content_types[file_content_type]
+	if !ok {
+		log.Error().Msgf("file type not supported")
+		return "", http.StatusBadRequest, fmt.Errorf("file type not supported")
+	}
+
+	detected_content_type, err := getContentType(file)
+	if err != nil || detected_content_type != file_content_type {
+		log.Error().Msgf("the provided file does not match the provided content type")
+		return "", http.StatusBadRequest, fmt.Errorf("provided file content is not allowed")
+	}
+
+	uuid, err := uuid.New()
+	if err != nil {
+		log.Error().Msgf("could not create the UUID: %v", err)
+		return "", http.StatusInternalServerError, fmt.Errorf("cannot create unique identifier: %v", err)
+	}
+
+	ext := filepath.Ext(file.Filename)
+	// check ext is supported
+	_, ok = allowed_extensions[ext]
+	if ext == "" || !ok {
+		log.Error().Msgf("file extension is not supported %s", ext)
+		return "", http.StatusBadRequest, fmt.Errorf("file extension is not supported")
+	}
+
+	directory := siteImageDirectory(c)
+	if err = os.MkdirAll(directory, 0755); err != nil {
+		log.Error().Msgf("could not create the media directory: %v", err)
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to upload image: %v", err)
+	}
+
+	filename := fmt.Sprintf("%s%s", uuid.String(), ext)
+	image_path := filepath.Join(directory, filename)
+	err = c.SaveUploadedFile(file, image_path)
+	if err != nil {
+		log.Error().Msgf("could not save file: %v", err)
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to upload image: %v", err)
+	}
+
+	upload := plugins.ImageUpload{
+		Name:        filename,
+		Title:       file.Filename[:len(file.Filename)-len(ext)],
+		Excerpt:     excerpt,
+		ContentType: file_content_type,
+		Size:        file.Size,
+	}
+	if err = hooks.Run(c.Request.Context(), plugins.EVENT_IMAGE_UPLOAD, &upload); err != nil {
+		log.Warn().Msgf("image refused by a plugin: %v", err)
+		os.Remove(image_path)
+		return "", http.StatusUnprocessableEntity, err
+	}
+	metadata.GenerateJson(directory, filename, upload.Title, upload.Excerpt)
+
+	// Resize image to 477px width
+	err = resizeImage(image_path, 477, 620)
+	if err != nil {
+		log.Error().Msgf("could not resize image: %v", err)
+		os.Remove(image_path)
+		return "", http.StatusInternalServerError, fmt.Errorf("could not resize image: %v", err)
+	}
+	return uuid.String(), http.StatusOK, nil
+}
+
+// Removes the image and its metadata from the media directory
+func removeImage(directory string, name string) {
+	image_path := filepath.Join(directory, name)
+	ext := filepath.Ext(image_path)
+	// Fix json_name calculation: replace extension with ".json"
+	json_name := image_path[:len(image_path)-len(ext)] + ".json"
+
+	err := os.Remove(image_path)
+	if err != nil {
+		log.Warn().Msgf("could not delete stored image file: %v", err)
+	}
+	err = os.Remove(json_name)
+	if err != nil {
+		log.Warn().Msgf("could not delete stored json file: %v", err)
+	}
+}
+
 func getContentType(file_header *multipart.FileHeader) (string, error) {
 	// Check if the content matches the provided type.
 	image_file, err := file_header.Open()
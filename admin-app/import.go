@@ -0,0 +1,761 @@
+package admin_app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fossoreslp/go-uuid-v4"
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/metadata"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Same limit as the image upload endpoint
+	MAX_IMPORT_IMAGE_SIZE = 10 * 1000000
+	MAX_IMPORT_SIZE       = 64 * 1000000
+	// Per markdown file of an archive
+	MAX_IMPORT_MARKDOWN_SIZE = 2 * 1000000
+	IMPORT_EXCERPT_LENGTH    = 160
+)
+
+type ImportOptions struct {
+	// When false the images keep pointing to their
+	// original location
+	DownloadImages bool
+	// Media directory the images are stored in,
+	// the image directory of the config when empty
+	ImageDirectory string
+}
+
+type ImportReport struct {
+	Posts      int
+	Pages      int
+	Images     int
+	Permalinks int
+	Skipped    int
+	Failed     []string
+}
+
+// Post or page read from any of the import formats
+type importItem struct {
+	Source  string
+	Title   string
+	Excerpt string
+	Content string
+	IsPage  bool
+	// Link of the page, unused for posts
+	Link string
+	// Paths the content was served from before
+	OldPaths []string
+}
+
+// Loads the image referenced by `src` in the item's
+// content, returning its data and name
+type imageLoader = func(src string) ([]byte, string, error)
+
+type importer struct {
+	db         database.Database
+	options    ImportOptions
+	report     ImportReport
+	client     *http.Client
+	permalinks map[string]bool
+	// Title and content of the posts already in the
+	// site, see postKey
+	posts map[string]bool
+	// Images already stored during the import by source
+	images map[string]string
+}
+
+var (
+	html_image_regex     = regexp.MustCompile(`(<img\b[^>]*?\bsrc\s*=\s*["'])([^"']+)(["'])`)
+	markdown_image_regex = regexp.MustCompile(`(!\[[^\]]*\]\()([^)\s]+)`)
+	srcset_regex         = regexp.MustCompile(`\s(?:srcset|sizes)\s*=\s*("[^"]*"|'[^']*')`)
+	html_tag_regex       = regexp.MustCompile(`<[^>]*>`)
+	whitespace_regex     = regexp.MustCompile(`\s+`)
+)
+
+var image_content_type_extensions = map[string]string{
+	"image/jpeg": ".jpg", "image/png": ".png",
+}
+
+func makeImporter(db database.Database, options ImportOptions) *importer {
+	permalinks := make(map[string]bool)
+	existing, err := db.GetPermalinks()
+	if err != nil {
+		log.Warn().Msgf("could not get the existing permalinks: %v", err)
+	}
+	for _, permalink := range existing {
+		permalinks[permalink.Path] = true
+	}
+
+	posts := make(map[string]bool)
+	existing_posts, err := db.GetPostsContent(0, 0)
+	if err != nil {
+		log.Warn().Msgf("could not get the existing posts: %v", err)
+	}
+	for _, post := range existing_posts {
+		posts[postKey(post.Title, post.Content)] = true
+	}
+
+	return &importer{
+		db:         db,
+		options:    options,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		permalinks: permalinks,
+		posts:      posts,
+		images:     make(map[string]string),
+	}
+}
+
+func (imp *importer) imageDirectory() string {
+	if imp.options.ImageDirectory != "" {
+		return imp.options.ImageDirectory
+	}
+	return common.CurrentSettings().ImageDirectory
+}
+
+func (imp *importer) fail(source string, err error) {
+	log.Error().Msgf("could not import %s: %v", source, err)
+	imp.report.Failed = append(imp.report.Failed, fmt.Sprintf("%s: %v", source, err))
+}
+
+// Identifies a post by its title and content, without the image
+// sources as they change when the images are stored again
+func postKey(title string, content string) string {
+	content = html_image_regex.ReplaceAllString(content, "$1$3")
+	content = markdown_image_regex.ReplaceAllString(content, "$1")
+	return title + "\x00" + strings.TrimSpace(content)
+}
+
+// Posts of an earlier import have their old URLs
+// as permalinks or the same title and content
+func (imp *importer) isImported(item importItem) bool {
+	for _, old_path := range item.OldPaths {
+		if permalink, ok := permalinkPath(old_path); ok && imp.permalinks[permalink] {
+			return true
+		}
+	}
+	return imp.posts[postKey(item.Title, item.Content)]
+}
+
+func (imp *importer) importItem(item importItem, load_image imageLoader) {
+	if strings.TrimSpace(item.Title) == "" {
+		imp.fail(item.Source, fmt.Errorf("missing title"))
+		return
+	}
+
+	link := ""
+	if item.IsPage {
+		link = common.Slugify(item.Link)
+		if link == "" {
+			link = common.Slugify(item.Title)
+		}
+		// Links are unique under each parent, the pages are imported at the top level
+		if page, err := imp.db.GetPage(link); err == nil && page.ParentId == 0 {
+			log.Warn().Msgf("skipping %s, page `%s` already exists", item.Source, link)
+			imp.report.Skipped++
+			return
+		}
+	} else if imp.isImported(item) {
+		log.Warn().Msgf("skipping %s, post `%s` already exists", item.Source, item.Title)
+		imp.report.Skipped++
+		return
+	}
+
+	content := item.Content
+	if imp.options.DownloadImages {
+		content = imp.localizeImages(content, load_image)
+	}
+
+	if item.IsPage {
+		if _, err := imp.db.AddPage(item.Title, content, link, nil, 0); err != nil {
+			imp.fail(item.Source, err)
+			return
+		}
+		imp.report.Pages++
+		return
+	}
+
+	excerpt := strings.TrimSpace(item.Excerpt)
+	if excerpt == "" {
+		excerpt = makeExcerpt(content)
+	}
+	if excerpt == "" {
+		excerpt = item.Title
+	}
+
+	id, err := imp.db.AddPost(item.Title, excerpt, content)
+	if err != nil {
+		imp.fail(item.Source, err)
+		return
+	}
+	imp.report.Posts++
+	imp.posts[postKey(item.Title, content)] = true
+
+	for _, old_path := range item.OldPaths {
+		permalink, ok := permalinkPath(old_path)
+		if !ok || imp.permalinks[permalink] {
+			continue
+		}
+		if _, err := imp.db.AddPermalink(common.Permalink{Path: permalink, PostId: id}); err != nil {
+			imp.fail(fmt.Sprintf("%s permalink %s", item.Source, permalink), err)
+			continue
+		}
+		imp.permalinks[permalink] = true
+		imp.report.Permalinks++
+	}
+}
+
+// Stores the images referenced in the content and points
+// the references to the stored copies, images that fail
+// keep their original reference.
+func (imp *importer) localizeImages(content string, load_image imageLoader) string {
+	localize := func(src string) string {
+		src = html.UnescapeString(src)
+		if stored, exists := imp.images[src]; exists {
+			return stored
+		}
+		if strings.HasPrefix(src, "data:") || strings.HasPrefix(src, "/images/data/") {
+			return src
+		}
+
+		data, name, err := load_image(src)
+		if err == nil {
+			var stored string
+			stored, err = storeImportedImage(imp.imageDirectory(), data, name)
+			if err == nil {
+				imp.images[src] = stored
+				imp.report.Images++
+				return stored
+			}
+		}
+		imp.fail(src, err)
+		// Don't try again for every reference
+		imp.images[src] = src
+		return src
+	}
+
+	content = html_image_regex.ReplaceAllStringFunc(content, func(match string) string {
+		groups := html_image_regex.FindStringSubmatch(match)
+		src := localize(groups[2])
+		if src == html.UnescapeString(groups[2]) {
+			return match
+		}
+		return groups[1] + src + groups[3]
+	})
+	content = markdown_image_regex.ReplaceAllStringFunc(content, func(match string) string {
+		groups := markdown_image_regex.FindStringSubmatch(match)
+		return groups[1] + localize(groups[2])
+	})
+	return content
+}
+
+func (imp *importer) downloadImage(src string) ([]byte, string, error) {
+	response, err := imp.client.Get(src)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download failed with status %d", response.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, MAX_IMPORT_IMAGE_SIZE+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > MAX_IMPORT_IMAGE_SIZE {
+		return nil, "", fmt.Errorf("image is bigger than %d bytes", MAX_IMPORT_IMAGE_SIZE)
+	}
+	return data, path.Base(response.Request.URL.Path), nil
+}
+
+// Saves the image the same way as the upload endpoint
+// and returns the path it's served from
+func storeImportedImage(directory string, data []byte, name string) (string, error) {
+	content_type := http.DetectContentType(data)
+	if !allowed_content_types[content_type] {
+		return "", fmt.Errorf("file type %s not supported", content_type)
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if !allowed_extensions[ext] {
+		ext = image_content_type_extensions[content_type]
+		if ext == "" {
+			return "", fmt.Errorf("file type %s not supported", content_type)
+		}
+	}
+
+	uuid, err := uuid.New()
+	if err != nil {
+		return "", fmt.Errorf("cannot create unique identifier: %v", err)
+	}
+
+	if err = os.MkdirAll(directory, 0755); err != nil {
+		return "", fmt.Errorf("could not create the media directory: %v", err)
+	}
+	filename := fmt.Sprintf("%s%s", uuid.String(), ext)
+	image_path := filepath.Join(directory, filename)
+	if err = os.WriteFile(image_path, data, 0644); err != nil {
+		return "", fmt.Errorf("could not save image: %v", err)
+	}
+
+	metadata.GenerateJson(directory, filename, strings.TrimSuffix(name, filepath.Ext(name)), "unknown")
+
+	err = resizeImage(image_path, 477, 620)
+	if err != nil {
+		// The original is still usable
+		log.Warn().Msgf("could not resize imported image %s: %v", name, err)
+	}
+
+	return fmt.Sprintf("/images/data/%s", filename), nil
+}
+
+// Route for an old URL path, paths gin can't register
+// as a static route are not allowed
+func permalinkPath(old_path string) (string, bool) {
+	if parsed, err := url.Parse(old_path); err == nil && parsed.Path != "" {
+		old_path = parsed.Path
+	}
+	old_path = strings.TrimSpace(old_path)
+	if old_path == "" || old_path == "/" || strings.ContainsAny(old_path, ":*?#") {
+		return "", false
+	}
+	if !strings.HasPrefix(old_path, "/") {
+		old_path = "/" + old_path
+	}
+	return old_path, true
+}
+
+func makeExcerpt(content string) string {
+	text := html_tag_regex.ReplaceAllString(content, " ")
+	text = strings.TrimSpace(whitespace_regex.ReplaceAllString(html.UnescapeString(text), " "))
+
+	runes := []rune(text)
+	if len(runes) <= IMPORT_EXCERPT_LENGTH {
+		return text
+	}
+	excerpt := string(runes[:IMPORT_EXCERPT_LENGTH])
+	if space := strings.LastIndex(excerpt, " "); space > 0 {
+		excerpt = excerpt[:space]
+	}
+	return excerpt + "..."
+}
+
+type wxrEncoded struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wxrItem struct {
+	Title    string       `xml:"title"`
+	Link     string       `xml:"link"`
+	Encoded  []wxrEncoded `xml:"encoded"`
+	PostName string       `xml:"post_name"`
+	PostType string       `xml:"post_type"`
+	Status   string       `xml:"status"`
+}
+
+type wxrDocument struct {
+	Channel struct {
+		Link  string    `xml:"link"`
+		Items []wxrItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Content and excerpt are both `encoded` elements, told
+// apart by their namespace
+func (item *wxrItem) encoded(namespace string) string {
+	for _, encoded := range item.Encoded {
+		if strings.Contains(encoded.XMLName.Space, namespace) {
+			return encoded.Value
+		}
+	}
+	return ""
+}
+
+// Imports the published posts and pages of a WordPress
+// WXR export, attachments and drafts are skipped
+func ImportWXR(db database.Database, reader io.Reader, options ImportOptions) (ImportReport, error) {
+	var document wxrDocument
+	decoder := xml.NewDecoder(reader)
+	// WordPress exports aren't always strict XML
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	if err := decoder.Decode(&document); err != nil {
+		return ImportReport{}, fmt.Errorf("could not parse WXR file: %v", err)
+	}
+
+	site_url, err := url.Parse(document.Channel.Link)
+	if err != nil {
+		site_url = &url.URL{}
+	}
+
+	imp := makeImporter(db, options)
+	load_image := func(src string) ([]byte, string, error) {
+		if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+			return nil, "", fmt.Errorf("cannot download image from `%s`", src)
+		}
+		return imp.downloadImage(src)
+	}
+
+	for _, item := range document.Channel.Items {
+		if item.PostType != "post" && item.PostType != "page" {
+			continue
+		}
+		source := item.Link
+		if source == "" {
+			source = item.Title
+		}
+		if item.Status != "publish" {
+			log.Info().Msgf("skipping %s with status `%s`", source, item.Status)
+			imp.report.Skipped++
+			continue
+		}
+
+		// Responsive images would keep loading the old sizes
+		content := srcset_regex.ReplaceAllString(item.encoded("content"), "")
+		content = absoluteImageUrls(content, site_url)
+		imp.importItem(importItem{
+			Source:   source,
+			Title:    html.UnescapeString(item.Title),
+			Excerpt:  item.encoded("excerpt"),
+			Content:  content,
+			IsPage:   item.PostType == "page",
+			Link:     item.PostName,
+			OldPaths: []string{item.Link},
+		}, load_image)
+	}
+
+	return imp.report, nil
+}
+
+// Points the images with paths relative to the old site
+// to it, so they still load when they aren't downloaded
+func absoluteImageUrls(content string, site_url *url.URL) string {
+	return html_image_regex.ReplaceAllStringFunc(content, func(match string) string {
+		groups := html_image_regex.FindStringSubmatch(match)
+		image_url, err := site_url.Parse(html.UnescapeString(groups[2]))
+		if err != nil || image_url.Scheme == "" {
+			return match
+		}
+		return groups[1] + html.EscapeString(image_url.String()) + groups[3]
+	})
+}
+
+// Front-matter keys understood from Hugo and Jekyll sites
+type markdownFrontMatter struct {
+	Title        string   `yaml:"title" toml:"title"`
+	Excerpt      string   `yaml:"excerpt" toml:"excerpt"`
+	Summary      string   `yaml:"summary" toml:"summary"`
+	Description  string   `yaml:"description" toml:"description"`
+	Type         string   `yaml:"type" toml:"type"`
+	Layout       string   `yaml:"layout" toml:"layout"`
+	Slug         string   `yaml:"slug" toml:"slug"`
+	Draft        bool     `yaml:"draft" toml:"draft"`
+	Url          string   `yaml:"url" toml:"url"`
+	Permalink    string   `yaml:"permalink" toml:"permalink"`
+	Aliases      []string `yaml:"aliases" toml:"aliases"`
+	RedirectFrom []string `yaml:"redirect_from" toml:"redirect_from"`
+}
+
+// Splits the YAML (`---`) or TOML (`+++`) front-matter
+// from the markdown body
+func parseFrontMatter(data []byte) (markdownFrontMatter, []byte, error) {
+	var front_matter markdownFrontMatter
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+
+	var delimiter string
+	switch {
+	case bytes.HasPrefix(data, []byte("---\n")):
+		delimiter = "---"
+	case bytes.HasPrefix(data, []byte("+++\n")):
+		delimiter = "+++"
+	default:
+		return front_matter, data, nil
+	}
+
+	rest := data[len(delimiter)+1:]
+	header, body, found := bytes.Cut(rest, []byte("\n"+delimiter+"\n"))
+	if !found {
+		header, found = bytes.CutSuffix(bytes.TrimRight(rest, "\n"), []byte("\n"+delimiter))
+		if !found {
+			return front_matter, nil, fmt.Errorf("front-matter is not closed")
+		}
+		body = nil
+	}
+
+	var err error
+	if delimiter == "---" {
+		err = yaml.Unmarshal(header, &front_matter)
+	} else {
+		err = toml.Unmarshal(header, &front_matter)
+	}
+	if err != nil {
+		return front_matter, nil, fmt.Errorf("invalid front-matter: %v", err)
+	}
+	return front_matter, body, nil
+}
+
+// Imports every markdown file of the directory
+func ImportMarkdownDir(db database.Database, dir string, options ImportOptions) (ImportReport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	if !info.IsDir() {
+		return ImportReport{}, fmt.Errorf("%s is not a directory", dir)
+	}
+	return ImportMarkdown(db, os.DirFS(dir), options)
+}
+
+// Imports every markdown file in the file system, images
+// with relative paths are copied from it
+func ImportMarkdown(db database.Database, files fs.FS, options ImportOptions) (ImportReport, error) {
+	imp := makeImporter(db, options)
+
+	err := fs.WalkDir(files, ".", func(file_path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if file_path != "." && strings.HasPrefix(entry.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(path.Ext(file_path))
+		if ext != ".md" && ext != ".markdown" {
+			return nil
+		}
+
+		data, err := readImportFile(files, file_path, MAX_IMPORT_MARKDOWN_SIZE)
+		if err != nil {
+			imp.fail(file_path, err)
+			return nil
+		}
+
+		item, draft, err := markdownItem(file_path, data)
+		if err != nil {
+			imp.fail(file_path, err)
+			return nil
+		}
+		if draft {
+			log.Info().Msgf("skipping draft %s", file_path)
+			imp.report.Skipped++
+			return nil
+		}
+
+		imp.importItem(item, func(src string) ([]byte, string, error) {
+			if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+				return imp.downloadImage(src)
+			}
+			return readImportedImage(files, path.Dir(file_path), src)
+		})
+		return nil
+	})
+	if err != nil {
+		return imp.report, err
+	}
+	return imp.report, nil
+}
+
+func markdownItem(file_path string, data []byte) (importItem, bool, error) {
+	front_matter, body, err := parseFrontMatter(data)
+	if err != nil {
+		return importItem{}, false, err
+	}
+
+	name := strings.TrimSuffix(path.Base(file_path), path.Ext(file_path))
+	title := front_matter.Title
+	if title == "" {
+		title = name
+	}
+	excerpt := front_matter.Excerpt
+	if excerpt == "" {
+		excerpt = front_matter.Summary
+	}
+	if excerpt == "" {
+		excerpt = front_matter.Description
+	}
+	link := front_matter.Slug
+	if link == "" {
+		link = name
+	}
+
+	old_paths := append([]string{}, front_matter.Aliases...)
+	old_paths = append(old_paths, front_matter.RedirectFrom...)
+	if front_matter.Url != "" {
+		old_paths = append(old_paths, front_matter.Url)
+	}
+	if front_matter.Permalink != "" {
+		old_paths = append(old_paths, front_matter.Permalink)
+	}
+
+	return importItem{
+		Source:   file_path,
+		Title:    title,
+		Excerpt:  excerpt,
+		Content:  strings.TrimSpace(string(body)),
+		IsPage:   front_matter.Type == "page" || front_matter.Layout == "page",
+		Link:     link,
+		OldPaths: old_paths,
+	}, front_matter.Draft, nil
+}
+
+// Paths are relative to the markdown file, absolute paths
+// are looked up from the root and from `static/` as
+// sites built with Hugo keep them there
+func readImportedImage(files fs.FS, dir string, src string) ([]byte, string, error) {
+	src, _, _ = strings.Cut(src, "?")
+	src, err := url.PathUnescape(src)
+	if err != nil {
+		return nil, "", err
+	}
+
+	candidates := []string{path.Join(dir, src)}
+	if strings.HasPrefix(src, "/") {
+		root_path := strings.TrimPrefix(path.Clean(src), "/")
+		candidates = []string{root_path, path.Join("static", root_path)}
+	}
+
+	for _, candidate := range candidates {
+		if !fs.ValidPath(candidate) {
+			continue
+		}
+		data, err := readImportFile(files, candidate, MAX_IMPORT_IMAGE_SIZE)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return data, path.Base(candidate), nil
+	}
+	return nil, "", fmt.Errorf("image not found")
+}
+
+// Reads at most `limit` bytes of the file, zip entries are
+// refused early by the size in their header (UncompressedSize64)
+func readImportFile(files fs.FS, name string, limit int64) ([]byte, error) {
+	file, err := files.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if info.Size() > limit {
+		return nil, fmt.Errorf("file is bigger than %d bytes", limit)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file is bigger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// @Summary      Import content
+// @Description  Imports posts and pages from a WordPress WXR export or a zip archive of markdown files with YAML or TOML front-matter. Referenced images are stored in the media directory and old post URLs become permalinks.
+// @Tags         import
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        file formData file true "WXR (.xml) file or zip archive with markdown files"
+// @Param        skip_images formData bool false "Keep the original image references"
+// @Success      200 {object} ImportResponse
+// @Failure      400 {object} common.ErrorResponse "Invalid file"
+// @Router       /import [post]
+func postImportHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MAX_IMPORT_SIZE)
+		form, err := c.MultipartForm()
+		if err != nil {
+			log.Error().Msgf("could not create multipart form: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("request type must be `multipart-form`", err))
+			return
+		}
+
+		file_array := form.File["file"]
+		if len(file_array) == 0 || file_array[0] == nil {
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes("no file provided for import"))
+			return
+		}
+
+		options := ImportOptions{DownloadImages: true, ImageDirectory: siteImageDirectory(c)}
+		if skip_images := form.Value["skip_images"]; len(skip_images) > 0 && skip_images[0] == "true" {
+			options.DownloadImages = false
+		}
+
+		file_header := file_array[0]
+		file, err := file_header.Open()
+		if err != nil {
+			log.Error().Msgf("could not open import file: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not open import file", err))
+			return
+		}
+		defer file.Close()
+
+		var report ImportReport
+		switch strings.ToLower(filepath.Ext(file_header.Filename)) {
+		case ".xml":
+			report, err = ImportWXR(database, file, options)
+		case ".zip":
+			var archive *zip.Reader
+			archive, err = zip.NewReader(file, file_header.Size)
+			if err == nil {
+				report, err = ImportMarkdown(database, archive, options)
+			}
+		default:
+			err = fmt.Errorf("expected a .xml or .zip file")
+		}
+		if err != nil {
+			log.Error().Msgf("could not import content: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not import content", err))
+			return
+		}
+
+		invalidateTags(invalidator, common.CACHE_TAG_POSTS, common.CACHE_TAG_PAGES, common.CACHE_TAG_IMAGES)
+
+		c.JSON(http.StatusOK, ImportResponse{
+			Posts:      report.Posts,
+			Pages:      report.Pages,
+			Images:     report.Images,
+			Permalinks: report.Permalinks,
+			Skipped:    report.Skipped,
+			Failed:     report.Failed,
+		})
+	}
+}
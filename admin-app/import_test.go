@@ -0,0 +1,294 @@
+package admin_app
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type importedContent struct {
+	posts      []common.Post
+	pages      []common.Page
+	permalinks []common.Permalink
+}
+
+func makeImportDatabase(imported *importedContent) mocks.DatabaseMock {
+	return mocks.DatabaseMock{
+		AddPostHandler: func(title string, excerpt string, content string) (int, error) {
+			imported.posts = append(imported.posts, common.Post{Id: len(imported.posts) + 1, Title: title, Excerpt: excerpt, Content: content})
+			return len(imported.posts), nil
+		},
+		AddPageHandler: func(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+			imported.pages = append(imported.pages, common.Page{Id: len(imported.pages) + 1, Title: title, Content: content, Link: link})
+			return len(imported.pages), nil
+		},
+		GetPageHandler: func(link string) (common.Page, error) {
+			for _, page := range imported.pages {
+				if page.Link == link {
+					return page, nil
+				}
+			}
+			return common.Page{}, fmt.Errorf("page not found")
+		},
+		AddPermalinkHandler: func(permalink common.Permalink) (int, error) {
+			imported.permalinks = append(imported.permalinks, permalink)
+			return len(imported.permalinks), nil
+		},
+		GetPostsContentHandler: func(limit int, offset int) ([]common.Post, error) {
+			return imported.posts, nil
+		},
+		GetPermalinksHandler: func() ([]common.Permalink, error) {
+			return imported.permalinks, nil
+		},
+	}
+}
+
+func makePng(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	require.Nil(t, png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	return buffer.Bytes()
+}
+
+const WXR_EXPORT = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<link>%[1]s</link>
+	<item>
+		<title>Hello &amp; welcome</title>
+		<link>%[1]s/2020/01/hello-world/</link>
+		<content:encoded><![CDATA[<p>First post</p><img src="/wp-content/uploads/cat.png" srcset="%[1]s/cat-300.png 300w" />]]></content:encoded>
+		<excerpt:encoded><![CDATA[]]></excerpt:encoded>
+		<wp:post_name>hello-world</wp:post_name>
+		<wp:status>publish</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>About</title>
+		<link>%[1]s/about/</link>
+		<content:encoded><![CDATA[<p>About us</p><img src="%[1]s/wp-content/uploads/cat.png" />]]></content:encoded>
+		<excerpt:encoded><![CDATA[]]></excerpt:encoded>
+		<wp:post_name>about</wp:post_name>
+		<wp:status>publish</wp:status>
+		<wp:post_type>page</wp:post_type>
+	</item>
+	<item>
+		<title>Draft</title>
+		<link>%[1]s/?p=3</link>
+		<content:encoded><![CDATA[not yet]]></content:encoded>
+		<wp:status>draft</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>cat</title>
+		<wp:status>inherit</wp:status>
+		<wp:post_type>attachment</wp:post_type>
+	</item>
+</channel>
+</rss>`
+
+func TestImportWXR(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.ImageDirectory = t.TempDir() })
+
+	cat := makePng(t)
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wp-content/uploads/cat.png" {
+			http.NotFound(w, r)
+			return
+		}
+		downloads++
+		w.Write(cat)
+	}))
+	defer server.Close()
+
+	imported := &importedContent{}
+	db := makeImportDatabase(imported)
+	report, err := ImportWXR(&db, strings.NewReader(fmt.Sprintf(WXR_EXPORT, server.URL)), ImportOptions{DownloadImages: true})
+	require.Nil(t, err)
+	assert.Empty(t, report.Failed)
+	assert.Equal(t, ImportReport{Posts: 1, Pages: 1, Images: 1, Permalinks: 1, Skipped: 1}, report)
+
+	// The image is downloaded once for both references
+	assert.Equal(t, 1, downloads)
+	require.Len(t, imported.posts, 1)
+	post := imported.posts[0]
+	assert.Equal(t, "Hello & welcome", post.Title)
+	assert.Equal(t, "First post", post.Excerpt)
+	assert.NotContains(t, post.Content, "srcset")
+	assert.NotContains(t, post.Content, "wp-content")
+	assert.Contains(t, post.Content, `<img src="/images/data/`)
+
+	require.Len(t, imported.pages, 1)
+	assert.Equal(t, "about", imported.pages[0].Link)
+	assert.NotContains(t, imported.pages[0].Content, "wp-content")
+
+	assert.Equal(t, []common.Permalink{{Path: "/2020/01/hello-world/", PostId: 1}}, imported.permalinks)
+
+	files, err := os.ReadDir(common.CurrentSettings().ImageDirectory)
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	// Importing again skips the post by its old URL and the page by its link
+	report, err = ImportWXR(&db, strings.NewReader(fmt.Sprintf(WXR_EXPORT, server.URL)), ImportOptions{DownloadImages: true})
+	require.Nil(t, err)
+	assert.Equal(t, ImportReport{Skipped: 3}, report)
+	assert.Len(t, imported.posts, 1)
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	front_matter, body, err := parseFrontMatter([]byte("---\ntitle: Hello\naliases: [/old/hello/]\ndraft: true\n---\n# Hello\n"))
+	require.Nil(t, err)
+	assert.Equal(t, "Hello", front_matter.Title)
+	assert.Equal(t, []string{"/old/hello/"}, front_matter.Aliases)
+	assert.True(t, front_matter.Draft)
+	assert.Equal(t, "# Hello\n", string(body))
+
+	front_matter, body, err = parseFrontMatter([]byte("+++\r\ntitle = \"Hello\"\r\ntype = \"page\"\r\n+++\r\nbody"))
+	require.Nil(t, err)
+	assert.Equal(t, "Hello", front_matter.Title)
+	assert.Equal(t, "page", front_matter.Type)
+	assert.Equal(t, "body", string(body))
+
+	front_matter, body, err = parseFrontMatter([]byte("no front-matter"))
+	require.Nil(t, err)
+	assert.Equal(t, markdownFrontMatter{}, front_matter)
+	assert.Equal(t, "no front-matter", string(body))
+
+	_, _, err = parseFrontMatter([]byte("---\ntitle: Hello\n"))
+	assert.NotNil(t, err)
+}
+
+func TestImportMarkdown(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.ImageDirectory = t.TempDir() })
+
+	cat := makePng(t)
+	files := fstest.MapFS{
+		"posts/hello.md": {Data: []byte("---\ntitle: Hello\nsummary: Says hello\nredirect_from:\n  - /2020/hello.html\n---\n" +
+			"Hello ![cat](images/cat.png) and ![logo](/logo.png)\n")},
+		"posts/images/cat.png": {Data: cat},
+		"static/logo.png":      {Data: cat},
+		"posts/draft.md":       {Data: []byte("+++\ntitle = \"Draft\"\ndraft = true\n+++\n")},
+		"about.markdown":       {Data: []byte("---\nlayout: page\nslug: About Us\n---\nAbout ![missing](../secret.png)\n")},
+		"broken.md":            {Data: []byte("---\ntitle: [\n---\n")},
+		"notes.txt":            {Data: []byte("ignored")},
+	}
+
+	imported := &importedContent{}
+	db := makeImportDatabase(imported)
+	report, err := ImportMarkdown(&db, files, ImportOptions{DownloadImages: true})
+	require.Nil(t, err)
+	assert.Equal(t, 1, report.Posts)
+	assert.Equal(t, 1, report.Pages)
+	assert.Equal(t, 2, report.Images)
+	assert.Equal(t, 1, report.Permalinks)
+	assert.Equal(t, 1, report.Skipped)
+	// The broken front-matter and the image outside of the directory
+	assert.Len(t, report.Failed, 2)
+
+	require.Len(t, imported.posts, 1)
+	assert.Equal(t, "Says hello", imported.posts[0].Excerpt)
+	assert.Regexp(t, `^Hello !\[cat\]\(/images/data/[0-9a-f-]+\.png\) and !\[logo\]\(/images/data/[0-9a-f-]+\.png\)$`, imported.posts[0].Content)
+	assert.Equal(t, []common.Permalink{{Path: "/2020/hello.html", PostId: 1}}, imported.permalinks)
+
+	require.Len(t, imported.pages, 1)
+	assert.Equal(t, "about-us", imported.pages[0].Link)
+	assert.Equal(t, "about", imported.pages[0].Title)
+	assert.Contains(t, imported.pages[0].Content, "../secret.png")
+
+	// Pages that already exist are not imported twice
+	report, err = ImportMarkdown(&db, fstest.MapFS{"about.md": files["about.markdown"]}, ImportOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, 0, report.Pages)
+	assert.Equal(t, 1, report.Skipped)
+
+	// Posts that already exist are not imported twice, by their
+	// old URL or by their title and content
+	report, err = ImportMarkdown(&db, fstest.MapFS{
+		"hello.md": files["posts/hello.md"],
+		"copy.md":  {Data: []byte("---\ntitle: Hello\n---\nHello ![cat](other/cat.png) and ![logo](/logo.png)\n")},
+		"other.md": {Data: []byte("---\ntitle: Hello\n---\nHello again\n")},
+	}, ImportOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, 1, report.Posts)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Len(t, imported.posts, 2)
+
+	stored, err := filepath.Glob(filepath.Join(common.CurrentSettings().ImageDirectory, "*.png"))
+	assert.Nil(t, err)
+	assert.Len(t, stored, 2)
+}
+
+func TestImportMarkdownSizeLimits(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.ImageDirectory = t.TempDir() })
+
+	big := bytes.Repeat([]byte("a"), MAX_IMPORT_MARKDOWN_SIZE+1)
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+	entry, err := writer.Create("big.md")
+	require.Nil(t, err)
+	_, err = entry.Write(big)
+	require.Nil(t, err)
+	// The header claims a small file, the data is bigger
+	lying := append(big, 'a')
+	entry, err = writer.CreateRaw(&zip.FileHeader{Name: "lying.md", Method: zip.Store, UncompressedSize64: 10, CompressedSize64: uint64(len(lying))})
+	require.Nil(t, err)
+	_, err = entry.Write(lying)
+	require.Nil(t, err)
+	entry, err = writer.Create("hello.md")
+	require.Nil(t, err)
+	_, err = entry.Write([]byte("---\ntitle: Hello\n---\nHello\n"))
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	require.Nil(t, err)
+
+	imported := &importedContent{}
+	db := makeImportDatabase(imported)
+	report, err := ImportMarkdown(&db, archive, ImportOptions{DownloadImages: true})
+	require.Nil(t, err)
+	assert.Equal(t, 1, report.Posts)
+	require.Len(t, report.Failed, 2)
+	assert.Contains(t, report.Failed[0], "big.md: file is bigger than")
+	assert.True(t, strings.HasPrefix(report.Failed[1], "lying.md: "))
+}
+
+func TestPermalinkPath(t *testing.T) {
+	for old_path, expected := range map[string]string{
+		"https://old.blog/2020/01/hello/": "/2020/01/hello/",
+		"2020/hello.html":                 "/2020/hello.html",
+		"/":                               "",
+		"https://old.blog/?p=3":           "",
+		"/post/:id":                       "",
+	} {
+		permalink, ok := permalinkPath(old_path)
+		assert.Equal(t, expected != "", ok, old_path)
+		assert.Equal(t, expected, permalink, old_path)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	assert.Equal(t, "about-us", common.Slugify("About Us!"))
+	assert.Equal(t, "café-menu", common.Slugify("caf%C3%A9 -- menu"))
+	assert.Equal(t, "", common.Slugify("  ?? "))
+}
@@ -0,0 +1,94 @@
+package admin_app
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	admin_views "github.com/rbc33/gocms/views/admin"
+	"github.com/rs/zerolog/log"
+)
+
+// @Summary      Media library page
+// @Description  Images of the media directory with a form to upload more.
+// @Tags         admin_ui
+// @Produce      html
+// @Success      200 {string} string "HTML page"
+// @Router       /ui/media [get]
+func getMediaPageHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		renderAdminPage(c, "Media", admin_views.MakeMediaLibrary(mediaImages(siteImageDirectory(c)), ""))
+	}
+}
+
+// @Summary      Media file
+// @Description  Image of the media directory shown in the admin pages.
+// @Tags         admin_ui
+// @Produce      image/png,image/jpeg,image/webp
+// @Param        filepath path string true "Image filename"
+// @Success      200 {file} file "Image file"
+// @Failure      404 {string} string "Image not found"
+// @Router       /ui/images/data/{filepath} [get]
+func getMediaFileHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.FileFromFS(c.Param("filepath"), common.SiteMediaFileSystem{SiteId: requestSiteId(c)})
+	}
+}
+
+// @Summary      Upload an image to the media library
+// @Description  Saves the image like `POST /images` and answers with the media grid, showing the error of rejected uploads.
+// @Tags         admin_ui
+// @Accept       multipart/form-data
+// @Produce      html
+// @Param        file formData file true "The image file to upload"
+// @Param        excerpt formData string false "A brief description of the image"
+// @Success      200 {string} string "HTML media grid"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Router       /ui/media [post]
+func postMediaHandler(hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 10*1000000)
+		upload_error := ""
+		file, err := c.FormFile("file")
+		if err != nil {
+			log.Warn().Msgf("no image uploaded: %v", err)
+			upload_error = "no file provided for image upload"
+		} else {
+			excerpt := c.PostForm("excerpt")
+			if excerpt == "" {
+				excerpt = "unknown"
+			}
+			if _, _, err = saveImage(c, hooks, file, excerpt); err != nil {
+				upload_error = err.Error()
+			} else {
+				invalidateTags(invalidator, common.CACHE_TAG_IMAGES)
+			}
+		}
+		renderAdminHtml(c, http.StatusOK, admin_views.MakeMediaGrid(mediaImages(siteImageDirectory(c)), upload_error))
+	}
+}
+
+// @Summary      Delete an image from the media library
+// @Description  Deletes the image and its metadata, htmx removes it from the grid with the empty response.
+// @Tags         admin_ui
+// @Param        name path string true "Image filename"
+// @Success      200 {string} string "Empty response"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Failure      404 {object} common.ErrorResponse "Image not found"
+// @Router       /ui/media/{name} [delete]
+func deleteMediaHandler(invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		// Only the images of the library, never other files
+		directory := siteImageDirectory(c)
+		if !slices.Contains(mediaImages(directory), name) {
+			c.JSON(http.StatusNotFound, common.MsgErrorRes("image not found"))
+			return
+		}
+		removeImage(directory, name)
+		invalidateTags(invalidator, common.CACHE_TAG_IMAGES)
+		c.String(http.StatusOK, "")
+	}
+}
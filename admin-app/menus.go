@@ -0,0 +1,356 @@
+package admin_app
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+// Checks the item against the content of the site, galleries
+// come from the config so they are checked here
+func checkMenuItem(site common.Site, item_request MenuItemRequest) error {
+	if err := common.ValidateMenuItem(item_request.Type, item_request.Target); err != nil {
+		return err
+	}
+	if item_request.Type == common.MENU_ITEM_GALLERY {
+		if _, exists := site.Galleries[item_request.Target]; !exists {
+			return fmt.Errorf("gallery `%s` does not exist", item_request.Target)
+		}
+	}
+	return nil
+}
+
+func makeMenuItem(item_request MenuItemRequest) common.MenuItem {
+	return common.MenuItem{
+		ParentId: item_request.ParentId,
+		Type:     item_request.Type,
+		Target:   item_request.Target,
+		Label:    item_request.Label,
+		Title:    item_request.Title,
+		Visible:  item_request.Visible == nil || *item_request.Visible,
+	}
+}
+
+// @Summary      Get the menus
+// @Description  Lists the menus of the site with their items nested, including the hidden ones.
+// @Tags         menus
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-GoCMS-Site header int false "Site ID, the host is used without it"
+// @Success      200 {object} GetMenusResponse
+// @Failure      500 {object} common.ErrorResponse
+// @Router       /menus [get]
+func getMenusHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		menus, err := database.GetMenus()
+		if err != nil {
+			log.Error().Msgf("could not get menus: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get menus", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, GetMenusResponse{Menus: menus})
+	}
+}
+
+// @Summary      Get a menu
+// @Description  Gets a menu of the site with its items nested.
+// @Tags         menus
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Menu ID"
+// @Success      200 {object} common.Menu
+// @Failure      400 {object} common.ErrorResponse "Invalid menu ID"
+// @Failure      404 {object} common.ErrorResponse "Menu not found"
+// @Router       /menus/{id} [get]
+func getMenuHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var menu_binding common.IntIdBinding
+		if err := c.ShouldBindUri(&menu_binding); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get menu id", err))
+			return
+		}
+
+		menu, err := database.GetMenu(menu_binding.Id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, common.ErrorRes("menu not found", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, menu)
+	}
+}
+
+// @Summary      Add a menu
+// @Description  Creates an empty menu, placed in the header or footer when a location is given.
+// @Tags         menus
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        menu body AddMenuRequest true "Menu to add"
+// @Success      201 {object} MenuResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus [post]
+func postMenuHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var add_menu_request AddMenuRequest
+		if err := c.ShouldBindJSON(&add_menu_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+		if err := common.ValidateMenuLocation(add_menu_request.Location); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid menu location", err))
+			return
+		}
+
+		id, err := database.AddMenu(add_menu_request.Name, add_menu_request.Location)
+		if err != nil {
+			log.Error().Msgf("could not add menu: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add menu", err))
+			return
+		}
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		c.JSON(http.StatusCreated, MenuResponse{Id: id})
+	}
+}
+
+// @Summary      Change a menu
+// @Description  Renames the menu or moves it to another location.
+// @Tags         menus
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        menu body ChangeMenuRequest true "New menu data"
+// @Success      200 {object} MenuResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus [put]
+func putMenuHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var change_menu_request ChangeMenuRequest
+		if err := c.ShouldBindJSON(&change_menu_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+		if err := common.ValidateMenuLocation(change_menu_request.Location); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid menu location", err))
+			return
+		}
+
+		err := database.ChangeMenu(change_menu_request.Id, change_menu_request.Name, change_menu_request.Location)
+		if err != nil {
+			log.Error().Msgf("could not change menu %d: %v", change_menu_request.Id, err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not change menu", err))
+			return
+		}
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		c.JSON(http.StatusOK, MenuResponse{Id: change_menu_request.Id})
+	}
+}
+
+// @Summary      Delete a menu
+// @Description  Deletes the menu with all its items.
+// @Tags         menus
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Menu ID"
+// @Success      200 {object} MenuResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus/{id} [delete]
+func deleteMenuHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var menu_binding common.IntIdBinding
+		if err := c.ShouldBindUri(&menu_binding); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get menu id", err))
+			return
+		}
+
+		if err := database.DeleteMenu(menu_binding.Id); err != nil {
+			log.Error().Msgf("could not delete menu %d: %v", menu_binding.Id, err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not delete menu", err))
+			return
+		}
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		c.JSON(http.StatusOK, MenuResponse{Id: menu_binding.Id})
+	}
+}
+
+// @Summary      Add a menu item
+// @Description  Adds an item after the other children of its parent. Page and post items keep linking to the content when its link changes.
+// @Tags         menus
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Menu ID"
+// @Param        item body MenuItemRequest true "Item to add"
+// @Success      201 {object} MenuResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus/{id}/items [post]
+func postMenuItemHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var menu_binding common.IntIdBinding
+		if err := c.ShouldBindUri(&menu_binding); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get menu id", err))
+			return
+		}
+		var item_request MenuItemRequest
+		if err := c.ShouldBindJSON(&item_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		site := c.MustGet(SITE_KEY).(common.Site)
+		if err := checkMenuItem(site, item_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid menu item", err))
+			return
+		}
+
+		id, err := database.AddMenuItem(menu_binding.Id, makeMenuItem(item_request))
+		if err != nil {
+			log.Error().Msgf("could not add item to menu %d: %v", menu_binding.Id, err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add menu item", err))
+			return
+		}
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		c.JSON(http.StatusCreated, MenuResponse{Id: id})
+	}
+}
+
+// @Summary      Change a menu item
+// @Description  Changes what the item links to and how it's shown.
+// @Tags         menus
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Menu ID"
+// @Param        item_id path int true "Item ID"
+// @Param        item body MenuItemRequest true "New item data"
+// @Success      200 {object} MenuResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus/{id}/items/{item_id} [put]
+func putMenuItemHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var item_binding MenuItemBinding
+		if err := c.ShouldBindUri(&item_binding); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get menu item id", err))
+			return
+		}
+		var item_request MenuItemRequest
+		if err := c.ShouldBindJSON(&item_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		site := c.MustGet(SITE_KEY).(common.Site)
+		if err := checkMenuItem(site, item_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid menu item", err))
+			return
+		}
+
+		item := makeMenuItem(item_request)
+		item.Id = item_binding.ItemId
+		if err := database.ChangeMenuItem(item); err != nil {
+			log.Error().Msgf("could not change menu item %d: %v", item.Id, err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not change menu item", err))
+			return
+		}
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		c.JSON(http.StatusOK, MenuResponse{Id: item.Id})
+	}
+}
+
+// @Summary      Delete a menu item
+// @Description  Deletes the item with its children.
+// @Tags         menus
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Menu ID"
+// @Param        item_id path int true "Item ID"
+// @Success      200 {object} MenuResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus/{id}/items/{item_id} [delete]
+func deleteMenuItemHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var item_binding MenuItemBinding
+		if err := c.ShouldBindUri(&item_binding); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get menu item id", err))
+			return
+		}
+
+		if err := database.DeleteMenuItem(item_binding.ItemId); err != nil {
+			log.Error().Msgf("could not delete menu item %d: %v", item_binding.ItemId, err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not delete menu item", err))
+			return
+		}
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		c.JSON(http.StatusOK, MenuResponse{Id: item_binding.ItemId})
+	}
+}
+
+// @Summary      Reorder menu items
+// @Description  Sets the parent and position of the dragged items, all of them or none. Items can't be nested under their own children.
+// @Tags         menus
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id path int true "Menu ID"
+// @Param        order body MoveMenuItemsRequest true "New parents and positions"
+// @Success      200 {object} common.Menu
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /menus/{id}/order [put]
+func putMenuOrderHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var menu_binding common.IntIdBinding
+		if err := c.ShouldBindUri(&menu_binding); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get menu id", err))
+			return
+		}
+		var move_request MoveMenuItemsRequest
+		if err := c.ShouldBindJSON(&move_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		items := make([]common.MenuItem, len(move_request.Items))
+		for i, position := range move_request.Items {
+			items[i] = common.MenuItem{Id: position.Id, ParentId: position.ParentId, Position: position.Position}
+		}
+		if err := database.MoveMenuItems(menu_binding.Id, items); err != nil {
+			log.Error().Msgf("could not reorder menu %d: %v", menu_binding.Id, err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not reorder menu", err))
+			return
+		}
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.MenusCacheTag(site.Id))
+
+		menu, err := database.GetMenu(menu_binding.Id)
+		if err != nil {
+			log.Error().Msgf("could not get menu %d: %v", menu_binding.Id, err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get menu", err))
+			return
+		}
+		c.JSON(http.StatusOK, menu)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rbc33/gocms/common"
 	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
 	"github.com/rs/zerolog/log"
 )
 
@@ -29,6 +30,7 @@ import (
 // @Router       /pages [get]
 func getPagesHandler(database database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		// Un valor de 0 para el límite significa "sin límite".
 		offsetStr := c.DefaultQuery("offset", "0")
 		limitStr := c.DefaultQuery("limit", "0")
@@ -65,9 +67,11 @@ func getPagesHandler(database database.Database) gin.HandlerFunc {
 // @Param        page body AddPageRequest true "Page to add"
 // @Success      200 {object} PageResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or data"
+// @Failure      422 {object} PluginErrorsResponse "A plugin refused the page"
 // @Router       /pages [post]
-func postPageHandler(database database.Database) func(*gin.Context) {
+func postPageHandler(database database.Database, hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var add_page_request AddPageRequest
 		if c.Request.Body == nil {
 			c.JSON(http.StatusBadRequest, common.MsgErrorRes("no request body provided"))
@@ -89,20 +93,36 @@ func postPageHandler(database database.Database) func(*gin.Context) {
 			return
 		}
 
-		id, err := database.AddPage(
-			add_page_request.Title,
-			add_page_request.Content,
-			add_page_request.Link,
+		page := common.Page{
+			Title:    add_page_request.Title,
+			Content:  add_page_request.Content,
+			Link:     add_page_request.Link,
+			Blocks:   add_page_request.Blocks,
+			ParentId: add_page_request.ParentId,
+		}
+		if err = hooks.Run(c.Request.Context(), plugins.EVENT_BEFORE_PAGE_SAVE, &page); err != nil {
+			pluginErrorResponse(c, "a plugin refused the page", err)
+			return
+		}
+
+		page.Id, err = database.AddPage(
+			page.Title,
+			page.Content,
+			page.Link,
+			page.Blocks,
+			page.ParentId,
 		)
 		if err != nil {
 			log.Error().Msgf("failed to add post: %v", err)
 			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add post", err))
 			return
 		}
+		runAfterHooks(c, hooks, plugins.EVENT_AFTER_PAGE_SAVE, &page)
+		invalidateTags(invalidator, common.PageCacheTag(page.Link), common.CACHE_TAG_PAGES)
 
 		c.JSON(http.StatusCreated, PageResponse{
-			Id:   id,
-			Link: add_page_request.Link,
+			Id:   page.Id,
+			Link: page.Link,
 		})
 	}
 }
@@ -116,9 +136,11 @@ func postPageHandler(database database.Database) func(*gin.Context) {
 // @Param        post body ChangePageRequest true "Page data to update"
 // @Success      200 {object} PostIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or could not change page"
+// @Failure      422 {object} PluginErrorsResponse "A plugin refused the page"
 // @Router       /pages [put]
-func putPageHandler(database database.Database) func(*gin.Context) {
+func putPageHandler(database database.Database, hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var change_page_request ChangePageRequest
 		decoder := json.NewDecoder(c.Request.Body)
 		decoder.DisallowUnknownFields()
@@ -133,18 +155,36 @@ func putPageHandler(database database.Database) func(*gin.Context) {
 			return
 		}
 
-		err = checkRequiredPageData(AddPageRequest{change_page_request.Title, change_page_request.Link, change_page_request.Content})
+		err = checkRequiredPageData(AddPageRequest{
+			Title:   change_page_request.Title,
+			Content: change_page_request.Content,
+			Link:    change_page_request.Link,
+			Blocks:  change_page_request.Blocks,
+		})
 		if err != nil {
 			log.Error().Msgf("failed to add post required data is missing: %v", err)
 			c.JSON(http.StatusBadRequest, common.ErrorRes("missing required data", err))
 			return
 		}
 
+		page := common.Page{
+			Id:      change_page_request.Id,
+			Title:   change_page_request.Title,
+			Content: change_page_request.Content,
+			Link:    change_page_request.Link,
+			Blocks:  change_page_request.Blocks,
+		}
+		if err = hooks.Run(c.Request.Context(), plugins.EVENT_BEFORE_PAGE_SAVE, &page); err != nil {
+			pluginErrorResponse(c, "a plugin refused the page", err)
+			return
+		}
+
 		err = database.ChangePage(
 			change_page_request.Id,
-			change_page_request.Title,
-			change_page_request.Content,
-			change_page_request.Link,
+			page.Title,
+			page.Content,
+			page.Link,
+			page.Blocks,
 		)
 		if err != nil {
 			log.Error().Msgf("failed to change post: %v", err)
@@ -154,6 +194,15 @@ func putPageHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		runAfterHooks(c, hooks, plugins.EVENT_AFTER_PAGE_SAVE, &page)
+		invalidateTags(
+			invalidator,
+			common.PageIdCacheTag(change_page_request.Id),
+			common.PageCacheTag(page.Link),
+			common.CACHE_TAG_PAGES,
+			// Menu items follow the link of the page
+			common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id),
+		)
 
 		c.JSON(http.StatusOK, gin.H{
 			"id": change_page_request.Id,
@@ -171,8 +220,9 @@ func putPageHandler(database database.Database) func(*gin.Context) {
 // @Failure      400 {object} common.ErrorResponse "Invalid link provided"
 // @Failure      404 {object} common.ErrorResponse "Page not found"
 // @Router       /pages/{link} [delete]
-func deletePageHandler(database database.Database) func(*gin.Context) {
+func deletePageHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var delete_page_request DeletePageRequest
 		decoder := json.NewDecoder(c.Request.Body)
 		decoder.DisallowUnknownFields()
@@ -196,6 +246,12 @@ func deletePageHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		invalidateTags(
+			invalidator,
+			common.PageCacheTag(delete_page_request.Link),
+			common.CACHE_TAG_PAGES,
+			common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id),
+		)
 
 		c.JSON(http.StatusOK, gin.H{
 			"link": delete_page_request.Link,
@@ -203,13 +259,58 @@ func deletePageHandler(database database.Database) func(*gin.Context) {
 	}
 }
 
+// @Summary      Reorder pages
+// @Description  Sets the parent and position of the moved pages, all of them or none. Pages can't be nested under their own children. Old paths of the moved pages redirect to the new ones.
+// @Tags         pages
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        order body MovePagesRequest true "New parents and positions"
+// @Success      200 {object} GetPagesResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /pages/order [put]
+func putPagesOrderHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var move_request MovePagesRequest
+		if err := c.ShouldBindJSON(&move_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		pages := make([]common.Page, len(move_request.Pages))
+		for i, position := range move_request.Pages {
+			pages[i] = common.Page{Id: position.Id, ParentId: position.ParentId, Position: position.Position}
+		}
+		if err := database.MovePages(pages); err != nil {
+			log.Error().Msgf("could not reorder pages: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not reorder pages", err))
+			return
+		}
+		site := c.MustGet(SITE_KEY).(common.Site)
+		// Paths change with the tree, and so do the menu items
+		invalidateTags(invalidator, common.CACHE_TAG_PAGES, common.MenusCacheTag(site.Id))
+
+		tree, err := database.GetPageTree()
+		if err != nil {
+			log.Error().Msgf("could not get page tree: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get pages", err))
+			return
+		}
+		c.JSON(http.StatusOK, GetPagesResponse{Pages: tree})
+	}
+}
+
 func checkRequiredPageData(add_page_request AddPageRequest) error {
 	if strings.TrimSpace(add_page_request.Title) == "" {
 		return fmt.Errorf("missing required data 'Title'")
 	}
 
-	if strings.TrimSpace(add_page_request.Content) == "" {
-		return fmt.Errorf("missing required data 'Content'")
+	if strings.TrimSpace(add_page_request.Content) == "" && len(add_page_request.Blocks) == 0 {
+		return fmt.Errorf("missing required data 'Content' or 'Blocks'")
+	}
+	if err := common.ValidateBlocks(add_page_request.Blocks); err != nil {
+		return err
 	}
 
 	err := validateLinkRegex(add_page_request.Link)
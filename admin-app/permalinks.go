@@ -22,6 +22,7 @@ import (
 // @Router       /permalinks/{permalink}/{post_id} [post]
 func postPermalinkHandler(database database.Database) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		// add_permalink_request := struct {
 		// 	Permalink string `uri:"permalink" binding:"required"`
 		// 	PostId    int    `uri:"post_id" binding:"required"`
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -13,7 +12,6 @@ import (
 	"github.com/rbc33/gocms/database"
 	"github.com/rbc33/gocms/plugins"
 	"github.com/rs/zerolog/log"
-	lua "github.com/yuin/gopher-lua"
 )
 
 // @Summary      Get a list of posts
@@ -29,6 +27,7 @@ import (
 // @Router       /posts [get]
 func getPostsHandler(database database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		// Lee offset y limit de la query (?offset=0&limit=10)
 		// Un valor de 0 para el límite significa "sin límite".
 		offsetStr := c.DefaultQuery("offset", "0")
@@ -69,6 +68,7 @@ func getPostsHandler(database database.Database) gin.HandlerFunc {
 // @Router       /posts/{id} [get]
 func getPostHandler(database database.Database) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		// localhost:8080/post/{id}
 		var post_binding common.PostIdBinding
 		if err := c.ShouldBindUri(&post_binding); err != nil {
@@ -107,9 +107,11 @@ func getPostHandler(database database.Database) func(*gin.Context) {
 // @Param        post body AddPostRequest true "Post to add"
 // @Success      201 {object} PostIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or missing data"
+// @Failure      422 {object} PluginErrorsResponse "A plugin refused the post"
 // @Router       /post [post]
-func postPostHandler(database database.Database, shortcode_handlers map[string]*lua.LState, post_hook *plugins.PostHook) func(*gin.Context) {
+func postPostHandler(database database.Database, hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var add_post_request AddPostRequest
 		if c.Request.Body == nil {
 			c.JSON(http.StatusBadRequest, common.MsgErrorRes("no request body provided"))
@@ -128,27 +130,34 @@ func postPostHandler(database database.Database, shortcode_handlers map[string]*
 		if err != nil {
 			log.Error().Msgf("failed to add post required data is missing: %v", err)
 			c.JSON(http.StatusBadRequest, common.ErrorRes("missing required data", err))
+			return
 		}
 
-		altered_post := post_hook.UpdatePost(add_post_request.Title, add_post_request.Excerpt, add_post_request.Content, shortcode_handlers)
-
-		fmt.Print("Title: ", altered_post.Title)
-		fmt.Print("Excerpt: ", altered_post.Excerpt)
-		fmt.Print("Content: ", altered_post.Content)
+		post := common.Post{
+			Title:   add_post_request.Title,
+			Excerpt: add_post_request.Excerpt,
+			Content: add_post_request.Content,
+		}
+		if err = hooks.Run(c.Request.Context(), plugins.EVENT_BEFORE_POST_SAVE, &post); err != nil {
+			pluginErrorResponse(c, "a plugin refused the post", err)
+			return
+		}
 
-		id, err := database.AddPost(
-			altered_post.Title,
-			altered_post.Excerpt,
-			altered_post.Content,
+		post.Id, err = database.AddPost(
+			post.Title,
+			post.Excerpt,
+			post.Content,
 		)
 		if err != nil {
 			log.Error().Msgf("failed to add post: %v", err)
 			c.JSON(http.StatusBadRequest, common.ErrorRes("could not add post", err))
 			return
 		}
+		runAfterHooks(c, hooks, plugins.EVENT_AFTER_POST_SAVE, &post)
+		invalidateTags(invalidator, common.CACHE_TAG_POSTS)
 
 		c.JSON(http.StatusCreated, PostIdResponse{
-			id,
+			post.Id,
 		})
 	}
 }
@@ -162,9 +171,11 @@ func postPostHandler(database database.Database, shortcode_handlers map[string]*
 // @Param        post body ChangePostRequest true "Post data to update"
 // @Success      200 {object} PostIdResponse
 // @Failure      400 {object} common.ErrorResponse "Invalid request body or could not change post"
+// @Failure      422 {object} PluginErrorsResponse "A plugin refused the post"
 // @Router       /posts [put]
-func putPostHandler(database database.Database) func(*gin.Context) {
+func putPostHandler(database database.Database, hooks *plugins.Hooks, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var change_post_request ChangePostRequest
 		decoder := json.NewDecoder(c.Request.Body)
 		decoder.DisallowUnknownFields()
@@ -179,11 +190,22 @@ func putPostHandler(database database.Database) func(*gin.Context) {
 			return
 		}
 
+		post := common.Post{
+			Id:      change_post_request.Id,
+			Title:   change_post_request.Title,
+			Excerpt: change_post_request.Excerpt,
+			Content: change_post_request.Content,
+		}
+		if err = hooks.Run(c.Request.Context(), plugins.EVENT_BEFORE_POST_SAVE, &post); err != nil {
+			pluginErrorResponse(c, "a plugin refused the post", err)
+			return
+		}
+
 		err = database.ChangePost(
 			change_post_request.Id,
-			change_post_request.Title,
-			change_post_request.Excerpt,
-			change_post_request.Content,
+			post.Title,
+			post.Excerpt,
+			post.Content,
 		)
 		if err != nil {
 			log.Error().Msgf("failed to change post: %v", err)
@@ -193,6 +215,8 @@ func putPostHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		runAfterHooks(c, hooks, plugins.EVENT_AFTER_POST_SAVE, &post)
+		invalidateTags(invalidator, common.PostCacheTag(change_post_request.Id), common.CACHE_TAG_POSTS, common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id))
 
 		c.JSON(http.StatusOK, gin.H{
 			"id": change_post_request.Id,
@@ -210,8 +234,9 @@ func putPostHandler(database database.Database) func(*gin.Context) {
 // @Failure      400 {object} common.ErrorResponse "Invalid ID provided"
 // @Failure      404 {object} common.ErrorResponse "Post not found"
 // @Router       /posts [delete]
-func deletePostHandler(database database.Database) func(*gin.Context) {
+func deletePostHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
 	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
 		var delete_post_request DeletePostRequest
 		if err := c.ShouldBindJSON(&delete_post_request); err != nil {
 			log.Warn().Msgf("could not delete post: %v", err)
@@ -228,6 +253,7 @@ func deletePostHandler(database database.Database) func(*gin.Context) {
 			})
 			return
 		}
+		invalidateTags(invalidator, common.PostCacheTag(delete_post_request.Id), common.CACHE_TAG_POSTS, common.MenusCacheTag(c.MustGet(SITE_KEY).(common.Site).Id))
 
 		c.JSON(http.StatusOK, gin.H{
 			"id": delete_post_request.Id,
@@ -250,86 +276,3 @@ func checkRequiredData(addPostRequest AddPostRequest) error {
 
 	return nil
 }
-
-// partitionString will partition the strings by
-// removing the given ranges
-func partitionString(text string, indexes [][]int) []string {
-
-	if len(text) == 0 {
-		return []string{}
-	}
-
-	partitions := make([]string, 0)
-	start := 0
-	for _, window := range indexes {
-		partitions = append(partitions, text[start:window[0]])
-		start = window[1]
-	}
-
-	partitions = append(partitions, text[start:len(text)-1])
-	return partitions
-}
-
-func shortcodeToMarkdown(shortcode string, shortcode_handlers map[string]*lua.LState) (string, error) {
-	key_value := strings.Split(shortcode, ":")
-
-	key := key_value[0]
-	values := key_value[1:]
-
-	if handler, found := shortcode_handlers[key]; found {
-
-		// Need to quote all values for a valid lua syntax
-		quoted_values := make([]string, 0)
-		for _, value := range values {
-			quoted_values = append(quoted_values, fmt.Sprintf("%q", value))
-		}
-
-		err := handler.DoString(fmt.Sprintf(`result = HandleShortcode({%s})`, strings.Join(quoted_values, ",")))
-		if err != nil {
-			return "", fmt.Errorf("error running %s shortcode: %v", key, err)
-		}
-
-		value := handler.GetGlobal("result")
-		if ret_type := value.Type().String(); ret_type != "string" {
-			return "", fmt.Errorf("error running %s shortcode: invalid return type %s", key, ret_type)
-		} else if ret_type == "" {
-			return "", fmt.Errorf("error running %s shortcode: returned empty string", key)
-		}
-
-		return value.String(), nil
-	}
-
-	return "", fmt.Errorf("unsupported shortcode: %s", key)
-}
-
-func transformContent(content string, shortcode_handlers map[string]*lua.LState) (string, error) {
-	// Find all the occurences of {{ and }}
-	regex, _ := regexp.Compile(`{{[\w.-]+(:[\w.-]+)+}}`)
-
-	shortcodes := regex.FindAllStringIndex(content, -1)
-	if len(shortcodes) == 0 {
-		return content, nil
-	}
-
-	partitions := partitionString(content, shortcodes)
-
-	builder := strings.Builder{}
-	i := 0
-
-	for i, shortcode := range shortcodes {
-		builder.WriteString(partitions[i])
-
-		markdown, err := shortcodeToMarkdown(content[shortcode[0]+2:shortcode[1]-2], shortcode_handlers)
-		if err != nil {
-			log.Error().Msgf("%v", err)
-			markdown = ""
-		}
-		builder.WriteString(markdown)
-	}
-
-	// Guaranteed to have +1 than the number of
-	// shortcodes by algorithm
-	builder.WriteString(partitions[i+1])
-
-	return builder.String(), nil
-}
@@ -0,0 +1,137 @@
+package admin_app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/views"
+	"github.com/rs/zerolog/log"
+)
+
+// Hours preview links work for when the request doesn't say
+const PREVIEW_HOURS = 24
+
+// HTML of the post content the way the site shows it, with the
+// shortcodes expanded and the errors of the ones that failed
+func renderPostContent(ctx context.Context, content string, shortcode_handlers plugins.ShortcodeHandlers) (string, []*plugins.PluginError) {
+	markdown, plugin_errors := plugins.ExpandShortcodes(ctx, content, shortcode_handlers)
+	return string(common.MdToHTML([]byte(markdown))), plugin_errors
+}
+
+// Renders the page of the public app, the layout takes the theme
+// and the menus of the site from the settings changed here
+func renderPublicPage(c *gin.Context, database database.Database, make_page func(common.Site) templ.Component) error {
+	site := c.MustGet(SITE_KEY).(common.Site)
+	values, err := database.GetSettings()
+	if err != nil {
+		return err
+	}
+	if len(values) > 0 {
+		site = site.WithSettings(values)
+	}
+	menus, err := database.GetMenus()
+	if err != nil {
+		return err
+	}
+	locations := make(map[string][]common.MenuItem)
+	for _, menu := range menus {
+		if menu.Location != "" {
+			locations[menu.Location] = common.VisibleMenuItems(menu.Items)
+		}
+	}
+
+	c.Set(views.THEME_KEY, site.Theme)
+	c.Set(views.MENUS_KEY, locations)
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	return make_page(site).Render(c, c.Writer)
+}
+
+// @Summary      Preview a post
+// @Description  Expands the shortcodes and renders the Markdown of the post, answering with the public post page.
+// @Tags         posts
+// @Accept       json
+// @Produce      html
+// @Security     BearerAuth
+// @Param        post body PreviewRequest true "Post to preview"
+// @Success      200 {string} string "HTML post page"
+// @Failure      400 {object} common.ErrorResponse "Invalid request body"
+// @Failure      422 {object} PluginErrorsResponse "Shortcodes failed"
+// @Failure      500 {object} common.ErrorResponse "Could not render the page"
+// @Router       /preview [post]
+func postPreviewPageHandler(database database.Database, shortcodes *shortcodeRegistry) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var preview_request PreviewRequest
+		if err := c.ShouldBindJSON(&preview_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		content, plugin_errors := renderPostContent(c.Request.Context(), preview_request.Content, shortcodes.Handlers())
+		if len(plugin_errors) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, PluginErrorsResponse{Msg: "shortcodes failed", Errors: plugin_errors})
+			return
+		}
+		err := renderPublicPage(c, database, func(site common.Site) templ.Component {
+			return views.MakePostPage(preview_request.Title, content, site.AppNavbar.Links, site.AppNavbar.Dropdowns)
+		})
+		if err != nil {
+			log.Error().Msgf("could not render preview page: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not render preview page", err))
+		}
+	}
+}
+
+// @Summary      Share a preview link
+// @Description  Stores the draft of a post and answers with the path of its preview on the public site.
+// @Description  The link works for `hours`, up to a week, without saving the post.
+// @Tags         posts
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        draft body AddPreviewRequest true "Draft to share"
+// @Success      201 {object} PreviewLinkResponse
+// @Failure      400 {object} common.ErrorResponse "Invalid request body"
+// @Failure      500 {object} common.ErrorResponse "Could not store the draft"
+// @Router       /previews [post]
+func postPreviewLinkHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var add_preview_request AddPreviewRequest
+		if err := c.ShouldBindJSON(&add_preview_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		hours := add_preview_request.Hours
+		if hours == 0 {
+			hours = PREVIEW_HOURS
+		}
+		preview := common.PostPreview{
+			Title:     add_preview_request.Title,
+			Excerpt:   add_preview_request.Excerpt,
+			Content:   add_preview_request.Content,
+			ExpiresAt: time.Now().UTC().Add(time.Duration(hours) * time.Hour).Truncate(time.Second),
+		}
+		uuid, err := database.AddPostPreview(preview)
+		if err != nil {
+			log.Error().Msgf("could not add post preview: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not add preview", err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, PreviewLinkResponse{
+			Uuid:      uuid,
+			Url:       fmt.Sprintf("/preview/%s", uuid),
+			ExpiresAt: preview.ExpiresAt,
+		})
+	}
+}
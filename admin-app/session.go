@@ -0,0 +1,150 @@
+package admin_app
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/utils/token"
+	admin_views "github.com/rbc33/gocms/views/admin"
+	"github.com/rs/zerolog/log"
+)
+
+// Cookie holding the JWT of the admin pages
+const SESSION_COOKIE = "gocms_session"
+
+// Context key of the CSRF token of the session
+const CSRF_KEY = "gocms_csrf"
+
+// The CSRF token is bound to the session, so there
+// is nothing to store between the requests
+func csrfToken(session string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("API_SECRET")))
+	mac.Write([]byte("csrf:" + session))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func setSessionCookie(c *gin.Context, session string, max_age int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(SESSION_COOKIE, session, max_age, "/ui", "", c.Request.TLS != nil, true)
+}
+
+// Sends the browser to the login page, htmx
+// requests are redirected by htmx itself
+func redirectToLogin(c *gin.Context) {
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Redirect", "/ui/login")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/ui/login")
+	c.Abort()
+}
+
+// Lets through the requests with a valid session cookie. The
+// rest of the middlewares and handlers read the session as a
+// bearer token, tokens in the query are not accepted.
+func sessionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, err := c.Cookie(SESSION_COOKIE)
+		if err != nil || session == "" {
+			redirectToLogin(c)
+			return
+		}
+
+		query := c.Request.URL.Query()
+		query.Del("token")
+		c.Request.URL.RawQuery = query.Encode()
+		c.Request.Header.Set("Authorization", "Bearer "+session)
+		if err = token.TokenValid(c); err != nil {
+			log.Warn().Msgf("invalid admin session: %v", err)
+			redirectToLogin(c)
+			return
+		}
+
+		c.Set(CSRF_KEY, csrfToken(session))
+		c.Next()
+	}
+}
+
+// Requests changing data must carry the CSRF token of the
+// session, in the header htmx sends or in a form field
+func csrfMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		sent := c.GetHeader(admin_views.CSRF_HEADER)
+		if sent == "" {
+			sent = c.PostForm(admin_views.CSRF_FIELD)
+		}
+		if !hmac.Equal([]byte(sent), []byte(c.GetString(CSRF_KEY))) {
+			c.AbortWithStatusJSON(http.StatusForbidden, common.MsgErrorRes("invalid CSRF token"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// @Summary      Login page
+// @Description  Form to log in to the admin pages.
+// @Tags         admin_ui
+// @Produce      html
+// @Success      200 {string} string "HTML page"
+// @Router       /ui/login [get]
+func getLoginPageHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		renderAdminHtml(c, http.StatusOK, admin_views.MakeLoginPage("", ""))
+	}
+}
+
+// @Summary      Log in to the admin pages
+// @Description  Checks the credentials and starts a session kept in a cookie, then redirects to the dashboard.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        username formData string true "Username"
+// @Param        password formData string true "Password"
+// @Success      303 {string} string "Redirect to the dashboard"
+// @Failure      401 {string} string "HTML login page with the error"
+// @Router       /ui/login [post]
+func postLoginHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		username := c.PostForm("username")
+		session, err := common.LoginCheck(username, c.PostForm("password"), database)
+		if err != nil {
+			log.Warn().Msgf("failed admin login of %s: %v", username, err)
+			renderAdminHtml(c, http.StatusUnauthorized, admin_views.MakeLoginPage(username, "username or password is incorrect."))
+			return
+		}
+
+		// The cookie lasts as long as the token
+		token_lifespan, _ := strconv.Atoi(os.Getenv("TOKEN_HOUR_LIFESPAN"))
+		setSessionCookie(c, session, token_lifespan*3600)
+		c.Redirect(http.StatusSeeOther, "/ui")
+	}
+}
+
+// @Summary      Log out of the admin pages
+// @Description  Removes the session cookie and redirects to the login page.
+// @Tags         admin_ui
+// @Accept       x-www-form-urlencoded
+// @Param        _csrf formData string true "CSRF token of the session"
+// @Success      303 {string} string "Redirect to the login page"
+// @Failure      403 {object} common.ErrorResponse "Invalid CSRF token"
+// @Router       /ui/logout [post]
+func postLogoutHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		setSessionCookie(c, "", -1)
+		c.Redirect(http.StatusSeeOther, "/ui/login")
+	}
+}
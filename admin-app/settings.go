@@ -0,0 +1,159 @@
+package admin_app
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+func makeSettingsResponse(site common.Site, values map[string]string) SettingsResponse {
+	settings := site.WithSettings(values).Settings()
+	for _, name := range common.WRITE_ONLY_SETTINGS {
+		delete(settings, name)
+	}
+
+	overridden := make([]string, 0, len(values))
+	for name := range values {
+		overridden = append(overridden, name)
+	}
+	slices.Sort(overridden)
+
+	return SettingsResponse{Settings: settings, Overridden: overridden}
+}
+
+// @Summary      Get the site settings
+// @Description  Returns the editable settings of the site, with the changes made from the admin-app.
+// @Tags         settings
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-GoCMS-Site header int false "Site ID, the host is used without it"
+// @Success      200 {object} SettingsResponse
+// @Failure      500 {object} common.ErrorResponse
+// @Router       /settings [get]
+func getSettingsHandler(database database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		values, err := database.GetSettings()
+		if err != nil {
+			log.Error().Msgf("could not get settings: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get settings", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, makeSettingsResponse(c.MustGet(SITE_KEY).(common.Site), values))
+	}
+}
+
+// @Summary      Get the settings schema
+// @Description  Returns the JSON schema of every editable setting.
+// @Tags         settings
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} map[string]any
+// @Router       /settings/schema [get]
+func getSettingsSchemaHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		schemas := make(map[string]json.RawMessage, len(common.EDITABLE_SETTINGS))
+		for name, schema := range common.EDITABLE_SETTINGS {
+			schemas[name] = json.RawMessage(schema)
+		}
+		c.JSON(http.StatusOK, schemas)
+	}
+}
+
+// @Summary      Change the site settings
+// @Description  Stores the given settings, which win over the config file. Every value is validated against its schema and nothing is stored if one is invalid.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-GoCMS-Site header int false "Site ID, the host is used without it"
+// @Param        settings body map[string]any true "New values by setting name"
+// @Success      200 {object} SettingsResponse
+// @Failure      400 {object} common.ErrorResponse "Unknown setting or invalid value"
+// @Failure      500 {object} common.ErrorResponse
+// @Router       /settings [put]
+func putSettingsHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		var settings_request map[string]json.RawMessage
+		if err := c.ShouldBindJSON(&settings_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+		if len(settings_request) == 0 {
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes("no settings given"))
+			return
+		}
+
+		values := make(map[string]string, len(settings_request))
+		for name, value := range settings_request {
+			if err := common.ValidateSetting(name, value); err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorRes("invalid setting", err))
+				return
+			}
+			values[name] = string(value)
+		}
+
+		if err := database.SetSettings(values); err != nil {
+			log.Error().Msgf("could not store settings: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not store settings", err))
+			return
+		}
+
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.SettingsCacheTag(site.Id))
+
+		stored_values, err := database.GetSettings()
+		if err != nil {
+			log.Error().Msgf("could not get settings: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get settings", err))
+			return
+		}
+		c.JSON(http.StatusOK, makeSettingsResponse(site, stored_values))
+	}
+}
+
+// @Summary      Reset a site setting
+// @Description  Drops the change made from the admin-app, the value of the config file is used again.
+// @Tags         settings
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-GoCMS-Site header int false "Site ID, the host is used without it"
+// @Param        name path string true "Setting name"
+// @Success      200 {object} SettingsResponse
+// @Failure      400 {object} common.ErrorResponse "Unknown setting"
+// @Failure      500 {object} common.ErrorResponse
+// @Router       /settings/{name} [delete]
+func deleteSettingHandler(database database.Database, invalidator CacheInvalidator) func(*gin.Context) {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		name := c.Param("name")
+		if _, exists := common.EDITABLE_SETTINGS[name]; !exists {
+			c.JSON(http.StatusBadRequest, common.MsgErrorRes("unknown setting "+name))
+			return
+		}
+
+		if err := database.DeleteSetting(name); err != nil {
+			log.Error().Msgf("could not delete setting %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not delete setting", err))
+			return
+		}
+
+		site := c.MustGet(SITE_KEY).(common.Site)
+		invalidateTags(invalidator, common.SettingsCacheTag(site.Id))
+
+		values, err := database.GetSettings()
+		if err != nil {
+			log.Error().Msgf("could not get settings: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get settings", err))
+			return
+		}
+		c.JSON(http.StatusOK, makeSettingsResponse(site, values))
+	}
+}
@@ -0,0 +1,132 @@
+package admin_app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rs/zerolog/log"
+)
+
+// Collects the shortcodes used by the content, the ones
+// of the config come first even when nothing uses them
+type shortcodeUsages struct {
+	usages []ShortcodeUsage
+}
+
+func makeShortcodeUsages(shortcodes []common.Shortcode) *shortcodeUsages {
+	usages := &shortcodeUsages{usages: []ShortcodeUsage{}}
+	for _, shortcode := range shortcodes {
+		usages.usages = append(usages.usages, ShortcodeUsage{Name: shortcode.Name, Plugin: shortcode.Plugin, Content: []ShortcodeContent{}})
+	}
+	return usages
+}
+
+func (usages *shortcodeUsages) add(text string, content ShortcodeContent) {
+	for _, name := range plugins.FindShortcodes(text) {
+		i := 0
+		for i < len(usages.usages) && usages.usages[i].Name != name {
+			i++
+		}
+		if i == len(usages.usages) {
+			usages.usages = append(usages.usages, ShortcodeUsage{Name: name, Content: []ShortcodeContent{}})
+		}
+		// Pages and cards can use it in several places
+		found := usages.usages[i].Content
+		if len(found) == 0 || found[len(found)-1] != content {
+			usages.usages[i].Content = append(found, content)
+		}
+	}
+}
+
+// Text values of the card data, nested ones included
+func cardTexts(value any) []string {
+	texts := []string{}
+	switch typed := value.(type) {
+	case string:
+		texts = append(texts, typed)
+	case map[string]any:
+		for _, item := range typed {
+			texts = append(texts, cardTexts(item)...)
+		}
+	case []any:
+		for _, item := range typed {
+			texts = append(texts, cardTexts(item)...)
+		}
+	}
+	return texts
+}
+
+// @Summary      Get the shortcode usage
+// @Description  Lists the shortcodes of the config and the ones found in the content, with the posts,
+// @Description  pages and cards using each of them. Shortcodes are expanded when the content is shown.
+// @Tags         shortcodes
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} GetShortcodesResponse
+// @Failure      500 {object} common.ErrorResponse "Could not read the content"
+// @Router       /shortcodes [get]
+func getShortcodesHandler(database database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		database := siteDatabase(c, database)
+		usages := makeShortcodeUsages(common.CurrentSettings().Shortcodes)
+
+		posts, err := database.GetPostsContent(0, 0)
+		if err != nil {
+			log.Error().Msgf("could not get posts: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get posts", err))
+			return
+		}
+		for _, post := range posts {
+			usages.add(post.Content, ShortcodeContent{Type: "post", Id: strconv.Itoa(post.Id), Title: post.Title})
+		}
+
+		pages, err := database.GetPages(0, 0)
+		if err != nil {
+			log.Error().Msgf("could not get pages: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get pages", err))
+			return
+		}
+		for _, page := range pages {
+			page_content := ShortcodeContent{Type: "page", Id: page.Link, Title: page.Title}
+			usages.add(page.Content, page_content)
+			for _, block := range page.Blocks {
+				var markdown common.MarkdownBlock
+				if block.Type == common.BLOCK_MARKDOWN && json.Unmarshal(block.Data, &markdown) == nil {
+					usages.add(markdown.Content, page_content)
+				}
+			}
+		}
+
+		schemas, err := database.GetCardSchemas(0, 0)
+		if err != nil {
+			log.Error().Msgf("could not get card schemas: %v", err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get card schemas", err))
+			return
+		}
+		for _, schema := range schemas {
+			cards, _, err := database.GetCards(schema.Uuid, common.CardQuery{})
+			if err != nil {
+				log.Error().Msgf("could not get cards of schema %s: %v", schema.Uuid, err)
+				c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get cards", err))
+				return
+			}
+			for _, card := range cards {
+				var card_data any
+				if err := json.Unmarshal([]byte(card.Content), &card_data); err != nil {
+					log.Warn().Msgf("could not parse card %s: %v", card.Id, err)
+					continue
+				}
+				for _, text := range cardTexts(card_data) {
+					usages.add(text, ShortcodeContent{Type: "card", Id: card.Id, Title: schema.Title})
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, GetShortcodesResponse{Shortcodes: usages.usages})
+	}
+}
@@ -0,0 +1,160 @@
+package admin_app
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/rs/zerolog/log"
+)
+
+// Context key of the site managed by the request
+const SITE_KEY = "gocms_site"
+
+// The site named by the `X-GoCMS-Site` header,
+// or the site of the host without it
+func requestSite(c *gin.Context) (common.Site, error) {
+	site_header := c.GetHeader(common.SITE_HEADER)
+	if site_header == "" {
+		return common.CurrentSettings().SiteForHost(c.Request.Host), nil
+	}
+
+	site_id, err := strconv.Atoi(site_header)
+	if err != nil {
+		return common.Site{}, fmt.Errorf("invalid site id `%s`", site_header)
+	}
+	site, exists := common.CurrentSettings().SiteById(site_id)
+	if !exists {
+		return common.Site{}, fmt.Errorf("site %d does not exist", site_id)
+	}
+	return site, nil
+}
+
+// Only lets through users granted access to the site
+// of the request, must run after the JWT middleware
+func requireSiteAccess(db database.Database) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		site, err := requestSite(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, common.ErrorRes("invalid site", err))
+			return
+		}
+
+		user_id, err := token.ExtractTokenID(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, common.ErrorRes("invalid token", err))
+			return
+		}
+
+		site_ids, err := db.GetUserSites(user_id)
+		if err != nil {
+			log.Error().Msgf("could not get sites of user %d: %v", user_id, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, common.ErrorRes("could not get user sites", err))
+			return
+		}
+		if !slices.Contains(site_ids, site.Id) {
+			c.AbortWithStatusJSON(http.StatusForbidden, common.MsgErrorRes(fmt.Sprintf("no access to site %d", site.Id)))
+			return
+		}
+
+		c.Set(SITE_KEY, site)
+		// Content read by the plugins of previews and hooks
+		c.Request = c.Request.WithContext(plugins.WithContentSource(c.Request.Context(), &plugins.ContentSource{
+			Database: db.ForSite(site.Id),
+			Site:     site,
+		}))
+		c.Next()
+	}
+}
+
+func requestSiteId(c *gin.Context) int {
+	if site, exists := c.Get(SITE_KEY); exists {
+		return site.(common.Site).Id
+	}
+	return common.DEFAULT_SITE_ID
+}
+
+// Database limited to the content of the request site
+func siteDatabase(c *gin.Context, db database.Database) database.Database {
+	return db.ForSite(requestSiteId(c))
+}
+
+// Media directory of the request site
+func siteImageDirectory(c *gin.Context) string {
+	return common.SiteImageDirectory(requestSiteId(c))
+}
+
+// @Summary      Get the sites of the user
+// @Description  Lists the sites the current user can manage.
+// @Tags         site
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} GetSitesResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Router       /sites [get]
+func getSitesHandler(db database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		user_id, err := token.ExtractTokenID(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid token", err))
+			return
+		}
+
+		site_ids, err := db.GetUserSites(user_id)
+		if err != nil {
+			log.Error().Msgf("could not get sites of user %d: %v", user_id, err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not get user sites", err))
+			return
+		}
+
+		sites := []SiteResponse{}
+		for _, site := range common.CurrentSettings().AllSites() {
+			if slices.Contains(site_ids, site.Id) {
+				sites = append(sites, SiteResponse{Id: site.Id, Name: site.Name, Hosts: site.Hosts})
+			}
+		}
+		c.JSON(http.StatusOK, GetSitesResponse{Sites: sites})
+	}
+}
+
+// @Summary      Grant access to the site
+// @Description  Lets another user manage the site of the request.
+// @Tags         site
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        X-GoCMS-Site header int false "Site ID, the host is used without it"
+// @Param        grant body GrantSiteRequest true "User to grant access to"
+// @Success      200 {object} SiteResponse
+// @Failure      400 {object} common.ErrorResponse
+// @Failure      403 {object} common.ErrorResponse
+// @Router       /sites/users [post]
+func postSiteUserHandler(db database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		var grant_request GrantSiteRequest
+		if err := c.ShouldBindJSON(&grant_request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		if _, err := db.GetUserById(grant_request.UserId); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not find user", err))
+			return
+		}
+
+		site := c.MustGet(SITE_KEY).(common.Site)
+		if err := db.AddUserSite(grant_request.UserId, site.Id); err != nil {
+			log.Error().Msgf("could not grant site %d to user %d: %v", site.Id, grant_request.UserId, err)
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not grant site access", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, SiteResponse{Id: site.Id, Name: site.Name, Hosts: site.Hosts})
+	}
+}
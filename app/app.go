@@ -2,25 +2,42 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rbc33/gocms/common"
 	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
 	"github.com/rbc33/gocms/views"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
 )
 
 const CACHE_TIMEOUT = 20 * time.Second
 
+// Posts and pages shown in each listing page
+const ITEMS_PER_PAGE = 10
+
+// Context key where generators leave the tags
+// for the page they just rendered
+const CACHE_TAGS_KEY = "gocms_cache_tags"
+
 type Generator = func(*gin.Context, database.Database) ([]byte, error)
 
 // func permalinkPostHandler(c *gin.Context, app_settings common.AppSettings, db database.Database) ([]byte, error) {
-func permalinkPostHandler(post_id int) func(*gin.Context, database.Database) ([]byte, error) {
+// Sites can use the same permalink for different posts,
+// `post_ids` maps each site id to its post
+func permalinkPostHandler(post_ids map[int]int) func(*gin.Context, database.Database) ([]byte, error) {
 	return func(c *gin.Context, database database.Database) ([]byte, error) {
+		post_id, exists := post_ids[currentSite(c).Id]
+		if !exists {
+			return renderHtml(c, views.MakeNotFoundPage(currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
+		}
 		c.Params = append(c.Params, gin.Param{Key: "id", Value: fmt.Sprintf("%d", post_id)})
 		return postHandler(c, database)
 	}
@@ -31,67 +48,215 @@ func SetupRoutes(settings common.AppSettings, database database.Database) *gin.E
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 	r.MaxMultipartMemory = 1
+	site_settings := makeSiteSettingsStore()
+	r.Use(siteMiddleware(database, site_settings))
 
 	// Contact form related endpoints
 	r.POST("/contact-send", makeContactFormHandler())
 	r.POST("/webhook", makeWebHookHandler())
 
-	// All cache endpoints
-	cache := MakeCache(4, time.Minute*10, &TimeValidator{})
-	addCacheHandler(r, "GET", "/", homeHandler, &cache, database)
-	addCacheHandler(r, "GET", "/contact", contactHandler, &cache, database)
-	addCacheHandler(r, "GET", "/about", aboutHandler, &cache, database)
-	addCacheHandler(r, "GET", "/services", servicesHandler, &cache, database)
-	addCacheHandler(r, "GET", "/post/:id", postHandler, &cache, database)
-	addCacheHandler(r, "GET", "/products/:schema", productHandler, &cache, database)
-	addCacheHandler(r, "GET", "/products/", getSchemasHandler, &cache, database)
-	addCacheHandler(r, "GET", "/images/:name", imageHandler, &cache, database)
-	addCacheHandler(r, "GET", "/images", imagesHandler, &cache, database)
-	addCacheHandler(r, "GET", "/gallery/:name", galleryHandler, &cache, database)
-
-	// Pages will be querying the page content from the unique
-	// link given at the creation of the page step
-	addCacheHandler(r, "GET", "/pages", getPagesHandler, &cache, database)
-	addCacheHandler(r, "GET", "/pages/:num", getPagesHandler, &cache, database)
-	addCacheHandler(r, "GET", "/page/:link", pageHandler, &cache, database)
-
-	// Add the pagination route as a cacheable endpoint
-	addCacheHandler(r, "GET", "/posts/:num", homeHandler, &cache, database)
+	// Drafts shared by time-limited links
+	r.GET("/preview/:id", makePreviewHandler(database))
 
-	// Where all the static files (css, js, etc) are served from
+	// GeoJSON of the geotagged images used by the maps
+	r.GET("/api/images/geo", makeGeoImagesHandler())
 
-	r.Static("/images/data", settings.ImageDirectory)
-	r.Static("/static", "./static")
-	r.StaticFS("/media", http.Dir(settings.ImageDirectory))
-	permalinks, err := database.GetPermalinks()
-	if err != nil {
-		log.Error().Msgf("could not get permalinks: %v", err)
-	} else {
-		for _, permalink := range permalinks {
-			addCacheHandler(r, "GET", permalink.Path, permalinkPostHandler(permalink.PostId), &cache, database)
+	// All cache endpoints
+	cache_size_mb := settings.CacheMaxSizeMB
+	if cache_size_mb <= 0 {
+		cache_size_mb = MAX_CACHE_SIZE_MB
+	}
+	timed_cache := MakeSizedCache(4, time.Minute*10, uint64(cache_size_mb)*1000000, &TimeValidator{})
+	stale_seconds := settings.CacheStaleSeconds
+	if stale_seconds == 0 {
+		stale_seconds = CACHE_STALE_SECONDS
+	}
+	timed_cache.SetStaleWindow(time.Duration(max(stale_seconds, 0)) * time.Second)
+	go timed_cache.SweepEvery(time.Minute)
+	cache := makeConfiguredCache(settings, timed_cache)
+	// Pages may show anything from the old config
+	if err := app_hooks.Reload(settings.Plugins); err != nil {
+		log.Error().Msgf("could not load plugins: %v", err)
+	}
+	common.OnSettingsReload(func(previous *common.AppSettings, settings *common.AppSettings) {
+		shortcode_renderer.Reset()
+		if err := app_hooks.Reload(settings.Plugins); err != nil {
+			log.Error().Msgf("could not reload plugins, keeping the previous ones: %v", err)
 		}
+		cache.Purge()
+	})
+
+	// Lets the admin-app purge pages after content changes
+	r.POST("/cache/invalidate", requireCacheSecret(), makeCacheInvalidationHandler(&cache, site_settings))
+	r.GET("/cache/metrics", requireCacheSecret(), makeCacheMetricsHandler(&cache))
+	for _, route := range pageRoutes(database) {
+		addCacheHandler(r, "GET", route.Path, route.Generator, &cache, database)
 	}
 
+	// Where all the static files (css, js, etc) are served from
+	r.GET("/images/data/*filepath", mediaFileHandler())
+	r.HEAD("/images/data/*filepath", mediaFileHandler())
+	r.Static("/static", "./static")
+	r.GET("/media/*filepath", mediaFileHandler())
+	r.HEAD("/media/*filepath", mediaFileHandler())
+
 	r.NoRoute(notFoundHandler())
 
 	return r
 }
 
+// A page rendered by a generator, these are served through
+// the cache and written out by ExportSite
+type pageRoute struct {
+	Path      string
+	Generator Generator
+}
+
+func pageRoutes(database database.Database) []pageRoute {
+	routes := []pageRoute{
+		{"/", homeHandler},
+		{"/contact", contactHandler},
+		{"/about", aboutHandler},
+		{"/services", servicesHandler},
+		{"/post/:id", postHandler},
+		{"/products/:schema", productHandler},
+		{"/products/", getSchemasHandler},
+		{"/images/:name", imageHandler},
+		{"/images", imagesHandler},
+		{"/gallery/:name", galleryHandler},
+		{"/gallery/:name/map", galleryMapHandler},
+		{"/map", mapHandler},
+
+		// Pages will be querying the page content from the
+		// links given at the creation of the page step, nested
+		// pages have the links of their parents in front
+		{"/pages", getPagesHandler},
+		{"/pages/:num", getPagesHandler},
+		{"/page/*path", pageHandler},
+
+		// Add the pagination route as a cacheable endpoint
+		{"/posts/:num", homeHandler},
+	}
+
+	// Gin only takes each path once, so the permalinks
+	// of all the sites share the routes
+	permalink_paths := []string{}
+	permalink_posts := make(map[string]map[int]int)
+	for _, site := range common.CurrentSettings().AllSites() {
+		permalinks, err := database.ForSite(site.Id).GetPermalinks()
+		if err != nil {
+			log.Error().Msgf("could not get permalinks of site %d: %v", site.Id, err)
+			continue
+		}
+		for _, permalink := range permalinks {
+			if _, exists := permalink_posts[permalink.Path]; !exists {
+				permalink_paths = append(permalink_paths, permalink.Path)
+				permalink_posts[permalink.Path] = make(map[int]int)
+			}
+			permalink_posts[permalink.Path][site.Id] = permalink.PostId
+		}
+	}
+	for _, path := range permalink_paths {
+		routes = append(routes, pageRoute{path, permalinkPostHandler(permalink_posts[path])})
+	}
+	return routes
+}
+
 func addCacheHandler(e *gin.Engine, method string, endpoint string, generator Generator, cache *Cache, db database.Database) {
+	// Concurrent requests for the same uncached page
+	// wait for a single generator call
+	var renders singleflight.Group
+	// Keys of the stale pages being regenerated
+	var refreshing sync.Map
+
+	// Pages the generator answered itself, like redirects and
+	// error pages, are not stored or shared. Neither are pages
+	// rendered without a shortcode that failed.
+	generate := func(c *gin.Context, cache_key string) (endpoint_cache EndpointCache, shared bool, err error) {
+		tagCacheEntry(c, common.SettingsCacheTag(currentSite(c).Id), common.MenusCacheTag(currentSite(c).Id))
+		ctx, shortcodes_failed := plugins.TrackShortcodeFailures(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		html_buffer, err := generator(c, siteDatabase(c, db))
+		if err != nil || c.Writer.Written() {
+			return EndpointCache{}, false, err
+		}
+
+		endpoint_cache = makeEndpointCache(cache_key, html_buffer)
+		if *shortcodes_failed {
+			log.Warn().Msgf("not caching %s, shortcodes failed", c.Request.RequestURI)
+			return endpoint_cache, false, nil
+		}
+
+		// After handler  (add to cache)
+		if common.CurrentSettings().CacheEnabled {
+			endpoint_cache.Variants = compressVariants(html_buffer)
+			err = (*cache).StoreEntry(endpoint_cache, c.GetStringSlice(CACHE_TAGS_KEY))
+			if err != nil {
+				log.Warn().Msgf("could not add page to cache: %v", err)
+			}
+		}
+		return endpoint_cache, true, nil
+	}
+
+	// Only stored pages are shared, the requests that waited
+	// for anything else call the generator themselves to get
+	// their own status and headers
+	render := func(c *gin.Context) (EndpointCache, error) {
+		cache_key := siteCacheKey(c)
+		leader := false
+		var endpoint_cache EndpointCache
+		var err error
+		value, _, _ := renders.Do(cache_key, func() (any, error) {
+			leader = true
+			var shared bool
+			endpoint_cache, shared, err = generate(c, cache_key)
+			if !shared {
+				return nil, nil
+			}
+			return endpoint_cache, nil
+		})
+		if leader {
+			return endpoint_cache, err
+		}
+		if value == nil {
+			endpoint_cache, _, err = generate(c, cache_key)
+			return endpoint_cache, err
+		}
+		return value.(EndpointCache), nil
+	}
 
 	handler := func(c *gin.Context) {
 		// if the endpoint is cached
-		if common.Settings.CacheEnabled {
-			cached_endpoint, err := (*cache).Get(c.Request.RequestURI)
+		if common.CurrentSettings().CacheEnabled && !isRefreshRequest(c.Request) {
+			cache_key := siteCacheKey(c)
+			cached_endpoint, fresh, err := (*cache).GetStale(cache_key)
 			if err == nil {
+				// Serve the expired page while it's regenerated,
+				// once at a time for each page
+				if !fresh {
+					if _, running := refreshing.LoadOrStore(cache_key, true); !running {
+						refresh_request := makeRefreshRequest(c.Request)
+						go func() {
+							defer refreshing.Delete(cache_key)
+							e.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, refresh_request)
+						}()
+					}
+				}
 				log.Info().Msgf("cache hit for page: %s", c.Request.RequestURI)
-				c.Data(http.StatusOK, "text/html; charset=utf-8", cached_endpoint.Contents)
+				writeEndpoint(c, endpoint, &cached_endpoint)
 				return
 			}
 		}
 
 		// Before handler call (retrieve from cache)
-		html_buffer, err := generator(c, db)
+		endpoint_cache, err := render(c)
+		// Generators may have answered already, e.g. with a redirect
+		if c.Writer.Written() {
+			if err != nil {
+				log.Warn().Msgf("page answered by the generator: %v", err)
+			}
+			return
+		}
 		if err != nil {
 			log.Error().Msgf("could not generate html: %v", err)
 			// TODO : Need a proper error page
@@ -99,14 +264,7 @@ func addCacheHandler(e *gin.Engine, method string, endpoint string, generator Ge
 			return
 		}
 
-		// After handler  (add to cache)
-		if common.Settings.CacheEnabled {
-			err = (*cache).Store(c.Request.RequestURI, html_buffer)
-			if err != nil {
-				log.Warn().Msgf("could not add page to cache: %v", err)
-			}
-		}
-		c.Data(http.StatusOK, "text/html; charset=utf-8", html_buffer)
+		writeEndpoint(c, endpoint, &endpoint_cache)
 	}
 
 	// Hacky
@@ -124,6 +282,44 @@ func addCacheHandler(e *gin.Engine, method string, endpoint string, generator Ge
 	}
 }
 
+type refreshRequestKey struct{}
+
+// Response of the background refreshes, nobody reads it
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (writer *discardResponseWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer *discardResponseWriter) Write(buffer []byte) (int, error) {
+	return len(buffer), nil
+}
+
+func (writer *discardResponseWriter) WriteHeader(status int) {}
+
+func isRefreshRequest(request *http.Request) bool {
+	return request.Context().Value(refreshRequestKey{}) != nil
+}
+
+// The request replayed through the router to regenerate
+// a stale page. The original request context is not used
+// as it's done as soon as the stale page is served.
+func makeRefreshRequest(request *http.Request) *http.Request {
+	refresh_context := context.WithValue(context.Background(), refreshRequestKey{}, true)
+	refresh_request := request.Clone(refresh_context)
+	refresh_request.Header.Del("If-None-Match")
+	refresh_request.Header.Del("If-Modified-Since")
+	return refresh_request
+}
+
+// Generators call this to tag the page they are rendering,
+// so the cached page is purged when the tagged content changes
+func tagCacheEntry(c *gin.Context, tags ...string) {
+	c.Set(CACHE_TAGS_KEY, append(c.GetStringSlice(CACHE_TAGS_KEY), tags...))
+}
+
 // This function will act as the handler for
 // the home page
 func homeHandler(c *gin.Context, db database.Database) ([]byte, error) {
@@ -136,7 +332,7 @@ func homeHandler(c *gin.Context, db database.Database) ([]byte, error) {
 			log.Error().Msgf("Invalid page number: %s", pageNumQuery)
 		}
 	}
-	limit := 10 // or whatever limit you want
+	limit := ITEMS_PER_PAGE
 	offset := max((pageNum-1)*limit, 0)
 
 	posts, err := db.GetPosts(limit, offset)
@@ -144,19 +340,22 @@ func homeHandler(c *gin.Context, db database.Database) ([]byte, error) {
 		log.Error().Msgf("Failed to load posts: %v", err)
 		return []byte("error: Failed to load posts"), err
 	}
+	tagCacheEntry(c, common.CACHE_TAG_POSTS)
+
 	sticky_posts := make([]common.Post, 0)
-	for _, sticky_post_id := range common.Settings.StickyPosts {
+	for _, sticky_post_id := range currentSite(c).StickyPosts {
+		tagCacheEntry(c, common.PostCacheTag(sticky_post_id))
 		post, err := db.GetPost(sticky_post_id)
 		if err != nil {
 			log.Error().Msgf("could not find sticky post `%d`: %v", sticky_post_id, err)
 			continue
 		}
-		post.Content = string(mdToHTML([]byte(post.Content)))
+		post.Content = renderMarkdown(c.Request.Context(), post.Content)
 		sticky_posts = append(sticky_posts, post)
 	}
 
 	// if not cached, create the cache
-	index_view := views.MakeIndex(posts, sticky_posts, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	index_view := views.MakeIndex(posts, sticky_posts, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
 	// if not cached, create the cache
 	html_buffer := bytes.NewBuffer(nil)
 	err = index_view.Render(c, html_buffer)
@@ -171,7 +370,7 @@ func homeHandler(c *gin.Context, db database.Database) ([]byte, error) {
 
 func notFoundHandler() func(*gin.Context) {
 	handler := func(c *gin.Context) {
-		buffer, err := renderHtml(c, views.MakeNotFoundPage(common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns))
+		buffer, err := renderHtml(c, views.MakeNotFoundPage(currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not render HTML", err))
 			return
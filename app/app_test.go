@@ -0,0 +1,387 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheHandlerCoalescesMisses(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheEnabled = true })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	cache := MakeCache(1, time.Minute, &TimeValidator{})
+
+	generated := atomic.Int32{}
+	started := make(chan bool)
+	release := make(chan bool)
+	addCacheHandler(r, "GET", "/", func(c *gin.Context, db database.Database) ([]byte, error) {
+		if generated.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("home"), nil
+	}, &cache, mocks.DatabaseMock{})
+
+	var requests sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 10)
+	for i := range responses {
+		responses[i] = httptest.NewRecorder()
+		requests.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer requests.Done()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		}(responses[i])
+
+		// The rest arrive while the first is rendering
+		if i == 0 {
+			<-started
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	requests.Wait()
+
+	assert.Equal(t, int32(1), generated.Load())
+	for _, w := range responses {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "home", w.Body.String())
+	}
+}
+
+func TestCacheHandlerServesStale(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheEnabled = true })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	refreshed := make(chan bool)
+	r.Use(func(c *gin.Context) {
+		c.Next()
+		if isRefreshRequest(c.Request) {
+			close(refreshed)
+		}
+	})
+	timed_cache := MakeSizedCache(1, 50*time.Millisecond, 1000, &TimeValidator{})
+	timed_cache.SetStaleWindow(time.Minute)
+	var cache Cache = timed_cache
+
+	version := atomic.Value{}
+	version.Store("v1")
+	addCacheHandler(r, "GET", "/", func(c *gin.Context, db database.Database) ([]byte, error) {
+		return []byte(version.Load().(string)), nil
+	}, &cache, mocks.DatabaseMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "v1", w.Body.String())
+
+	time.Sleep(60 * time.Millisecond)
+	version.Store("v2")
+
+	// The stale page is served while it's regenerated
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "v1", w.Body.String())
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("the stale page was not refreshed")
+	}
+
+	entry, fresh, err := cache.GetStale("/")
+	assert.Nil(t, err)
+	assert.True(t, fresh)
+	assert.Equal(t, "v2", string(entry.Contents))
+}
+
+func TestCacheHandlerFollowersGetRedirects(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheEnabled = true })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var cache Cache = MakeCache(1, time.Minute, &TimeValidator{})
+
+	generated := atomic.Int32{}
+	started := make(chan bool)
+	release := make(chan bool)
+	addCacheHandler(r, "GET", "/old", func(c *gin.Context, db database.Database) ([]byte, error) {
+		if generated.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		c.Redirect(http.StatusMovedPermanently, "/new")
+		return nil, fmt.Errorf("page moved")
+	}, &cache, mocks.DatabaseMock{})
+
+	var requests sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 5)
+	for i := range responses {
+		responses[i] = httptest.NewRecorder()
+		requests.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer requests.Done()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/old", nil))
+		}(responses[i])
+		if i == 0 {
+			<-started
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	requests.Wait()
+
+	// Every request gets its own redirect, none is stored
+	for _, w := range responses {
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/new", w.Header().Get("Location"))
+	}
+	_, err := cache.Get("/old")
+	assert.NotNil(t, err)
+}
+
+func TestCacheHandlerRefreshesStaleOnce(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheEnabled = true })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	timed_cache := MakeSizedCache(1, 50*time.Millisecond, 1000, &TimeValidator{})
+	timed_cache.SetStaleWindow(time.Minute)
+	var cache Cache = timed_cache
+
+	generated := atomic.Int32{}
+	release := make(chan bool)
+	addCacheHandler(r, "GET", "/", func(c *gin.Context, db database.Database) ([]byte, error) {
+		if generated.Add(1) > 1 {
+			<-release
+		}
+		return []byte("home"), nil
+	}, &cache, mocks.DatabaseMock{})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	time.Sleep(60 * time.Millisecond)
+
+	// The stale hits while the page is regenerated start no other refresh
+	for range 5 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assert.Equal(t, "home", w.Body.String())
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), generated.Load())
+	close(release)
+}
+
+func TestCacheHandlerSeparatesSites(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.CacheEnabled = true
+		settings.Sites = []common.Site{{Id: 2, Name: "blog", Hosts: []string{"blog.example.com"}}}
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(siteMiddleware(mocks.DatabaseMock{}, makeSiteSettingsStore()))
+	var cache Cache = MakeCache(1, time.Minute, &TimeValidator{})
+
+	addCacheHandler(r, "GET", "/about", func(c *gin.Context, db database.Database) ([]byte, error) {
+		return []byte(currentSite(c).Name), nil
+	}, &cache, mocks.DatabaseMock{})
+
+	for _, host := range []string{"example.com", "blog.example.com:8080"} {
+		request := httptest.NewRequest("GET", "/about", nil)
+		request.Host = host
+		r.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	entry, err := cache.Get("/about")
+	assert.Nil(t, err)
+	assert.Equal(t, "", string(entry.Contents))
+	entry, err = cache.Get("@2/about")
+	assert.Nil(t, err)
+	assert.Equal(t, "blog", string(entry.Contents))
+
+	// Path invalidations reach every site
+	assert.Equal(t, 2, cache.InvalidateTag(common.PathCacheTag("/about")))
+}
+
+func TestMediaIsServedPerSite(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.ImageDirectory = image_directory
+		settings.Sites = []common.Site{{Id: 2, Name: "blog", Hosts: []string{"blog.example.com"}}}
+	})
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "sky.png"), []byte("sky"), 0644))
+	require.Nil(t, os.MkdirAll(common.SiteImageDirectory(2), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(common.SiteImageDirectory(2), "moon.png"), []byte("moon"), 0644))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(siteMiddleware(mocks.DatabaseMock{}, makeSiteSettingsStore()))
+	r.GET("/images/data/*filepath", mediaFileHandler())
+	request := func(host string, path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Host = host
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+
+	w := request("example.com", "/images/data/sky.png")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "sky", w.Body.String())
+	w = request("blog.example.com", "/images/data/moon.png")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "moon", w.Body.String())
+
+	// Neither site reaches the media of the other
+	assert.Equal(t, http.StatusNotFound, request("blog.example.com", "/images/data/sky.png").Code)
+	assert.Equal(t, http.StatusNotFound, request("example.com", "/images/data/moon.png").Code)
+	assert.Equal(t, http.StatusNotFound, request("example.com", "/images/data/sites/2/moon.png").Code)
+	assert.Equal(t, http.StatusNotFound, request("example.com", "/images/data/sites/").Code)
+}
+
+func TestHeaderMenuReplacesNavbar(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.AppNavbar = common.Navbar{Links: []common.Link{{Name: "Config link", Href: "/config"}}}
+	})
+
+	menus := []common.Menu{{Id: 1, Name: "Main", Location: common.MENU_LOCATION_HEADER, Items: []common.MenuItem{
+		{Id: 1, Type: common.MENU_ITEM_PAGE, Visible: true, Text: "About us", Href: "/page/about-us", Children: []common.MenuItem{
+			{Id: 2, ParentId: 1, Type: common.MENU_ITEM_URL, Visible: true, Text: "Team", Href: "/page/team"},
+			{Id: 3, ParentId: 1, Type: common.MENU_ITEM_URL, Visible: false, Text: "Hidden", Href: "/hidden"},
+		}},
+		// Linked to a deleted post
+		{Id: 4, Type: common.MENU_ITEM_POST, Visible: true, Text: "Gone"},
+	}}}
+	render := func(database database.Database) string {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(siteMiddleware(database, makeSiteSettingsStore()))
+		r.GET("/about", func(c *gin.Context) {
+			html, err := aboutHandler(c, database)
+			require.Nil(t, err)
+			c.Data(http.StatusOK, "text/html", html)
+		})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/about", nil))
+		return w.Body.String()
+	}
+
+	html := render(mocks.DatabaseMock{GetMenusHandler: func() ([]common.Menu, error) { return menus, nil }})
+	assert.Contains(t, html, `href="/page/about-us"`)
+	assert.Contains(t, html, `href="/page/team"`)
+	assert.NotContains(t, html, "Hidden")
+	assert.NotContains(t, html, "Gone")
+	assert.NotContains(t, html, "Config link")
+
+	// Sites without a header menu keep the navbar of the config
+	html = render(mocks.DatabaseMock{})
+	assert.Contains(t, html, "Config link")
+}
+
+func TestNestedPages(t *testing.T) {
+	tree := []common.Page{
+		{Id: 1, Title: "Docs", Link: "docs", Path: "docs"},
+		{Id: 2, Title: "Install", Link: "install", ParentId: 1, Path: "docs/install"},
+		{Id: 3, Title: "Linux", Link: "linux", ParentId: 2, Position: 1, Path: "docs/install/linux"},
+		{Id: 4, Title: "Windows", Link: "windows", ParentId: 2, Position: 0, Path: "docs/install/windows"},
+		// Same link under another parent
+		{Id: 5, Title: "Blog", Link: "blog", Path: "blog"},
+		{Id: 6, Title: "Blog install", Link: "install", ParentId: 5, Path: "blog/install"},
+	}
+	database := mocks.DatabaseMock{
+		GetPageTreeHandler: func() ([]common.Page, error) {
+			return tree, nil
+		},
+		GetPageHandler: func(link string) (common.Page, error) {
+			for _, page := range tree {
+				if page.Link == link {
+					return page, nil
+				}
+			}
+			return common.Page{}, fmt.Errorf("page not found")
+		},
+		GetPageByIdHandler: func(id int) (common.Page, error) {
+			for _, page := range tree {
+				if page.Id == id {
+					page.Content = "# " + page.Title
+					return page, nil
+				}
+			}
+			return common.Page{}, fmt.Errorf("page not found")
+		},
+		GetPageRedirectHandler: func(link string) (int, error) {
+			if link == "setup" {
+				return 2, nil
+			}
+			return 0, fmt.Errorf("redirect not found")
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	cache := MakeCache(1, time.Minute, &TimeValidator{})
+	addCacheHandler(r, "GET", "/page/*path", pageHandler, &cache, database)
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := request("/page/docs/install")
+	require.Equal(t, http.StatusOK, w.Code)
+	html := w.Body.String()
+	assert.Contains(t, html, `<a class="hover:underline dark:text-blue-400" href="/page/docs">Docs</a>`)
+	assert.Contains(t, html, `<span aria-current="page" class="font-semibold text-gray-900 dark:text-white">Install</span>`)
+	// Children are sorted by position
+	windows := strings.Index(html, `href="/page/docs/install/windows"`)
+	linux := strings.Index(html, `href="/page/docs/install/linux"`)
+	assert.True(t, windows >= 0 && linux > windows)
+
+	// Moved pages are found by their link
+	w = request("/page/install")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/page/docs/install", w.Header().Get("Location"))
+
+	// Renamed pages are found by their old link
+	w = request("/page/docs/setup/")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/page/docs/install", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, request("/page/docs/missing").Code)
+
+	// Each page is found at its own path
+	w = request("/page/blog/install")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Blog install")
+
+	// Other paths ending with its link lead to the page
+	w = request("/page/blog/install/linux")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/page/docs/install/linux", w.Header().Get("Location"))
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/a-h/templ"
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/views"
+	"github.com/rs/zerolog/log"
+)
+
+// Cards shown by a cards block without a limit
+const BLOCK_CARDS_LIMIT = 10
+
+// Turns the blocks of a page into components, loading the
+// content each one shows. Blocks that can't be rendered are
+// left out so one broken block doesn't take the page down.
+func renderBlocks(c *gin.Context, db database.Database, blocks []common.Block) ([]templ.Component, []string) {
+	components := []templ.Component{}
+	scripts := []string{}
+	for i, block := range blocks {
+		component, script, err := renderBlock(c, db, block)
+		if err != nil {
+			log.Error().Msgf("could not render %s block %d: %v", block.Type, i, err)
+			continue
+		}
+		components = append(components, component)
+		if script != "" && !slices.Contains(scripts, script) {
+			scripts = append(scripts, script)
+		}
+	}
+	return components, scripts
+}
+
+// The component of the block and the script it needs, if any
+func renderBlock(c *gin.Context, db database.Database, block common.Block) (templ.Component, string, error) {
+	switch block.Type {
+	case common.BLOCK_MARKDOWN:
+		var markdown common.MarkdownBlock
+		if err := json.Unmarshal(block.Data, &markdown); err != nil {
+			return nil, "", err
+		}
+		return views.MakeMarkdownBlock(renderMarkdown(c.Request.Context(), markdown.Content)), "", nil
+	case common.BLOCK_HERO:
+		var hero common.HeroBlock
+		if err := json.Unmarshal(block.Data, &hero); err != nil {
+			return nil, "", err
+		}
+		return views.MakeHeroBlock(hero), "", nil
+	case common.BLOCK_IMAGE:
+		var image common.ImageBlock
+		if err := json.Unmarshal(block.Data, &image); err != nil {
+			return nil, "", err
+		}
+		return views.MakeImageBlock(image), "", nil
+	case common.BLOCK_GALLERY:
+		var gallery_block common.GalleryBlock
+		if err := json.Unmarshal(block.Data, &gallery_block); err != nil {
+			return nil, "", err
+		}
+		gallery, exists := currentSite(c).Galleries[gallery_block.Gallery]
+		if !exists {
+			return nil, "", fmt.Errorf("gallery `%s` does not exist", gallery_block.Gallery)
+		}
+		tagCacheEntry(c, common.GalleryCacheTag(gallery_block.Gallery), common.CACHE_TAG_IMAGES)
+		images, err := getGalleryImages(currentSite(c).Id, gallery)
+		if err != nil {
+			return nil, "", err
+		}
+		return views.MakeGalleryBlock(gallery, images), "/static/scripts/images.js", nil
+	case common.BLOCK_CARDS:
+		var cards_block common.CardsBlock
+		if err := json.Unmarshal(block.Data, &cards_block); err != nil {
+			return nil, "", err
+		}
+		limit := cards_block.Limit
+		if limit <= 0 {
+			limit = BLOCK_CARDS_LIMIT
+		}
+		tagCacheEntry(c, common.SchemaCacheTag(cards_block.Schema), common.CACHE_TAG_CARDS)
+		cards, _, err := db.GetCards(cards_block.Schema, common.CardQuery{Limit: limit})
+		if err != nil {
+			return nil, "", err
+		}
+		cards_data, err := cardsData(c.Request.Context(), cards)
+		if err != nil {
+			return nil, "", err
+		}
+		return views.MakeCardsBlock(cards_data), "", nil
+	case common.BLOCK_CTA:
+		var cta common.CtaBlock
+		if err := json.Unmarshal(block.Data, &cta); err != nil {
+			return nil, "", err
+		}
+		return views.MakeCtaBlock(cta), "", nil
+	case common.BLOCK_CONTACT_FORM:
+		var contact common.ContactFormBlock
+		if len(block.Data) > 0 {
+			if err := json.Unmarshal(block.Data, &contact); err != nil {
+				return nil, "", err
+			}
+		}
+		return views.MakeContactFormBlock(contact, currentSite(c).RecaptchaSiteKey), "", nil
+	}
+	return nil, "", fmt.Errorf("unknown block type `%s`", block.Type)
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeBlock(block_type string, data any) common.Block {
+	data_json, _ := json.Marshal(data)
+	return common.Block{Type: block_type, Data: data_json}
+}
+
+func TestBlockPage(t *testing.T) {
+	page := common.Page{Id: 1, Title: "Landing", Link: "landing", Blocks: []common.Block{
+		makeBlock(common.BLOCK_HERO, common.HeroBlock{Title: "Welcome", ButtonText: "Shop", ButtonHref: "/products/"}),
+		makeBlock(common.BLOCK_MARKDOWN, common.MarkdownBlock{Content: "## About us"}),
+		// Missing galleries are left out of the page
+		makeBlock(common.BLOCK_GALLERY, common.GalleryBlock{Gallery: "missing"}),
+		makeBlock(common.BLOCK_CARDS, common.CardsBlock{Schema: "products"}),
+		makeBlock(common.BLOCK_CTA, common.CtaBlock{Title: "Ready?", ButtonText: "Contact", ButtonHref: "/contact"}),
+	}}
+	requested_limit := 0
+	database := mocks.DatabaseMock{
+		GetPageByIdHandler: func(id int) (common.Page, error) {
+			return page, nil
+		},
+		GetPageTreeHandler: func() ([]common.Page, error) {
+			return []common.Page{{Id: page.Id, Title: page.Title, Link: page.Link, Path: page.Link}}, nil
+		},
+		GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+			requested_limit = query.Limit
+			return []common.Card{{Image: "shoe.jpg", Content: `{"title": "Shoe", "slogan": "New", "excerpt": "Comfy"}`}}, 1, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/page/landing", nil)
+	c.Params = gin.Params{{Key: "path", Value: "/landing"}}
+
+	html, err := pageHandler(c, database)
+	require.Nil(t, err)
+	assert.Contains(t, string(html), "Welcome")
+	assert.Contains(t, string(html), `href="/products/"`)
+	assert.Contains(t, string(html), `<h2 id="about-us">About us</h2>`)
+	assert.Contains(t, string(html), "Shoe")
+	assert.Contains(t, string(html), "Ready?")
+	assert.Equal(t, BLOCK_CARDS_LIMIT, requested_limit)
+	assert.Contains(t, c.GetStringSlice(CACHE_TAGS_KEY), common.SchemaCacheTag("products"))
+
+	// Pages without blocks are still rendered from Markdown
+	page = common.Page{Id: 2, Title: "About", Link: "about", Content: "# Plain page"}
+	c.Params = gin.Params{{Key: "path", Value: "/about"}}
+	html, err = pageHandler(c, database)
+	require.Nil(t, err)
+	assert.Contains(t, string(html), `<h1 id="plain-page">Plain page</h1>`)
+}
@@ -1,31 +1,79 @@
 package app
 
 import (
+	"container/list"
 	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	shardedmap "github.com/zutto/shardedmap"
+	"github.com/rbc33/gocms/common"
+	"github.com/rs/zerolog/log"
 )
 
-// Do not store over this amount
-// of MBs in the cache
+// Default maximum amount of MBs stored in the
+// cache, see `cache_max_size_mb` in the settings
 const MAX_CACHE_SIZE_MB = 10
 
+// Default seconds an expired page is still served while
+// it's regenerated, see `cache_stale_seconds`
+const CACHE_STALE_SECONDS = 60
+
 type EndpointCache struct {
-	Name       string
-	Contents   []byte
-	ValidUntil time.Time
+	Name         string
+	Contents     []byte
+	ValidUntil   time.Time
+	ETag         string
+	LastModified time.Time
+	// Precompressed contents by content encoding
+	Variants map[string][]byte
 }
 
 func emptyEndpointCache() EndpointCache {
-	return EndpointCache{"", []byte{}, time.Now()}
+	return EndpointCache{Contents: []byte{}, ValidUntil: time.Now()}
+}
+
+// Bytes taken by the contents and all of its variants
+func (entry *EndpointCache) size() uint64 {
+	size := uint64(len(entry.Contents))
+	for _, variant := range entry.Variants {
+		size += uint64(len(variant))
+	}
+	return size
+}
+
+type CacheMetrics struct {
+	Hits         uint64 `json:"hits"`
+	StaleHits    uint64 `json:"stale_hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Expirations  uint64 `json:"expirations"`
+	Entries      int    `json:"entries"`
+	SizeBytes    uint64 `json:"size_bytes"`
+	MaxSizeBytes uint64 `json:"max_size_bytes"`
 }
 
 type Cache interface {
 	Get(name string) (EndpointCache, error)
+	// Like Get, but also returns expired entries still within
+	// the stale window, fresh is false for those
+	GetStale(name string) (entry EndpointCache, fresh bool, err error)
 	Store(name string, buffer []byte) error
+	// Stores the entry and associates it with the given tags,
+	// so it can later be removed with InvalidateTag
+	StoreTagged(name string, buffer []byte, tags []string) error
+	// Stores an entry made with makeEndpointCache, the cache
+	// timeout is used when it has no ValidUntil set
+	StoreEntry(entry EndpointCache, tags []string) error
+	Delete(name string)
+	// Removes every entry with the given tag and
+	// returns how many entries were removed
+	InvalidateTag(tag string) int
+	Purge()
 	Size() uint64
+	Metrics() CacheMetrics
 }
 
 type CacheValidator interface {
@@ -39,57 +87,337 @@ func (validator *TimeValidator) IsValid(cache *EndpointCache) bool {
 	return cache.ValidUntil.After(time.Now())
 }
 
+// Each shard is an LRU list of its entries and their tags,
+// the memory cap is shared by all the shards.
+type cacheShard struct {
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	// front is the most recently used entry
+	lru  *list.List
+	size uint64
+	// Bytes stored by all the shards
+	cacheSize *atomic.Int64
+
+	// tag -> names and name -> tags indexes
+	taggedNames map[string]map[string]bool
+	nameTags    map[string][]string
+}
+
+// Removes the element and its tags from the shard,
+// the shard lock must be held by the caller
+func (shard *cacheShard) removeLocked(element *list.Element) EndpointCache {
+	entry := shard.lru.Remove(element).(EndpointCache)
+	delete(shard.entries, entry.Name)
+	shard.size -= entry.size()
+	shard.cacheSize.Add(-int64(entry.size()))
+
+	for _, tag := range shard.nameTags[entry.Name] {
+		delete(shard.taggedNames[tag], entry.Name)
+		if len(shard.taggedNames[tag]) == 0 {
+			delete(shard.taggedNames, tag)
+		}
+	}
+	delete(shard.nameTags, entry.Name)
+	return entry
+}
+
+// Adds the entry in front of the shard with its tags,
+// the shard lock must be held by the caller
+func (shard *cacheShard) pushLocked(entry EndpointCache, tags []string) {
+	shard.entries[entry.Name] = shard.lru.PushFront(entry)
+	shard.size += entry.size()
+	shard.cacheSize.Add(int64(entry.size()))
+
+	for _, tag := range tags {
+		if _, exists := shard.taggedNames[tag]; !exists {
+			shard.taggedNames[tag] = make(map[string]bool)
+		}
+		shard.taggedNames[tag][entry.Name] = true
+	}
+	shard.nameTags[entry.Name] = tags
+}
+
+// Evicts the least recently used entries while the cache
+// is over its cap, the shard lock must be held by the caller
+func (shard *cacheShard) evictLocked(max_size uint64, keep string) int {
+	evicted := 0
+	for uint64(shard.cacheSize.Load()) > max_size {
+		element := shard.lru.Back()
+		if element == nil || element.Value.(EndpointCache).Name == keep {
+			break
+		}
+		shard.removeLocked(element)
+		evicted++
+	}
+	return evicted
+}
+
 type TimedCache struct {
-	cacheMap      shardedmap.ShardMap
-	cacheTimeout  time.Duration
-	estimatedSize atomic.Uint64 // in bytes
-	validator     CacheValidator
+	shards       []*cacheShard
+	maxSize      uint64
+	size         atomic.Int64
+	cacheTimeout time.Duration
+	validator    CacheValidator
+	// How long expired entries are kept to be served
+	// while they are regenerated, 0 disables it
+	staleWindow time.Duration
+
+	hits        atomic.Uint64
+	staleHits   atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// Every entry gets tagged with its path so it can be
+// purged without knowing the exact query string or site.
+func entryPathTag(name string) string {
+	name = trimSiteCacheKey(name)
+	if parsed, err := url.ParseRequestURI(name); err == nil {
+		return common.PathCacheTag(parsed.Path)
+	}
+	return common.PathCacheTag(name)
+}
+
+func (cache *TimedCache) shardIndex(name string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	return int(hash.Sum32() % uint32(len(cache.shards)))
+}
+
+func (cache *TimedCache) shard(name string) *cacheShard {
+	return cache.shards[cache.shardIndex(name)]
 }
 
 func (cache *TimedCache) Store(name string, buffer []byte) error {
-	// Only store to the cache if we have enough space left
-	afterSizeMB := float64(cache.estimatedSize.Load()+uint64(len(buffer))) / 1000000
-	if afterSizeMB > MAX_CACHE_SIZE_MB {
-		return fmt.Errorf("maximum size reached")
+	return cache.StoreTagged(name, buffer, []string{})
+}
+
+func (cache *TimedCache) StoreTagged(name string, buffer []byte, tags []string) error {
+	entry := makeEndpointCache(name, buffer)
+	entry.Variants = compressVariants(buffer)
+	return cache.StoreEntry(entry, tags)
+}
+
+func (cache *TimedCache) StoreEntry(cache_entry EndpointCache, tags []string) error {
+	name := cache_entry.Name
+	index := cache.shardIndex(name)
+	shard := cache.shards[index]
+
+	if cache_entry.ValidUntil.IsZero() {
+		cache_entry.ValidUntil = time.Now().Add(cache.cacheTimeout)
 	}
 
-	var cache_entry interface{} = EndpointCache{
-		Name:       name,
-		Contents:   buffer,
-		ValidUntil: time.Now().Add(cache.cacheTimeout),
+	// The compressed variants are optional, big entries
+	// are better kept uncompressed than not at all
+	if cache_entry.size() > cache.maxSize {
+		cache_entry.Variants = nil
 	}
-	cache.cacheMap.Set(name, &cache_entry)
-	cache.estimatedSize.Add(uint64(len(buffer)))
+
+	// Entries bigger than the cache would evict
+	// everything and still not fit
+	if cache_entry.size() > cache.maxSize {
+		return fmt.Errorf("entry of %d bytes is over the maximum cache size", len(cache_entry.Contents))
+	}
+
+	shard.lock.Lock()
+	if element, exists := shard.entries[name]; exists {
+		shard.removeLocked(element)
+	}
+	shard.pushLocked(cache_entry, append([]string{entryPathTag(name)}, tags...))
+	evicted := shard.evictLocked(cache.maxSize, name)
+	shard.lock.Unlock()
+
+	// Room the shard of the entry couldn't make is
+	// taken from the other shards, one at a time
+	for i := 1; i < len(cache.shards) && uint64(cache.size.Load()) > cache.maxSize; i++ {
+		other := cache.shards[(index+i)%len(cache.shards)]
+		other.lock.Lock()
+		evicted += other.evictLocked(cache.maxSize, "")
+		other.lock.Unlock()
+	}
+
+	cache.evictions.Add(uint64(evicted))
 	return nil
 }
 
 func (cache *TimedCache) Get(name string) (EndpointCache, error) {
-	// if the endpoint is cached
-	cached_entry := cache.cacheMap.Get(name)
-	if cached_entry != nil {
-		cache_contents := (*cached_entry).(EndpointCache)
-
-		// We only return the cache if it's still valid
-		if cache.validator.IsValid(&cache_contents) {
-			return cache_contents, nil
-		} else {
-			cache.cacheMap.Delete(name)
-			return emptyEndpointCache(), fmt.Errorf("cached endpoint had expired")
+	cache_contents, _, err := cache.lookup(name, false)
+	return cache_contents, err
+}
+
+func (cache *TimedCache) GetStale(name string) (EndpointCache, bool, error) {
+	return cache.lookup(name, true)
+}
+
+func (cache *TimedCache) lookup(name string, allow_stale bool) (EndpointCache, bool, error) {
+	shard := cache.shard(name)
+
+	shard.lock.Lock()
+	element, exists := shard.entries[name]
+	if !exists {
+		shard.lock.Unlock()
+		cache.misses.Add(1)
+		return emptyEndpointCache(), false, fmt.Errorf("cache does not contain key")
+	}
+
+	cache_contents := element.Value.(EndpointCache)
+
+	// We only return the cache if it's still valid
+	if !cache.validator.IsValid(&cache_contents) {
+		// Stale entries are kept for GetStale
+		if cache.isStale(&cache_contents) {
+			shard.lock.Unlock()
+			if allow_stale {
+				cache.staleHits.Add(1)
+				return cache_contents, false, nil
+			}
+			cache.misses.Add(1)
+			return emptyEndpointCache(), false, fmt.Errorf("cached endpoint had expired")
 		}
+
+		shard.removeLocked(element)
+		shard.lock.Unlock()
+
+		cache.misses.Add(1)
+		cache.expirations.Add(1)
+		return emptyEndpointCache(), false, fmt.Errorf("cached endpoint had expired")
 	}
 
-	return emptyEndpointCache(), fmt.Errorf("cache does not contain key")
+	shard.lru.MoveToFront(element)
+	shard.lock.Unlock()
+
+	cache.hits.Add(1)
+	return cache_contents, true, nil
+}
+
+// Expired entries can still be served for staleWindow
+func (cache *TimedCache) isStale(entry *EndpointCache) bool {
+	return cache.staleWindow > 0 && entry.ValidUntil.Add(cache.staleWindow).After(time.Now())
+}
+
+// Keeps the expired entries around for the given window, so
+// GetStale can serve them while the page is regenerated
+func (cache *TimedCache) SetStaleWindow(window time.Duration) {
+	cache.staleWindow = window
+}
+
+func (cache *TimedCache) Delete(name string) {
+	shard := cache.shard(name)
+
+	shard.lock.Lock()
+	if element, exists := shard.entries[name]; exists {
+		shard.removeLocked(element)
+	}
+	shard.lock.Unlock()
+}
+
+func (cache *TimedCache) InvalidateTag(tag string) int {
+	removed := 0
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		for name := range shard.taggedNames[tag] {
+			shard.removeLocked(shard.entries[name])
+			removed++
+		}
+		shard.lock.Unlock()
+	}
+	return removed
+}
+
+func (cache *TimedCache) Purge() {
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		for element := shard.lru.Front(); element != nil; element = shard.lru.Front() {
+			shard.removeLocked(element)
+		}
+		shard.lock.Unlock()
+	}
 }
 
 func (cache *TimedCache) Size() uint64 {
-	return cache.estimatedSize.Load()
+	return uint64(cache.size.Load())
 }
 
-func MakeCache(n_shards int, expiry_duration time.Duration, validator CacheValidator) Cache {
-	return &TimedCache{
-		cacheMap:      shardedmap.NewShardMap(n_shards),
-		cacheTimeout:  expiry_duration,
-		estimatedSize: atomic.Uint64{},
-		validator:     validator,
+func (cache *TimedCache) Metrics() CacheMetrics {
+	metrics := CacheMetrics{
+		Hits:         cache.hits.Load(),
+		StaleHits:    cache.staleHits.Load(),
+		Misses:       cache.misses.Load(),
+		Evictions:    cache.evictions.Load(),
+		Expirations:  cache.expirations.Load(),
+		MaxSizeBytes: cache.maxSize,
+	}
+
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		metrics.Entries += len(shard.entries)
+		metrics.SizeBytes += shard.size
+		shard.lock.Unlock()
+	}
+	return metrics
+}
+
+// Removes the expired entries so they don't take up
+// space until they are requested again, returns the
+// number of entries removed.
+func (cache *TimedCache) SweepExpired() int {
+	expired := make([]string, 0)
+	for _, shard := range cache.shards {
+		shard.lock.Lock()
+		for element := shard.lru.Front(); element != nil; {
+			next := element.Next()
+			entry := element.Value.(EndpointCache)
+			if !cache.validator.IsValid(&entry) && !cache.isStale(&entry) {
+				shard.removeLocked(element)
+				expired = append(expired, entry.Name)
+			}
+			element = next
+		}
+		shard.lock.Unlock()
 	}
+
+	cache.expirations.Add(uint64(len(expired)))
+	return len(expired)
+}
+
+// Sweeps the expired entries every interval, this
+// blocks so it should be started in a goroutine
+func (cache *TimedCache) SweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if removed := cache.SweepExpired(); removed > 0 {
+			log.Info().Msgf("removed %d expired cache entries", removed)
+		}
+	}
+}
+
+// Creates a cache holding at most max_size_bytes in all of
+// its shards. The least recently used entries are evicted
+// once it's full, starting with the shard of the new entry.
+func MakeSizedCache(n_shards int, expiry_duration time.Duration, max_size_bytes uint64, validator CacheValidator) *TimedCache {
+	n_shards = max(n_shards, 1)
+
+	cache := &TimedCache{
+		shards:       make([]*cacheShard, n_shards),
+		maxSize:      max_size_bytes,
+		cacheTimeout: expiry_duration,
+		validator:    validator,
+	}
+	for i := range cache.shards {
+		cache.shards[i] = &cacheShard{
+			entries:     make(map[string]*list.Element),
+			lru:         list.New(),
+			cacheSize:   &cache.size,
+			taggedNames: make(map[string]map[string]bool),
+			nameTags:    make(map[string][]string),
+		}
+	}
+	return cache
+}
+
+func MakeCache(n_shards int, expiry_duration time.Duration, validator CacheValidator) Cache {
+	return MakeSizedCache(n_shards, expiry_duration, MAX_CACHE_SIZE_MB*1000000, validator)
 }
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rs/zerolog/log"
+)
+
+// Applies the invalidation request to the cache and
+// returns the number of entries removed, or -1 if
+// the whole cache was purged.
+func applyCacheInvalidation(cache Cache, request common.CacheInvalidationRequest) int {
+	if request.All {
+		cache.Purge()
+		return -1
+	}
+
+	invalidated := 0
+	for _, tag := range request.Tags {
+		invalidated += cache.InvalidateTag(tag)
+	}
+	for _, path := range request.Paths {
+		invalidated += cache.InvalidateTag(common.PathCacheTag(path))
+	}
+	return invalidated
+}
+
+// Only lets through requests carrying the `cache_secret`
+// shared with the admin-app.
+func requireCacheSecret() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := common.CurrentSettings().CacheSecret
+		if secret == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, common.MsgErrorRes("cache endpoints are disabled"))
+			return
+		}
+
+		given_secret := c.GetHeader(common.CACHE_SECRET_HEADER)
+		if subtle.ConstantTimeCompare([]byte(given_secret), []byte(secret)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, common.MsgErrorRes("invalid cache secret"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// POST /cache/invalidate
+func makeCacheInvalidationHandler(cache *Cache, site_settings *siteSettingsStore) func(*gin.Context) {
+	return func(c *gin.Context) {
+		var request common.CacheInvalidationRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, common.ErrorRes("invalid request body", err))
+			return
+		}
+
+		site_settings.forget(request)
+		invalidated := applyCacheInvalidation(*cache, request)
+		log.Info().Msgf("cache invalidation: tags=%v paths=%v all=%v removed=%d", request.Tags, request.Paths, request.All, invalidated)
+
+		c.JSON(http.StatusOK, gin.H{"invalidated": invalidated})
+	}
+}
+
+// GET /cache/metrics
+func makeCacheMetricsHandler(cache *Cache) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, (*cache).Metrics())
+	}
+}
@@ -1,12 +1,13 @@
 package app
 
 import (
-	"sync/atomic"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/rbc33/gocms/common"
 	"github.com/stretchr/testify/assert"
-	shardedmap "github.com/zutto/shardedmap"
 )
 
 type TrueTimeMockValidator struct{}
@@ -22,21 +23,11 @@ func (validator *FalseTimeMockValidator) IsValid(cache *EndpointCache) bool {
 }
 
 func makeTrueCacheMock() Cache {
-	return &TimedCache{
-		cacheMap:      shardedmap.NewShardMap(2),
-		cacheTimeout:  10 * time.Second,
-		estimatedSize: atomic.Uint64{},
-		validator:     &TrueTimeMockValidator{},
-	}
+	return MakeSizedCache(2, 10*time.Second, MAX_CACHE_SIZE_MB*1000000, &TrueTimeMockValidator{})
 }
 
 func makeFalseCacheMock() Cache {
-	return &TimedCache{
-		cacheMap:      shardedmap.NewShardMap(2),
-		cacheTimeout:  10 * time.Second,
-		estimatedSize: atomic.Uint64{},
-		validator:     &FalseTimeMockValidator{},
-	}
+	return MakeSizedCache(2, 10*time.Second, MAX_CACHE_SIZE_MB*1000000, &FalseTimeMockValidator{})
 }
 
 func TestCacheAddition(t *testing.T) {
@@ -81,15 +72,206 @@ func TestCacheFailure(t *testing.T) {
 
 	cache := makeFalseCacheMock()
 
-	rolling_size := uint64(0)
 	for _, test_case := range test_data {
 
-		rolling_size += uint64(len(test_case.contents))
 		err := cache.Store(test_case.name, test_case.contents)
 		assert.Nil(t, err)
-		assert.Equal(t, cache.Size(), rolling_size)
+		assert.Equal(t, cache.Size(), uint64(len(test_case.contents)))
 
+		// Expired entries are removed and stop counting
+		// towards the cache size
 		_, err = cache.Get(test_case.name)
 		assert.NotNil(t, err)
+		assert.Equal(t, cache.Size(), uint64(0))
+	}
+}
+
+func TestCacheInvalidateTag(t *testing.T) {
+	cache := makeTrueCacheMock()
+
+	assert.Nil(t, cache.StoreTagged("/post/1", []byte("first post"), []string{"post:1"}))
+	assert.Nil(t, cache.StoreTagged("/", []byte("home"), []string{"posts", "post:1"}))
+	assert.Nil(t, cache.StoreTagged("/page/about", []byte("about"), []string{"page:about"}))
+
+	assert.Equal(t, 2, cache.InvalidateTag("post:1"))
+	_, err := cache.Get("/post/1")
+	assert.NotNil(t, err)
+	_, err = cache.Get("/")
+	assert.NotNil(t, err)
+
+	// Untouched entries are still there
+	entry, err := cache.Get("/page/about")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("about"), entry.Contents)
+	assert.Equal(t, uint64(len("about")), cache.Size())
+
+	// Already invalidated tags remove nothing
+	assert.Equal(t, 0, cache.InvalidateTag("post:1"))
+}
+
+func TestCacheInvalidatePath(t *testing.T) {
+	cache := makeTrueCacheMock()
+
+	assert.Nil(t, cache.Store("/products/abc?page=2", []byte("page two")))
+	assert.Nil(t, cache.Store("/products/abc", []byte("page one")))
+
+	invalidated := applyCacheInvalidation(cache, common.CacheInvalidationRequest{Paths: []string{"/products/abc"}})
+	assert.Equal(t, 2, invalidated)
+	assert.Equal(t, uint64(0), cache.Size())
+}
+
+func TestCachePurge(t *testing.T) {
+	cache := makeTrueCacheMock()
+
+	assert.Nil(t, cache.Store("/", []byte("home")))
+	assert.Nil(t, cache.Store("/about", []byte("about")))
+
+	cache.Purge()
+	_, err := cache.Get("/")
+	assert.NotNil(t, err)
+	_, err = cache.Get("/about")
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(0), cache.Size())
+}
+
+func TestCacheOverwriteSize(t *testing.T) {
+	cache := makeTrueCacheMock()
+
+	assert.Nil(t, cache.Store("/", []byte("first version")))
+	assert.Nil(t, cache.Store("/", []byte("second")))
+	assert.Equal(t, uint64(len("second")), cache.Size())
+
+	cache.Delete("/")
+	assert.Equal(t, uint64(0), cache.Size())
+}
+
+func TestCacheLruEviction(t *testing.T) {
+	cache := MakeSizedCache(1, 10*time.Second, 10, &TrueTimeMockValidator{})
+
+	assert.Nil(t, cache.Store("a", []byte("aaaa")))
+	assert.Nil(t, cache.Store("b", []byte("bbbb")))
+
+	// Using "a" makes "b" the least recently used
+	_, err := cache.Get("a")
+	assert.Nil(t, err)
+
+	assert.Nil(t, cache.Store("c", []byte("cccc")))
+	_, err = cache.Get("b")
+	assert.NotNil(t, err)
+	_, err = cache.Get("a")
+	assert.Nil(t, err)
+	_, err = cache.Get("c")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(8), cache.Size())
+
+	// Entries over the cap are never stored
+	assert.NotNil(t, cache.Store("d", []byte("ddddddddddd")))
+
+	metrics := cache.Metrics()
+	assert.Equal(t, uint64(3), metrics.Hits)
+	assert.Equal(t, uint64(1), metrics.Misses)
+	assert.Equal(t, uint64(1), metrics.Evictions)
+	assert.Equal(t, 2, metrics.Entries)
+	assert.Equal(t, uint64(10), metrics.MaxSizeBytes)
+}
+
+func TestCacheSweepExpired(t *testing.T) {
+	cache := MakeSizedCache(2, 10*time.Second, 1000, &FalseTimeMockValidator{})
+
+	assert.Nil(t, cache.StoreTagged("/post/1", []byte("post"), []string{"post:1"}))
+	assert.Nil(t, cache.Store("/", []byte("home")))
+
+	assert.Equal(t, 2, cache.SweepExpired())
+	assert.Equal(t, uint64(0), cache.Size())
+	assert.Equal(t, uint64(2), cache.Metrics().Expirations)
+	assert.Equal(t, 0, cache.InvalidateTag("post:1"))
+}
+
+func TestCacheStaleWindow(t *testing.T) {
+	cache := MakeSizedCache(1, -time.Second, 1000, &TimeValidator{})
+	cache.SetStaleWindow(time.Minute)
+
+	assert.Nil(t, cache.Store("/", []byte("home")))
+
+	// Expired but kept to be served stale
+	_, err := cache.Get("/")
+	assert.NotNil(t, err)
+	entry, fresh, err := cache.GetStale("/")
+	assert.Nil(t, err)
+	assert.False(t, fresh)
+	assert.Equal(t, []byte("home"), entry.Contents)
+	assert.Equal(t, 0, cache.SweepExpired())
+	assert.Equal(t, uint64(1), cache.Metrics().StaleHits)
+
+	// Past the stale window it's gone
+	cache.SetStaleWindow(time.Millisecond)
+	_, _, err = cache.GetStale("/")
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(0), cache.Size())
+}
+
+func TestCacheSharesSizeBetweenShards(t *testing.T) {
+	cache := MakeSizedCache(4, 10*time.Second, 100, &TrueTimeMockValidator{})
+
+	// Bigger than a quarter of the cache
+	page := make([]byte, 60)
+	assert.Nil(t, cache.Store("/big", page))
+	_, err := cache.Get("/big")
+	assert.Nil(t, err)
+
+	// Room for the next page is made in any shard
+	for i := range 10 {
+		assert.Nil(t, cache.Store(fmt.Sprintf("/page/%d", i), page))
+		assert.LessOrEqual(t, cache.Size(), uint64(100))
+	}
+	metrics := cache.Metrics()
+	assert.Equal(t, 1, metrics.Entries)
+	assert.Equal(t, uint64(60), metrics.SizeBytes)
+	assert.Equal(t, uint64(10), metrics.Evictions)
+	assert.Equal(t, uint64(100), metrics.MaxSizeBytes)
+	_, err = cache.Get("/page/9")
+	assert.Nil(t, err)
+
+	assert.NotNil(t, cache.Store("/huge", make([]byte, 101)))
+}
+
+func TestCacheTagsFollowEntries(t *testing.T) {
+	cache := MakeSizedCache(4, 10*time.Second, 200, &TrueTimeMockValidator{})
+
+	var wait sync.WaitGroup
+	for worker := range 8 {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := range 200 {
+				name := fmt.Sprintf("/post/%d", (worker+i)%16)
+				switch i % 4 {
+				case 0, 1:
+					assert.Nil(t, cache.StoreTagged(name, []byte("post"), []string{"posts"}))
+				case 2:
+					cache.InvalidateTag("posts")
+				case 3:
+					cache.Delete(name)
+				}
+			}
+		}()
 	}
+	wait.Wait()
+
+	// Every entry has its tags and every tag its entries
+	for _, shard := range cache.shards {
+		assert.Equal(t, len(shard.entries), len(shard.nameTags))
+		for name := range shard.nameTags {
+			assert.Contains(t, shard.entries, name)
+		}
+		for _, names := range shard.taggedNames {
+			for name := range names {
+				assert.Contains(t, shard.entries, name)
+			}
+		}
+	}
+
+	entries := cache.Metrics().Entries
+	assert.Equal(t, entries, cache.InvalidateTag("posts"))
+	assert.Equal(t, uint64(0), cache.Size())
 }
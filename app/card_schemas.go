@@ -43,7 +43,9 @@ func getSchemasHandler(c *gin.Context, database database.Database) ([]byte, erro
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return []byte{}, err
 	}
-	schemas_view := views.MakeAllSchemas(schemas, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	tagCacheEntry(c, common.CACHE_TAG_SCHEMAS)
+
+	schemas_view := views.MakeAllSchemas(schemas, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
 	html_buffer := bytes.NewBuffer(nil)
 
 	err = schemas_view.Render(c, html_buffer)
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,8 +13,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"github.com/rbc33/gocms/common"
 	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
 	"github.com/rbc33/gocms/views"
 	"github.com/rs/zerolog/log"
 
@@ -180,9 +181,9 @@ func makeContactFormHandler() func(*gin.Context) {
 
 		// Make the request to Google's API only if user
 		// configured recatpcha settings
-		if (len(common.Settings.RecaptchaSecret) > 0) && (len(common.Settings.RecaptchaSiteKey) > 0) {
+		if (len(currentSite(c).RecaptchaSecret) > 0) && (len(currentSite(c).RecaptchaSiteKey) > 0) {
 			ctx := c.Request.Context()
-			err := verifyRecaptchaEnterprise(ctx, "gocms-1750166214215", common.Settings.RecaptchaSiteKey, recaptcha_response, "contact_submit")
+			err := verifyRecaptchaEnterprise(ctx, "gocms-1750166214215", currentSite(c).RecaptchaSiteKey, recaptcha_response, "contact_submit")
 			if err != nil {
 				// El error ya se loguea dentro de verifyRecaptcha si es necesario o aquí en renderErrorPage
 				renderErrorPage(c, email, err)
@@ -207,13 +208,25 @@ func makeContactFormHandler() func(*gin.Context) {
 			renderErrorPage(c, email, fmt.Errorf("message too long (10000 chars max)"))
 			return
 		}
-		err = sendEmail(email, name, subject, message, c)
-		if err != nil {
+		submission := plugins.ContactSubmission{Name: name, Email: email, Subject: subject, Message: message}
+		if err = app_hooks.Run(c.Request.Context(), plugins.EVENT_CONTACT_SUBMIT, &submission); err != nil {
+			// Visitors only see what the script raised
+			var plugin_error *plugins.PluginError
+			if errors.As(err, &plugin_error) {
+				log.Error().Msgf("contact_submit plugins refused the message: %v", err)
+				err = errors.New(plugin_error.Public())
+			}
 			renderErrorPage(c, email, err)
 			return
 		}
 
-		if renderErr := TemplRender(c, http.StatusOK, views.MakeContactSuccess(email, name)); renderErr != nil {
+		err = sendEmail(submission.Email, submission.Name, submission.Subject, submission.Message, c)
+		if err != nil {
+			renderErrorPage(c, submission.Email, err)
+			return
+		}
+
+		if renderErr := TemplRender(c, http.StatusOK, views.MakeContactSuccess(submission.Email, submission.Name)); renderErr != nil {
 			log.Error().Err(renderErr).Msg("Failed to render contact success page")
 			c.String(http.StatusInternalServerError, "An error occurred while processing your request.")
 		}
@@ -222,5 +235,5 @@ func makeContactFormHandler() func(*gin.Context) {
 
 // TODO : This is a duplicate of the index handler... abstract
 func contactHandler(c *gin.Context, db database.Database) ([]byte, error) {
-	return renderHtml(c, views.MakeContactPage(common.Settings.AppNavbar.Links, common.Settings.RecaptchaSiteKey, common.Settings.AppNavbar.Dropdowns))
+	return renderHtml(c, views.MakeContactPage(currentSite(c).AppNavbar.Links, currentSite(c).RecaptchaSiteKey, currentSite(c).AppNavbar.Dropdowns))
 }
@@ -0,0 +1,561 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+// Kept in the output directory to know what changed
+// since the last export in incremental mode
+const EXPORT_MANIFEST = ".gocms-export.json"
+
+// The export router returns the cache tags of the
+// rendered page in this header
+const EXPORT_TAGS_HEADER = "X-Gocms-Export-Tags"
+
+type ExportOptions struct {
+	OutDir    string
+	StaticDir string
+	// Path the site is served from, e.g. `/blog`, every
+	// root relative link is prefixed with it
+	BasePath string
+	// Only renders the pages whose content changed
+	Incremental bool
+	// Host the pages are requested with, picking the site
+	// like the app does. The default site when empty.
+	Host string
+}
+
+type ExportReport struct {
+	Rendered int
+	Skipped  int
+	Removed  int
+	Assets   int
+	// Paths that could not be rendered
+	Failed []string
+}
+
+type exportedPage struct {
+	File string `json:"file"`
+	// Fingerprint of every tagged content when rendered
+	Sources map[string]string `json:"sources"`
+}
+
+type exportManifest struct {
+	// Changing the settings re-renders everything
+	Settings string                  `json:"settings"`
+	Pages    map[string]exportedPage `json:"pages"`
+}
+
+var EXPORT_LINK_REGEX = regexp.MustCompile(`(href|src|action|data-geo-endpoint)="/([^/"][^"]*)?"`)
+var EXPORT_GEO_GALLERY_REGEX = regexp.MustCompile(`/api/images/geo\?gallery=([^"&]+)`)
+
+// Renders every page route into the output directory
+// along with the static files and images, so the site
+// can be served without gocms. The pages are rendered
+// by their generators directly, never from the cache.
+func ExportSite(db database.Database, options ExportOptions) (ExportReport, error) {
+	report := ExportReport{Failed: []string{}}
+
+	if err := os.MkdirAll(options.OutDir, 0755); err != nil {
+		return report, err
+	}
+
+	site_settings := makeSiteSettingsStore()
+	site := site_settings.apply(common.CurrentSettings().SiteForHost(options.Host), db)
+	site_db := db.ForSite(site.Id)
+
+	routes := pageRoutes(db)
+	paths, err := expandExportPaths(routes, site_db, site)
+	if err != nil {
+		return report, err
+	}
+
+	fingerprints, err := exportFingerprints(site_db, site)
+	if err != nil {
+		return report, err
+	}
+
+	previous, err := readExportManifest(options.OutDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warn().Msgf("could not read export manifest, exporting everything: %v", err)
+	}
+
+	// The settings (navbar, galleries...) show up on every
+	// page, so changing them or the site re-renders everything
+	settings_fingerprint := fingerprint([]any{common.CurrentSettings(), site.Id})
+	incremental := options.Incremental && previous.Settings == settings_fingerprint
+	manifest := exportManifest{Settings: settings_fingerprint, Pages: map[string]exportedPage{}}
+
+	router := makeExportRouter(routes, db, site_settings)
+	exported := make(map[string]bool)
+	for _, page_path := range paths {
+		exported[page_path] = true
+		if incremental && isExportUpToDate(options.OutDir, previous.Pages[page_path], fingerprints) {
+			manifest.Pages[page_path] = previous.Pages[page_path]
+			report.Skipped++
+			continue
+		}
+
+		contents, tags, err := renderExportPath(router, options.Host, page_path)
+		if err != nil {
+			log.Warn().Msgf("could not export `%s`: %v", page_path, err)
+			report.Failed = append(report.Failed, page_path)
+			continue
+		}
+
+		file := exportFilePath(page_path)
+		if err := writeExportFile(options.OutDir, file, rewriteExportLinks(contents, options.BasePath)); err != nil {
+			return report, err
+		}
+
+		sources := make(map[string]string)
+		for _, tag := range tags {
+			sources[tag] = fingerprints[tag]
+		}
+		manifest.Pages[page_path] = exportedPage{File: file, Sources: sources}
+		report.Rendered++
+	}
+
+	// Pages of deleted content
+	for page_path, page := range previous.Pages {
+		if exported[page_path] {
+			continue
+		}
+		err := os.Remove(filepath.Join(options.OutDir, filepath.FromSlash(page.File)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return report, err
+		}
+		report.Removed++
+	}
+
+	if err := exportGeoImages(options.OutDir, site); err != nil {
+		return report, err
+	}
+
+	not_found, _, err := renderExportPath(router, options.Host, "/404.html")
+	if err != nil {
+		return report, fmt.Errorf("could not render the not found page: %v", err)
+	}
+	if err := writeExportFile(options.OutDir, "404.html", rewriteExportLinks(not_found, options.BasePath)); err != nil {
+		return report, err
+	}
+
+	// Mirrors the static routes registered in SetupRoutes,
+	// without the media of the other sites
+	image_directory := common.SiteImageDirectory(site.Id)
+	asset_dirs := map[string]string{
+		"static":      options.StaticDir,
+		"images/data": image_directory,
+		"media":       image_directory,
+	}
+	for target, source := range asset_dirs {
+		excluded := ""
+		if source == image_directory && site.Id == common.DEFAULT_SITE_ID {
+			excluded = common.SITES_MEDIA_DIRECTORY
+		}
+		copied, err := copyExportAssets(source, filepath.Join(options.OutDir, target), excluded)
+		if err != nil {
+			return report, fmt.Errorf("could not copy `%s`: %v", source, err)
+		}
+		report.Assets += copied
+	}
+
+	return report, writeExportManifest(options.OutDir, manifest)
+}
+
+// Fills in the parameters of every route with the
+// content in the database, routes with unknown
+// parameters are skipped.
+func expandExportPaths(routes []pageRoute, db database.Database, site common.Site) ([]string, error) {
+	posts, err := db.GetPosts(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not get posts: %v", err)
+	}
+	pages, err := db.GetPageTree()
+	if err != nil {
+		return nil, fmt.Errorf("could not get pages: %v", err)
+	}
+	schemas, err := db.GetCardSchemas(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not get card schemas: %v", err)
+	}
+	images, err := getAllImages(site.Id)
+	if err != nil {
+		return nil, fmt.Errorf("could not get images: %v", err)
+	}
+
+	params := map[string][]string{
+		"/post/:id":          {},
+		"/posts/:num":        {},
+		"/pages/:num":        {},
+		"/page/*path":        {},
+		"/products/:schema":  {},
+		"/images/:name":      {},
+		"/gallery/:name":     {},
+		"/gallery/:name/map": {},
+	}
+	for _, post := range posts {
+		params["/post/:id"] = append(params["/post/:id"], fmt.Sprintf("%d", post.Id))
+	}
+	for num := 1; (num-1)*ITEMS_PER_PAGE < len(posts); num++ {
+		params["/posts/:num"] = append(params["/posts/:num"], fmt.Sprintf("%d", num))
+	}
+	for num := 1; (num-1)*ITEMS_PER_PAGE < len(pages); num++ {
+		params["/pages/:num"] = append(params["/pages/:num"], fmt.Sprintf("%d", num))
+	}
+	for _, page := range pages {
+		params["/page/*path"] = append(params["/page/*path"], page.Path)
+	}
+	for _, schema := range schemas {
+		params["/products/:schema"] = append(params["/products/:schema"], schema.Uuid)
+	}
+	for _, image := range images {
+		params["/images/:name"] = append(params["/images/:name"], image.Filename)
+	}
+	for name := range site.Galleries {
+		params["/gallery/:name"] = append(params["/gallery/:name"], name)
+		params["/gallery/:name/map"] = append(params["/gallery/:name/map"], name)
+	}
+
+	paths := make([]string, 0)
+	for _, route := range routes {
+		if !strings.ContainsAny(route.Path, ":*") {
+			paths = append(paths, route.Path)
+			continue
+		}
+
+		values, exists := params[route.Path]
+		if !exists {
+			log.Warn().Msgf("not exporting route `%s`, its parameters are unknown", route.Path)
+			continue
+		}
+		for _, value := range values {
+			param := route.Path[strings.LastIndexAny(route.Path, ":*"):]
+			param = strings.SplitN(param, "/", 2)[0]
+			paths = append(paths, strings.Replace(route.Path, param, value, 1))
+		}
+	}
+	return paths, nil
+}
+
+func getAllImages(site_id int) ([]common.Image, error) {
+	filepaths, err := common.GetImageMetadataPaths(site_id)
+	if err != nil {
+		return nil, err
+	}
+	return common.GetImages(site_id, filepaths, len(filepaths), 1)
+}
+
+func fingerprint(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		// Never matches, so the page is rendered again
+		return ""
+	}
+	hash := sha256.Sum256(encoded)
+	return hex.EncodeToString(hash[:])
+}
+
+// Fingerprints of the content behind each cache tag, a
+// page is up to date if the content of all its tags
+// is the same as when it was exported.
+func exportFingerprints(db database.Database, site common.Site) (map[string]string, error) {
+	fingerprints := make(map[string]string)
+
+	posts, err := db.GetPosts(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not get posts: %v", err)
+	}
+	fingerprints[common.CACHE_TAG_POSTS] = fingerprint(posts)
+	for _, post := range posts {
+		full_post, err := db.GetPost(post.Id)
+		if err != nil {
+			return nil, fmt.Errorf("could not get post `%d`: %v", post.Id, err)
+		}
+		fingerprints[common.PostCacheTag(post.Id)] = fingerprint(full_post)
+	}
+
+	pages, err := db.GetPages(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pages: %v", err)
+	}
+	fingerprints[common.CACHE_TAG_PAGES] = fingerprint(pages)
+	for _, page := range pages {
+		fingerprints[common.PageCacheTag(page.Link)] = fingerprint(page)
+		fingerprints[common.PageIdCacheTag(page.Id)] = fingerprint(page)
+	}
+
+	schemas, err := db.GetCardSchemas(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not get card schemas: %v", err)
+	}
+	fingerprints[common.CACHE_TAG_SCHEMAS] = fingerprint(schemas)
+	all_cards := make([]common.Card, 0)
+	for _, schema := range schemas {
+		cards, _, err := db.GetCards(schema.Uuid, common.CardQuery{Limit: ITEMS_PER_PAGE})
+		if err != nil {
+			return nil, fmt.Errorf("could not get cards of `%s`: %v", schema.Uuid, err)
+		}
+		fingerprints[common.SchemaCacheTag(schema.Uuid)] = fingerprint([]any{schema, cards})
+		all_cards = append(all_cards, cards...)
+	}
+	fingerprints[common.CACHE_TAG_CARDS] = fingerprint(all_cards)
+
+	images, err := getAllImages(site.Id)
+	if err != nil {
+		return nil, fmt.Errorf("could not get images: %v", err)
+	}
+	fingerprints[common.CACHE_TAG_IMAGES] = fingerprint(images)
+	for name, gallery := range site.Galleries {
+		fingerprints[common.GalleryCacheTag(name)] = fingerprint(gallery)
+	}
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return nil, fmt.Errorf("could not get settings: %v", err)
+	}
+	fingerprints[common.SettingsCacheTag(site.Id)] = fingerprint(settings)
+
+	menus, err := db.GetMenus()
+	if err != nil {
+		return nil, fmt.Errorf("could not get menus: %v", err)
+	}
+	fingerprints[common.MenusCacheTag(site.Id)] = fingerprint(menus)
+
+	return fingerprints, nil
+}
+
+func isExportUpToDate(out_dir string, page exportedPage, fingerprints map[string]string) bool {
+	if page.File == "" {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(out_dir, filepath.FromSlash(page.File))); err != nil {
+		return false
+	}
+
+	for tag, source := range page.Sources {
+		current, exists := fingerprints[tag]
+		if !exists || current != source {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs the generators of the page routes with the same
+// routing as the app, but without the cache in between
+func makeExportRouter(routes []pageRoute, db database.Database, site_settings *siteSettingsStore) *gin.Engine {
+	r := gin.New()
+	r.Use(siteMiddleware(db, site_settings))
+	for _, route := range routes {
+		generator := route.Generator
+		r.GET(route.Path, func(c *gin.Context) {
+			// Every page shows the settings and menus, like in addCacheHandler
+			tagCacheEntry(c, common.SettingsCacheTag(currentSite(c).Id), common.MenusCacheTag(currentSite(c).Id))
+			html_buffer, err := generator(c, siteDatabase(c, db))
+			if err != nil {
+				if !c.Writer.Written() {
+					c.String(http.StatusInternalServerError, err.Error())
+				}
+				return
+			}
+
+			c.Writer.Header()[EXPORT_TAGS_HEADER] = c.GetStringSlice(CACHE_TAGS_KEY)
+			c.Data(http.StatusOK, "text/html; charset=utf-8", html_buffer)
+		})
+	}
+	r.NoRoute(notFoundHandler())
+	return r
+}
+
+// Requested with the host of the exported site
+// so the middleware resolves it like in the app
+func renderExportPath(router *gin.Engine, host string, page_path string) ([]byte, []string, error) {
+	request_url := url.URL{Path: page_path}
+	request, err := http.NewRequest(http.MethodGet, request_url.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Host = host
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	if w.Code != http.StatusOK {
+		return nil, nil, fmt.Errorf("got status %d", w.Code)
+	}
+	return w.Body.Bytes(), w.Header()[EXPORT_TAGS_HEADER], nil
+}
+
+// Every page is exported as an index.html file in a
+// directory named after its path, so the links keep
+// working on hosts serving the directory index
+func exportFilePath(page_path string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+page_path), "/")
+	if cleaned == "" {
+		return "index.html"
+	}
+	return cleaned + "/index.html"
+}
+
+// The geo API can't be queried on a static host, so the
+// maps load the whole collection from a JSON file
+func rewriteExportLinks(contents []byte, base_path string) []byte {
+	contents = EXPORT_GEO_GALLERY_REGEX.ReplaceAllFunc(contents, func(match []byte) []byte {
+		escaped := EXPORT_GEO_GALLERY_REGEX.FindSubmatch(match)[1]
+		gallery, err := url.QueryUnescape(string(escaped))
+		if err != nil {
+			return match
+		}
+		return []byte("/api/images/geo/" + url.PathEscape(gallery) + ".json")
+	})
+	contents = []byte(strings.ReplaceAll(string(contents), `"/api/images/geo"`, `"/api/images/geo.json"`))
+
+	base_path = strings.TrimSuffix(base_path, "/")
+	if base_path == "" {
+		return contents
+	}
+	return EXPORT_LINK_REGEX.ReplaceAll(contents, []byte(`$1="`+base_path+`/$2"`))
+}
+
+func exportGeoImages(out_dir string, site common.Site) error {
+	galleries := []string{""}
+	for name := range site.Galleries {
+		galleries = append(galleries, name)
+	}
+
+	for _, gallery := range galleries {
+		images, err := getGeotaggedImages(site, gallery)
+		if err != nil {
+			return fmt.Errorf("could not get geotagged images: %v", err)
+		}
+
+		// Zoomed in enough to never cluster, the client
+		// can't ask for the clusters of each zoom level
+		encoded, err := json.Marshal(GeoFeatureCollection{
+			Type:     "FeatureCollection",
+			Features: clusterImages(images, MAX_CLUSTER_ZOOM),
+		})
+		if err != nil {
+			return err
+		}
+
+		file := "api/images/geo.json"
+		if gallery != "" {
+			file = "api/images/geo/" + gallery + ".json"
+		}
+		if err := writeExportFile(out_dir, file, encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeExportFile(out_dir string, file string, contents []byte) error {
+	target := filepath.Join(out_dir, filepath.FromSlash(file))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, contents, 0644)
+}
+
+// Copies the files that are missing or changed in size or
+// modification time, but the ones under the `excluded`
+// directory, returns how many were copied
+func copyExportAssets(source_dir string, target_dir string, excluded string) (int, error) {
+	if _, err := os.Stat(source_dir); source_dir == "" || errors.Is(err, fs.ErrNotExist) {
+		log.Warn().Msgf("not copying assets from `%s`, the directory does not exist", source_dir)
+		return 0, nil
+	}
+
+	copied := 0
+	err := filepath.WalkDir(source_dir, func(source string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(source_dir, source)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(target_dir, relative)
+		if entry.IsDir() {
+			if excluded != "" && relative == excluded {
+				return fs.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		}
+
+		source_info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		target_info, err := os.Stat(target)
+		if err == nil && target_info.Size() == source_info.Size() && target_info.ModTime().Equal(source_info.ModTime()) {
+			return nil
+		}
+
+		if err := copyExportFile(source, target); err != nil {
+			return err
+		}
+		copied++
+		return os.Chtimes(target, source_info.ModTime(), source_info.ModTime())
+	})
+	return copied, err
+}
+
+func copyExportFile(source string, target string) error {
+	source_file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer source_file.Close()
+
+	target_file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer target_file.Close()
+
+	_, err = io.Copy(target_file, source_file)
+	return err
+}
+
+func readExportManifest(out_dir string) (exportManifest, error) {
+	contents, err := os.ReadFile(filepath.Join(out_dir, EXPORT_MANIFEST))
+	if err != nil {
+		return exportManifest{}, err
+	}
+
+	var manifest exportManifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return exportManifest{}, err
+	}
+	return manifest, nil
+}
+
+func writeExportManifest(out_dir string, manifest exportManifest) error {
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(out_dir, EXPORT_MANIFEST), encoded, 0644)
+}
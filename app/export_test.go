@@ -0,0 +1,225 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFilePath(t *testing.T) {
+	assert.Equal(t, "index.html", exportFilePath("/"))
+	assert.Equal(t, "products/index.html", exportFilePath("/products/"))
+	assert.Equal(t, "post/1/index.html", exportFilePath("/post/1"))
+	assert.Equal(t, "etc/passwd/index.html", exportFilePath("/../../etc/passwd"))
+}
+
+func TestRewriteExportLinks(t *testing.T) {
+	html := []byte(`<a href="/post/1">post</a><a href="//cdn.com/x.js"></a>` +
+		`<div data-geo-endpoint="/api/images/geo?gallery=my+cats"></div>` +
+		`<div data-geo-endpoint="/api/images/geo"></div><a href="/">home</a>`)
+
+	assert.Equal(t, `<a href="/post/1">post</a><a href="//cdn.com/x.js"></a>`+
+		`<div data-geo-endpoint="/api/images/geo/my%20cats.json"></div>`+
+		`<div data-geo-endpoint="/api/images/geo.json"></div><a href="/">home</a>`, string(rewriteExportLinks(html, "")))
+
+	assert.Equal(t, `<a href="/blog/post/1">post</a><a href="//cdn.com/x.js"></a>`+
+		`<div data-geo-endpoint="/blog/api/images/geo/my%20cats.json"></div>`+
+		`<div data-geo-endpoint="/blog/api/images/geo.json"></div><a href="/blog/">home</a>`, string(rewriteExportLinks(html, "/blog/")))
+}
+
+func makeExportDatabase(posts map[int]common.Post) mocks.DatabaseMock {
+	page := common.Page{Id: 1, Title: "About", Content: "about us", Link: "about"}
+	return mocks.DatabaseMock{
+		GetPostsHandler: func(offset int, limit int) ([]common.Post, error) {
+			all_posts := make([]common.Post, 0)
+			for _, post := range posts {
+				all_posts = append(all_posts, common.Post{Id: post.Id, Title: post.Title, Excerpt: post.Excerpt})
+			}
+			sort.Slice(all_posts, func(i, j int) bool { return all_posts[i].Id < all_posts[j].Id })
+			return all_posts, nil
+		},
+		GetPostHandler: func(id int) (common.Post, error) {
+			post, exists := posts[id]
+			if !exists {
+				return common.Post{}, fmt.Errorf("post not found")
+			}
+			return post, nil
+		},
+		GetPagesHandler: func(offset int, limit int) ([]common.Page, error) {
+			return []common.Page{page}, nil
+		},
+		GetPageByIdHandler: func(id int) (common.Page, error) {
+			return page, nil
+		},
+		GetPageTreeHandler: func() ([]common.Page, error) {
+			return []common.Page{{Id: page.Id, Title: page.Title, Link: page.Link, Path: page.Link}}, nil
+		},
+		GetCardSchemasHandler: func(offset int, limit int) ([]common.CardSchema, error) {
+			return []common.CardSchema{}, nil
+		},
+	}
+}
+
+func TestExportSite(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	// The export never renders from the cache
+	common.GetSettings(common.AppSettings{ImageDirectory: t.TempDir(), CacheEnabled: true})
+	settings := common.CurrentSettings()
+
+	static_dir := t.TempDir()
+	require.Nil(t, os.MkdirAll(filepath.Join(static_dir, "css"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(static_dir, "css", "style.css"), []byte("body {}"), 0644))
+
+	posts := map[int]common.Post{
+		1: {Id: 1, Title: "First", Excerpt: "first post", Content: "hello"},
+		2: {Id: 2, Title: "Second", Excerpt: "second post", Content: "world"},
+	}
+	db := makeExportDatabase(posts)
+	options := ExportOptions{OutDir: t.TempDir(), StaticDir: static_dir, Incremental: true}
+
+	report, err := ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Empty(t, report.Failed)
+	assert.Equal(t, 0, report.Skipped)
+	assert.Equal(t, 1, report.Assets)
+	assert.Same(t, settings, common.CurrentSettings())
+	assert.True(t, settings.CacheEnabled)
+
+	for _, file := range []string{
+		"index.html", "post/1/index.html", "post/2/index.html", "posts/1/index.html",
+		"pages/index.html", "page/about/index.html", "map/index.html", "404.html",
+		"api/images/geo.json", "static/css/style.css", EXPORT_MANIFEST,
+	} {
+		assert.FileExists(t, filepath.Join(options.OutDir, file))
+	}
+	post, err := os.ReadFile(filepath.Join(options.OutDir, "post/1/index.html"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(post), "hello")
+	map_page, err := os.ReadFile(filepath.Join(options.OutDir, "map/index.html"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(map_page), `"/api/images/geo.json"`)
+
+	// Nothing changed
+	rendered := report.Rendered
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, 0, report.Rendered)
+	assert.Equal(t, rendered, report.Skipped)
+	assert.Equal(t, 0, report.Assets)
+
+	// Only the changed post is rendered again
+	posts[1] = common.Post{Id: 1, Title: "First", Excerpt: "first post", Content: "hello again"}
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, 1, report.Rendered)
+	post, err = os.ReadFile(filepath.Join(options.OutDir, "post/1/index.html"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(post), "hello again")
+
+	// Deleted posts are removed from the export
+	delete(posts, 2)
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, 1, report.Removed)
+	assert.NoFileExists(t, filepath.Join(options.OutDir, "post/2/index.html"))
+}
+
+func TestExportSiteOfHost(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	common.GetSettings(common.AppSettings{
+		ImageDirectory: image_directory,
+		Galleries:      map[string]common.Gallery{"cats": {Name: "Cats"}},
+		Sites: []common.Site{{Id: 2, Name: "blog", Hosts: []string{"blog.example.com"},
+			Galleries: map[string]common.Gallery{"shoes": {Name: "Shoes", Images: []string{"shoe.json"}}}}},
+	})
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "cat.png"), []byte("cat"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "cat.json"), []byte(`{"filename": "cat.png"}`), 0644))
+	site_directory := common.SiteImageDirectory(2)
+	require.Nil(t, os.MkdirAll(site_directory, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(site_directory, "shoe.png"), []byte("shoe"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(site_directory, "shoe.json"), []byte(`{"filename": "shoe.png"}`), 0644))
+
+	db := makeExportDatabase(map[int]common.Post{})
+	options := ExportOptions{OutDir: t.TempDir(), StaticDir: t.TempDir(), Host: "blog.example.com"}
+	report, err := ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Empty(t, report.Failed)
+
+	// The pages, galleries and media of the site only
+	for _, file := range []string{"images/shoe.png/index.html", "gallery/shoes/index.html", "api/images/geo/shoes.json", "images/data/shoe.png", "media/shoe.json"} {
+		assert.FileExists(t, filepath.Join(options.OutDir, file))
+	}
+	for _, file := range []string{"images/cat.png", "gallery/cats", "images/data/cat.png", "images/data/sites"} {
+		assert.NoFileExists(t, filepath.Join(options.OutDir, file))
+		assert.NoDirExists(t, filepath.Join(options.OutDir, file))
+	}
+
+	// The default site leaves the other sites out
+	options = ExportOptions{OutDir: t.TempDir(), StaticDir: t.TempDir()}
+	_, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.FileExists(t, filepath.Join(options.OutDir, "images/data/cat.png"))
+	assert.DirExists(t, filepath.Join(options.OutDir, "gallery/cats"))
+	assert.NoDirExists(t, filepath.Join(options.OutDir, "images/data/sites"))
+	assert.NoDirExists(t, filepath.Join(options.OutDir, "gallery/shoes"))
+}
+
+func TestExportSiteAfterSettingsChange(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.GetSettings(common.AppSettings{ImageDirectory: t.TempDir()})
+
+	db := makeExportDatabase(map[int]common.Post{1: {Id: 1, Title: "First", Excerpt: "first post", Content: "hello"}})
+	settings := map[string]string{"sticky_posts": "[]"}
+	db.GetSettingsHandler = func() (map[string]string, error) {
+		return settings, nil
+	}
+	options := ExportOptions{OutDir: t.TempDir(), StaticDir: t.TempDir(), Incremental: true}
+	report, err := ExportSite(&db, options)
+	require.Nil(t, err)
+	rendered := report.Rendered
+
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, 0, report.Rendered)
+
+	// The settings of the site show up on every page
+	settings = map[string]string{"sticky_posts": "[1]"}
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, rendered, report.Rendered)
+	assert.Equal(t, 0, report.Skipped)
+}
+
+func TestExportSiteAfterMenusChange(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.GetSettings(common.AppSettings{ImageDirectory: t.TempDir()})
+
+	db := makeExportDatabase(map[int]common.Post{1: {Id: 1, Title: "First", Excerpt: "first post", Content: "hello"}})
+	menus := []common.Menu{}
+	db.GetMenusHandler = func() ([]common.Menu, error) {
+		return menus, nil
+	}
+	options := ExportOptions{OutDir: t.TempDir(), StaticDir: t.TempDir(), Incremental: true}
+	report, err := ExportSite(&db, options)
+	require.Nil(t, err)
+	rendered := report.Rendered
+
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, 0, report.Rendered)
+
+	// The menus of the site show up on every page
+	menus = []common.Menu{{Id: 1, Name: "main", Location: "navbar"}}
+	report, err = ExportSite(&db, options)
+	require.Nil(t, err)
+	assert.Equal(t, rendered, report.Rendered)
+	assert.Equal(t, 0, report.Skipped)
+}
@@ -15,7 +15,7 @@ import (
 //
 // The manifest files in "gallery.links" should
 // be relative to the image directory
-func getGalleryImages(gallery common.Gallery) ([]common.Image, error) {
+func getGalleryImages(site_id int, gallery common.Gallery) ([]common.Image, error) {
 
 	// Get all images from the manifests listed in gallery
 	// image_paths := make([]string, 0)
@@ -37,7 +37,7 @@ func getGalleryImages(gallery common.Gallery) ([]common.Image, error) {
 	// }
 
 	// HACK: just getting all the
-	images, err := common.GetImages(gallery.Images, len(gallery.Images), 1)
+	images, err := common.GetImages(site_id, gallery.Images, len(gallery.Images), 1)
 	if err != nil {
 		return []common.Image{}, err
 	}
@@ -54,18 +54,20 @@ func galleryHandler(c *gin.Context, database database.Database) ([]byte, error)
 		return []byte{}, err
 	}
 
-	gallery, exists := common.Settings.Galleries[get_gallery_binding.Name]
+	gallery, exists := currentSite(c).Galleries[get_gallery_binding.Name]
 	if !exists {
 		return []byte{}, fmt.Errorf("requested gallery `%s` does not exist", gallery.Name)
 	}
 
+	tagCacheEntry(c, common.GalleryCacheTag(get_gallery_binding.Name), common.CACHE_TAG_IMAGES)
+
 	// TODO : Get valid images for a gallery
-	images, err := getGalleryImages(gallery)
+	images, err := getGalleryImages(currentSite(c).Id, gallery)
 	if err != nil {
 		return []byte{}, fmt.Errorf("could not get gallery: %v", err)
 	}
 
-	gallery_view := views.MakeImagesPage(images, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	gallery_view := views.MakeGalleryPage(gallery, images, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
 	html_buffer := bytes.NewBuffer(nil)
 	err = gallery_view.Render(c, html_buffer)
 	if err != nil {
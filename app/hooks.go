@@ -0,0 +1,22 @@
+package app
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rs/zerolog/log"
+)
+
+// Plugins of the render and contact_submit events, loaded
+// from the settings by SetupRoutes
+var app_hooks = &plugins.Hooks{}
+
+// HTML of the content after the render plugins, it is left
+// as is when one of them fails
+func runRenderHooks(c *gin.Context, title string, html string) string {
+	content := plugins.RenderedContent{Path: c.Request.URL.Path, Title: title, Html: html}
+	if err := app_hooks.Run(c.Request.Context(), plugins.EVENT_RENDER, &content); err != nil {
+		log.Error().Msgf("render plugins failed on %s: %v", content.Path, err)
+		return html
+	}
+	return content.Html
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const app_test_plugin = `
+function render(content)
+	if content.title == "Broken" then
+		error("cannot render")
+	end
+	content.html = content.html .. "<p>seen at " .. content.path .. "</p>"
+	return content
+end
+
+function contact_submit(submission)
+	if string.find(submission.message, "buy now") then
+		error("spam from " .. submission.email)
+	end
+	return {email = string.lower(submission.email)}
+end
+`
+
+func loadAppHooks(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "app.lua")
+	require.Nil(t, os.WriteFile(script, []byte(app_test_plugin), 0644))
+	require.Nil(t, app_hooks.Reload([]common.Plugin{{Name: "app", Script: script, Events: []string{plugins.EVENT_RENDER, plugins.EVENT_CONTACT_SUBMIT}}}))
+	t.Cleanup(func() { app_hooks.Reload(nil) })
+}
+
+func TestRenderHooks(t *testing.T) {
+	loadAppHooks(t)
+	title := "Post"
+	database := mocks.DatabaseMock{
+		GetPostHandler: func(id int) (common.Post, error) {
+			return common.Post{Id: id, Title: title, Content: "Hello"}, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	render := func() string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/post/1", nil)
+		c.Params = gin.Params{{Key: "id", Value: "1"}}
+		html, err := postHandler(c, database)
+		require.Nil(t, err)
+		return string(html)
+	}
+
+	assert.Contains(t, render(), "<p>Hello</p>\n<p>seen at /post/1</p>")
+
+	// The content is served as is when a plugin fails
+	title = "Broken"
+	html := render()
+	assert.Contains(t, html, "<p>Hello</p>")
+	assert.NotContains(t, html, "seen at")
+}
+
+func TestContactSubmitHooks(t *testing.T) {
+	loadAppHooks(t)
+	// Sending fails without the MailerSend settings, after the plugins ran
+	t.Setenv("MAILERSEND_API_KEY", "")
+
+	gin.SetMode(gin.TestMode)
+	submit := func(message string) string {
+		form := url.Values{"name": {"Ann"}, "email": {"Ann@Example.com"}, "subject": {"Hi"}, "message": {message}}
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest("POST", "/contact-send", strings.NewReader(form.Encode()))
+		c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		makeContactFormHandler()(c)
+		return recorder.Body.String()
+	}
+
+	body := submit("buy now")
+	assert.Contains(t, body, "spam from Ann@Example.com")
+	// Without the script path and traceback
+	assert.NotContains(t, body, "app.lua")
+	assert.NotContains(t, body, "traceback")
+
+	body = submit("Hello there")
+	assert.Contains(t, body, "Failed to send message from ann@example.com")
+	assert.Contains(t, body, "server email configuration is incomplete")
+}
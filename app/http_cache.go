@@ -0,0 +1,235 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ENCODING_GZIP   = "gzip"
+	ENCODING_BROTLI = "br"
+	// Pages smaller than this are not worth compressing
+	MIN_COMPRESS_SIZE = 1024
+)
+
+// Preferred first when the client accepts both
+var COMPRESSED_ENCODINGS = []string{ENCODING_BROTLI, ENCODING_GZIP}
+
+// Builds the entry for a rendered page with its ETag, the
+// cache sets the expiry time. The compressed variants are
+// only made for the entries that get stored.
+func makeEndpointCache(name string, contents []byte) EndpointCache {
+	return EndpointCache{
+		Name:         name,
+		Contents:     contents,
+		ETag:         pageETag(contents),
+		LastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// Strong ETag from the contents, so every replica
+// gives the same ETag for the same page
+func pageETag(contents []byte) string {
+	hash := sha256.Sum256(contents)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+func compressContents(contents []byte, encoding string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case ENCODING_GZIP:
+		writer = gzip.NewWriter(&buffer)
+	case ENCODING_BROTLI:
+		writer = brotli.NewWriterLevel(&buffer, brotli.DefaultCompression)
+	default:
+		return nil, fmt.Errorf("unknown content encoding `%s`", encoding)
+	}
+
+	_, err := writer.Write(contents)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Variants smaller than the contents by encoding
+func compressVariants(contents []byte) map[string][]byte {
+	if len(contents) < MIN_COMPRESS_SIZE {
+		return nil
+	}
+
+	variants := make(map[string][]byte)
+	for _, encoding := range COMPRESSED_ENCODINGS {
+		compressed, err := compressContents(contents, encoding)
+		if err != nil {
+			log.Warn().Msgf("could not %s compress page: %v", encoding, err)
+		} else if len(compressed) < len(contents) {
+			variants[encoding] = compressed
+		}
+	}
+	return variants
+}
+
+// Pages that are not cached are only compressed
+// with the encoding the client prefers
+func compressedResponse(accept_encoding string, contents []byte) (string, []byte) {
+	if len(contents) < MIN_COMPRESS_SIZE {
+		return "", contents
+	}
+
+	available := make(map[string][]byte)
+	for _, encoding := range COMPRESSED_ENCODINGS {
+		available[encoding] = nil
+	}
+	encoding := negotiateEncoding(accept_encoding, available)
+	if encoding == "" {
+		return "", contents
+	}
+
+	compressed, err := compressContents(contents, encoding)
+	if err != nil {
+		log.Warn().Msgf("could not %s compress page: %v", encoding, err)
+		return "", contents
+	}
+	if len(compressed) >= len(contents) {
+		return "", contents
+	}
+	return encoding, compressed
+}
+
+// Returns the q-value given to the encoding in the
+// Accept-Encoding header, 0 if it's not accepted
+func encodingQuality(accept_encoding string, encoding string) float64 {
+	quality := 0.0
+	for _, accepted := range strings.Split(accept_encoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+		name = strings.TrimSpace(name)
+		if name != encoding && name != "*" {
+			continue
+		}
+
+		name_quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			name_quality = parsed
+		}
+
+		// An explicit entry always wins over `*`
+		if name == encoding {
+			return name_quality
+		}
+		quality = name_quality
+	}
+	return quality
+}
+
+// Picks the best variant the client accepts, an empty
+// string means the uncompressed contents
+func negotiateEncoding(accept_encoding string, variants map[string][]byte) string {
+	best_encoding := ""
+	best_quality := 0.0
+	for _, encoding := range COMPRESSED_ENCODINGS {
+		if _, exists := variants[encoding]; !exists {
+			continue
+		}
+		if quality := encodingQuality(accept_encoding, encoding); quality > best_quality {
+			best_encoding = encoding
+			best_quality = quality
+		}
+	}
+	return best_encoding
+}
+
+func etagMatches(if_none_match string, etag string) bool {
+	for _, candidate := range strings.Split(if_none_match, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match uses the weak comparison
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// If-None-Match takes precedence, If-Modified-Since is
+// only looked at when the client sent no ETags
+func isNotModified(request *http.Request, entry *EndpointCache) bool {
+	if if_none_match := request.Header.Get("If-None-Match"); if_none_match != "" {
+		return etagMatches(if_none_match, entry.ETag)
+	}
+
+	if if_modified_since := request.Header.Get("If-Modified-Since"); if_modified_since != "" {
+		since, err := http.ParseTime(if_modified_since)
+		if err != nil {
+			return false
+		}
+		return !entry.LastModified.After(since)
+	}
+	return false
+}
+
+// Returns the `cache_control` header configured for
+// the route, or an empty string if there is none
+func cacheControlFor(route string) string {
+	fallback := ""
+	for _, policy := range common.CurrentSettings().CacheControl {
+		if policy.Route == route {
+			return policy.Header
+		}
+		if policy.Route == "*" {
+			fallback = policy.Header
+		}
+	}
+	return fallback
+}
+
+// Writes the page with its validators, answering with
+// 304 when the client copy is still fresh
+func writeEndpoint(c *gin.Context, route string, entry *EndpointCache) {
+	header := c.Writer.Header()
+	header.Set("ETag", entry.ETag)
+	header.Set("Last-Modified", entry.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("Vary", "Accept-Encoding, HX-Request")
+	if cache_control := cacheControlFor(route); cache_control != "" {
+		header.Set("Cache-Control", cache_control)
+	}
+
+	if isNotModified(c.Request, entry) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	encoding := ""
+	contents := entry.Contents
+	if entry.Variants == nil {
+		encoding, contents = compressedResponse(c.GetHeader("Accept-Encoding"), entry.Contents)
+	} else if encoding = negotiateEncoding(c.GetHeader("Accept-Encoding"), entry.Variants); encoding != "" {
+		contents = entry.Variants[encoding]
+	}
+
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", contents)
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var LONG_PAGE = []byte(strings.Repeat("<p>gocms</p>", 200))
+
+func TestCompressVariants(t *testing.T) {
+	assert.Empty(t, compressVariants([]byte("<p>short</p>")))
+
+	variants := compressVariants(LONG_PAGE)
+	require.Contains(t, variants, ENCODING_GZIP)
+	require.Contains(t, variants, ENCODING_BROTLI)
+
+	gzip_reader, err := gzip.NewReader(bytes.NewReader(variants[ENCODING_GZIP]))
+	require.Nil(t, err)
+	contents, err := io.ReadAll(gzip_reader)
+	assert.Nil(t, err)
+	assert.Equal(t, LONG_PAGE, contents)
+
+	contents, err = io.ReadAll(brotli.NewReader(bytes.NewReader(variants[ENCODING_BROTLI])))
+	assert.Nil(t, err)
+	assert.Equal(t, LONG_PAGE, contents)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	variants := compressVariants(LONG_PAGE)
+
+	assert.Equal(t, "", negotiateEncoding("", variants))
+	assert.Equal(t, "", negotiateEncoding("identity", variants))
+	assert.Equal(t, ENCODING_GZIP, negotiateEncoding("gzip, deflate", variants))
+	assert.Equal(t, ENCODING_BROTLI, negotiateEncoding("gzip, deflate, br", variants))
+	assert.Equal(t, ENCODING_GZIP, negotiateEncoding("br;q=0.5, gzip", variants))
+	assert.Equal(t, ENCODING_GZIP, negotiateEncoding("*, br;q=0", variants))
+	assert.Equal(t, "", negotiateEncoding("gzip, br", nil))
+}
+
+func TestIsNotModified(t *testing.T) {
+	entry := makeEndpointCache("/about", []byte("about"))
+
+	request := httptest.NewRequest("GET", "/about", nil)
+	assert.False(t, isNotModified(request, &entry))
+
+	request.Header.Set("If-None-Match", `"other", W/`+entry.ETag)
+	assert.True(t, isNotModified(request, &entry))
+
+	request.Header.Set("If-None-Match", `"other"`)
+	assert.False(t, isNotModified(request, &entry))
+
+	// Ignored when If-None-Match is given
+	request.Header.Set("If-Modified-Since", entry.LastModified.Format(http.TimeFormat))
+	assert.False(t, isNotModified(request, &entry))
+
+	request.Header.Del("If-None-Match")
+	assert.True(t, isNotModified(request, &entry))
+
+	request.Header.Set("If-Modified-Since", entry.LastModified.Add(-time.Hour).Format(http.TimeFormat))
+	assert.False(t, isNotModified(request, &entry))
+}
+
+func TestCacheControlFor(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheControl = nil })
+	assert.Equal(t, "", cacheControlFor("/post/:id"))
+
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.CacheControl = []common.CacheControlPolicy{
+			{Route: "*", Header: "public, max-age=60"},
+			{Route: "/post/:id", Header: "public, max-age=300"},
+		}
+	})
+	assert.Equal(t, "public, max-age=300", cacheControlFor("/post/:id"))
+	assert.Equal(t, "public, max-age=60", cacheControlFor("/pages"))
+}
+
+func TestCacheHandlerConditionalRequests(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.CacheEnabled = true
+		settings.CacheControl = []common.CacheControlPolicy{
+			{Route: "/page/:link", Header: "public, max-age=300"},
+		}
+	})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	cache := MakeCache(1, time.Minute, &TimeValidator{})
+	generated := 0
+	addCacheHandler(r, "GET", "/page/:link", func(c *gin.Context, db database.Database) ([]byte, error) {
+		generated++
+		return LONG_PAGE, nil
+	}, &cache, mocks.DatabaseMock{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/page/about", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, LONG_PAGE, w.Body.Bytes())
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Accept-Encoding, HX-Request", w.Header().Get("Vary"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// Served from the cache with the same ETag
+	request := httptest.NewRequest("GET", "/page/about", nil)
+	request.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+	assert.Equal(t, 1, generated)
+
+	request = httptest.NewRequest("GET", "/page/about", nil)
+	request.Header.Set("Accept-Encoding", "gzip, br")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ENCODING_BROTLI, w.Header().Get("Content-Encoding"))
+	contents, err := io.ReadAll(brotli.NewReader(w.Body))
+	assert.Nil(t, err)
+	assert.Equal(t, LONG_PAGE, contents)
+}
+
+func TestUncachedPagesAreCompressedOnRequest(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheEnabled = false })
+
+	// Nothing is compressed until a client asks for it
+	entry := makeEndpointCache("/about", LONG_PAGE)
+	assert.Nil(t, entry.Variants)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	cache := MakeCache(1, time.Minute, &TimeValidator{})
+	addCacheHandler(r, "GET", "/page/:link", func(c *gin.Context, db database.Database) ([]byte, error) {
+		return LONG_PAGE, nil
+	}, &cache, mocks.DatabaseMock{})
+
+	request := httptest.NewRequest("GET", "/page/about", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ENCODING_GZIP, w.Header().Get("Content-Encoding"))
+	gzip_reader, err := gzip.NewReader(w.Body)
+	require.Nil(t, err)
+	contents, err := io.ReadAll(gzip_reader)
+	assert.Nil(t, err)
+	assert.Equal(t, LONG_PAGE, contents)
+	assert.Equal(t, uint64(0), cache.Size())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/page/about", nil))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, LONG_PAGE, w.Body.Bytes())
+}
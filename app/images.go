@@ -2,7 +2,6 @@ package app
 
 import (
 	"bytes"
-	"os"
 	"path"
 	"strconv"
 
@@ -24,27 +23,20 @@ func imagesHandler(c *gin.Context, database database.Database) ([]byte, error) {
 		}
 	}
 
-	// Get all the files inside the image directory
-	files, err := os.ReadDir(common.Settings.ImageDirectory)
+	// Get all the metadata files inside the image directory
+	filepaths, err := common.GetImageMetadataPaths(currentSite(c).Id)
 	if err != nil {
 		log.Error().Msgf("could not read files in image directory: %v", err)
 		return []byte{}, err
 	}
 
-	filepaths := common.Map(files, func(file os.DirEntry) string {
-		return file.Name()
-	})
-	filepaths = common.Filter(filepaths, func(filepath string) bool {
-		ext := path.Ext(filepath)
-		return ext == ".json"
-	})
-
-	valid_images, err := common.GetImages(filepaths, 10, pageNum)
+	valid_images, err := common.GetImages(currentSite(c).Id, filepaths, 10, pageNum)
 	if err != nil {
 		return []byte{}, err
 	}
+	tagCacheEntry(c, common.CACHE_TAG_IMAGES)
 
-	index_view := views.MakeImagesPage(valid_images, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	index_view := views.MakeImagesPage(valid_images, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
 	html_buffer := bytes.NewBuffer(nil)
 
 	err = index_view.Render(c, html_buffer)
@@ -73,5 +65,14 @@ func imageHandler(c *gin.Context, database database.Database) ([]byte, error) {
 		Ext:  ext,
 	}
 
-	return renderHtml(c, views.MakeImagePage(image, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns))
+	tagCacheEntry(c, common.CACHE_TAG_IMAGES)
+
+	return renderHtml(c, views.MakeImagePage(image, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
+}
+
+// Serves the files of the media directory of the request site
+func mediaFileHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.FileFromFS(c.Param("filepath"), common.SiteMediaFileSystem{SiteId: currentSite(c).Id})
+	}
 }
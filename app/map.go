@@ -0,0 +1,259 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/views"
+	"github.com/rs/zerolog/log"
+)
+
+// Collections with more geotagged images than this
+// will be clustered on the server before being sent
+const MAX_UNCLUSTERED_MARKERS = 100
+
+// Zoom level used when the client doesn't send one,
+// roughly a "whole world" view
+const DEFAULT_MAP_ZOOM = 2
+
+// Past this zoom level we never cluster, markers this
+// close together are better shown individually
+const MAX_CLUSTER_ZOOM = 16
+
+type GeoBoundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+type GeoGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type GeoFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoGeometry            `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []GeoFeature `json:"features"`
+}
+
+// Parses a "min_lon,min_lat,max_lon,max_lat" bounding box,
+// the same order used by the GeoJSON `bbox` member.
+func parseBoundingBox(bbox string) (GeoBoundingBox, error) {
+	values := strings.Split(bbox, ",")
+	if len(values) != 4 {
+		return GeoBoundingBox{}, fmt.Errorf("bbox must have 4 comma separated values, got %d", len(values))
+	}
+
+	coords := make([]float64, 4)
+	for i, value := range values {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return GeoBoundingBox{}, fmt.Errorf("invalid bbox value `%s`: %v", value, err)
+		}
+		coords[i] = coord
+	}
+
+	box := GeoBoundingBox{coords[0], coords[1], coords[2], coords[3]}
+	if box.MinLatitude > box.MaxLatitude {
+		return GeoBoundingBox{}, fmt.Errorf("bbox min latitude is greater than max latitude")
+	}
+
+	return box, nil
+}
+
+// Contains handles boxes crossing the antimeridian, where
+// the min longitude is greater than the max longitude.
+func (box GeoBoundingBox) Contains(location common.Location) bool {
+	lat := float64(location.Latitude)
+	lon := float64(location.Longitude)
+
+	if lat < box.MinLatitude || lat > box.MaxLatitude {
+		return false
+	}
+	if box.MinLongitude <= box.MaxLongitude {
+		return lon >= box.MinLongitude && lon <= box.MaxLongitude
+	}
+	return lon >= box.MinLongitude || lon <= box.MaxLongitude
+}
+
+func makeImageFeature(image common.Image) GeoFeature {
+	return GeoFeature{
+		Type: "Feature",
+		Geometry: GeoGeometry{
+			Type:        "Point",
+			Coordinates: []float64{float64(image.Location.Longitude), float64(image.Location.Latitude)},
+		},
+		Properties: map[string]interface{}{
+			"cluster":   false,
+			"uuid":      image.Uuid,
+			"name":      image.Name,
+			"excerpt":   image.Excerpt,
+			"date":      image.Date,
+			"place":     image.Location.Name,
+			"thumbnail": image.Filepath,
+			"link":      fmt.Sprintf("/images/%s", image.Filename),
+		},
+	}
+}
+
+// clusterImages groups the images in a grid whose cells shrink
+// as the zoom level grows, similar to how map tiles are split.
+// Cells with a single image are returned as a plain marker.
+func clusterImages(images []common.Image, zoom int) []GeoFeature {
+	features := make([]GeoFeature, 0)
+	if len(images) <= MAX_UNCLUSTERED_MARKERS || zoom >= MAX_CLUSTER_ZOOM {
+		for _, image := range images {
+			features = append(features, makeImageFeature(image))
+		}
+		return features
+	}
+
+	// A 256px tile spans 360 / 2^zoom degrees, we want
+	// roughly 4 clusters across each tile
+	cell_size := 360.0 / math.Pow(2, float64(max(zoom, 0))) / 4
+
+	type cell struct{ x, y int }
+	cells := make(map[cell][]common.Image)
+	order := make([]cell, 0)
+	for _, image := range images {
+		key := cell{
+			int(math.Floor(float64(image.Location.Longitude) / cell_size)),
+			int(math.Floor(float64(image.Location.Latitude) / cell_size)),
+		}
+		if _, exists := cells[key]; !exists {
+			order = append(order, key)
+		}
+		cells[key] = append(cells[key], image)
+	}
+
+	for _, key := range order {
+		cell_images := cells[key]
+		if len(cell_images) == 1 {
+			features = append(features, makeImageFeature(cell_images[0]))
+			continue
+		}
+
+		lat_sum, lon_sum := 0.0, 0.0
+		for _, image := range cell_images {
+			lat_sum += float64(image.Location.Latitude)
+			lon_sum += float64(image.Location.Longitude)
+		}
+		count := float64(len(cell_images))
+
+		features = append(features, GeoFeature{
+			Type: "Feature",
+			Geometry: GeoGeometry{
+				Type:        "Point",
+				Coordinates: []float64{lon_sum / count, lat_sum / count},
+			},
+			Properties: map[string]interface{}{
+				"cluster":     true,
+				"point_count": len(cell_images),
+				"thumbnail":   cell_images[0].Filepath,
+			},
+		})
+	}
+
+	return features
+}
+
+// Gets every geotagged image of the site, optionally
+// restricted to the manifests of the given gallery
+func getGeotaggedImages(site common.Site, gallery_name string) ([]common.Image, error) {
+	var metadata_paths []string
+	if gallery_name != "" {
+		gallery, exists := site.Galleries[gallery_name]
+		if !exists {
+			return []common.Image{}, fmt.Errorf("requested gallery `%s` does not exist", gallery_name)
+		}
+		metadata_paths = gallery.Images
+	} else {
+		paths, err := common.GetImageMetadataPaths(site.Id)
+		if err != nil {
+			return []common.Image{}, err
+		}
+		metadata_paths = paths
+	}
+
+	images, err := common.GetImages(site.Id, metadata_paths, len(metadata_paths), 1)
+	if err != nil {
+		return []common.Image{}, err
+	}
+
+	return common.Filter(images, func(image common.Image) bool {
+		return image.IsGeotagged()
+	}), nil
+}
+
+// GET /api/images/geo?bbox=min_lon,min_lat,max_lon,max_lat&zoom=5&gallery=cats
+func makeGeoImagesHandler() func(*gin.Context) {
+	return func(c *gin.Context) {
+		images, err := getGeotaggedImages(currentSite(c), c.Query("gallery"))
+		if err != nil {
+			log.Error().Msgf("could not get geotagged images: %v", err)
+			c.JSON(http.StatusBadRequest, common.ErrorRes("could not get geotagged images", err))
+			return
+		}
+
+		if bbox := c.Query("bbox"); bbox != "" {
+			box, err := parseBoundingBox(bbox)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, common.ErrorRes("invalid bbox parameter", err))
+				return
+			}
+			images = common.Filter(images, func(image common.Image) bool {
+				return box.Contains(image.Location)
+			})
+		}
+
+		zoom := DEFAULT_MAP_ZOOM
+		if zoom_query := c.Query("zoom"); zoom_query != "" {
+			zoom, err = strconv.Atoi(zoom_query)
+			if err != nil || zoom < 0 {
+				c.JSON(http.StatusBadRequest, common.MsgErrorRes("invalid zoom parameter"))
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, GeoFeatureCollection{
+			Type:     "FeatureCollection",
+			Features: clusterImages(images, zoom),
+		})
+	}
+}
+
+func mapHandler(c *gin.Context, db database.Database) ([]byte, error) {
+	return renderHtml(c, views.MakeMapPage("Map", "/api/images/geo", currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
+}
+
+func galleryMapHandler(c *gin.Context, db database.Database) ([]byte, error) {
+	var get_gallery_binding struct {
+		Name string `uri:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindUri(&get_gallery_binding); err != nil {
+		return []byte{}, err
+	}
+
+	gallery, exists := currentSite(c).Galleries[get_gallery_binding.Name]
+	if !exists {
+		return []byte{}, fmt.Errorf("requested gallery `%s` does not exist", get_gallery_binding.Name)
+	}
+
+	geo_endpoint := fmt.Sprintf("/api/images/geo?gallery=%s", url.QueryEscape(get_gallery_binding.Name))
+	return renderHtml(c, views.MakeMapPage(gallery.Name, geo_endpoint, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
+}
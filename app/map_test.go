@@ -0,0 +1,71 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeGeotaggedImage(name string, lat float32, lon float32) common.Image {
+	return common.Image{
+		Name:     name,
+		Location: common.Location{Latitude: lat, Longitude: lon},
+	}
+}
+
+func TestParseBoundingBox(t *testing.T) {
+	box, err := parseBoundingBox("-10.5,40,20,60.25")
+	assert.Nil(t, err)
+	assert.Equal(t, GeoBoundingBox{-10.5, 40, 20, 60.25}, box)
+
+	_, err = parseBoundingBox("1,2,3")
+	assert.NotNil(t, err)
+
+	_, err = parseBoundingBox("1,2,a,4")
+	assert.NotNil(t, err)
+
+	_, err = parseBoundingBox("0,50,10,40")
+	assert.NotNil(t, err)
+}
+
+func TestBoundingBoxContains(t *testing.T) {
+	box := GeoBoundingBox{-10, 40, 20, 60}
+	assert.True(t, box.Contains(common.Location{Latitude: 47.4, Longitude: 10.2}))
+	assert.False(t, box.Contains(common.Location{Latitude: 36.1, Longitude: 28.1}))
+
+	// Crossing the antimeridian
+	pacific := GeoBoundingBox{170, -50, -170, 0}
+	assert.True(t, pacific.Contains(common.Location{Latitude: -41, Longitude: 175}))
+	assert.True(t, pacific.Contains(common.Location{Latitude: -14, Longitude: -172}))
+	assert.False(t, pacific.Contains(common.Location{Latitude: -41, Longitude: 0}))
+}
+
+func TestClusterImages(t *testing.T) {
+	images := []common.Image{
+		makeGeotaggedImage("allgaeu", 47.46, 10.20),
+		makeGeotaggedImage("lindos", 36.09, 28.08),
+	}
+
+	// Small collections are never clustered
+	features := clusterImages(images, 0)
+	assert.Len(t, features, 2)
+	assert.Equal(t, false, features[0].Properties["cluster"])
+	assert.Equal(t, []float64{float64(float32(10.20)), float64(float32(47.46))}, features[0].Geometry.Coordinates)
+
+	many_images := make([]common.Image, 0)
+	for range MAX_UNCLUSTERED_MARKERS {
+		many_images = append(many_images, makeGeotaggedImage("allgaeu", 47.46, 10.20))
+	}
+	many_images = append(many_images, makeGeotaggedImage("lindos", 36.09, 28.08))
+
+	features = clusterImages(many_images, 2)
+	assert.Len(t, features, 2)
+	assert.Equal(t, true, features[0].Properties["cluster"])
+	assert.Equal(t, MAX_UNCLUSTERED_MARKERS, features[0].Properties["point_count"])
+	assert.Equal(t, false, features[1].Properties["cluster"])
+
+	// Zoomed in enough, every image is its own marker
+	features = clusterImages(many_images, MAX_CLUSTER_ZOOM)
+	assert.Len(t, features, MAX_UNCLUSTERED_MARKERS+1)
+}
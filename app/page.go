@@ -2,9 +2,12 @@ package app
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/a-h/templ"
 	"github.com/gin-gonic/gin"
 	"github.com/rbc33/gocms/common"
 	"github.com/rbc33/gocms/database"
@@ -12,29 +15,70 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// Pages are served at the path of links of their ancestors,
+// they are found by walking it from the top level. Moved and
+// renamed pages are found by their last link and redirect
+// to their current path.
 func pageHandler(c *gin.Context, database database.Database) ([]byte, error) {
-	var page_binding common.PageLinkBinding
-	err := c.ShouldBindUri(&page_binding)
-
-	if err != nil || len(page_binding.Link) == 0 {
+	page_path := strings.Trim(c.Param("path"), "/")
+	link := page_path[strings.LastIndex(page_path, "/")+1:]
+	if len(link) == 0 {
 		// TODO : we should be serving an error page
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page uri"})
+		return nil, fmt.Errorf("invalid page path `%s`", page_path)
+	}
 
+	tree, err := database.GetPageTree()
+	if err != nil {
 		return nil, err
 	}
+	// The breadcrumbs and children show the other pages
+	tagCacheEntry(c, common.CACHE_TAG_PAGES)
 
-	// Get the page with the ID
-	page, err := database.GetPage(page_binding.Link)
+	tree_page, found := common.PageAtPath(tree, page_path)
+	if !found {
+		moved_page := common.Page{}
+		if page_id, err := database.GetPageRedirect(link); err == nil {
+			moved_page = findPage(tree, page_id)
+		} else if page, err := database.GetPage(link); err == nil {
+			moved_page = findPage(tree, page.Id)
+		}
+		if moved_page.Path != "" {
+			c.Redirect(http.StatusMovedPermanently, "/page/"+moved_page.Path)
+			return nil, fmt.Errorf("page `%s` moved to `%s`", page_path, moved_page.Path)
+		}
+		// TODO : serve the error page instead
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page Not Found"})
+		return nil, fmt.Errorf("page `%s` not found", page_path)
+	}
 
-	if err != nil || page.Content == "" {
+	page, err := database.GetPageById(tree_page.Id)
+	if err != nil || (page.Content == "" && len(page.Blocks) == 0) {
 		// TODO : serve the error page instead
 		c.JSON(http.StatusNotFound, gin.H{"error": "Page Not Found"})
-		return nil, err
+		return nil, fmt.Errorf("page `%s` not found: %v", page_path, err)
+	}
+	tagCacheEntry(c, common.PageCacheTag(page.Link), common.PageIdCacheTag(page.Id))
+
+	breadcrumbs := []common.Link{}
+	for _, ancestor := range common.PageAncestors(tree, page.Id) {
+		breadcrumbs = append(breadcrumbs, common.Link{Name: ancestor.Title, Href: "/page/" + ancestor.Path})
+	}
+	breadcrumbs = append(breadcrumbs, common.Link{Name: page.Title})
+	children := []common.Link{}
+	for _, child := range common.PageChildren(tree, page.Id) {
+		children = append(children, common.Link{Name: child.Title, Href: "/page/" + child.Path})
 	}
 
 	// Generate HTML page
-	page.Content = string(mdToHTML([]byte(page.Content)))
-	post_view := views.MakePage(page.Title, page.Content, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	var post_view templ.Component
+	if len(page.Blocks) > 0 {
+		blocks, scripts := renderBlocks(c, database, page.Blocks)
+		post_view = views.MakeBlocksPage(page.Title, blocks, scripts, breadcrumbs, children, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
+	} else {
+		page.Content = runRenderHooks(c, page.Title, renderMarkdown(c.Request.Context(), page.Content))
+		post_view = views.MakePage(page.Title, page.Content, breadcrumbs, children, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
+	}
 	html_buffer := bytes.NewBuffer(nil)
 	if err = post_view.Render(c, html_buffer); err != nil {
 		log.Error().Msgf("could not render: %v", err)
@@ -43,6 +87,15 @@ func pageHandler(c *gin.Context, database database.Database) ([]byte, error) {
 	return html_buffer.Bytes(), nil
 }
 
+func findPage(pages []common.Page, id int) common.Page {
+	for _, page := range pages {
+		if page.Id == id {
+			return page
+		}
+	}
+	return common.Page{}
+}
+
 func getPagesHandler(c *gin.Context, db database.Database) ([]byte, error) {
 
 	pageNum := 1 // Default to page 0
@@ -54,16 +107,25 @@ func getPagesHandler(c *gin.Context, db database.Database) ([]byte, error) {
 			log.Error().Msgf("Invalid page number: %s", pageNumQuery)
 		}
 	}
-	limit := 10 // or whatever limit you want
+	limit := ITEMS_PER_PAGE
 	offset := max((pageNum-1)*limit, 0)
 
 	pages, err := db.GetPages(limit, offset)
 	if err != nil {
 		return nil, err
 	}
+	tree, err := db.GetPageTree()
+	if err != nil {
+		return nil, err
+	}
+	paths := common.PagePaths(tree)
+	for i := range pages {
+		pages[i].Path = paths[pages[i].Id]
+	}
+	tagCacheEntry(c, common.CACHE_TAG_PAGES)
 
 	// if not cached, create the cache
-	pages_view := views.MakeAllPages(pages, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	pages_view := views.MakeAllPages(pages, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
 	html_buffer := bytes.NewBuffer(nil)
 
 	err = pages_view.Render(c, html_buffer)
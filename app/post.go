@@ -4,9 +4,6 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gomarkdown/markdown"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/gomarkdown/markdown/parser"
 	"github.com/rbc33/gocms/common"
 	"github.com/rbc33/gocms/database"
 	"github.com/rbc33/gocms/views"
@@ -14,27 +11,13 @@ import (
 )
 
 func serveErrorPage(c *gin.Context, err string, error_code int) error {
-	error_view := views.MakeErrorPage(err, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns)
+	error_view := views.MakeErrorPage(err, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns)
 	if err := TemplRender(c, error_code, error_view); err != nil {
 		log.Error().Msgf("Could not render: %v", err)
 	}
 	return nil
 }
 
-func mdToHTML(md []byte) []byte {
-	// create markdown parser with extensions
-	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock
-	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse(md)
-
-	// create HTML renderer with extensions
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank
-	opts := html.RendererOptions{Flags: htmlFlags}
-	renderer := html.NewRenderer(opts)
-
-	return markdown.Render(doc, renderer)
-}
-
 func postHandler(c *gin.Context, database database.Database) ([]byte, error) {
 
 	var post_binding common.PostIdBinding
@@ -62,8 +45,10 @@ func postHandler(c *gin.Context, database database.Database) ([]byte, error) {
 		return nil, err
 	}
 
+	tagCacheEntry(c, common.PostCacheTag(post.Id))
+
 	// Generate HTML page
-	post.Content = string(mdToHTML([]byte(post.Content)))
+	post.Content = runRenderHooks(c, post.Title, renderMarkdown(c.Request.Context(), post.Content))
 
-	return renderHtml(c, views.MakePostPage(post.Title, post.Content, common.Settings.AppNavbar.Links, common.Settings.AppNavbar.Dropdowns))
+	return renderHtml(c, views.MakePostPage(post.Title, post.Content, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
 }
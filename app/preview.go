@@ -0,0 +1,40 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/views"
+	"github.com/rs/zerolog/log"
+)
+
+// Drafts shared from the admin-app, served outside of the
+// cache so the links stop working once they expire
+func makePreviewHandler(db database.Database) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Robots-Tag", "noindex")
+
+		preview, err := siteDatabase(c, db).GetPostPreview(c.Param("id"))
+		if err == nil && time.Now().After(preview.ExpiresAt) {
+			err = fmt.Errorf("expired at %v", preview.ExpiresAt)
+		}
+		if err != nil {
+			log.Warn().Msgf("could not get post preview %s: %v", c.Param("id"), err)
+			serveErrorPage(c, "preview not found or expired", http.StatusNotFound)
+			return
+		}
+
+		content := renderMarkdown(c.Request.Context(), preview.Content)
+		buffer, err := renderHtml(c, views.MakePostPage(preview.Title, content, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, common.ErrorRes("could not render HTML", err))
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", buffer)
+	}
+}
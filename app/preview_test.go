@@ -0,0 +1,52 @@
+package app
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewLink(t *testing.T) {
+	db := mocks.DatabaseMock{
+		GetPostPreviewHandler: func(uuid string) (common.PostPreview, error) {
+			switch uuid {
+			case "draft":
+				return common.PostPreview{Uuid: uuid, Title: "Draft", Content: "# Soon\n\n![Sky](/images/data/sky.png)", ExpiresAt: time.Now().Add(time.Hour)}, nil
+			case "late":
+				return common.PostPreview{Uuid: uuid, Title: "Late", Content: "Gone", ExpiresAt: time.Now().Add(-time.Second)}, nil
+			}
+			return common.PostPreview{}, sql.ErrNoRows
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/preview/:id", makePreviewHandler(db))
+	request := func(uri string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+		return w
+	}
+
+	w := request("/preview/draft")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<!doctype html>")
+	assert.Contains(t, w.Body.String(), `<h1 id="soon">Soon</h1>`)
+	assert.Contains(t, w.Body.String(), `<img src="/images/data/sky.png" alt="Sky"`)
+	// Drafts stay out of caches and search engines
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "noindex", w.Header().Get("X-Robots-Tag"))
+
+	w = request("/preview/late")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "Gone")
+	assert.Equal(t, http.StatusNotFound, request("/preview/missing").Code)
+}
@@ -1,8 +1,16 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rbc33/gocms/common"
@@ -10,55 +18,153 @@ import (
 	"github.com/rbc33/gocms/views"
 )
 
-func productHandler(c *gin.Context, db database.Database) ([]byte, error) {
+// Cards shown on each page of the product listings
+const PRODUCTS_PER_PAGE = 10
+
+// `filter[<field>]` matches any of the values, `filter[<field>][<op>]`
+// compares numbers, e.g. `filter[price][lt]=100`
+var product_filter_regex = regexp.MustCompile(`^filter\[([A-Za-z_][A-Za-z0-9_]*)\](?:\[([a-z]+)\])?$`)
+
+// Filters and sort of the listing query string, checked
+// against the fields of the schema. Empty values are
+// left out, forms send the inputs that weren't filled.
+func productFilters(query url.Values, fields []common.CardField) ([]common.CardFilter, string, error) {
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	filters := []common.CardFilter{}
+	for _, name := range names {
+		matches := product_filter_regex.FindStringSubmatch(name)
+		if matches == nil {
+			continue
+		}
+		filter := common.CardFilter{Field: matches[1], Op: matches[2]}
+		if filter.Op == "" {
+			filter.Op = common.FILTER_EQ
+		}
+		for _, value := range query[name] {
+			if value != "" {
+				filter.Values = append(filter.Values, value)
+			}
+		}
+		if len(filter.Values) == 0 {
+			continue
+		}
 
+		field_index := slices.IndexFunc(fields, func(field common.CardField) bool { return field.Name == filter.Field })
+		if field_index < 0 {
+			return nil, "", fmt.Errorf("products can't be filtered by `%s`", filter.Field)
+		}
+		if err := fields[field_index].CheckFilter(filter); err != nil {
+			return nil, "", err
+		}
+		filters = append(filters, filter)
+	}
+
+	sort_by := query.Get("sort")
+	if sort_by != "" {
+		field := strings.TrimPrefix(sort_by, "-")
+		if !slices.ContainsFunc(fields, func(schema_field common.CardField) bool { return schema_field.Name == field }) {
+			return nil, "", fmt.Errorf("products can't be sorted by `%s`", field)
+		}
+	}
+	return filters, sort_by, nil
+}
+
+// Product listings can be filtered by the enum, number and boolean
+// fields of the schema, htmx requests get the listing without the
+// layout so filter changes don't reload the page
+func productHandler(c *gin.Context, db database.Database) ([]byte, error) {
 	// Used only for destructing the URI params
 	var params struct {
 		Schema string `uri:"schema" binding:"required"`
-		Limit  int    `uri:"limit"`
-		Page   int    `uri:"page"`
 	}
 
 	err := c.ShouldBindUri(&params)
-
 	if err != nil {
 		return []byte{}, fmt.Errorf("could not bind url params: %v", err)
 	}
 
-	if (params.Limit == 0) && (params.Page != 0) {
-		return []byte{}, fmt.Errorf("card limit is 0 but pages is %d", params.Page)
+	schema, err := db.GetCardSchema(params.Schema)
+	if err != nil {
+		return []byte{}, fmt.Errorf("could not get card schema: %v", err)
 	}
+	tagCacheEntry(c, common.SchemaCacheTag(params.Schema), common.CACHE_TAG_CARDS, common.CACHE_TAG_SCHEMAS)
 
-	if (params.Page == 0) && (params.Limit != 0) {
-		return []byte{}, fmt.Errorf("card page is 0 but limit is %d", params.Limit)
+	fields, err := common.CardFilterFields(schema.Schema)
+	if err != nil {
+		return []byte{}, err
 	}
 
-	limit := params.Limit
-	page := params.Page
-	if (params.Limit == 0) && (params.Page == 0) {
-		limit = 10
-		page = 0
+	filters, sort_by, err := productFilters(c.Request.URL.Query(), fields)
+	page := 1
+	if err == nil && c.Query("page") != "" {
+		page, err = strconv.Atoi(c.Query("page"))
+		if err == nil && page < 1 {
+			err = fmt.Errorf("page %d is out of range", page)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, common.ErrorRes("invalid product query", err))
+		return []byte{}, err
 	}
 
-	cards, err := db.GetCards(params.Schema, int(limit), int(page))
+	cards, total, err := db.GetCards(params.Schema, common.CardQuery{
+		Limit:      PRODUCTS_PER_PAGE,
+		Offset:     (page - 1) * PRODUCTS_PER_PAGE,
+		SortBy:     strings.TrimPrefix(sort_by, "-"),
+		Descending: strings.HasPrefix(sort_by, "-"),
+		Filters:    filters,
+	})
 	if err != nil {
 		return []byte{}, fmt.Errorf("could not get cards: %v", err)
 	}
 
+	facets, err := db.GetCardFacets(params.Schema, fields, filters)
+	if err != nil {
+		return []byte{}, fmt.Errorf("could not count cards: %v", err)
+	}
+
+	cards_data, err := cardsData(c.Request.Context(), cards)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	listing := views.ProductListing{
+		Schema:  params.Schema,
+		Cards:   cards_data,
+		Facets:  facets,
+		Filters: filters,
+		Sort:    sort_by,
+		Page:    page,
+		Pages:   (total + PRODUCTS_PER_PAGE - 1) / PRODUCTS_PER_PAGE,
+		Total:   total,
+	}
+	if isHtmxRequest(c.Request) {
+		return renderHtml(c, views.MakeProductListing(listing))
+	}
+	return renderHtml(c, views.MakeProductListPage(listing, currentSite(c).AppNavbar.Links, currentSite(c).AppNavbar.Dropdowns))
+}
+
+// Fields of the cards for the card grid, with the image
+func cardsData(ctx context.Context, cards []common.Card) ([]map[string]interface{}, error) {
 	// TODO : this isn't very efficient as we transform
 	// TODO : the card data to a JSON string, only to
 	// TODO : deserialise it into a map of interface
 	cards_data := make([]map[string]interface{}, 0)
 	for _, card := range cards {
 		var card_data map[string]interface{}
-		err = json.Unmarshal([]byte(card.Content), &card_data)
+		err := json.Unmarshal([]byte(card.Content), &card_data)
 		if err != nil {
-			return []byte{}, fmt.Errorf("could not parse card json")
+			return nil, fmt.Errorf("could not parse card json")
 		}
+		card_data = expandCardShortcodes(ctx, card_data).(map[string]interface{})
 		// Añade el campo image al mapa
 		card_data["image"] = card.Image
 		cards_data = append(cards_data, card_data)
 	}
-
-	return renderHtml(c, views.MakeProductPage(common.Settings.AppNavbar.Links, cards_data, common.Settings.AppNavbar.Dropdowns))
+	return cards_data, nil
 }
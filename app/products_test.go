@@ -0,0 +1,132 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const product_schema = `{
+	"type": "object",
+	"properties": {
+		"title": {"type": "string"},
+		"price": {"type": "number", "title": "Price"},
+		"color": {"type": "string", "enum": ["red", "blue"]},
+		"in_stock": {"type": "boolean"}
+	}
+}`
+
+func TestCardFilterFields(t *testing.T) {
+	fields, err := common.CardFilterFields(product_schema)
+	require.Nil(t, err)
+	assert.Equal(t, []common.CardField{
+		{Name: "color", Title: "color", Type: common.CARD_FIELD_ENUM, Enum: []string{"red", "blue"}},
+		{Name: "in_stock", Title: "in_stock", Type: common.CARD_FIELD_BOOLEAN},
+		{Name: "price", Title: "Price", Type: common.CARD_FIELD_NUMBER},
+	}, fields)
+}
+
+func TestProductFilters(t *testing.T) {
+	fields, err := common.CardFilterFields(product_schema)
+	require.Nil(t, err)
+
+	query, _ := url.ParseQuery("filter[price][lt]=100&filter[color]=red&filter[color]=blue&filter[price][gte]=&sort=-price&page=2")
+	filters, sort_by, err := productFilters(query, fields)
+	assert.Nil(t, err)
+	assert.Equal(t, "-price", sort_by)
+	assert.Equal(t, []common.CardFilter{
+		{Field: "color", Op: common.FILTER_EQ, Values: []string{"red", "blue"}},
+		{Field: "price", Op: common.FILTER_LT, Values: []string{"100"}},
+	}, filters)
+
+	for _, invalid := range []string{
+		"filter[title]=Shoe",
+		"filter[price][lt]=cheap",
+		"filter[price][like]=1",
+		"filter[color]=green",
+		"filter[color][lt]=red",
+		"filter[in_stock]=yes",
+		"sort=title",
+	} {
+		query, _ := url.ParseQuery(invalid)
+		_, _, err := productFilters(query, fields)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestProductListing(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.CacheEnabled = true })
+
+	var queries []common.CardQuery
+	db := mocks.DatabaseMock{
+		GetCardSchemaHandler: func(uuid string) (common.CardSchema, error) {
+			return common.CardSchema{Uuid: uuid, Schema: product_schema}, nil
+		},
+		GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+			queries = append(queries, query)
+			return []common.Card{{Image: "shoe.jpg", Content: `{"title": "Shoe", "slogan": "New", "excerpt": "Comfy", "price": 50}`}}, 25, nil
+		},
+		GetCardFacetsHandler: func(schema_uuid string, fields []common.CardField, filters []common.CardFilter) ([]common.CardFacet, error) {
+			return []common.CardFacet{
+				{Field: fields[0], Values: []common.FacetValue{{Value: "red", Count: 20}, {Value: "blue", Count: 5}}, Count: 25},
+				{Field: fields[2], Min: 10, Max: 250, Count: 25},
+			}, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var cache Cache = MakeCache(1, time.Minute, &TimeValidator{})
+	addCacheHandler(r, "GET", "/products/:schema", productHandler, &cache, db)
+
+	request := func(uri string, htmx bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", uri, nil)
+		if htmx {
+			req.Header.Set("HX-Request", "true")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	uri := "/products/shoes?filter%5Bcolor%5D=red&sort=-price&page=2"
+	w := request(uri, false)
+	require.Equal(t, http.StatusOK, w.Code)
+	html := w.Body.String()
+	assert.Contains(t, html, "<!doctype html>")
+	assert.Contains(t, html, "Shoe")
+	assert.Contains(t, html, "25 products")
+	assert.Contains(t, html, `value="red" checked`)
+	assert.Contains(t, html, `placeholder="250"`)
+	assert.Contains(t, html, `<option value="-price" selected>`)
+	// The other pages keep the filters
+	assert.Contains(t, html, `hx-get="/products/shoes?filter%5Bcolor%5D=red&amp;page=3&amp;sort=-price"`)
+	assert.Equal(t, common.CardQuery{
+		Limit: PRODUCTS_PER_PAGE, Offset: PRODUCTS_PER_PAGE, SortBy: "price", Descending: true,
+		Filters: []common.CardFilter{{Field: "color", Op: common.FILTER_EQ, Values: []string{"red"}}},
+	}, queries[0])
+
+	// htmx gets the listing without the layout, cached apart
+	w = request(uri, true)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<!doctype html>")
+	assert.Contains(t, w.Body.String(), `id="product-listing"`)
+	assert.Contains(t, request(uri, false).Body.String(), "<!doctype html>")
+	assert.Len(t, queries, 2)
+	_, err := cache.Get("~" + uri)
+	assert.Nil(t, err)
+	// Path invalidations reach the partials too
+	assert.Equal(t, 2, cache.InvalidateTag(common.PathCacheTag("/products/shoes")))
+
+	assert.Equal(t, http.StatusBadRequest, request("/products/shoes?filter%5Bprice%5D%5Blt%5D=cheap", false).Code)
+	assert.Equal(t, http.StatusBadRequest, request("/products/shoes?page=0", false).Code)
+}
@@ -0,0 +1,380 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rbc33/gocms/common"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	REDIS_CACHE_PREFIX  = "gocms:cache:"
+	REDIS_CACHE_CHANNEL = "gocms:cache:invalidations"
+	// Maximum time spent on a single redis call, the
+	// page is rendered instead of waiting any longer
+	REDIS_CACHE_TIMEOUT = 500 * time.Millisecond
+)
+
+// Entry as stored in redis, the tags are kept with the
+// contents so the L1 can index the entries it copies.
+// The path tag is left out as the L1 adds it itself.
+type redisCacheEntry struct {
+	Contents     []byte            `json:"contents"`
+	ValidUntil   time.Time         `json:"valid_until"`
+	ETag         string            `json:"etag"`
+	LastModified time.Time         `json:"last_modified"`
+	Variants     map[string][]byte `json:"variants,omitempty"`
+	Tags         []string          `json:"tags"`
+}
+
+// Published on every Delete, InvalidateTag and Purge so
+// the other replicas drop the entries from their L1.
+type redisInvalidationMessage struct {
+	Origin string   `json:"origin"`
+	Names  []string `json:"names,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	All    bool     `json:"all,omitempty"`
+}
+
+// Cache shared between replicas through a redis server,
+// with the in-process TimedCache in front of it as L1.
+type RedisCache struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+	local  *TimedCache
+	// Identifies this replica on the invalidation channel
+	origin string
+
+	remoteHits      atomic.Uint64
+	remoteStaleHits atomic.Uint64
+	remoteMisses    atomic.Uint64
+}
+
+func entryKey(name string) string {
+	return REDIS_CACHE_PREFIX + "entry:" + name
+}
+
+func tagKey(tag string) string {
+	return REDIS_CACHE_PREFIX + "tag:" + tag
+}
+
+func redisContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), REDIS_CACHE_TIMEOUT)
+}
+
+func (cache *RedisCache) Store(name string, buffer []byte) error {
+	return cache.StoreTagged(name, buffer, []string{})
+}
+
+func (cache *RedisCache) StoreTagged(name string, buffer []byte, tags []string) error {
+	entry := makeEndpointCache(name, buffer)
+	entry.Variants = compressVariants(buffer)
+	return cache.StoreEntry(entry, tags)
+}
+
+func (cache *RedisCache) StoreEntry(cache_entry EndpointCache, tags []string) error {
+	if cache_entry.ValidUntil.IsZero() {
+		cache_entry.ValidUntil = time.Now().Add(cache.local.cacheTimeout)
+	}
+	if err := cache.local.StoreEntry(cache_entry, tags); err != nil {
+		return err
+	}
+
+	name := cache_entry.Name
+	entry_tags := append([]string{entryPathTag(name)}, tags...)
+	entry := redisCacheEntry{
+		Contents:     cache_entry.Contents,
+		ValidUntil:   cache_entry.ValidUntil,
+		ETag:         cache_entry.ETag,
+		LastModified: cache_entry.LastModified,
+		Variants:     cache_entry.Variants,
+		Tags:         tags,
+	}
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	_, err = cache.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		// Kept past its expiry for the stale window as well
+		pipe.Set(ctx, entryKey(name), encoded, time.Until(cache_entry.ValidUntil)+cache.local.staleWindow)
+		for _, tag := range entry_tags {
+			pipe.SAdd(ctx, tagKey(tag), name)
+			// Tag sets outlive their entries at most by one timeout
+			pipe.Expire(ctx, tagKey(tag), cache.local.cacheTimeout+cache.local.staleWindow)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not store entry in redis: %v", err)
+	}
+	return nil
+}
+
+func (cache *RedisCache) Get(name string) (EndpointCache, error) {
+	cached, _, err := cache.lookup(name, false)
+	return cached, err
+}
+
+func (cache *RedisCache) GetStale(name string) (EndpointCache, bool, error) {
+	return cache.lookup(name, true)
+}
+
+func (cache *RedisCache) lookup(name string, allow_stale bool) (EndpointCache, bool, error) {
+	local_cached, local_fresh, local_err := cache.local.lookup(name, allow_stale)
+	if local_err == nil && local_fresh {
+		return local_cached, true, nil
+	}
+
+	// A stale L1 entry may have been refreshed by another replica
+	cached, tags, err := cache.getRemote(name)
+	if err == nil && cache.local.validator.IsValid(&cached) {
+		cache.copyToLocal(cached, tags)
+		cache.remoteHits.Add(1)
+		return cached, true, nil
+	}
+
+	if local_err == nil {
+		return local_cached, false, nil
+	}
+
+	if err == nil && allow_stale && cache.local.isStale(&cached) {
+		cache.copyToLocal(cached, tags)
+		cache.remoteStaleHits.Add(1)
+		return cached, false, nil
+	}
+
+	cache.remoteMisses.Add(1)
+	if err == nil {
+		err = fmt.Errorf("cached endpoint had expired")
+	}
+	return emptyEndpointCache(), false, err
+}
+
+func (cache *RedisCache) getRemote(name string) (EndpointCache, []string, error) {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	encoded, err := cache.client.Get(ctx, entryKey(name)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return emptyEndpointCache(), nil, fmt.Errorf("cache does not contain key")
+	} else if err != nil {
+		log.Warn().Msgf("could not get cache entry from redis: %v", err)
+		return emptyEndpointCache(), nil, err
+	}
+
+	var entry redisCacheEntry
+	if err := json.Unmarshal(encoded, &entry); err != nil {
+		return emptyEndpointCache(), nil, err
+	}
+
+	return EndpointCache{
+		Name:         name,
+		Contents:     entry.Contents,
+		ValidUntil:   entry.ValidUntil,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		Variants:     entry.Variants,
+	}, entry.Tags, nil
+}
+
+// Keeps the original expiry so the copy in the L1
+// doesn't outlive the entry in redis
+func (cache *RedisCache) copyToLocal(cached EndpointCache, tags []string) {
+	if err := cache.local.StoreEntry(cached, tags); err != nil {
+		log.Warn().Msgf("could not copy redis entry to local cache: %v", err)
+	}
+}
+
+func (cache *RedisCache) Delete(name string) {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	if err := cache.client.Del(ctx, entryKey(name)).Err(); err != nil {
+		log.Warn().Msgf("could not delete cache entry from redis: %v", err)
+	}
+	cache.local.Delete(name)
+	cache.publish(redisInvalidationMessage{Names: []string{name}})
+}
+
+func (cache *RedisCache) InvalidateTag(tag string) int {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	names, err := cache.client.SMembers(ctx, tagKey(tag)).Result()
+	if err != nil {
+		log.Warn().Msgf("could not get tagged cache entries from redis: %v", err)
+	}
+
+	keys := []string{tagKey(tag)}
+	for _, name := range names {
+		keys = append(keys, entryKey(name))
+	}
+	if err := cache.client.Del(ctx, keys...).Err(); err != nil {
+		log.Warn().Msgf("could not delete tagged cache entries from redis: %v", err)
+	}
+
+	invalidated := cache.local.InvalidateTag(tag)
+	cache.publish(redisInvalidationMessage{Tags: []string{tag}})
+	return max(invalidated, len(names))
+}
+
+func (cache *RedisCache) Purge() {
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	iter := cache.client.Scan(ctx, 0, REDIS_CACHE_PREFIX+"*", 100).Iterator()
+	keys := make([]string, 0)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		log.Warn().Msgf("could not list cache entries in redis: %v", err)
+	}
+	if len(keys) > 0 {
+		if err := cache.client.Del(ctx, keys...).Err(); err != nil {
+			log.Warn().Msgf("could not purge cache entries from redis: %v", err)
+		}
+	}
+
+	cache.local.Purge()
+	cache.publish(redisInvalidationMessage{All: true})
+}
+
+// Size of the local L1, the memory used in redis
+// is not accounted for.
+func (cache *RedisCache) Size() uint64 {
+	return cache.local.Size()
+}
+
+// Metrics of the local L1, where the L1 misses
+// served from redis are counted as hits.
+func (cache *RedisCache) Metrics() CacheMetrics {
+	metrics := cache.local.Metrics()
+	metrics.Hits += cache.remoteHits.Load()
+	metrics.StaleHits += cache.remoteStaleHits.Load()
+	metrics.Misses = cache.remoteMisses.Load()
+	return metrics
+}
+
+// Stops listening for invalidations and closes the
+// connection to redis.
+func (cache *RedisCache) Close() error {
+	if err := cache.pubsub.Close(); err != nil {
+		return err
+	}
+	return cache.client.Close()
+}
+
+func (cache *RedisCache) publish(message redisInvalidationMessage) {
+	message.Origin = cache.origin
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		log.Error().Msgf("could not encode cache invalidation: %v", err)
+		return
+	}
+
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	if err := cache.client.Publish(ctx, REDIS_CACHE_CHANNEL, encoded).Err(); err != nil {
+		log.Warn().Msgf("could not publish cache invalidation: %v", err)
+	}
+}
+
+// Applies an invalidation published by another replica
+// to the local L1, the entries in redis are already gone.
+func (cache *RedisCache) applyInvalidation(message redisInvalidationMessage) {
+	if message.Origin == cache.origin {
+		return
+	}
+
+	if message.All {
+		cache.local.Purge()
+		return
+	}
+	for _, name := range message.Names {
+		cache.local.Delete(name)
+	}
+	for _, tag := range message.Tags {
+		cache.local.InvalidateTag(tag)
+	}
+}
+
+func (cache *RedisCache) listen() {
+	for redis_message := range cache.pubsub.Channel() {
+		var message redisInvalidationMessage
+		if err := json.Unmarshal([]byte(redis_message.Payload), &message); err != nil {
+			log.Warn().Msgf("invalid cache invalidation message: %v", err)
+			continue
+		}
+		cache.applyInvalidation(message)
+	}
+}
+
+// Connects to the redis server at redis_url, using the
+// timeout and validator of the given local cache for the
+// shared entries as well.
+func MakeRedisCache(redis_url string, local *TimedCache) (*RedisCache, error) {
+	options, err := redis.ParseURL(redis_url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %v", err)
+	}
+
+	client := redis.NewClient(options)
+	ctx, cancel := redisContext()
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not connect to redis: %v", err)
+	}
+
+	// Waits for the subscription to be confirmed, otherwise
+	// the first invalidations could be missed
+	pubsub := client.Subscribe(ctx, REDIS_CACHE_CHANNEL)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		client.Close()
+		return nil, fmt.Errorf("could not subscribe to cache invalidations: %v", err)
+	}
+
+	cache := &RedisCache{
+		client: client,
+		pubsub: pubsub,
+		local:  local,
+		origin: uuid.NewString(),
+	}
+	go cache.listen()
+
+	return cache, nil
+}
+
+// Picks the cache backend from the settings, falling back
+// to the in-memory cache if redis is not reachable.
+func makeConfiguredCache(settings common.AppSettings, local *TimedCache) Cache {
+	switch settings.CacheBackend {
+	case "", "memory":
+		return local
+	case "redis":
+		redis_cache, err := MakeRedisCache(settings.RedisUrl, local)
+		if err != nil {
+			log.Error().Msgf("could not use the redis cache, using the in-memory cache: %v", err)
+			return local
+		}
+		return redis_cache
+	default:
+		log.Error().Msgf("unknown cache backend `%s`, using the in-memory cache", settings.CacheBackend)
+		return local
+	}
+}
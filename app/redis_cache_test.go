@@ -0,0 +1,120 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rbc33/gocms/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Two replicas sharing the same fake redis server
+func makeRedisReplicas(t *testing.T) (*miniredis.Miniredis, *RedisCache, *RedisCache) {
+	server := miniredis.RunT(t)
+
+	replicas := make([]*RedisCache, 2)
+	for i := range replicas {
+		local := MakeSizedCache(4, time.Minute, 1000000, &TimeValidator{})
+		redis_cache, err := MakeRedisCache("redis://"+server.Addr(), local)
+		require.Nil(t, err)
+		t.Cleanup(func() { redis_cache.Close() })
+		replicas[i] = redis_cache
+	}
+	return server, replicas[0], replicas[1]
+}
+
+func TestRedisCacheSharedEntries(t *testing.T) {
+	server, first, second := makeRedisReplicas(t)
+
+	err := first.StoreTagged("/post/1?ref=home", []byte("post"), []string{common.PostCacheTag(1)})
+	assert.Nil(t, err)
+	assert.True(t, server.Exists(entryKey("/post/1?ref=home")))
+
+	// Served from redis and copied to the L1
+	cached, err := second.Get("/post/1?ref=home")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("post"), cached.Contents)
+	assert.Equal(t, uint64(4), second.Size())
+	assert.Equal(t, uint64(1), second.Metrics().Hits)
+
+	// The copy keeps its tags, including the path tag
+	assert.Equal(t, 1, second.local.InvalidateTag(common.PathCacheTag("/post/1")))
+
+	_, err = second.Get("/post/2")
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(1), second.Metrics().Misses)
+}
+
+func TestRedisCacheInvalidateTag(t *testing.T) {
+	server, first, second := makeRedisReplicas(t)
+
+	err := first.StoreTagged("/post/1", []byte("post"), []string{common.PostCacheTag(1)})
+	assert.Nil(t, err)
+	_, err = second.Get("/post/1")
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, first.InvalidateTag(common.PostCacheTag(1)))
+	assert.False(t, server.Exists(entryKey("/post/1")))
+
+	// The other replica drops its L1 copy on the message
+	assert.Eventually(t, func() bool {
+		return second.local.Size() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = second.Get("/post/1")
+	assert.NotNil(t, err)
+}
+
+func TestRedisCacheDeleteAndPurge(t *testing.T) {
+	server, first, second := makeRedisReplicas(t)
+
+	assert.Nil(t, first.Store("/about", []byte("about")))
+	assert.Nil(t, first.Store("/contact", []byte("contact")))
+	_, err := second.Get("/about")
+	assert.Nil(t, err)
+	_, err = second.Get("/contact")
+	assert.Nil(t, err)
+
+	second.Delete("/about")
+	assert.False(t, server.Exists(entryKey("/about")))
+	assert.Eventually(t, func() bool {
+		_, err := first.local.Get("/about")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	first.Purge()
+	assert.Empty(t, server.Keys())
+	assert.Eventually(t, func() bool {
+		return second.local.Size() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRedisCacheExpiry(t *testing.T) {
+	server, first, second := makeRedisReplicas(t)
+
+	assert.Nil(t, first.Store("/about", []byte("about")))
+	server.FastForward(2 * time.Minute)
+
+	_, err := second.Get("/about")
+	assert.NotNil(t, err)
+}
+
+func TestConfiguredCacheFallback(t *testing.T) {
+	local := MakeSizedCache(1, time.Minute, 1000, &TimeValidator{})
+
+	assert.Equal(t, Cache(local), makeConfiguredCache(common.AppSettings{}, local))
+	assert.Equal(t, Cache(local), makeConfiguredCache(common.AppSettings{
+		CacheBackend: "redis",
+		RedisUrl:     "not a url",
+	}, local))
+
+	server := miniredis.RunT(t)
+	redis_cache := makeConfiguredCache(common.AppSettings{
+		CacheBackend: "redis",
+		RedisUrl:     "redis://" + server.Addr(),
+	}, local)
+	assert.IsType(t, &RedisCache{}, redis_cache)
+	redis_cache.(*RedisCache).Close()
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"bytes"
+	"net/http"
 
 	"github.com/a-h/templ"
 	"github.com/gin-gonic/gin"
@@ -10,7 +11,7 @@ import (
 
 func TemplRender(c *gin.Context, status int, template templ.Component) error {
 	c.Status(status)
-	return template.Render(c.Request.Context(), c.Writer)
+	return template.Render(c, c.Writer)
 }
 
 func renderHtml(c *gin.Context, template templ.Component) ([]byte, error) {
@@ -24,3 +25,9 @@ func renderHtml(c *gin.Context, template templ.Component) ([]byte, error) {
 
 	return html_buffer.Bytes(), nil
 }
+
+// Requests made by htmx, answered with the part
+// of the page being swapped
+func isHtmxRequest(request *http.Request) bool {
+	return request.Header.Get("HX-Request") == "true"
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+)
+
+// Content is stored with its shortcodes, they are expanded
+// when pages are rendered so plugin changes apply to all of it
+var shortcode_renderer = &plugins.ShortcodeRenderer{}
+
+// HTML of the Markdown content with its shortcodes expanded
+func renderMarkdown(ctx context.Context, content string) string {
+	return string(common.MdToHTML([]byte(shortcode_renderer.Expand(ctx, content))))
+}
+
+// Expands the shortcodes in the text values of the card,
+// nested objects and arrays included
+func expandCardShortcodes(ctx context.Context, value any) any {
+	switch typed := value.(type) {
+	case string:
+		return shortcode_renderer.Expand(ctx, typed)
+	case map[string]any:
+		for key, item := range typed {
+			typed[key] = expandCardShortcodes(ctx, item)
+		}
+	case []any:
+		for i, item := range typed {
+			typed[i] = expandCardShortcodes(ctx, item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTimeShortcodes(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	defer shortcode_renderer.Reset()
+	plugin := filepath.Join(t.TempDir(), "strong.lua")
+	require.Nil(t, os.WriteFile(plugin, []byte(`function HandleShortcode(arguments) return "**" .. arguments[1] .. "**" end`), 0644))
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.Shortcodes = []common.Shortcode{{Name: "strong", Plugin: plugin}}
+	})
+
+	database := mocks.DatabaseMock{
+		GetPostHandler: func(id int) (common.Post, error) {
+			return common.Post{Id: id, Title: "Post", Content: "Hello {{strong:there}} and {{missing:plugin}}!"}, nil
+		},
+		GetPageByIdHandler: func(id int) (common.Page, error) {
+			return common.Page{Id: id, Title: "Landing", Link: "landing", Blocks: []common.Block{
+				makeBlock(common.BLOCK_MARKDOWN, common.MarkdownBlock{Content: "Block {{strong:text}}"}),
+				makeBlock(common.BLOCK_CARDS, common.CardsBlock{Schema: "products"}),
+			}}, nil
+		},
+		GetPageTreeHandler: func() ([]common.Page, error) {
+			return []common.Page{{Id: 1, Title: "Landing", Link: "landing", Path: "landing"}}, nil
+		},
+		GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+			return []common.Card{{Content: `{"title": "Shoe", "slogan": "New", "excerpt": "Now {{strong:cheaper}}"}`}}, 1, nil
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	render := func(handler Generator, param string, value string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Params = gin.Params{{Key: param, Value: value}}
+		html, err := handler(c, database)
+		require.Nil(t, err)
+		return string(html)
+	}
+
+	html := render(postHandler, "id", "1")
+	assert.Contains(t, html, "<p>Hello <strong>there</strong> and !</p>")
+
+	html = render(pageHandler, "path", "/landing")
+	assert.Contains(t, html, "<p>Block <strong>text</strong></p>")
+	assert.Contains(t, html, "Now **cheaper**")
+
+	// Results are kept until the plugins are loaded again
+	require.Nil(t, os.WriteFile(plugin, []byte(`function HandleShortcode(arguments) return "_" .. arguments[1] .. "_" end`), 0644))
+	assert.Contains(t, render(postHandler, "id", "1"), "<strong>there</strong>")
+	shortcode_renderer.Reset()
+	assert.Contains(t, render(postHandler, "id", "1"), "<p>Hello <em>there</em> and !</p>")
+
+	// Shortcodes removed from the config are left out
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.Shortcodes = nil })
+	assert.Contains(t, render(postHandler, "id", "1"), "<p>Hello  and !</p>")
+}
+
+func TestContentShortcodesTagCache(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	defer shortcode_renderer.Reset()
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.CacheEnabled = true
+		settings.Shortcodes = []common.Shortcode{{Name: "latest", Plugin: "../plugins/latest_posts_shortcode.lua"}}
+	})
+
+	database := mocks.DatabaseMock{
+		GetPostHandler: func(id int) (common.Post, error) {
+			return common.Post{Id: id, Title: "News", Content: "Latest:\n\n{{latest:3}}"}, nil
+		},
+		GetPostsHandler: func(limit int, offset int) ([]common.Post, error) {
+			return []common.Post{{Id: 7, Title: "Seventh"}}, nil
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(siteMiddleware(database, makeSiteSettingsStore()))
+	var cache Cache = MakeCache(1, time.Minute, &TimeValidator{})
+	addCacheHandler(r, "GET", "/post/:id", postHandler, &cache, database)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/post/1", nil))
+	assert.Contains(t, w.Body.String(), `<li><a href="/post/7">Seventh</a></li>`)
+
+	// The post shows the post list, new posts purge it
+	assert.Equal(t, 1, cache.InvalidateTag(common.CACHE_TAG_POSTS))
+}
+
+func TestFailedShortcodesAreNotCached(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	defer shortcode_renderer.Reset()
+	plugin := filepath.Join(t.TempDir(), "flaky.lua")
+	require.Nil(t, os.WriteFile(plugin, []byte(`function HandleShortcode(arguments) error("service down") end`), 0644))
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.CacheEnabled = true
+		settings.Shortcodes = []common.Shortcode{{Name: "flaky", Plugin: plugin}}
+	})
+
+	database := mocks.DatabaseMock{
+		GetPostHandler: func(id int) (common.Post, error) {
+			return common.Post{Id: id, Title: "Post", Content: "Status: {{flaky:status}}"}, nil
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(siteMiddleware(database, makeSiteSettingsStore()))
+	var cache Cache = MakeCache(1, time.Minute, &TimeValidator{})
+	addCacheHandler(r, "GET", "/post/:id", postHandler, &cache, database)
+
+	// The page is served without the shortcode but not kept
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/post/1", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "<p>Status:</p>")
+	_, err := cache.Get("/post/1")
+	assert.NotNil(t, err)
+
+	require.Nil(t, os.WriteFile(plugin, []byte(`function HandleShortcode(arguments) return "up" end`), 0644))
+	shortcode_renderer.Reset()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/post/1", nil))
+	assert.Contains(t, w.Body.String(), "<p>Status: up</p>")
+	_, err = cache.Get("/post/1")
+	assert.Nil(t, err)
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/views"
+)
+
+// Context key of the site resolved for the request
+const SITE_KEY = "gocms_site"
+
+// Cache names of every site but the default one
+// start with `@<site id>`, then htmx partials
+// are marked with `~`
+var site_cache_key_regex = regexp.MustCompile(`^(@[0-9]+)?~?`)
+
+// Resolves the site from the request host, with the settings
+// changed from the admin-app. The theme and menus are left
+// in the context for the layout.
+func siteMiddleware(db database.Database, site_settings *siteSettingsStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		site := common.CurrentSettings().SiteForHost(c.Request.Host)
+		site = site_settings.apply(site, db)
+		c.Set(SITE_KEY, site)
+		c.Set(views.THEME_KEY, site.Theme)
+		c.Set(views.MENUS_KEY, site.Menus)
+		// Plugins read the content of the site, the page
+		// showing it is tagged with what they read
+		c.Request = c.Request.WithContext(plugins.WithContentSource(c.Request.Context(), &plugins.ContentSource{
+			Database: db.ForSite(site.Id),
+			Site:     site,
+			Tag:      func(tags ...string) { tagCacheEntry(c, tags...) },
+		}))
+		c.Next()
+	}
+}
+
+// Site of the request, generators called without the
+// middleware (e.g. in tests) get the site of the host
+func currentSite(c *gin.Context) common.Site {
+	if site, exists := c.Get(SITE_KEY); exists {
+		return site.(common.Site)
+	}
+	return common.CurrentSettings().SiteForHost(c.Request.Host)
+}
+
+// Database limited to the content of the request site
+func siteDatabase(c *gin.Context, db database.Database) database.Database {
+	return db.ForSite(currentSite(c).Id)
+}
+
+// The default site keeps using the bare request URI so
+// single site deployments see the same cache names
+func siteCacheKey(c *gin.Context) string {
+	uri := c.Request.RequestURI
+	// Same URI as the full page
+	if isHtmxRequest(c.Request) {
+		uri = "~" + uri
+	}
+	site := currentSite(c)
+	if site.Id == common.DEFAULT_SITE_ID {
+		return uri
+	}
+	return fmt.Sprintf("@%d%s", site.Id, uri)
+}
+
+func trimSiteCacheKey(name string) string {
+	return site_cache_key_regex.ReplaceAllString(name, "")
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+// Settings of a site read from the database are kept this
+// long, in case the invalidation only reached another replica
+const SITE_SETTINGS_TIMEOUT = time.Minute
+
+type siteSettingsEntry struct {
+	values     map[string]string
+	menus      map[string][]common.MenuItem
+	validUntil time.Time
+}
+
+// Settings and menus changed from the admin-app, by site id
+type siteSettingsStore struct {
+	lock    sync.Mutex
+	entries map[int]siteSettingsEntry
+}
+
+func makeSiteSettingsStore() *siteSettingsStore {
+	return &siteSettingsStore{entries: make(map[int]siteSettingsEntry)}
+}
+
+// The site with its settings and menus from the database, the
+// config file values are used if they can't be read
+func (store *siteSettingsStore) apply(site common.Site, db database.Database) common.Site {
+	store.lock.Lock()
+	entry, exists := store.entries[site.Id]
+	store.lock.Unlock()
+
+	if !exists || time.Now().After(entry.validUntil) {
+		values, err := db.ForSite(site.Id).GetSettings()
+		if err != nil {
+			log.Error().Msgf("could not get settings of site %d: %v", site.Id, err)
+			return site
+		}
+		menus, err := db.ForSite(site.Id).GetMenus()
+		if err != nil {
+			log.Error().Msgf("could not get menus of site %d: %v", site.Id, err)
+			return site
+		}
+		entry = siteSettingsEntry{values: values, menus: menusByLocation(menus), validUntil: time.Now().Add(SITE_SETTINGS_TIMEOUT)}
+
+		store.lock.Lock()
+		store.entries[site.Id] = entry
+		store.lock.Unlock()
+	}
+
+	site.Menus = entry.menus
+	if len(entry.values) == 0 {
+		return site
+	}
+	return site.WithSettings(entry.values)
+}
+
+// Visible items of the menus placed in the layout
+func menusByLocation(menus []common.Menu) map[string][]common.MenuItem {
+	locations := make(map[string][]common.MenuItem)
+	for _, menu := range menus {
+		if menu.Location != "" {
+			locations[menu.Location] = common.VisibleMenuItems(menu.Items)
+		}
+	}
+	return locations
+}
+
+// Drops the settings and menus of the sites named by the tags of
+// an invalidation request, or of every site
+func (store *siteSettingsStore) forget(request common.CacheInvalidationRequest) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if request.All {
+		clear(store.entries)
+		return
+	}
+	for _, tag := range request.Tags {
+		for site_id := range store.entries {
+			if tag == common.SettingsCacheTag(site_id) || tag == common.MenusCacheTag(site_id) {
+				delete(store.entries, site_id)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Increased whenever the archive layout changes,
+	// older archives can always be restored
+	BACKUP_FORMAT_VERSION = 1
+	MANIFEST_FILE         = "manifest.json"
+	DATA_DIRECTORY        = "data"
+	MEDIA_DIRECTORY       = "media"
+	GALLERIES_FILE        = "galleries.toml"
+)
+
+type BackupOptions struct {
+	ImageDirectory string
+	Galleries      map[string]common.Gallery
+	// Only the rows of the site are written and the user
+	// accounts are left out, every site when zero
+	SiteId int
+}
+
+type TableManifest struct {
+	Name    string   `json:"name"`
+	Rows    int      `json:"rows"`
+	Columns []Column `json:"columns"`
+}
+
+type FileManifest struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	FormatVersion int             `json:"format_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Driver        string          `json:"driver"`
+	SiteId        int             `json:"site_id,omitempty"`
+	Tables        []TableManifest `json:"tables"`
+	// Every entry of the archive but the manifest
+	Files []FileManifest `json:"files"`
+}
+
+type archiveWriter struct {
+	zip_writer *zip.Writer
+	manifest   Manifest
+}
+
+// Adds an entry to the archive and records its checksum
+func (writer *archiveWriter) create(name string, write func(io.Writer) error) error {
+	entry, err := writer.zip_writer.Create(name)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	if err = write(io.MultiWriter(entry, hash, counter)); err != nil {
+		return fmt.Errorf("could not write %s: %v", name, err)
+	}
+
+	writer.manifest.Files = append(writer.manifest.Files, FileManifest{
+		Path:   name,
+		Size:   counter.size,
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+type countingWriter struct {
+	size int64
+}
+
+func (counter *countingWriter) Write(data []byte) (int, error) {
+	counter.size += int64(len(data))
+	return len(data), nil
+}
+
+// Writes the whole site to `out`: a JSON-lines dump of every
+// table, the media directory and the galleries, with a
+// manifest of checksums written last. The media directory
+// is shared by the sites and always written whole.
+func WriteBackup(db database.SqlDatabase, options BackupOptions, out io.Writer) (Manifest, error) {
+	writer := &archiveWriter{
+		zip_writer: zip.NewWriter(out),
+		manifest: Manifest{
+			FormatVersion: BACKUP_FORMAT_VERSION,
+			CreatedAt:     time.Now().UTC(),
+			Driver:        db.Driver,
+			SiteId:        options.SiteId,
+		},
+	}
+
+	for _, table := range TABLES {
+		if options.SiteId != 0 && slices.Contains(ACCOUNT_TABLES, table.Name) {
+			continue
+		}
+		exists, err := tableExists(db, table.Name)
+		if err != nil {
+			return writer.manifest, err
+		}
+		if !exists {
+			log.Info().Msgf("skipping table %s, it does not exist", table.Name)
+			continue
+		}
+
+		rows := 0
+		err = writer.create(path.Join(DATA_DIRECTORY, table.Name+".jsonl"), func(w io.Writer) error {
+			var err error
+			rows, err = dumpTable(db.Connection, table, options.SiteId, w)
+			return err
+		})
+		if err != nil {
+			return writer.manifest, err
+		}
+		writer.manifest.Tables = append(writer.manifest.Tables, TableManifest{
+			Name:    table.Name,
+			Rows:    rows,
+			Columns: table.Columns,
+		})
+	}
+
+	if options.ImageDirectory != "" {
+		if err := writeMedia(writer, options.ImageDirectory, options.SiteId); err != nil {
+			return writer.manifest, err
+		}
+	}
+
+	err := writer.create(GALLERIES_FILE, func(w io.Writer) error {
+		// Same layout as the `gallery` tables of the config
+		return toml.NewEncoder(w).Encode(struct {
+			Galleries map[string]common.Gallery `toml:"gallery"`
+		}{options.Galleries})
+	})
+	if err != nil {
+		return writer.manifest, err
+	}
+
+	manifest_entry, err := writer.zip_writer.Create(MANIFEST_FILE)
+	if err != nil {
+		return writer.manifest, err
+	}
+	encoder := json.NewEncoder(manifest_entry)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(writer.manifest); err != nil {
+		return writer.manifest, err
+	}
+
+	return writer.manifest, writer.zip_writer.Close()
+}
+
+// Writes one JSON object per row, in primary key order,
+// only the rows of the site when `site_id` isn't zero
+func dumpTable(connection *sql.DB, table Table, site_id int, w io.Writer) (int, error) {
+	where_clause := ""
+	args := []any{}
+	if site_filter, filtered := SITE_FILTERS[table.Name]; filtered && site_id != 0 {
+		where_clause = " WHERE " + site_filter
+		args = append(args, site_id)
+	}
+	rows, err := connection.Query(fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s;", table.columnList(), table.Name, where_clause, table.primaryKey()), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(w)
+	count := 0
+	for rows.Next() {
+		values := make([]any, len(table.Columns))
+		for i, column := range table.Columns {
+			values[i] = column.scanTarget()
+		}
+		if err = rows.Scan(values...); err != nil {
+			return count, fmt.Errorf("could not read row of %s: %v", table.Name, err)
+		}
+
+		row := make(map[string]any, len(table.Columns))
+		for i, column := range table.Columns {
+			row[column.Name] = column.jsonValue(values[i])
+		}
+		if err = encoder.Encode(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+func writeMedia(writer *archiveWriter, image_directory string, site_id int) error {
+	// Sites get their media directory with their first image
+	if _, err := os.Stat(image_directory); errors.Is(err, fs.ErrNotExist) && site_id != 0 {
+		return nil
+	}
+	return filepath.WalkDir(image_directory, func(file_path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// The media of the other sites
+		if site_id != 0 && entry.IsDir() && file_path == filepath.Join(image_directory, common.SITES_MEDIA_DIRECTORY) {
+			return fs.SkipDir
+		}
+		// Skips files like `.DS_Store`
+		if strings.HasPrefix(entry.Name(), ".") && file_path != image_directory {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relative_path, err := filepath.Rel(image_directory, file_path)
+		if err != nil {
+			return err
+		}
+		return writer.create(path.Join(MEDIA_DIRECTORY, filepath.ToSlash(relative_path)), func(w io.Writer) error {
+			file, err := os.Open(file_path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(w, file)
+			return err
+		})
+	})
+}
@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSqliteDatabase(t *testing.T) database.SqlDatabase {
+	db, err := database.MakeSqliteConnection(filepath.Join(t.TempDir(), "gocms.db"))
+	require.Nil(t, err)
+	t.Cleanup(func() { db.Connection.Close() })
+	return db
+}
+
+func makeSourceDatabase(t *testing.T) database.SqlDatabase {
+	db := makeSqliteDatabase(t)
+	for _, table := range TABLES {
+		if table.Name == "images" {
+			// Not created by the migrations either
+			continue
+		}
+		_, err := db.Connection.Exec(table.createStatement(db.Driver))
+		require.Nil(t, err, table.Name)
+	}
+
+	_, err := db.AddPost("First", "first post", "# hello")
+	require.Nil(t, err)
+	post_id, err := db.AddPost("Second", "second post", "world")
+	require.Nil(t, err)
+	page_id, err := db.AddPage("About", "about us", "about", nil, 0)
+	require.Nil(t, err)
+	_, err = db.AddPage("Team", "our team", "team", nil, page_id)
+	require.Nil(t, err)
+	menu_id, err := db.AddMenu("Main", common.MENU_LOCATION_HEADER)
+	require.Nil(t, err)
+	item_id, err := db.AddMenuItem(menu_id, common.MenuItem{Type: common.MENU_ITEM_PAGE, Target: fmt.Sprint(page_id), Visible: true})
+	require.Nil(t, err)
+	_, err = db.AddMenuItem(menu_id, common.MenuItem{ParentId: item_id, Type: common.MENU_ITEM_URL, Target: "https://example.com", Label: "Example", Visible: true})
+	require.Nil(t, err)
+	_, err = db.AddPermalink(common.Permalink{Path: "/2020/second/", PostId: post_id})
+	require.Nil(t, err)
+	_, err = db.CreateUser(common.User{Username: "admin", Password: "hash"})
+	require.Nil(t, err)
+	schema_uuid := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+	_, err = db.Connection.Exec("INSERT INTO card_schemas(uuid, json_id, json_schema, json_title) VALUES(?, ?, ?, ?);",
+		schema_uuid, "product", `{"type": "object"}`, "Product")
+	require.Nil(t, err)
+	_, err = db.Connection.Exec("INSERT INTO card_schema_versions(schema_uuid, version, json_schema, created_at) VALUES(?, ?, ?, ?);",
+		schema_uuid, 1, `{"type": "object"}`, "2026-01-02 03:04:05")
+	require.Nil(t, err)
+	_, err = db.Connection.Exec("INSERT INTO cards(uuid, image_location, json_data, json_schema, schema_uuid, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?);",
+		[]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, "shoe.jpg", `{"title": "Shoe"}`, "product", schema_uuid,
+		"2026-01-02 03:04:05", "2026-01-02 03:04:05")
+	require.Nil(t, err)
+	return db
+}
+
+func writeTestBackup(t *testing.T, db database.SqlDatabase, image_directory string) *zip.Reader {
+	var buffer bytes.Buffer
+	manifest, err := WriteBackup(db, BackupOptions{
+		ImageDirectory: image_directory,
+		Galleries:      map[string]common.Gallery{"cats": {Name: "Cats", Images: []string{"cat.jpg"}}},
+	}, &buffer)
+	require.Nil(t, err)
+	assert.Equal(t, BACKUP_FORMAT_VERSION, manifest.FormatVersion)
+	assert.Equal(t, database.DRIVER_SQLITE, manifest.Driver)
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	require.Nil(t, err)
+	return archive
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	image_directory := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "cat.jpg"), []byte("jpeg data"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "cat.json"), []byte("{}"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, ".DS_Store"), []byte("ignored"), 0644))
+
+	source := makeSourceDatabase(t)
+	_, err := source.Connection.Exec("INSERT INTO post_previews(uuid, title, excerpt, content, expires_at) VALUES(?, ?, ?, ?, ?);",
+		[]byte{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}, "Draft", "soon", "wip", "2026-01-02 03:04:05")
+	require.Nil(t, err)
+	archive := writeTestBackup(t, source, image_directory)
+
+	manifest, err := ReadManifest(archive)
+	require.Nil(t, err)
+	tables := make(map[string]int)
+	for _, table := range manifest.Tables {
+		tables[table.Name] = table.Rows
+	}
+	assert.Equal(t, map[string]int{
+		"posts": 2, "pages": 2, "page_redirects": 0, "card_schemas": 1, "card_schema_versions": 1, "cards": 1,
+		"post_permalinks": 1, "users": 1, "user_sites": 1, "site_settings": 0,
+		"menus": 1, "menu_items": 2, "post_previews": 1, "goose_db_version": 0,
+	}, tables)
+
+	// The tables are created in the empty database
+	target := makeSqliteDatabase(t)
+	restored_images := t.TempDir()
+	galleries_file := filepath.Join(t.TempDir(), "galleries.toml")
+	report, err := RestoreBackup(target, archive, RestoreOptions{ImageDirectory: restored_images, GalleriesFile: galleries_file})
+	require.Nil(t, err)
+	assert.Equal(t, RestoreReport{Tables: 14, Rows: 14, Files: 2, Galleries: true}, report)
+
+	post, err := target.GetPost(1)
+	assert.Nil(t, err)
+	assert.Equal(t, common.Post{Id: 1, Title: "First", Excerpt: "first post", Content: "# hello"}, post)
+	// The content stays in the default site
+	_, err = target.ForSite(2).GetPost(1)
+	assert.NotNil(t, err)
+	page, err := target.GetPage("about")
+	assert.Nil(t, err)
+	assert.Equal(t, "about us", page.Content)
+	permalinks, err := target.GetPermalinks()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Permalink{{Path: "/2020/second/", PostId: 2}}, permalinks)
+
+	// Menu items follow the link of the page
+	require.Nil(t, target.ChangePage(1, "", "", "about-us", nil))
+	menus, err := target.GetMenus()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Menu{{Id: 1, Name: "Main", Location: common.MENU_LOCATION_HEADER, Items: []common.MenuItem{{
+		Id: 1, Type: common.MENU_ITEM_PAGE, Target: "1", Visible: true, Text: "About", Href: "/page/about-us",
+		Children: []common.MenuItem{{
+			Id: 2, ParentId: 1, Type: common.MENU_ITEM_URL, Target: "https://example.com", Label: "Example",
+			Visible: true, Text: "Example", Href: "https://example.com", Children: []common.MenuItem{},
+		}},
+	}}}}, menus)
+
+	// Child pages follow the link of their parent and
+	// the old link redirects to the page
+	tree, err := target.GetPageTree()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Page{
+		{Id: 1, Title: "About", Link: "about-us", Path: "about-us"},
+		{Id: 2, Title: "Team", Link: "team", ParentId: 1, Path: "about-us/team"},
+	}, tree)
+	redirect, err := target.GetPageRedirect("about")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, redirect)
+	assert.NotNil(t, target.DeletePage("about-us"))
+	assert.NotNil(t, target.MovePages([]common.Page{{Id: 1, ParentId: 2}}))
+
+	// Shared preview links keep working
+	var preview_title, expires_at string
+	err = target.Connection.QueryRow("SELECT title, expires_at FROM post_previews WHERE uuid = ?;",
+		[]byte{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}).Scan(&preview_title, &expires_at)
+	assert.Nil(t, err)
+	assert.Equal(t, "Draft", preview_title)
+	assert.Equal(t, "2026-01-02 03:04:05", expires_at)
+
+	user, err := target.GetUserByUsername("admin")
+	assert.Nil(t, err)
+	assert.Equal(t, "hash", user.Password)
+
+	var uuid []byte
+	err = target.Connection.QueryRow("SELECT uuid FROM card_schemas;").Scan(&uuid)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}, uuid)
+	// Cards keep their schema and timestamps
+	var card_schema []byte
+	var created_at string
+	err = target.Connection.QueryRow("SELECT schema_uuid, created_at FROM cards;").Scan(&card_schema, &created_at)
+	assert.Nil(t, err)
+	assert.Equal(t, uuid, card_schema)
+	assert.Equal(t, "2026-01-02 03:04:05", created_at)
+	// And the version of the schema they were written with
+	var version int
+	err = target.Connection.QueryRow("SELECT cards.schema_version FROM cards JOIN card_schema_versions ON card_schema_versions.schema_uuid = cards.schema_uuid AND card_schema_versions.version = cards.schema_version;").Scan(&version)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+
+	// New rows continue after the restored ids
+	id, err := target.AddPost("Third", "third post", "!")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, id)
+
+	contents, err := os.ReadFile(filepath.Join(restored_images, "cat.jpg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "jpeg data", string(contents))
+	assert.NoFileExists(t, filepath.Join(restored_images, ".DS_Store"))
+
+	var settings common.AppSettings
+	_, err = toml.DecodeFile(galleries_file, &settings)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cat.jpg"}, settings.Galleries["cats"].Images)
+
+	// Restoring twice would duplicate the content
+	_, err = RestoreBackup(target, archive, RestoreOptions{})
+	assert.ErrorContains(t, err, "database is not empty")
+}
+
+func TestSiteBackup(t *testing.T) {
+	source := makeSourceDatabase(t)
+	_, err := source.ForSite(2).AddPost("Blog", "blog post", "other site")
+	require.Nil(t, err)
+	_, err = source.ForSite(2).AddMenu("Blog", common.MENU_LOCATION_HEADER)
+	require.Nil(t, err)
+
+	site_tables := func(site_id int) map[string]int {
+		var buffer bytes.Buffer
+		manifest, err := WriteBackup(source, BackupOptions{SiteId: site_id}, &buffer)
+		require.Nil(t, err)
+		assert.Equal(t, site_id, manifest.SiteId)
+		tables := make(map[string]int)
+		for _, table := range manifest.Tables {
+			tables[table.Name] = table.Rows
+		}
+		return tables
+	}
+
+	// The accounts are never written
+	assert.Equal(t, map[string]int{
+		"posts": 2, "pages": 2, "page_redirects": 0, "card_schemas": 1, "card_schema_versions": 1, "cards": 1,
+		"post_permalinks": 1, "site_settings": 0, "menus": 1, "menu_items": 2, "post_previews": 0, "goose_db_version": 0,
+	}, site_tables(common.DEFAULT_SITE_ID))
+	assert.Equal(t, map[string]int{
+		"posts": 1, "pages": 0, "page_redirects": 0, "card_schemas": 0, "card_schema_versions": 0, "cards": 0,
+		"post_permalinks": 0, "site_settings": 0, "menus": 1, "menu_items": 0, "post_previews": 0, "goose_db_version": 0,
+	}, site_tables(2))
+}
+
+func TestSiteBackupMedia(t *testing.T) {
+	image_directory := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "cat.jpg"), []byte("jpeg data"), 0644))
+	site_directory := filepath.Join(image_directory, common.SITES_MEDIA_DIRECTORY, "2")
+	require.Nil(t, os.MkdirAll(site_directory, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(site_directory, "shoe.jpg"), []byte("jpeg data"), 0644))
+
+	source := makeSourceDatabase(t)
+	media_files := func(options BackupOptions) []string {
+		var buffer bytes.Buffer
+		manifest, err := WriteBackup(source, options, &buffer)
+		require.Nil(t, err)
+		files := []string{}
+		for _, file := range manifest.Files {
+			if strings.HasPrefix(file.Path, MEDIA_DIRECTORY+"/") {
+				files = append(files, file.Path)
+			}
+		}
+		return files
+	}
+
+	// The default site leaves out the media of the other sites
+	assert.Equal(t, []string{"media/cat.jpg"}, media_files(BackupOptions{ImageDirectory: image_directory, SiteId: common.DEFAULT_SITE_ID}))
+	assert.Equal(t, []string{"media/shoe.jpg"}, media_files(BackupOptions{ImageDirectory: site_directory, SiteId: 2}))
+	assert.Equal(t, []string{}, media_files(BackupOptions{ImageDirectory: filepath.Join(image_directory, "missing"), SiteId: 3}))
+	assert.Equal(t, []string{"media/cat.jpg", "media/sites/2/shoe.jpg"}, media_files(BackupOptions{ImageDirectory: image_directory}))
+}
+
+// The goose versions are restored too, so tables left out
+// of the backup would never be created again
+func TestTablesCoverMigrations(t *testing.T) {
+	migrations, err := filepath.Glob("../migrations/*.sql")
+	require.Nil(t, err)
+	require.NotEmpty(t, migrations)
+	create_regex := regexp.MustCompile(`CREATE TABLE (?:IF NOT EXISTS )?([a-z_]+)`)
+	for _, migration := range migrations {
+		contents, err := os.ReadFile(migration)
+		require.Nil(t, err)
+		for _, match := range create_regex.FindAllStringSubmatch(string(contents), -1) {
+			_, known := knownTable(match[1])
+			assert.True(t, known, "table %s of %s is not backed up", match[1], filepath.Base(migration))
+		}
+	}
+}
+
+func TestRestoreRejectsCorruptArchive(t *testing.T) {
+	source := makeSourceDatabase(t)
+	archive := writeTestBackup(t, source, "")
+
+	var buffer bytes.Buffer
+	zip_writer := zip.NewWriter(&buffer)
+	for _, file := range archive.File {
+		entry, err := zip_writer.Create(file.Name)
+		require.Nil(t, err)
+		reader, err := file.Open()
+		require.Nil(t, err)
+		contents := new(bytes.Buffer)
+		_, err = contents.ReadFrom(reader)
+		require.Nil(t, err)
+		if file.Name == "data/posts.jsonl" {
+			contents = bytes.NewBufferString(`{"id": 1, "title": "Evil", "excerpt": "", "content": ""}` + "\n")
+		}
+		_, err = entry.Write(contents.Bytes())
+		require.Nil(t, err)
+	}
+	require.Nil(t, zip_writer.Close())
+
+	corrupt, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	require.Nil(t, err)
+
+	target := makeSqliteDatabase(t)
+	_, err = RestoreBackup(target, corrupt, RestoreOptions{})
+	assert.ErrorContains(t, err, "checksum mismatch for data/posts.jsonl")
+
+	// Nothing was created
+	exists, err := tableExists(target, "posts")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,301 @@
+package backup
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rbc33/gocms/database"
+)
+
+type RestoreOptions struct {
+	ImageDirectory string
+	// Where the galleries are written, they are
+	// not restored when empty
+	GalleriesFile string
+}
+
+var identifier_regex = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Only numbers and the current time are used as defaults
+var default_regex = regexp.MustCompile(`^(-?[0-9]+|CURRENT_TIMESTAMP)$`)
+
+type RestoreReport struct {
+	Tables    int
+	Rows      int
+	Files     int
+	Galleries bool
+}
+
+// Functions the card queries rely on in MySQL, same
+// as the `add_uiid_stored_func` migration
+var MYSQL_UUID_FUNCTIONS = map[string]string{
+	"UuidToBin": `CREATE FUNCTION UuidToBin(_uuid BINARY(36))
+    RETURNS BINARY(16)
+    LANGUAGE SQL  DETERMINISTIC  CONTAINS SQL  SQL SECURITY INVOKER
+RETURN
+    UNHEX(CONCAT(
+        SUBSTR(_uuid, 15, 4),
+        SUBSTR(_uuid, 10, 4),
+        SUBSTR(_uuid,  1, 8),
+        SUBSTR(_uuid, 20, 4),
+        SUBSTR(_uuid, 25) ));`,
+	"UuidFromBin": `CREATE FUNCTION UuidFromBin(_bin BINARY(16))
+    RETURNS BINARY(36)
+    LANGUAGE SQL  DETERMINISTIC  CONTAINS SQL  SQL SECURITY INVOKER
+RETURN
+    LCASE(CONCAT_WS('-',
+        HEX(SUBSTR(_bin,  5, 4)),
+        HEX(SUBSTR(_bin,  3, 2)),
+        HEX(SUBSTR(_bin,  1, 2)),
+        HEX(SUBSTR(_bin,  9, 2)),
+        HEX(SUBSTR(_bin, 11))
+             ));`,
+}
+
+func ReadManifest(archive *zip.Reader) (Manifest, error) {
+	var manifest Manifest
+	file, err := archive.Open(MANIFEST_FILE)
+	if err != nil {
+		return manifest, fmt.Errorf("archive has no manifest: %v", err)
+	}
+	defer file.Close()
+
+	if err = json.NewDecoder(file).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > BACKUP_FORMAT_VERSION {
+		return manifest, fmt.Errorf("unsupported backup format version %d", manifest.FormatVersion)
+	}
+
+	// Names end up in the restore queries
+	for _, table := range manifest.Tables {
+		if !identifier_regex.MatchString(table.Name) || len(table.Columns) == 0 {
+			return manifest, fmt.Errorf("invalid table `%s` in manifest", table.Name)
+		}
+		for _, column := range table.Columns {
+			if !identifier_regex.MatchString(column.Name) {
+				return manifest, fmt.Errorf("invalid column `%s` of table %s in manifest", column.Name, table.Name)
+			}
+			for _, unique_with := range strings.Split(column.UniqueWith, ",") {
+				if column.UniqueWith != "" && !identifier_regex.MatchString(strings.TrimSpace(unique_with)) {
+					return manifest, fmt.Errorf("invalid unique column `%s` of table %s in manifest", column.UniqueWith, table.Name)
+				}
+			}
+			if column.Default != "" && !default_regex.MatchString(column.Default) {
+				return manifest, fmt.Errorf("invalid default of column %s of table %s in manifest", column.Name, table.Name)
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// Checks every entry listed in the manifest before
+// anything is restored
+func verifyArchive(archive *zip.Reader, manifest Manifest) error {
+	for _, file_manifest := range manifest.Files {
+		file, err := archive.Open(file_manifest.Path)
+		if err != nil {
+			return fmt.Errorf("archive is missing %s", file_manifest.Path)
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("could not read %s: %v", file_manifest.Path, err)
+		}
+		if size != file_manifest.Size || hex.EncodeToString(hash.Sum(nil)) != file_manifest.Sha256 {
+			return fmt.Errorf("checksum mismatch for %s", file_manifest.Path)
+		}
+	}
+	return nil
+}
+
+// Restores the archive into an empty database, the tables
+// that don't exist yet are created for the driver
+func RestoreBackup(db database.SqlDatabase, archive *zip.Reader, options RestoreOptions) (RestoreReport, error) {
+	var report RestoreReport
+	manifest, err := ReadManifest(archive)
+	if err != nil {
+		return report, err
+	}
+	if err = verifyArchive(archive, manifest); err != nil {
+		return report, err
+	}
+
+	// Nothing is written unless every table is empty
+	missing_tables := make(map[string]bool)
+	for _, table_manifest := range manifest.Tables {
+		exists, err := tableExists(db, table_manifest.Name)
+		if err != nil {
+			return report, err
+		}
+		if !exists {
+			missing_tables[table_manifest.Name] = true
+			continue
+		}
+
+		rows := 0
+		err = db.Connection.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s;", table_manifest.Name)).Scan(&rows)
+		if err != nil {
+			return report, fmt.Errorf("could not count rows of %s: %v", table_manifest.Name, err)
+		}
+		if rows > 0 {
+			return report, fmt.Errorf("database is not empty, table %s has %d rows", table_manifest.Name, rows)
+		}
+	}
+
+	for _, table_manifest := range manifest.Tables {
+		if !missing_tables[table_manifest.Name] {
+			continue
+		}
+		table, known := knownTable(table_manifest.Name)
+		if !known {
+			table = Table{Name: table_manifest.Name, Columns: table_manifest.Columns}
+		}
+		if _, err = db.Connection.Exec(table.createStatement(db.Driver)); err != nil {
+			return report, fmt.Errorf("could not create table %s: %v", table.Name, err)
+		}
+	}
+	if db.Driver == database.DRIVER_MYSQL {
+		if err = createUuidFunctions(db); err != nil {
+			return report, err
+		}
+	}
+
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return report, err
+	}
+	for _, table_manifest := range manifest.Tables {
+		table := Table{Name: table_manifest.Name, Columns: table_manifest.Columns}
+		rows, err := restoreTable(tx, archive, table)
+		if err != nil {
+			tx.Rollback()
+			return report, err
+		}
+		report.Tables++
+		report.Rows += rows
+	}
+	if err = tx.Commit(); err != nil {
+		return report, err
+	}
+
+	for _, file_manifest := range manifest.Files {
+		if file_manifest.Path == GALLERIES_FILE && options.GalleriesFile != "" {
+			dir, name := filepath.Split(options.GalleriesFile)
+			if err = restoreFile(archive, GALLERIES_FILE, dir, name); err != nil {
+				return report, err
+			}
+			report.Galleries = true
+			continue
+		}
+
+		relative_path, is_media := strings.CutPrefix(file_manifest.Path, MEDIA_DIRECTORY+"/")
+		if !is_media || options.ImageDirectory == "" {
+			continue
+		}
+		if err = restoreFile(archive, file_manifest.Path, options.ImageDirectory, relative_path); err != nil {
+			return report, err
+		}
+		report.Files++
+	}
+
+	return report, nil
+}
+
+func restoreTable(tx *sql.Tx, archive *zip.Reader, table Table) (int, error) {
+	file, err := archive.Open(path.Join(DATA_DIRECTORY, table.Name+".jsonl"))
+	if err != nil {
+		return 0, fmt.Errorf("archive has no data for %s", table.Name)
+	}
+	defer file.Close()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+	statement, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s);", table.Name, table.columnList(), placeholders))
+	if err != nil {
+		return 0, fmt.Errorf("could not prepare insert for %s: %v", table.Name, err)
+	}
+	defer statement.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	rows := 0
+	for {
+		var row map[string]any
+		err = decoder.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, fmt.Errorf("invalid row %d of %s: %v", rows+1, table.Name, err)
+		}
+
+		values := make([]any, len(table.Columns))
+		for i, column := range table.Columns {
+			values[i], err = column.sqlValue(row[column.Name])
+			if err != nil {
+				return rows, fmt.Errorf("invalid row %d of %s: %v", rows+1, table.Name, err)
+			}
+		}
+		if _, err = statement.Exec(values...); err != nil {
+			return rows, fmt.Errorf("could not restore row %d of %s: %v", rows+1, table.Name, err)
+		}
+		rows++
+	}
+	return rows, nil
+}
+
+func createUuidFunctions(db database.SqlDatabase) error {
+	for name, statement := range MYSQL_UUID_FUNCTIONS {
+		count := 0
+		err := db.Connection.QueryRow("SELECT COUNT(*) FROM information_schema.routines WHERE routine_schema = DATABASE() AND routine_name = ?;", name).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("could not check function %s: %v", name, err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err = db.Connection.Exec(statement); err != nil {
+			return fmt.Errorf("could not create function %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func restoreFile(archive *zip.Reader, name string, dir string, relative_path string) error {
+	if !filepath.IsLocal(relative_path) {
+		return fmt.Errorf("refusing to restore %s outside of %s", name, dir)
+	}
+
+	source, err := archive.Open(name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target_path := filepath.Join(dir, filepath.FromSlash(relative_path))
+	if err = os.MkdirAll(filepath.Dir(target_path), 0755); err != nil {
+		return err
+	}
+	target, err := os.Create(target_path)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	if _, err = io.Copy(target, source); err != nil {
+		return fmt.Errorf("could not restore %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rbc33/gocms/database"
+)
+
+// Portable column types, mapped to the type of each
+// driver when the tables are created on restore
+type ColumnKind string
+
+const (
+	COLUMN_INT     ColumnKind = "int"
+	COLUMN_BIGINT  ColumnKind = "bigint"
+	COLUMN_TEXT    ColumnKind = "text"
+	COLUMN_VARCHAR ColumnKind = "varchar"
+	COLUMN_JSON    ColumnKind = "json"
+	// Written as `YYYY-MM-DD HH:MM:SS` text
+	COLUMN_TIMESTAMP ColumnKind = "timestamp"
+	// UUIDs stored as BINARY(16) by `UuidToBin`
+	COLUMN_UUID ColumnKind = "uuid"
+)
+
+type Column struct {
+	Name          string     `json:"name"`
+	Kind          ColumnKind `json:"kind"`
+	Nullable      bool       `json:"nullable,omitempty"`
+	PrimaryKey    bool       `json:"primary_key,omitempty"`
+	AutoIncrement bool       `json:"auto_increment,omitempty"`
+	Unique        bool       `json:"unique,omitempty"`
+	// Columns the value is unique together with,
+	// separated by commas
+	UniqueWith string `json:"unique_with,omitempty"`
+	// SQL literal used for rows of older archives
+	// that don't have the column
+	Default string `json:"default,omitempty"`
+}
+
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+// Tables created by the migrations, tables that
+// don't exist in the database are skipped
+var TABLES = []Table{
+	{"posts", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "title", Kind: COLUMN_TEXT},
+		{Name: "excerpt", Kind: COLUMN_TEXT},
+		{Name: "content", Kind: COLUMN_TEXT},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+	}},
+	{"images", []Column{
+		{Name: "uuid", Kind: COLUMN_VARCHAR, PrimaryKey: true},
+		{Name: "name", Kind: COLUMN_TEXT},
+		{Name: "alt", Kind: COLUMN_TEXT},
+	}},
+	{"pages", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "title", Kind: COLUMN_TEXT},
+		{Name: "content", Kind: COLUMN_TEXT},
+		{Name: "link", Kind: COLUMN_VARCHAR, UniqueWith: "site_id, parent_id"},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+		{Name: "blocks", Kind: COLUMN_JSON, Nullable: true},
+		{Name: "parent_id", Kind: COLUMN_INT, Default: "0"},
+		{Name: "position", Kind: COLUMN_INT, Default: "0"},
+	}},
+	{"page_redirects", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+		{Name: "link", Kind: COLUMN_VARCHAR, UniqueWith: "site_id"},
+		{Name: "page_id", Kind: COLUMN_INT},
+	}},
+	{"card_schemas", []Column{
+		{Name: "uuid", Kind: COLUMN_UUID, PrimaryKey: true},
+		{Name: "json_id", Kind: COLUMN_VARCHAR},
+		{Name: "json_schema", Kind: COLUMN_JSON},
+		{Name: "json_title", Kind: COLUMN_VARCHAR},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+		{Name: "version", Kind: COLUMN_INT, Default: "1"},
+	}},
+	{"card_schema_versions", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "schema_uuid", Kind: COLUMN_UUID},
+		{Name: "version", Kind: COLUMN_INT, UniqueWith: "schema_uuid"},
+		{Name: "json_schema", Kind: COLUMN_JSON},
+		{Name: "created_at", Kind: COLUMN_TIMESTAMP, Default: "CURRENT_TIMESTAMP"},
+	}},
+	{"cards", []Column{
+		{Name: "uuid", Kind: COLUMN_UUID, PrimaryKey: true},
+		{Name: "image_location", Kind: COLUMN_TEXT},
+		{Name: "json_data", Kind: COLUMN_TEXT},
+		{Name: "json_schema", Kind: COLUMN_TEXT},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+		{Name: "schema_uuid", Kind: COLUMN_UUID, Nullable: true},
+		{Name: "position", Kind: COLUMN_INT, Default: "0"},
+		{Name: "created_at", Kind: COLUMN_TIMESTAMP, Default: "CURRENT_TIMESTAMP"},
+		{Name: "updated_at", Kind: COLUMN_TIMESTAMP, Default: "CURRENT_TIMESTAMP"},
+		{Name: "schema_version", Kind: COLUMN_INT, Default: "1"},
+	}},
+	{"post_permalinks", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "permalink", Kind: COLUMN_VARCHAR, Nullable: true, UniqueWith: "site_id"},
+		{Name: "post_id", Kind: COLUMN_INT},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+	}},
+	{"users", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "username", Kind: COLUMN_VARCHAR, Unique: true},
+		{Name: "passwd", Kind: COLUMN_VARCHAR},
+	}},
+	{"user_sites", []Column{
+		{Name: "user_id", Kind: COLUMN_INT},
+		{Name: "site_id", Kind: COLUMN_INT, UniqueWith: "user_id"},
+	}},
+	{"site_settings", []Column{
+		{Name: "site_id", Kind: COLUMN_INT},
+		{Name: "name", Kind: COLUMN_VARCHAR, UniqueWith: "site_id"},
+		{Name: "value", Kind: COLUMN_JSON},
+	}},
+	{"menus", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+		{Name: "name", Kind: COLUMN_VARCHAR},
+		{Name: "location", Kind: COLUMN_VARCHAR},
+	}},
+	{"menu_items", []Column{
+		{Name: "id", Kind: COLUMN_INT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "menu_id", Kind: COLUMN_INT},
+		{Name: "parent_id", Kind: COLUMN_INT},
+		{Name: "position", Kind: COLUMN_INT},
+		{Name: "type", Kind: COLUMN_VARCHAR},
+		{Name: "target", Kind: COLUMN_VARCHAR},
+		{Name: "label", Kind: COLUMN_VARCHAR},
+		{Name: "title", Kind: COLUMN_VARCHAR},
+		{Name: "visible", Kind: COLUMN_INT},
+	}},
+	{"post_previews", []Column{
+		{Name: "uuid", Kind: COLUMN_UUID, PrimaryKey: true},
+		{Name: "site_id", Kind: COLUMN_INT, Default: "1"},
+		{Name: "title", Kind: COLUMN_VARCHAR},
+		{Name: "excerpt", Kind: COLUMN_TEXT},
+		{Name: "content", Kind: COLUMN_TEXT},
+		{Name: "expires_at", Kind: COLUMN_TIMESTAMP},
+	}},
+	// Keeps goose from running the migrations again
+	// on the restored database
+	{"goose_db_version", []Column{
+		{Name: "id", Kind: COLUMN_BIGINT, PrimaryKey: true, AutoIncrement: true},
+		{Name: "version_id", Kind: COLUMN_BIGINT},
+		{Name: "is_applied", Kind: COLUMN_INT},
+		{Name: "tstamp", Kind: COLUMN_VARCHAR, Nullable: true},
+	}},
+}
+
+// Rows of one site in the tables that hold site content,
+// `?` is the id of the site. The other tables are dumped
+// whole in site backups.
+var SITE_FILTERS = map[string]string{
+	"posts":                "site_id = ?",
+	"pages":                "site_id = ?",
+	"page_redirects":       "site_id = ?",
+	"card_schemas":         "site_id = ?",
+	"card_schema_versions": "schema_uuid IN (SELECT uuid FROM card_schemas WHERE site_id = ?)",
+	"cards":                "site_id = ?",
+	"post_permalinks":      "site_id = ?",
+	"site_settings":        "site_id = ?",
+	"menus":                "site_id = ?",
+	"menu_items":           "menu_id IN (SELECT id FROM menus WHERE site_id = ?)",
+	"post_previews":        "site_id = ?",
+}
+
+// User accounts and their password hashes, never
+// written to site backups
+var ACCOUNT_TABLES = []string{"users", "user_sites"}
+
+func (table *Table) columnList() string {
+	names := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		names[i] = column.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func (table *Table) primaryKey() string {
+	for _, column := range table.Columns {
+		if column.PrimaryKey {
+			return column.Name
+		}
+	}
+	return table.Columns[0].Name
+}
+
+func (column *Column) scanTarget() any {
+	switch column.Kind {
+	case COLUMN_INT, COLUMN_BIGINT:
+		return &sql.NullInt64{}
+	case COLUMN_UUID:
+		return &[]byte{}
+	default:
+		return &sql.NullString{}
+	}
+}
+
+// Binary values are written as base64
+func (column *Column) jsonValue(value any) any {
+	switch value := value.(type) {
+	case *sql.NullInt64:
+		if !value.Valid {
+			return nil
+		}
+		return value.Int64
+	case *sql.NullString:
+		if !value.Valid {
+			return nil
+		}
+		return value.String
+	case *[]byte:
+		if *value == nil {
+			return nil
+		}
+		return base64.StdEncoding.EncodeToString(*value)
+	}
+	return nil
+}
+
+// Reverse of `jsonValue` for a value decoded with `UseNumber`
+func (column *Column) sqlValue(value any) (any, error) {
+	if value == nil {
+		if !column.Nullable {
+			return nil, fmt.Errorf("column %s can't be null", column.Name)
+		}
+		return nil, nil
+	}
+
+	switch column.Kind {
+	case COLUMN_INT, COLUMN_BIGINT:
+		number, ok := value.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("column %s expects a number", column.Name)
+		}
+		return number.Int64()
+	case COLUMN_UUID:
+		encoded, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("column %s expects base64 data", column.Name)
+		}
+		return base64.StdEncoding.DecodeString(encoded)
+	default:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("column %s expects a string", column.Name)
+		}
+		return text, nil
+	}
+}
+
+func (column *Column) definition(driver string) string {
+	var sql_type string
+	switch column.Kind {
+	case COLUMN_INT:
+		sql_type = "INT"
+	case COLUMN_BIGINT:
+		sql_type = "BIGINT"
+	case COLUMN_VARCHAR:
+		sql_type = "VARCHAR(255)"
+	case COLUMN_JSON:
+		sql_type = "JSON"
+	case COLUMN_UUID:
+		sql_type = "BINARY(16)"
+	case COLUMN_TIMESTAMP:
+		sql_type = "TIMESTAMP"
+	default:
+		sql_type = "TEXT"
+	}
+
+	if driver == database.DRIVER_SQLITE {
+		switch column.Kind {
+		case COLUMN_INT, COLUMN_BIGINT:
+			// Only INTEGER primary keys alias the rowid
+			sql_type = "INTEGER"
+		case COLUMN_JSON:
+			sql_type = "TEXT"
+		case COLUMN_UUID:
+			sql_type = "BLOB"
+		case COLUMN_TIMESTAMP:
+			sql_type = "TEXT"
+		}
+	}
+
+	definition := column.Name + " " + sql_type
+	if !column.Nullable {
+		definition += " NOT NULL"
+	}
+	if column.PrimaryKey {
+		definition += " PRIMARY KEY"
+		if column.AutoIncrement && driver == database.DRIVER_SQLITE {
+			definition += " AUTOINCREMENT"
+		}
+	}
+	if column.AutoIncrement && driver != database.DRIVER_SQLITE {
+		definition += " AUTO_INCREMENT"
+	}
+	if column.Unique && !column.PrimaryKey {
+		definition += " UNIQUE"
+	}
+	if column.Default != "" {
+		definition += " DEFAULT " + column.Default
+	}
+	return definition
+}
+
+func (table *Table) createStatement(driver string) string {
+	definitions := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		definitions[i] = column.definition(driver)
+	}
+	for _, column := range table.Columns {
+		if column.UniqueWith != "" {
+			definitions = append(definitions, fmt.Sprintf("UNIQUE (%s, %s)", column.UniqueWith, column.Name))
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", table.Name, strings.Join(definitions, ",\n  "))
+}
+
+// Current definition of a table, the manifest of
+// older archives can miss some of its columns
+func knownTable(name string) (Table, bool) {
+	for _, table := range TABLES {
+		if table.Name == name {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
+
+func tableExists(db database.SqlDatabase, name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;"
+	if db.Driver == database.DRIVER_SQLITE {
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?;"
+	}
+
+	count := 0
+	if err := db.Connection.QueryRow(query, name).Scan(&count); err != nil {
+		return false, fmt.Errorf("could not check table %s: %v", name, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rbc33/gocms/backup"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+func readConfig(config_toml string) bool {
+	if config_toml == "" {
+		return true
+	}
+	settings, err := common.ReadConfigToml(config_toml)
+	if err != nil {
+		log.Error().Msgf("Could not read config file: %s", err)
+		return false
+	}
+	common.GetSettings(settings)
+	return true
+}
+
+// gocms-admin backup --config gocms_config.toml --out site.zip
+func runBackup(args []string) int {
+	backup_flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	config_toml := backup_flags.String("config", "", "path to the config file")
+	out_file := backup_flags.String("out", "", "file the archive is written to")
+	backup_flags.Parse(args)
+
+	if *out_file == "" {
+		fmt.Println("the --out file is required")
+		backup_flags.Usage()
+		return -1
+	}
+	if !readConfig(*config_toml) {
+		return -1
+	}
+
+	db_connection, err := database.MakeSqlConnection(*common.CurrentSettings())
+	if err != nil {
+		log.Error().Msgf("could not create database connection: %v", err)
+		return -1
+	}
+
+	out, err := os.Create(*out_file)
+	if err != nil {
+		log.Error().Msgf("could not create %s: %v", *out_file, err)
+		return -1
+	}
+	defer out.Close()
+
+	manifest, err := backup.WriteBackup(db_connection, backup.BackupOptions{
+		ImageDirectory: common.CurrentSettings().ImageDirectory,
+		Galleries:      common.CurrentSettings().Galleries,
+	}, out)
+	if err != nil {
+		log.Error().Msgf("could not write backup: %v", err)
+		return -1
+	}
+
+	rows := 0
+	for _, table := range manifest.Tables {
+		rows += table.Rows
+	}
+	fmt.Printf("backed up %d tables with %d rows and %d files to %s\n", len(manifest.Tables), rows, len(manifest.Files), *out_file)
+	return 0
+}
+
+// gocms-admin restore --config gocms_config.toml --archive site.zip [--driver sqlite3 --database gocms.db]
+func runRestore(args []string) int {
+	restore_flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	config_toml := restore_flags.String("config", "", "path to the config file")
+	archive_file := restore_flags.String("archive", "", "backup archive to restore")
+	driver := restore_flags.String("driver", database.DRIVER_MYSQL, "driver of the database to restore into, mysql or sqlite3")
+	database_uri := restore_flags.String("database", "", "connection string or sqlite file, the config database by default")
+	image_directory := restore_flags.String("images", "", "directory the media is restored to, the config image directory by default")
+	galleries_file := restore_flags.String("galleries", "", "file the galleries are written to, they are not restored if empty")
+	restore_flags.Parse(args)
+
+	if *archive_file == "" {
+		fmt.Println("the --archive file is required")
+		restore_flags.Usage()
+		return -1
+	}
+	if !readConfig(*config_toml) {
+		return -1
+	}
+	if *image_directory == "" {
+		*image_directory = common.CurrentSettings().ImageDirectory
+	}
+
+	var db_connection database.SqlDatabase
+	var err error
+	switch *driver {
+	case database.DRIVER_MYSQL:
+		settings := *common.CurrentSettings()
+		if *database_uri != "" {
+			settings.DatabaseUri = *database_uri
+		}
+		db_connection, err = database.MakeSqlConnection(settings)
+	case database.DRIVER_SQLITE, "sqlite":
+		if *database_uri == "" {
+			fmt.Println("the --database file is required for sqlite")
+			return -1
+		}
+		db_connection, err = database.MakeSqliteConnection(*database_uri)
+	default:
+		fmt.Printf("unsupported driver %s\n", *driver)
+		return -1
+	}
+	if err != nil {
+		log.Error().Msgf("could not create database connection: %v", err)
+		return -1
+	}
+
+	archive, err := zip.OpenReader(*archive_file)
+	if err != nil {
+		log.Error().Msgf("could not open %s: %v", *archive_file, err)
+		return -1
+	}
+	defer archive.Close()
+
+	report, err := backup.RestoreBackup(db_connection, &archive.Reader, backup.RestoreOptions{
+		ImageDirectory: *image_directory,
+		GalleriesFile:  *galleries_file,
+	})
+	if err != nil {
+		log.Error().Msgf("could not restore backup: %v", err)
+		return -1
+	}
+
+	fmt.Printf("restored %d tables with %d rows and %d files\n", report.Tables, report.Rows, report.Files)
+	if report.Galleries {
+		fmt.Printf("galleries written to %s, add them to the config file\n", *galleries_file)
+	}
+	return 0
+}
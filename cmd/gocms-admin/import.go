@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+// gocms-admin import --config gocms_config.toml [--site id] (--wxr export.xml | --markdown dir)
+func runImport(args []string) int {
+	import_flags := flag.NewFlagSet("import", flag.ExitOnError)
+	config_toml := import_flags.String("config", "", "path to the config file")
+	wxr_file := import_flags.String("wxr", "", "WordPress WXR export to import")
+	markdown_dir := import_flags.String("markdown", "", "directory of markdown files with front-matter to import")
+	skip_images := import_flags.Bool("skip-images", false, "keep the original image references")
+	site_id := import_flags.Int("site", common.DEFAULT_SITE_ID, "id of the site the content is imported into")
+	import_flags.Parse(args)
+
+	if (*wxr_file == "") == (*markdown_dir == "") {
+		fmt.Println("exactly one of --wxr or --markdown is required")
+		import_flags.Usage()
+		return -1
+	}
+
+	if !readConfig(*config_toml) {
+		return -1
+	}
+
+	if _, exists := common.CurrentSettings().SiteById(*site_id); !exists {
+		log.Error().Msgf("site %d is not in the config", *site_id)
+		return -1
+	}
+
+	db_connection, err := database.MakeSqlConnection(*common.CurrentSettings())
+	if err != nil {
+		log.Error().Msgf("could not create database connection: %v", err)
+		return -1
+	}
+	site_database := db_connection.ForSite(*site_id)
+
+	options := admin_app.ImportOptions{
+		DownloadImages: !*skip_images,
+		ImageDirectory: common.SiteImageDirectory(*site_id),
+	}
+	var report admin_app.ImportReport
+	if *wxr_file != "" {
+		file, err := os.Open(*wxr_file)
+		if err != nil {
+			log.Error().Msgf("could not open %s: %v", *wxr_file, err)
+			return -1
+		}
+		defer file.Close()
+		report, err = admin_app.ImportWXR(site_database, file, options)
+	} else {
+		report, err = admin_app.ImportMarkdownDir(site_database, *markdown_dir, options)
+	}
+	if err != nil {
+		log.Error().Msgf("could not import content: %v", err)
+		return -1
+	}
+
+	err = admin_app.MakeCacheInvalidator(*common.CurrentSettings()).Invalidate(common.CacheInvalidationRequest{
+		Tags: []string{common.CACHE_TAG_POSTS, common.CACHE_TAG_PAGES, common.CACHE_TAG_IMAGES},
+	})
+	if err != nil {
+		log.Warn().Msgf("could not invalidate the app cache: %v", err)
+	}
+
+	fmt.Printf("imported %d posts, %d pages, %d images, %d permalinks, %d skipped\n", report.Posts, report.Pages, report.Images, report.Permalinks, report.Skipped)
+	for _, failed := range report.Failed {
+		fmt.Printf("could not import %s\n", failed)
+	}
+	if len(report.Failed) > 0 {
+		return -1
+	}
+	return 0
+}
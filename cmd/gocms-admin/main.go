@@ -37,15 +37,26 @@ import (
 )
 
 func main() {
-
-	config_toml := flag.String("config", "", "path to the config file")
-	flag.Parse()
-
 	common.SetupLogger("error-admin.log")
 	err := godotenv.Load()
 	if err != nil {
 		log.Error().Msgf("Error loading .env file")
 	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackup(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:]))
+		}
+	}
+
+	config_toml := flag.String("config", "", "path to the config file")
+	flag.Parse()
+
 	fmt.Println("TOKEN_HOUR_LIFESPAN:", os.Getenv("TOKEN_HOUR_LIFESPAN"))
 
 	if (*config_toml) != "" {
@@ -57,6 +68,12 @@ func main() {
 		}
 		common.GetSettings(settings)
 
+		config_watcher, err := common.WatchConfig(*config_toml)
+		if err != nil {
+			log.Warn().Msgf("config changes need a restart, could not watch the config file: %v", err)
+		} else {
+			defer config_watcher.Close()
+		}
 	}
 
 	// err := godotenv.Load()
@@ -65,37 +82,29 @@ func main() {
 	// 	os.Exit(-1)
 	// }
 
-	db_connection, err := database.MakeSqlConnection(common.Settings)
+	db_connection, err := database.MakeSqlConnection(*common.CurrentSettings())
 	if err != nil {
 		log.Error().Msgf("could not create database connection: %v", err)
 		return
 	}
 	Port := (os.Getenv("PORT_ADMIN"))
 	if Port == "" {
-		Port = common.Settings.WebserverPortAdmin
+		Port = common.CurrentSettings().WebserverPortAdmin
 	}
-	shortcode_handlers, err := admin_app.LoadShortcodesHandlers(common.Settings.Shortcodes)
+	shortcode_handlers, err := admin_app.LoadShortcodesHandlers(common.CurrentSettings().Shortcodes)
 	if err != nil {
 		log.Error().Msgf("%s", err)
 		os.Exit(-1)
 	}
 
-	// TODO : we probably want to refactor loadShortcodeHandler
-	// TODO : into loadPluginHandlers instead
-
-	post_hook := &plugins.PostHook{}
-	image_plugin := plugins.Plugin{
-		ScriptName: "img",
-		Id:         "img-plugin",
-	}
-	post_hook.Register(image_plugin)
-	// img, _ := shortcode_handlers["img"]
-	hooks_map := map[string]plugins.Hook{
-		"add_post": post_hook,
+	hooks, err := plugins.LoadHooks(common.CurrentSettings().Plugins)
+	if err != nil {
+		log.Error().Msgf("%s", err)
+		os.Exit(-1)
 	}
 
-	r := admin_app.SetupRoutes(common.Settings, shortcode_handlers, &db_connection, hooks_map)
-	// r := admin_app.SetupRoutes(common.Settings, shortcode_handlers, &db_connection)// Esta línea añade la ruta para la UI de Swagger.
+	r := admin_app.SetupRoutes(*common.CurrentSettings(), shortcode_handlers, &db_connection, hooks)
+	// r := admin_app.SetupRoutes(*common.CurrentSettings(), shortcode_handlers, &db_connection)// Esta línea añade la ruta para la UI de Swagger.
 	// // La URL será: http://localhost:8081/swagger/index.html
 	// r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	err = r.Run(fmt.Sprintf(":%s", Port))
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/rbc33/gocms/app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	"github.com/rs/zerolog/log"
+)
+
+// gocms export --config gocms_config.toml --out dir [--incremental] [--site id | --host host]
+func runExport(args []string) int {
+	export_flags := flag.NewFlagSet("export", flag.ExitOnError)
+	config_toml := export_flags.String("config", "", "path to the config file")
+	out_dir := export_flags.String("out", "", "directory the static site is written to")
+	static_dir := export_flags.String("static", "./static", "directory with the static assets")
+	base_path := export_flags.String("base-path", "", "path the site is served from, e.g. /blog")
+	incremental := export_flags.Bool("incremental", false, "only render the pages whose content changed")
+	site_id := export_flags.Int("site", 0, "id of the site to export, the default site if no host is given either")
+	host := export_flags.String("host", "", "host of the site to export, picking the site like the app does")
+	export_flags.Parse(args)
+
+	if *out_dir == "" {
+		fmt.Println("the --out directory is required")
+		export_flags.Usage()
+		return -1
+	}
+
+	if (*config_toml) != "" {
+		settings, err := common.ReadConfigToml(*config_toml)
+		if err != nil {
+			log.Error().Msgf("Could not read config file: %s", err)
+			return -1
+		}
+		common.GetSettings(settings)
+	}
+
+	// The site is resolved from the host of its requests
+	if *site_id != 0 {
+		site, exists := common.CurrentSettings().SiteById(*site_id)
+		if !exists {
+			log.Error().Msgf("site %d is not in the config", *site_id)
+			return -1
+		}
+		if *host == "" && len(site.Hosts) > 0 {
+			*host = site.Hosts[0]
+		}
+		if common.CurrentSettings().SiteForHost(*host).Id != site.Id {
+			log.Error().Msgf("site %d has no host it can be requested with, use --host", *site_id)
+			return -1
+		}
+	}
+
+	db_connection, err := database.MakeSqlConnection(*common.CurrentSettings())
+	if err != nil {
+		log.Error().Msgf("could not create database connection: %v", err)
+		return -1
+	}
+
+	report, err := app.ExportSite(&db_connection, app.ExportOptions{
+		OutDir:      *out_dir,
+		StaticDir:   *static_dir,
+		BasePath:    *base_path,
+		Incremental: *incremental,
+		Host:        *host,
+	})
+	if err != nil {
+		log.Error().Msgf("could not export site: %v", err)
+		return -1
+	}
+
+	fmt.Printf("rendered %d pages, %d unchanged, %d removed, %d assets copied\n", report.Rendered, report.Skipped, report.Removed, report.Assets)
+	for _, failed := range report.Failed {
+		fmt.Printf("could not export %s\n", failed)
+	}
+	if len(report.Failed) > 0 {
+		return -1
+	}
+	return 0
+}
@@ -14,11 +14,15 @@ import (
 )
 
 func main() {
+	common.SetupLogger("error.log")
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
+
 	config_toml := flag.String("config", "", "path to the config file")
 	flag.Parse()
 
-	common.SetupLogger("error.log")
-
 	if (*config_toml) != "" {
 		log.Info().Msgf("Reading config file %s", *config_toml)
 		settings, err := common.ReadConfigToml(*config_toml)
@@ -28,6 +32,12 @@ func main() {
 		}
 		common.GetSettings(settings)
 
+		config_watcher, err := common.WatchConfig(*config_toml)
+		if err != nil {
+			log.Warn().Msgf("config changes need a restart, could not watch the config file: %v", err)
+		} else {
+			defer config_watcher.Close()
+		}
 	}
 
 	// err := godotenv.Load()
@@ -36,16 +46,16 @@ func main() {
 	// 	os.Exit(-1)
 	// }
 
-	db_connection, err := database.MakeSqlConnection(common.Settings)
+	db_connection, err := database.MakeSqlConnection(*common.CurrentSettings())
 	if err != nil {
 		log.Error().Msgf("could not create database connection: %v", err)
 		return
 	}
 	Port := os.Getenv("PORT")
 	if Port == "" {
-		Port = common.Settings.WebserverPort
+		Port = common.CurrentSettings().WebserverPort
 	}
-	r := app.SetupRoutes(common.Settings, &db_connection)
+	r := app.SetupRoutes(*common.CurrentSettings(), &db_connection)
 	err = r.Run(fmt.Sprintf(":%s", Port))
 
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 
 	"github.com/BurntSushi/toml"
 )
@@ -15,20 +16,50 @@ type Shortcode struct {
 	Plugin string `toml:"plugin"`
 }
 
+// Lua script called on the events it subscribes to, it has
+// a global function named after each of them
+type Plugin struct {
+	// name of the plugin in the logs and errors
+	Name string `toml:"name"`
+	// the lua script path
+	Script string `toml:"script"`
+	// e.g. `before_post_save`, see the events in plugins
+	Events []string `toml:"events"`
+}
+
+// Cache-Control header sent for a route, the route is
+// the pattern as registered in gin, e.g. `/post/:id`,
+// or `*` for all the routes without their own policy
+type CacheControlPolicy struct {
+	Route  string `toml:"route"`
+	Header string `toml:"header"`
+}
+
 type AppSettings struct {
-	DatabaseUri        string             `toml:"MY_SQL_URL"`
-	WebserverPort      string             `toml:"PORT"`
-	WebserverPortAdmin string             `toml:"PORT_ADMIN"`
-	CardSchema         []CardSchema       `toml:"card_schema"`
-	Shortcodes         []Shortcode        `toml:"shortcodes"`
-	ImageDirectory     string             `toml:"image_dir"`
-	CacheEnabled       bool               `toml:"cache_enabled"`
-	AppNavbar          Navbar             `toml:"navbar"`
-	RecaptchaSiteKey   string             `toml:"recaptcha_sitekey, omitempty"`
-	RecaptchaSecret    string             `toml:"recaptcha_secret, omitempty"`
-	AppDomain          string             `toml:"app_domain, omitempty"`
-	Galleries          map[string]Gallery `toml:"gallery"`
-	StickyPosts        []int              `toml:"sticky_posts"`
+	DatabaseUri        string               `toml:"MY_SQL_URL"`
+	WebserverPort      string               `toml:"PORT"`
+	WebserverPortAdmin string               `toml:"PORT_ADMIN"`
+	CardSchema         []CardSchema         `toml:"card_schema"`
+	Shortcodes         []Shortcode          `toml:"shortcodes"`
+	Plugins            []Plugin             `toml:"plugins"`
+	ImageDirectory     string               `toml:"image_dir"`
+	CacheEnabled       bool                 `toml:"cache_enabled"`
+	CacheMaxSizeMB     int                  `toml:"cache_max_size_mb"`
+	CacheStaleSeconds  int                  `toml:"cache_stale_seconds"`
+	CacheSecret        string               `toml:"cache_secret"`
+	CacheInvalidateUrl string               `toml:"cache_invalidate_url"`
+	CacheBackend       string               `toml:"cache_backend"`
+	RedisUrl           string               `toml:"redis_url"`
+	CacheControl       []CacheControlPolicy `toml:"cache_control"`
+	AppNavbar          Navbar               `toml:"navbar"`
+	RecaptchaSiteKey   string               `toml:"recaptcha_sitekey, omitempty"`
+	RecaptchaSecret    string               `toml:"recaptcha_secret, omitempty"`
+	AppDomain          string               `toml:"app_domain, omitempty"`
+	Galleries          map[string]Gallery   `toml:"gallery"`
+	StickyPosts        []int                `toml:"sticky_posts"`
+	// Stylesheet in `static/themes`, without the extension
+	Theme string `toml:"theme"`
+	Sites []Site `toml:"site"`
 }
 
 type Navbar struct {
@@ -36,10 +67,28 @@ type Navbar struct {
 	Dropdowns map[string][]Link `toml:"dropdowns"`
 }
 
-var Settings AppSettings
+// Swapped as a whole when the config is reloaded,
+// readers never see a half updated config
+var current_settings atomic.Pointer[AppSettings]
+
+func init() {
+	current_settings.Store(&AppSettings{})
+}
+
+// Settings in use, callers must not modify them
+func CurrentSettings() *AppSettings {
+	return current_settings.Load()
+}
 
 func GetSettings(settings AppSettings) {
-	Settings = settings
+	current_settings.Store(&settings)
+}
+
+// Replaces the settings by a modified copy
+func UpdateSettings(update func(settings *AppSettings)) {
+	settings := *CurrentSettings()
+	update(&settings)
+	GetSettings(settings)
 }
 func ReadConfigToml(filepath string) (AppSettings, error) {
 	var config AppSettings
@@ -70,6 +119,9 @@ func ReadConfigToml(filepath string) (AppSettings, error) {
 	if config.WebserverPort == "" {
 		return config, fmt.Errorf("PORT is required")
 	}
+	if err = validateSites(config.Sites); err != nil {
+		return config, err
+	}
 
 	return config, nil
 }
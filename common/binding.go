@@ -16,10 +16,6 @@ type CardIdBinding struct {
 	StringIdBinding
 }
 
-type PageLinkBinding struct {
-	Link string `uri:"link" binding:"required"`
-}
-
 type ImageIdBinding struct {
 	// This is the uuid of an image to be retrieved
 	Filename string `uri:"name" binding:"required"`
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Types of the blocks pages can be built from
+const (
+	BLOCK_MARKDOWN     = "markdown"
+	BLOCK_HERO         = "hero"
+	BLOCK_IMAGE        = "image"
+	BLOCK_GALLERY      = "gallery"
+	BLOCK_CARDS        = "cards"
+	BLOCK_CTA          = "cta"
+	BLOCK_CONTACT_FORM = "contact_form"
+)
+
+const button_schema = `"button_text": {"type": "string"}, "button_href": {"type": "string"}`
+
+// JSON schema the data of each block type must follow
+var BLOCK_SCHEMAS = map[string]string{
+	BLOCK_MARKDOWN: `{"type": "object", "properties": {
+		"content": {"type": "string", "minLength": 1}
+	}, "required": ["content"], "additionalProperties": false}`,
+	BLOCK_HERO: `{"type": "object", "properties": {
+		"title": {"type": "string", "minLength": 1},
+		"subtitle": {"type": "string"},
+		"image": {"type": "string"},
+		` + button_schema + `
+	}, "required": ["title"], "additionalProperties": false}`,
+	BLOCK_IMAGE: `{"type": "object", "properties": {
+		"image": {"type": "string", "minLength": 1},
+		"alt": {"type": "string"},
+		"caption": {"type": "string"}
+	}, "required": ["image"], "additionalProperties": false}`,
+	BLOCK_GALLERY: `{"type": "object", "properties": {
+		"gallery": {"type": "string", "minLength": 1}
+	}, "required": ["gallery"], "additionalProperties": false}`,
+	BLOCK_CARDS: `{"type": "object", "properties": {
+		"schema": {"type": "string", "minLength": 1},
+		"limit": {"type": "integer", "minimum": 1, "maximum": 100}
+	}, "required": ["schema"], "additionalProperties": false}`,
+	BLOCK_CTA: `{"type": "object", "properties": {
+		"title": {"type": "string", "minLength": 1},
+		"text": {"type": "string"},
+		` + button_schema + `
+	}, "required": ["title", "button_text", "button_href"], "additionalProperties": false}`,
+	BLOCK_CONTACT_FORM: `{"type": "object", "properties": {
+		"title": {"type": "string"}
+	}, "additionalProperties": false}`,
+}
+
+// A section of a page, `Data` follows the schema of its type
+type Block struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+type MarkdownBlock struct {
+	Content string `json:"content"`
+}
+
+type HeroBlock struct {
+	Title      string `json:"title"`
+	Subtitle   string `json:"subtitle"`
+	Image      string `json:"image"`
+	ButtonText string `json:"button_text"`
+	ButtonHref string `json:"button_href"`
+}
+
+type ImageBlock struct {
+	Image   string `json:"image"`
+	Alt     string `json:"alt"`
+	Caption string `json:"caption"`
+}
+
+type GalleryBlock struct {
+	Gallery string `json:"gallery"`
+}
+
+// Cards of a schema, like the product pages
+type CardsBlock struct {
+	Schema string `json:"schema"`
+	Limit  int    `json:"limit"`
+}
+
+type CtaBlock struct {
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+	ButtonText string `json:"button_text"`
+	ButtonHref string `json:"button_href"`
+}
+
+type ContactFormBlock struct {
+	Title string `json:"title"`
+}
+
+// Checks the data of every block against the schema
+// of its type, errors name the position of the block
+func ValidateBlocks(blocks []Block) error {
+	for i, block := range blocks {
+		schema, exists := BLOCK_SCHEMAS[block.Type]
+		if !exists {
+			return fmt.Errorf("block %d has unknown type `%s`", i, block.Type)
+		}
+		data := block.Data
+		if len(data) == 0 {
+			data = json.RawMessage("{}")
+		}
+
+		result, err := gojsonschema.Validate(gojsonschema.NewStringLoader(schema), gojsonschema.NewBytesLoader(data))
+		if err != nil {
+			return fmt.Errorf("invalid %s block %d: %v", block.Type, i, err)
+		}
+		if !result.Valid() {
+			errors := []string{}
+			for _, err := range result.Errors() {
+				errors = append(errors, err.String())
+			}
+			return fmt.Errorf("invalid %s block %d: %s", block.Type, i, strings.Join(errors, "; "))
+		}
+	}
+	return nil
+}
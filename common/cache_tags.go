@@ -0,0 +1,62 @@
+package common
+
+import "fmt"
+
+// Tags shared between the app and the admin-app so that
+// content mutations in the admin-app can invalidate the
+// pages rendered from that content in the app.
+const (
+	CACHE_TAG_POSTS   = "posts"
+	CACHE_TAG_PAGES   = "pages"
+	CACHE_TAG_SCHEMAS = "schemas"
+	CACHE_TAG_CARDS   = "cards"
+	CACHE_TAG_IMAGES  = "images"
+)
+
+// Header carrying the shared secret on invalidation requests
+const CACHE_SECRET_HEADER = "X-Cache-Secret"
+
+func PostCacheTag(id int) string {
+	return fmt.Sprintf("post:%d", id)
+}
+
+func PageCacheTag(link string) string {
+	return fmt.Sprintf("page:%s", link)
+}
+
+func PageIdCacheTag(id int) string {
+	return fmt.Sprintf("page-id:%d", id)
+}
+
+func SchemaCacheTag(uuid string) string {
+	return fmt.Sprintf("schema:%s", uuid)
+}
+
+func GalleryCacheTag(name string) string {
+	return fmt.Sprintf("gallery:%s", name)
+}
+
+// Every page of the site depends on its settings
+func SettingsCacheTag(site_id int) string {
+	return fmt.Sprintf("settings:%d", site_id)
+}
+
+// Every page of the site shows its menus, which
+// follow the pages and posts they link to
+func MenusCacheTag(site_id int) string {
+	return fmt.Sprintf("menus:%d", site_id)
+}
+
+// Every cached entry is implicitly tagged with the path
+// it was requested from (without the query string).
+func PathCacheTag(path string) string {
+	return fmt.Sprintf("path:%s", path)
+}
+
+// Body of the cache invalidation messages sent by the
+// admin-app to the app.
+type CacheInvalidationRequest struct {
+	Tags  []string `json:"tags"`
+	Paths []string `json:"paths"`
+	All   bool     `json:"all"`
+}
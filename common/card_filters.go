@@ -0,0 +1,145 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Kinds of card data fields that can be filtered,
+// derived from the properties of the schema
+const (
+	CARD_FIELD_ENUM    = "enum"
+	CARD_FIELD_NUMBER  = "number"
+	CARD_FIELD_BOOLEAN = "boolean"
+)
+
+// Filter operators, `eq` matches any of the values
+const (
+	FILTER_EQ  = "eq"
+	FILTER_LT  = "lt"
+	FILTER_LTE = "lte"
+	FILTER_GT  = "gt"
+	FILTER_GTE = "gte"
+)
+
+// Top level property of a card schema
+type CardField struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	// Values of `enum` fields, in the schema order
+	Enum []string `json:"enum,omitempty"`
+}
+
+type CardFilter struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"`
+	Values []string `json:"values"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Counts of a field for the cards matching the
+// filters on the other fields
+type CardFacet struct {
+	Field CardField `json:"field"`
+	// Counts of `enum` and `boolean` fields
+	Values []FacetValue `json:"values,omitempty"`
+	// Range of `number` fields
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// Fields of the schema cards can be filtered by, by name.
+// Properties that aren't enums, numbers or booleans are left out.
+func CardFilterFields(json_schema string) ([]CardField, error) {
+	var schema struct {
+		Properties map[string]struct {
+			Title string            `json:"title"`
+			Type  any               `json:"type"`
+			Enum  []json.RawMessage `json:"enum"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(json_schema), &schema); err != nil {
+		return nil, fmt.Errorf("could not parse card schema: %v", err)
+	}
+
+	fields := []CardField{}
+	for name, property := range schema.Properties {
+		field := CardField{Name: name, Title: property.Title}
+		if field.Title == "" {
+			field.Title = name
+		}
+
+		switch {
+		case len(property.Enum) > 0:
+			field.Type = CARD_FIELD_ENUM
+			for _, value := range property.Enum {
+				var text string
+				if err := json.Unmarshal(value, &text); err != nil {
+					// Enums of numbers and such are compared as text
+					text = string(value)
+				}
+				field.Enum = append(field.Enum, text)
+			}
+		case property.Type == "number" || property.Type == "integer":
+			field.Type = CARD_FIELD_NUMBER
+		case property.Type == "boolean":
+			field.Type = CARD_FIELD_BOOLEAN
+		default:
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields, nil
+}
+
+// Checks that the operator and values make sense
+// for the type of the field
+func (field *CardField) CheckFilter(filter CardFilter) error {
+	if len(filter.Values) == 0 {
+		return fmt.Errorf("filter on `%s` has no value", field.Name)
+	}
+
+	switch field.Type {
+	case CARD_FIELD_NUMBER:
+		if filter.Op != FILTER_EQ && len(filter.Values) > 1 {
+			return fmt.Errorf("filter `%s` on `%s` takes a single value", filter.Op, field.Name)
+		}
+		switch filter.Op {
+		case FILTER_EQ, FILTER_LT, FILTER_LTE, FILTER_GT, FILTER_GTE:
+		default:
+			return fmt.Errorf("unknown filter `%s` on `%s`", filter.Op, field.Name)
+		}
+		for _, value := range filter.Values {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("`%s` is not a number", value)
+			}
+		}
+	case CARD_FIELD_ENUM, CARD_FIELD_BOOLEAN:
+		if filter.Op != FILTER_EQ {
+			return fmt.Errorf("`%s` can only be filtered by value", field.Name)
+		}
+		allowed := field.Enum
+		if field.Type == CARD_FIELD_BOOLEAN {
+			allowed = []string{"true", "false"}
+		}
+		for _, value := range filter.Values {
+			if !slices.Contains(allowed, value) {
+				return fmt.Errorf("`%s` is not a value of `%s`", value, field.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("`%s` can't be filtered", field.Name)
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Inputs the card forms are made of
+const (
+	FORM_FIELD_TEXT     = "text"
+	FORM_FIELD_TEXTAREA = "textarea"
+	FORM_FIELD_NUMBER   = "number"
+	FORM_FIELD_INTEGER  = "integer"
+	FORM_FIELD_BOOLEAN  = "boolean"
+	FORM_FIELD_ENUM     = "enum"
+	FORM_FIELD_IMAGE    = "image"
+	FORM_FIELD_OBJECT   = "object"
+	FORM_FIELD_ARRAY    = "array"
+)
+
+// Input of a card form made from a property of the schema
+type FormField struct {
+	// JSON pointer of the value in the card data,
+	// also used as the name of the input
+	Name        string
+	Label       string
+	Description string
+	Type        string
+	Required    bool
+	// Values of enums and images to choose from
+	Options   []string
+	Min       *float64
+	Max       *float64
+	MinLength *int
+	MaxLength *int
+	Pattern   string
+	// Value of the input, checked booleans are "true"
+	Value string
+	// Properties of objects and items of arrays
+	Fields []FormField
+	Error  string
+}
+
+// Subset of JSON schema the forms understand,
+// the properties keep their order
+type formSchema struct {
+	Type        any               `json:"type"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Format      string            `json:"format"`
+	Enum        []json.RawMessage `json:"enum"`
+	Properties  json.RawMessage   `json:"properties"`
+	Required    []string          `json:"required"`
+	Items       *formSchema       `json:"items"`
+	Minimum     *float64          `json:"minimum"`
+	Maximum     *float64          `json:"maximum"`
+	MinLength   *int              `json:"minLength"`
+	MaxLength   *int              `json:"maxLength"`
+	Pattern     string            `json:"pattern"`
+
+	property_names []string
+	properties     map[string]*formSchema
+}
+
+func parseFormSchema(data []byte) (*formSchema, error) {
+	schema := &formSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	if err := schema.parseProperties(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// Reads the properties one by one, a map would lose their order
+func (schema *formSchema) parseProperties() error {
+	schema.properties = make(map[string]*formSchema)
+	if schema.Items != nil {
+		if err := schema.Items.parseProperties(); err != nil {
+			return err
+		}
+	}
+	if len(schema.Properties) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(schema.Properties))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return fmt.Errorf("`properties` must be an object")
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string)
+		var property json.RawMessage
+		if err = decoder.Decode(&property); err != nil {
+			return err
+		}
+		if schema.properties[name], err = parseFormSchema(property); err != nil {
+			return fmt.Errorf("property `%s`: %v", name, err)
+		}
+		schema.property_names = append(schema.property_names, name)
+	}
+	return nil
+}
+
+// First type of the schema that isn't null
+func (schema *formSchema) typeName() string {
+	switch schema_type := schema.Type.(type) {
+	case string:
+		return schema_type
+	case []any:
+		for _, name := range schema_type {
+			if name, ok := name.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	if len(schema.property_names) > 0 {
+		return "object"
+	}
+	return "string"
+}
+
+func (schema *formSchema) fieldType() string {
+	if len(schema.Enum) > 0 {
+		return FORM_FIELD_ENUM
+	}
+	switch schema.typeName() {
+	case "number":
+		return FORM_FIELD_NUMBER
+	case "integer":
+		return FORM_FIELD_INTEGER
+	case "boolean":
+		return FORM_FIELD_BOOLEAN
+	case "object":
+		return FORM_FIELD_OBJECT
+	case "array":
+		return FORM_FIELD_ARRAY
+	}
+	switch schema.Format {
+	case "image":
+		return FORM_FIELD_IMAGE
+	case "textarea", "markdown":
+		return FORM_FIELD_TEXTAREA
+	}
+	return FORM_FIELD_TEXT
+}
+
+func enumText(value json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return string(value)
+	}
+	return text
+}
+
+func pointerChild(pointer string, name string) string {
+	return pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+// Fields of the form for the card data, `errors` are the
+// messages of the values by JSON pointer and `images`
+// the images the image fields can pick from
+func CardFormFields(json_schema string, data any, errors map[string]string, images []string) ([]FormField, error) {
+	schema, err := parseFormSchema([]byte(json_schema))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse card schema: %v", err)
+	}
+	if schema.typeName() != "object" {
+		return nil, fmt.Errorf("card schemas must describe an object")
+	}
+	root := schema.formField("", "", false, data, errors, images)
+	return root.Fields, nil
+}
+
+func (schema *formSchema) formField(pointer string, name string, required bool, value any, errors map[string]string, images []string) FormField {
+	field := FormField{
+		Name:        pointer,
+		Label:       schema.Title,
+		Description: schema.Description,
+		Type:        schema.fieldType(),
+		Required:    required,
+		Min:         schema.Minimum,
+		Max:         schema.Maximum,
+		MinLength:   schema.MinLength,
+		MaxLength:   schema.MaxLength,
+		Pattern:     schema.Pattern,
+		Error:       errors[pointer],
+	}
+	if field.Label == "" {
+		field.Label = name
+	}
+
+	switch field.Type {
+	case FORM_FIELD_OBJECT:
+		values, _ := value.(map[string]any)
+		for _, property := range schema.property_names {
+			child := schema.properties[property]
+			field.Fields = append(field.Fields, child.formField(
+				pointerChild(pointer, property), property, slices.Contains(schema.Required, property),
+				values[property], errors, images))
+		}
+	case FORM_FIELD_ARRAY:
+		items, _ := value.([]any)
+		item_schema := schema.Items
+		if item_schema == nil {
+			item_schema = &formSchema{Type: "string", properties: map[string]*formSchema{}}
+		}
+		for i, item := range items {
+			item_field := item_schema.formField(pointerChild(pointer, strconv.Itoa(i)), fmt.Sprintf("%s %d", field.Label, i+1), true, item, errors, images)
+			field.Fields = append(field.Fields, item_field)
+		}
+	case FORM_FIELD_ENUM:
+		for _, option := range schema.Enum {
+			field.Options = append(field.Options, enumText(option))
+		}
+		field.Value = formValue(value)
+	case FORM_FIELD_IMAGE:
+		field.Options = images
+		field.Value = formValue(value)
+	default:
+		field.Value = formValue(value)
+	}
+	return field
+}
+
+func formValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// Card data of the submitted form. Empty values of optional
+// fields are left out, unless `keep_empty` is set to render
+// the form again with the items being added.
+func CardFormData(json_schema string, values url.Values, keep_empty bool) (map[string]any, error) {
+	schema, err := parseFormSchema([]byte(json_schema))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse card schema: %v", err)
+	}
+	data, err := schema.formData("", true, values, keep_empty)
+	if err != nil {
+		return nil, err
+	}
+	object, _ := data.(map[string]any)
+	return object, nil
+}
+
+// Indexes of the array items in the form, items
+// removed from the middle leave gaps
+func arrayIndexes(pointer string, values url.Values) []int {
+	prefix := pointer + "/"
+	indexes := []int{}
+	for name := range values {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		token, _, _ := strings.Cut(name[len(prefix):], "/")
+		index, err := strconv.Atoi(token)
+		if err == nil && !slices.Contains(indexes, index) {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (schema *formSchema) formData(pointer string, required bool, values url.Values, keep_empty bool) (any, error) {
+	field_type := schema.fieldType()
+	switch field_type {
+	case FORM_FIELD_OBJECT:
+		object := make(map[string]any)
+		for _, property := range schema.property_names {
+			child := schema.properties[property]
+			value, err := child.formData(pointerChild(pointer, property), slices.Contains(schema.Required, property), values, keep_empty)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				object[property] = value
+			}
+		}
+		return object, nil
+	case FORM_FIELD_ARRAY:
+		item_schema := schema.Items
+		if item_schema == nil {
+			item_schema = &formSchema{Type: "string", properties: map[string]*formSchema{}}
+		}
+		items := []any{}
+		for _, index := range arrayIndexes(pointer, values) {
+			item, err := item_schema.formData(pointerChild(pointer, strconv.Itoa(index)), false, values, keep_empty)
+			if err != nil {
+				return nil, err
+			}
+			if item != nil || keep_empty {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 && !required && !keep_empty {
+			return nil, nil
+		}
+		return items, nil
+	case FORM_FIELD_BOOLEAN:
+		// Checkboxes come after a hidden `false` input
+		submitted := values[pointer]
+		if len(submitted) == 0 {
+			return nil, nil
+		}
+		return submitted[len(submitted)-1] == "true", nil
+	}
+
+	text := values.Get(pointer)
+	if text == "" && (!required || field_type != FORM_FIELD_TEXT && field_type != FORM_FIELD_TEXTAREA) {
+		return nil, nil
+	}
+	number_type := schema.typeName()
+	if field_type == FORM_FIELD_ENUM && number_type != "number" && number_type != "integer" {
+		return text, nil
+	}
+	switch number_type {
+	case "number":
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("`%s` is not a number", pointer)
+		}
+		return number, nil
+	case "integer":
+		number, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("`%s` is not an integer", pointer)
+		}
+		return number, nil
+	}
+	return text, nil
+}
+
+// Value of a new item of the array at the pointer,
+// objects and arrays start empty
+func CardFormNewItem(json_schema string, pointer string) (any, error) {
+	schema, err := parseFormSchema([]byte(json_schema))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse card schema: %v", err)
+	}
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch schema.fieldType() {
+		case FORM_FIELD_OBJECT:
+			schema = schema.properties[token]
+		case FORM_FIELD_ARRAY:
+			schema = schema.Items
+		default:
+			schema = nil
+		}
+		if schema == nil {
+			return nil, fmt.Errorf("`%s` is not in the schema", pointer)
+		}
+	}
+	if schema.fieldType() != FORM_FIELD_ARRAY {
+		return nil, fmt.Errorf("`%s` is not an array", pointer)
+	}
+	if schema.Items == nil {
+		return nil, nil
+	}
+	switch schema.Items.fieldType() {
+	case FORM_FIELD_OBJECT:
+		return map[string]any{}, nil
+	case FORM_FIELD_ARRAY:
+		return []any{}, nil
+	}
+	return nil, nil
+}
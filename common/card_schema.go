@@ -1,8 +1,74 @@
 package common
 
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kaptinlin/jsonschema"
+)
+
 type CardSchema struct {
-	Uuid   string   `json:"uuid"`
-	Title  string   `json:"title"`
-	Schema string   `json:"schema"`
-	Cards  []string `json:"cards"`
+	Uuid   string `json:"uuid"`
+	Title  string `json:"title"`
+	Schema string `json:"schema"`
+	// Latest version of the schema, new
+	// cards are written with it
+	Version int `json:"version"`
+	// Number of cards of the schema
+	CardCount int `json:"card_count"`
+}
+
+// A schema as it was stored at each update, cards are
+// validated against the version they were written with
+type CardSchemaVersion struct {
+	Version   int       `json:"version"`
+	Schema    string    `json:"schema"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A card that doesn't follow a proposed schema
+type CardFailure struct {
+	CardId string `json:"card_id"`
+	Error  string `json:"error"`
+}
+
+// Checks the card data against the JSON schema, with
+// the same validator the admin forms use
+func ValidateCardData(json_data string, json_schema string) error {
+	schema, err := jsonschema.NewCompiler().Compile([]byte(json_schema))
+	if err != nil {
+		return fmt.Errorf("could not validate card data: %v", err)
+	}
+
+	var data any
+	if err = json.Unmarshal([]byte(json_data), &data); err != nil {
+		return fmt.Errorf("invalid card data: %v", err)
+	}
+
+	result := schema.Validate(data)
+	if !result.IsValid() {
+		errors := []string{}
+		collectSchemaErrors(result.ToList(false), &errors)
+		slices.Sort(errors)
+		return fmt.Errorf("invalid card data: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// Messages of the failed keywords, prefixed by the
+// location of the value in the data
+func collectSchemaErrors(list *jsonschema.List, errors *[]string) {
+	for _, message := range list.Errors {
+		location := list.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		*errors = append(*errors, location+": "+message)
+	}
+	for i := range list.Details {
+		collectSchemaErrors(&list.Details[i], errors)
+	}
 }
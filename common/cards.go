@@ -1,8 +1,30 @@
 package common
 
+import "time"
+
 type Card struct {
 	Id      string `json:"id"`
 	Image   string `json:"image"`
 	Schema  string `json:"schema"`
 	Content string `json:"content"`
+	// Version of the schema the card was written with
+	SchemaVersion int `json:"schema_version"`
+	// Order of the card within its schema
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Which cards of a schema to get and in what order
+type CardQuery struct {
+	// Zero or less means no limit
+	Limit  int
+	Offset int
+	// Top level field of the card data to sort by,
+	// the cards are sorted by position without it
+	SortBy     string
+	Descending bool
+	// Every filter must match, fields are top level
+	// fields of the card data
+	Filters []CardFilter
 }
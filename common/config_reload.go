@@ -0,0 +1,148 @@
+package common
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// Editors write the config in several steps, the reload
+// waits for the file to settle for this long
+const CONFIG_RELOAD_DELAY = 200 * time.Millisecond
+
+var reload_lock sync.Mutex
+var reload_listeners []func(previous *AppSettings, settings *AppSettings)
+
+// Registers a function called after every successful
+// reload, with the settings before and after it
+func OnSettingsReload(listener func(previous *AppSettings, settings *AppSettings)) {
+	reload_lock.Lock()
+	defer reload_lock.Unlock()
+	reload_listeners = append(reload_listeners, listener)
+}
+
+// Reads and validates the config again and swaps it in,
+// the running settings are kept when it's invalid
+func ReloadConfig(filepath string) error {
+	settings, err := ReadConfigToml(filepath)
+	if err != nil {
+		return err
+	}
+
+	reload_lock.Lock()
+	defer reload_lock.Unlock()
+
+	previous := CurrentSettings()
+	keepRestartSettings(previous, &settings)
+	GetSettings(settings)
+	log.Info().Msgf("reloaded config file %s", filepath)
+
+	for _, listener := range reload_listeners {
+		listener(previous, CurrentSettings())
+	}
+	return nil
+}
+
+// Settings used when the servers start, changing
+// them needs a restart
+func keepRestartSettings(previous *AppSettings, settings *AppSettings) {
+	keepSetting("MY_SQL_URL", previous.DatabaseUri, &settings.DatabaseUri)
+	keepSetting("PORT", previous.WebserverPort, &settings.WebserverPort)
+	keepSetting("PORT_ADMIN", previous.WebserverPortAdmin, &settings.WebserverPortAdmin)
+	keepSetting("image_dir", previous.ImageDirectory, &settings.ImageDirectory)
+	keepSetting("cache_backend", previous.CacheBackend, &settings.CacheBackend)
+	keepSetting("redis_url", previous.RedisUrl, &settings.RedisUrl)
+	keepSetting("cache_max_size_mb", previous.CacheMaxSizeMB, &settings.CacheMaxSizeMB)
+	keepSetting("cache_stale_seconds", previous.CacheStaleSeconds, &settings.CacheStaleSeconds)
+}
+
+func keepSetting[T comparable](name string, previous T, current *T) {
+	if *current != previous {
+		log.Warn().Msgf("`%s` changed, restart to apply it", name)
+		*current = previous
+	}
+}
+
+type ConfigWatcher struct {
+	watcher *fsnotify.Watcher
+	signals chan os.Signal
+	done    chan bool
+}
+
+// Reloads the config whenever the file changes or the
+// process gets a SIGHUP. Errors in the new config are
+// logged and the running settings are kept.
+func WatchConfig(config_path string) (*ConfigWatcher, error) {
+	config_path, err := filepath.Abs(config_path)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// The directory is watched as editors replace the
+	// file instead of writing to it
+	if err = watcher.Add(filepath.Dir(config_path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	config_watcher := &ConfigWatcher{
+		watcher: watcher,
+		signals: make(chan os.Signal, 1),
+		done:    make(chan bool),
+	}
+	signal.Notify(config_watcher.signals, syscall.SIGHUP)
+
+	go config_watcher.run(config_path)
+	return config_watcher, nil
+}
+
+func (config_watcher *ConfigWatcher) run(config_path string) {
+	reload := func() {
+		if err := ReloadConfig(config_path); err != nil {
+			log.Error().Msgf("could not reload config file, keeping the running config: %v", err)
+		}
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case event, ok := <-config_watcher.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != config_path || event.Op == fsnotify.Chmod {
+				continue
+			}
+			pending = time.After(CONFIG_RELOAD_DELAY)
+		case err, ok := <-config_watcher.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Msgf("config watcher error: %v", err)
+		case <-config_watcher.signals:
+			log.Info().Msgf("got SIGHUP, reloading config")
+			reload()
+		case <-pending:
+			pending = nil
+			reload()
+		case <-config_watcher.done:
+			return
+		}
+	}
+}
+
+func (config_watcher *ConfigWatcher) Close() error {
+	signal.Stop(config_watcher.signals)
+	close(config_watcher.done)
+	return config_watcher.watcher.Close()
+}
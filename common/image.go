@@ -10,3 +10,10 @@ type Image struct {
 	Location Location `json:"location"`
 	Date     string   `json:"date"`
 }
+
+// An image is considered geotagged if the metadata
+// stored any coordinates other than the (0, 0) default
+// written when the EXIF data had no GPS information.
+func (image Image) IsGeotagged() bool {
+	return image.Location.Latitude != 0 || image.Location.Longitude != 0
+}
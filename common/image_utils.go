@@ -8,9 +8,14 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -25,10 +30,51 @@ var ValidImageExtensions = map[string]bool{
 	".gif":  true,
 }
 
-func populateImageMetadata(metadata_path string) (Image, error) {
+// Directory of the image directory holding the
+// media of every site but the default one
+const SITES_MEDIA_DIRECTORY = "sites"
+
+// Media directory of the site, the default site keeps the
+// images at the top of the image directory and the other
+// sites get their own directory under `sites/`
+func SiteImageDirectory(site_id int) string {
+	if site_id == 0 || site_id == DEFAULT_SITE_ID {
+		return CurrentSettings().ImageDirectory
+	}
+	return filepath.Join(CurrentSettings().ImageDirectory, SITES_MEDIA_DIRECTORY, strconv.Itoa(site_id))
+}
+
+// Serves the files of the site media directory without
+// listing them. The default site can't reach the media
+// of the other sites.
+type SiteMediaFileSystem struct {
+	SiteId int
+}
+
+func (media SiteMediaFileSystem) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if media.SiteId == 0 || media.SiteId == DEFAULT_SITE_ID {
+		if name == "/"+SITES_MEDIA_DIRECTORY || strings.HasPrefix(name, "/"+SITES_MEDIA_DIRECTORY+"/") {
+			return nil, fs.ErrNotExist
+		}
+	}
+
+	file, err := http.Dir(SiteImageDirectory(media.SiteId)).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+	return file, nil
+}
+
+func populateImageMetadata(site_id int, metadata_path string) (Image, error) {
 
 	// Check if a json metadata file exists
-	metadata_contents, err := os.ReadFile(path.Join(Settings.ImageDirectory, metadata_path))
+	metadata_contents, err := os.ReadFile(path.Join(SiteImageDirectory(site_id), metadata_path))
 	if err != nil {
 		return Image{}, fmt.Errorf("could not read metadata for image `%s`", metadata_path)
 	}
@@ -62,10 +108,11 @@ func populateImageMetadata(metadata_path string) (Image, error) {
 // a filtered list of valid images, with the page number
 // and page size taken as pagination arguments.
 //
-// paths must be a list of strings referencing the metadata file for an image.
+// paths must be a list of strings referencing the metadata file for an image
+// in the media directory of the site.
 // page_size must be a non-negative number greater than zero.
 // page_num must be a non-negative number greater than 0.
-func GetImages(paths []string, page_size, page_num int) ([]Image, error) {
+func GetImages(site_id int, paths []string, page_size, page_num int) ([]Image, error) {
 
 	if page_num <= 0 {
 		return []Image{}, fmt.Errorf("invalid `page_num` (%d) given", page_num)
@@ -83,7 +130,7 @@ func GetImages(paths []string, page_size, page_num int) ([]Image, error) {
 
 	valid_images := make([]Image, 0)
 	for _, metadata_path := range paths {
-		image, err := populateImageMetadata(metadata_path)
+		image, err := populateImageMetadata(site_id, metadata_path)
 		if err != nil {
 			log.Warn().Msgf("skipping image defined in metadata path `%s`: %v", metadata_path, err)
 			continue
@@ -92,3 +139,23 @@ func GetImages(paths []string, page_size, page_num int) ([]Image, error) {
 	}
 	return valid_images, nil
 }
+
+// Returns the metadata file names (relative to the media
+// directory of the site) for every image uploaded to it.
+func GetImageMetadataPaths(site_id int) ([]string, error) {
+	files, err := os.ReadDir(SiteImageDirectory(site_id))
+	// Sites get their directory with their first image
+	if errors.Is(err, fs.ErrNotExist) && site_id != DEFAULT_SITE_ID {
+		return []string{}, nil
+	}
+	if err != nil {
+		return []string{}, err
+	}
+
+	filepaths := Map(files, func(file os.DirEntry) string {
+		return file.Name()
+	})
+	return Filter(filepaths, func(filepath string) bool {
+		return path.Ext(filepath) == ".json"
+	}), nil
+}
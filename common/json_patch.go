@@ -0,0 +1,253 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JSON patch operations, see RFC 6902. The
+// `test` operation isn't supported.
+const (
+	PATCH_ADD     = "add"
+	PATCH_REMOVE  = "remove"
+	PATCH_REPLACE = "replace"
+	PATCH_MOVE    = "move"
+	PATCH_COPY    = "copy"
+)
+
+type PatchOperation struct {
+	Op string `json:"op"`
+	// JSON pointers, `From` is only used by `move` and `copy`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty" swaggertype:"object"`
+}
+
+// Applies the operations in order to the JSON document,
+// nothing is applied if one of them fails
+func ApplyPatch(document string, operations []PatchOperation) (string, error) {
+	root, err := decodePatchValue([]byte(document))
+	if err != nil {
+		return "", fmt.Errorf("invalid document: %v", err)
+	}
+
+	for i, operation := range operations {
+		root, err = applyPatchOperation(root, operation)
+		if err != nil {
+			return "", fmt.Errorf("patch operation %d (%s `%s`): %v", i, operation.Op, operation.Path, err)
+		}
+	}
+
+	patched, err := json.Marshal(root)
+	if err != nil {
+		return "", err
+	}
+	return string(patched), nil
+}
+
+// Numbers are kept as written
+func decodePatchValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func applyPatchOperation(root any, operation PatchOperation) (any, error) {
+	switch operation.Op {
+	case PATCH_ADD, PATCH_REPLACE:
+		if len(operation.Value) == 0 {
+			return nil, fmt.Errorf("missing value")
+		}
+		value, err := decodePatchValue(operation.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		// The whole document always exists and is replaced by the add
+		if operation.Op == PATCH_REPLACE && operation.Path != "" {
+			if root, _, err = patchRemove(root, operation.Path); err != nil {
+				return nil, err
+			}
+		}
+		return patchAdd(root, operation.Path, value)
+	case PATCH_REMOVE:
+		root, _, err := patchRemove(root, operation.Path)
+		return root, err
+	case PATCH_MOVE:
+		root, value, err := patchRemove(root, operation.From)
+		if err != nil {
+			return nil, err
+		}
+		return patchAdd(root, operation.Path, value)
+	case PATCH_COPY:
+		value, err := patchGet(root, operation.From)
+		if err != nil {
+			return nil, err
+		}
+		// The copy must not share maps and slices with the original
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = decodePatchValue(encoded); err != nil {
+			return nil, err
+		}
+		return patchAdd(root, operation.Path, value)
+	}
+	return nil, fmt.Errorf("unknown operation")
+}
+
+// Reference tokens of a JSON pointer, empty for the whole document
+func pointerTokens(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer `%s` must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// Index of the token in an array, `-` is past the last element
+func arrayIndex(token string, length int, allow_end bool) (int, error) {
+	if token == "-" && allow_end {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (index == length && !allow_end) {
+		return 0, fmt.Errorf("invalid array index `%s`", token)
+	}
+	return index, nil
+}
+
+// Calls `change` with the container of the last token and
+// returns the document with the changed container in place
+func patchContainer(node any, tokens []string, change func(container any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return change(node, tokens[0])
+	}
+
+	switch container := node.(type) {
+	case map[string]any:
+		child, exists := container[tokens[0]]
+		if !exists {
+			return nil, fmt.Errorf("member `%s` not found", tokens[0])
+		}
+		updated, err := patchContainer(child, tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		container[tokens[0]] = updated
+		return container, nil
+	case []any:
+		index, err := arrayIndex(tokens[0], len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := patchContainer(container[index], tokens[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = updated
+		return container, nil
+	}
+	return nil, fmt.Errorf("can't look up `%s` in a value", tokens[0])
+}
+
+func patchAdd(root any, pointer string, value any) (any, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return patchContainer(root, tokens, func(node any, token string) (any, error) {
+		switch container := node.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(container, index, value), nil
+		}
+		return nil, fmt.Errorf("can't add `%s` to a value", token)
+	})
+}
+
+// Returns the document without the value and the removed value
+func patchRemove(root any, pointer string) (any, any, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("can't remove the whole document")
+	}
+
+	var removed any
+	root, err = patchContainer(root, tokens, func(node any, token string) (any, error) {
+		switch container := node.(type) {
+		case map[string]any:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("member `%s` not found", token)
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return slices.Delete(container, index, index+1), nil
+		}
+		return nil, fmt.Errorf("can't remove `%s` from a value", token)
+	})
+	return root, removed, err
+}
+
+func patchGet(root any, pointer string) (any, error) {
+	tokens, err := pointerTokens(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	node := root
+	for _, token := range tokens {
+		switch container := node.(type) {
+		case map[string]any:
+			value, exists := container[token]
+			if !exists {
+				return nil, fmt.Errorf("member `%s` not found", token)
+			}
+			node = value
+		case []any:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			node = container[index]
+		default:
+			return nil, fmt.Errorf("can't look up `%s` in a value", token)
+		}
+	}
+	return node, nil
+}
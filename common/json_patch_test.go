@@ -0,0 +1,98 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchOperations(t *testing.T, operations string) []PatchOperation {
+	var patch []PatchOperation
+	require.Nil(t, json.Unmarshal([]byte(operations), &patch))
+	return patch
+}
+
+func TestApplyPatch(t *testing.T) {
+	document := `{"title": "Shoe", "price": 10.50, "tags": ["red", "new"], "size": {"eu": 42}}`
+	tests := []struct {
+		name       string
+		operations string
+		expected   string
+	}{
+		{"add member", `[{"op": "add", "path": "/stock", "value": 3}]`,
+			`{"price": 10.50, "size": {"eu": 42}, "stock": 3, "tags": ["red", "new"], "title": "Shoe"}`},
+		{"add replaces member", `[{"op": "add", "path": "/title", "value": "Boot"}]`,
+			`{"price": 10.50, "size": {"eu": 42}, "tags": ["red", "new"], "title": "Boot"}`},
+		{"add to array", `[{"op": "add", "path": "/tags/1", "value": "sale"}]`,
+			`{"price": 10.50, "size": {"eu": 42}, "tags": ["red", "sale", "new"], "title": "Shoe"}`},
+		{"add to array end", `[{"op": "add", "path": "/tags/-", "value": "sale"}]`,
+			`{"price": 10.50, "size": {"eu": 42}, "tags": ["red", "new", "sale"], "title": "Shoe"}`},
+		{"add nested", `[{"op": "add", "path": "/size/us", "value": 9}]`,
+			`{"price": 10.50, "size": {"eu": 42, "us": 9}, "tags": ["red", "new"], "title": "Shoe"}`},
+		{"remove member", `[{"op": "remove", "path": "/size"}]`,
+			`{"price": 10.50, "tags": ["red", "new"], "title": "Shoe"}`},
+		{"remove from array", `[{"op": "remove", "path": "/tags/0"}]`,
+			`{"price": 10.50, "size": {"eu": 42}, "tags": ["new"], "title": "Shoe"}`},
+		{"replace", `[{"op": "replace", "path": "/size/eu", "value": 43}]`,
+			`{"price": 10.50, "size": {"eu": 43}, "tags": ["red", "new"], "title": "Shoe"}`},
+		{"move", `[{"op": "move", "from": "/title", "path": "/name"}]`,
+			`{"name": "Shoe", "price": 10.50, "size": {"eu": 42}, "tags": ["red", "new"]}`},
+		{"move in array", `[{"op": "move", "from": "/tags/0", "path": "/tags/-"}]`,
+			`{"price": 10.50, "size": {"eu": 42}, "tags": ["new", "red"], "title": "Shoe"}`},
+		{"copy", `[{"op": "copy", "from": "/size", "path": "/fit"}, {"op": "replace", "path": "/fit/eu", "value": 41}]`,
+			`{"fit": {"eu": 41}, "price": 10.50, "size": {"eu": 42}, "tags": ["red", "new"], "title": "Shoe"}`},
+		{"escaped pointer", `[{"op": "add", "path": "/a~1b~0c", "value": 1}]`,
+			`{"a/b~c": 1, "price": 10.50, "size": {"eu": 42}, "tags": ["red", "new"], "title": "Shoe"}`},
+		{"replace root", `[{"op": "replace", "path": "", "value": {"title": "Hat"}}]`,
+			`{"title": "Hat"}`},
+		{"add root", `[{"op": "add", "path": "", "value": [1, 2]}]`,
+			`[1, 2]`},
+		{"no operations", `[]`, document},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched, err := ApplyPatch(document, patchOperations(t, test.operations))
+			require.Nil(t, err)
+			assert.JSONEq(t, test.expected, patched)
+		})
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	document := `{"title": "Shoe", "tags": ["red"]}`
+	tests := []struct {
+		name       string
+		operations string
+	}{
+		{"pointer without slash", `[{"op": "add", "path": "title", "value": 1}]`},
+		{"missing parent", `[{"op": "add", "path": "/size/eu", "value": 1}]`},
+		{"missing member", `[{"op": "remove", "path": "/price"}]`},
+		{"replace missing member", `[{"op": "replace", "path": "/price", "value": 1}]`},
+		{"array index out of range", `[{"op": "add", "path": "/tags/2", "value": "new"}]`},
+		{"array index not a number", `[{"op": "remove", "path": "/tags/first"}]`},
+		{"remove array end", `[{"op": "remove", "path": "/tags/-"}]`},
+		{"look up in a value", `[{"op": "add", "path": "/title/name", "value": 1}]`},
+		{"remove root", `[{"op": "remove", "path": ""}]`},
+		{"missing value", `[{"op": "add", "path": "/price"}]`},
+		{"move from missing member", `[{"op": "move", "from": "/name", "path": "/title"}]`},
+		{"copy from missing member", `[{"op": "copy", "from": "/name", "path": "/title"}]`},
+		{"unknown operation", `[{"op": "test", "path": "/title", "value": "Shoe"}]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ApplyPatch(document, patchOperations(t, test.operations))
+			assert.NotNil(t, err)
+		})
+	}
+
+	// Nothing is applied when an operation fails
+	_, err := ApplyPatch(document, patchOperations(t, `[{"op": "remove", "path": "/title"}, {"op": "remove", "path": "/title"}]`))
+	assert.ErrorContains(t, err, "patch operation 1")
+
+	_, err = ApplyPatch(`{"title": `, []PatchOperation{})
+	assert.ErrorContains(t, err, "invalid document")
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Places of the layout a menu can be shown in,
+// each site has at most one menu per location
+const (
+	MENU_LOCATION_HEADER = "header"
+	MENU_LOCATION_FOOTER = "footer"
+)
+
+var MENU_LOCATIONS = []string{MENU_LOCATION_HEADER, MENU_LOCATION_FOOTER}
+
+// What a menu item links to
+const (
+	MENU_ITEM_URL     = "url"
+	MENU_ITEM_PAGE    = "page"
+	MENU_ITEM_POST    = "post"
+	MENU_ITEM_GALLERY = "gallery"
+	MENU_ITEM_SCHEMA  = "schema"
+)
+
+var MENU_ITEM_TYPES = []string{MENU_ITEM_URL, MENU_ITEM_PAGE, MENU_ITEM_POST, MENU_ITEM_GALLERY, MENU_ITEM_SCHEMA}
+
+type Menu struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Empty for menus not shown anywhere
+	Location string     `json:"location"`
+	Items    []MenuItem `json:"items"`
+}
+
+type MenuItem struct {
+	Id int `json:"id"`
+	// Zero for the top level items
+	ParentId int `json:"parent_id"`
+	// Order between the items with the same parent
+	Position int    `json:"position"`
+	Type     string `json:"type"`
+	// The URL of `url` items, the id of `page` and `post`
+	// items, the gallery name or the schema uuid
+	Target string `json:"target"`
+	// Shown in the menu, the title of the linked
+	// content is used when empty
+	Label   string `json:"label"`
+	Title   string `json:"title"`
+	Visible bool   `json:"visible"`
+	// Resolved when the menu is read so they follow the
+	// linked content, `Href` is empty when it's gone
+	Text     string     `json:"text"`
+	Href     string     `json:"href"`
+	Children []MenuItem `json:"children"`
+}
+
+// Checks the type and target of an item
+func ValidateMenuItem(item_type string, target string) error {
+	if !slices.Contains(MENU_ITEM_TYPES, item_type) {
+		return fmt.Errorf("unknown menu item type `%s`", item_type)
+	}
+	if target == "" {
+		return fmt.Errorf("menu item needs a target")
+	}
+	if item_type == MENU_ITEM_PAGE || item_type == MENU_ITEM_POST {
+		if _, err := strconv.Atoi(target); err != nil {
+			return fmt.Errorf("target of %s items must be an id", item_type)
+		}
+	}
+	return nil
+}
+
+func ValidateMenuLocation(location string) error {
+	if location != "" && !slices.Contains(MENU_LOCATIONS, location) {
+		return fmt.Errorf("unknown menu location `%s`", location)
+	}
+	return nil
+}
+
+// Link of the content the item points to, `page_path`
+// is the current path of `page` items
+func MenuItemHref(item_type string, target string, page_path string) string {
+	switch item_type {
+	case MENU_ITEM_URL:
+		return target
+	case MENU_ITEM_PAGE:
+		if page_path == "" {
+			return ""
+		}
+		return "/page/" + page_path
+	case MENU_ITEM_POST:
+		return "/post/" + target
+	case MENU_ITEM_GALLERY:
+		return "/gallery/" + target
+	case MENU_ITEM_SCHEMA:
+		return "/products/" + target
+	}
+	return ""
+}
+
+// Nests the items under their parents, sorted by position.
+// Items whose parent is missing are left at the top level.
+func MenuTree(items []MenuItem) []MenuItem {
+	ids := make(map[int]bool)
+	for _, item := range items {
+		ids[item.Id] = true
+	}
+	children := make(map[int][]MenuItem)
+	for _, item := range items {
+		parent_id := item.ParentId
+		if !ids[parent_id] {
+			parent_id = 0
+		}
+		children[parent_id] = append(children[parent_id], item)
+	}
+
+	var build func(parent_id int, seen map[int]bool) []MenuItem
+	build = func(parent_id int, seen map[int]bool) []MenuItem {
+		level := []MenuItem{}
+		for _, item := range children[parent_id] {
+			if seen[item.Id] {
+				continue
+			}
+			seen[item.Id] = true
+			item.Children = build(item.Id, seen)
+			level = append(level, item)
+		}
+		slices.SortStableFunc(level, func(a, b MenuItem) int {
+			return a.Position - b.Position
+		})
+		return level
+	}
+	return build(0, make(map[int]bool))
+}
+
+// The items shown on the site, hidden items and items
+// linking to deleted content are left out with their children
+func VisibleMenuItems(items []MenuItem) []MenuItem {
+	visible := []MenuItem{}
+	for _, item := range items {
+		if !item.Visible || item.Href == "" {
+			continue
+		}
+		item.Children = VisibleMenuItems(item.Children)
+		visible = append(visible, item)
+	}
+	return visible
+}
@@ -1,7 +1,7 @@
 package common
 
 type Link struct {
-	Name  string
-	Href  string
-	Title string
+	Name  string `json:"name"`
+	Href  string `json:"href"`
+	Title string `json:"title"`
 }
@@ -1,8 +1,107 @@
 package common
 
+import (
+	"slices"
+	"strings"
+)
+
 type Page struct {
 	Id      int    `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
 	Link    string `json:"link"`
+	// Pages with blocks are rendered from them,
+	// the Markdown content is used otherwise
+	Blocks []Block `json:"blocks"`
+	// Zero for the top level pages
+	ParentId int `json:"parent_id"`
+	// Order between the pages with the same parent
+	Position int `json:"position"`
+	// Links of the ancestors and the page joined by `/`,
+	// the page is served at `/page/<path>`
+	Path string `json:"path"`
+}
+
+// Path of every page by id. Pages under a missing parent
+// are placed at the top level.
+func PagePaths(pages []Page) map[int]string {
+	by_id := make(map[int]Page, len(pages))
+	for _, page := range pages {
+		by_id[page.Id] = page
+	}
+
+	paths := make(map[int]string, len(pages))
+	for _, page := range pages {
+		links := []string{page.Link}
+		seen := map[int]bool{page.Id: true}
+		for parent, exists := by_id[page.ParentId]; exists && !seen[parent.Id]; parent, exists = by_id[parent.ParentId] {
+			seen[parent.Id] = true
+			links = append(links, parent.Link)
+		}
+		slices.Reverse(links)
+		paths[page.Id] = strings.Join(links, "/")
+	}
+	return paths
+}
+
+// Page of the tree at the path, found by walking the
+// links of the path from the top level. Pages under a
+// missing parent are at the top level, as in PagePaths.
+func PageAtPath(pages []Page, page_path string) (Page, bool) {
+	exists := make(map[int]bool, len(pages))
+	for _, page := range pages {
+		exists[page.Id] = true
+	}
+	parentId := func(page Page) int {
+		if !exists[page.ParentId] {
+			return 0
+		}
+		return page.ParentId
+	}
+
+	current := Page{}
+	for _, link := range strings.Split(strings.Trim(page_path, "/"), "/") {
+		found := false
+		for _, page := range pages {
+			if parentId(page) == current.Id && page.Link == link && page.Id != current.Id {
+				current, found = page, true
+				break
+			}
+		}
+		if !found {
+			return Page{}, false
+		}
+	}
+	return current, true
+}
+
+// Ancestors of the page, the top level one first
+func PageAncestors(pages []Page, id int) []Page {
+	by_id := make(map[int]Page, len(pages))
+	for _, page := range pages {
+		by_id[page.Id] = page
+	}
+
+	ancestors := []Page{}
+	seen := map[int]bool{id: true}
+	for parent, exists := by_id[by_id[id].ParentId]; exists && !seen[parent.Id]; parent, exists = by_id[parent.ParentId] {
+		seen[parent.Id] = true
+		ancestors = append(ancestors, parent)
+	}
+	slices.Reverse(ancestors)
+	return ancestors
+}
+
+// Children of the page sorted by position
+func PageChildren(pages []Page, id int) []Page {
+	children := []Page{}
+	for _, page := range pages {
+		if page.ParentId == id && page.Id != id {
+			children = append(children, page)
+		}
+	}
+	slices.SortStableFunc(children, func(a, b Page) int {
+		return a.Position - b.Position
+	})
+	return children
 }
@@ -1,8 +1,20 @@
 package common
 
+import "time"
+
 type Post struct {
 	Id      int    `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
 	Excerpt string `json:"excerpt"`
 }
+
+// Draft of a post shared by a link before it is saved,
+// the shortcodes are expanded when it's shown like posts
+type PostPreview struct {
+	Uuid      string    `json:"uuid"`
+	Title     string    `json:"title"`
+	Excerpt   string    `json:"excerpt"`
+	Content   string    `json:"content"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
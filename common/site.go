@@ -0,0 +1,149 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Content created before sites existed belongs to
+// this site, as do requests for unknown hosts
+const DEFAULT_SITE_ID = 1
+
+// Header picking the site managed through the
+// admin-app, the host is used without it
+const SITE_HEADER = "X-GoCMS-Site"
+
+// A site served from this deployment, picked from the
+// host of each request. Settings left empty are taken
+// from the top level of the config.
+type Site struct {
+	Id   int    `toml:"id"`
+	Name string `toml:"name"`
+	// Hosts without the port, `*.example.com` matches
+	// any subdomain of example.com
+	Hosts       []string           `toml:"hosts"`
+	Theme       string             `toml:"theme"`
+	AppNavbar   Navbar             `toml:"navbar"`
+	Galleries   map[string]Gallery `toml:"gallery"`
+	StickyPosts []int              `toml:"sticky_posts"`
+	// Only taken from the top level settings, they can
+	// be changed per site from the admin-app
+	RecaptchaSiteKey string `toml:"-"`
+	RecaptchaSecret  string `toml:"-"`
+	// Visible items of the menus built in the admin-app,
+	// by location, the navbar is shown without a header menu
+	Menus map[string][]MenuItem `toml:"-"`
+}
+
+// The site made from the top level settings, it
+// can be overridden by a `site` with the same id
+func (settings *AppSettings) DefaultSite() Site {
+	return Site{
+		Id:          DEFAULT_SITE_ID,
+		Name:        settings.AppDomain,
+		Theme:       settings.Theme,
+		AppNavbar:   settings.AppNavbar,
+		Galleries:   settings.Galleries,
+		StickyPosts: settings.StickyPosts,
+
+		RecaptchaSiteKey: settings.RecaptchaSiteKey,
+		RecaptchaSecret:  settings.RecaptchaSecret,
+	}
+}
+
+// Every site of the deployment, the default one first
+func (settings *AppSettings) AllSites() []Site {
+	sites := []Site{settings.DefaultSite()}
+	for _, site := range settings.Sites {
+		site = settings.inheritSite(site)
+		if site.Id == DEFAULT_SITE_ID {
+			sites[0] = site
+			continue
+		}
+		sites = append(sites, site)
+	}
+	return sites
+}
+
+func (settings *AppSettings) SiteById(id int) (Site, bool) {
+	for _, site := range settings.AllSites() {
+		if site.Id == id {
+			return site, true
+		}
+	}
+	return Site{}, false
+}
+
+// Resolves the site of a request host, exact hosts win
+// over wildcards and unknown hosts get the default site
+func (settings *AppSettings) SiteForHost(host string) Site {
+	host = normalizeHost(host)
+	sites := settings.AllSites()
+
+	for _, site := range sites {
+		for _, site_host := range site.Hosts {
+			if normalizeHost(site_host) == host {
+				return site
+			}
+		}
+	}
+	for _, site := range sites {
+		for _, site_host := range site.Hosts {
+			suffix, is_wildcard := strings.CutPrefix(normalizeHost(site_host), "*")
+			if is_wildcard && strings.HasSuffix(host, suffix) {
+				return site
+			}
+		}
+	}
+	return sites[0]
+}
+
+func (settings *AppSettings) inheritSite(site Site) Site {
+	if site.Theme == "" {
+		site.Theme = settings.Theme
+	}
+	if len(site.AppNavbar.Links) == 0 && len(site.AppNavbar.Dropdowns) == 0 {
+		site.AppNavbar = settings.AppNavbar
+	}
+	if site.Galleries == nil {
+		site.Galleries = settings.Galleries
+	}
+	if site.StickyPosts == nil {
+		site.StickyPosts = settings.StickyPosts
+	}
+	site.RecaptchaSiteKey = settings.RecaptchaSiteKey
+	site.RecaptchaSecret = settings.RecaptchaSecret
+	return site
+}
+
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if without_port, _, err := net.SplitHostPort(host); err == nil {
+		host = without_port
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+func validateSites(sites []Site) error {
+	ids := make(map[int]bool)
+	hosts := make(map[string]int)
+	for _, site := range sites {
+		if site.Id <= 0 {
+			return fmt.Errorf("site `%s` needs a positive id", site.Name)
+		}
+		if ids[site.Id] {
+			return fmt.Errorf("site id %d is used more than once", site.Id)
+		}
+		ids[site.Id] = true
+
+		for _, host := range site.Hosts {
+			host = normalizeHost(host)
+			if other_id, exists := hosts[host]; exists {
+				return fmt.Errorf("host `%s` is used by sites %d and %d", host, other_id, site.Id)
+			}
+			hosts[host] = site.Id
+		}
+	}
+	return nil
+}
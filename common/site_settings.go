@@ -0,0 +1,103 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const link_schema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"href": {"type": "string", "minLength": 1},
+		"title": {"type": "string"}
+	},
+	"required": ["name", "href"],
+	"additionalProperties": false
+}`
+
+// Settings of a site that can be changed from the admin-app,
+// by name, with the JSON schema their values must follow.
+// Values stored in the database win over the config file.
+var EDITABLE_SETTINGS = map[string]string{
+	"sticky_posts":      `{"type": "array", "items": {"type": "integer", "minimum": 0}, "uniqueItems": true}`,
+	"navbar.links":      `{"type": "array", "items": ` + link_schema + `}`,
+	"navbar.dropdowns":  `{"type": "object", "additionalProperties": {"type": "array", "items": ` + link_schema + `}}`,
+	"recaptcha_sitekey": `{"type": "string"}`,
+	"recaptcha_secret":  `{"type": "string"}`,
+}
+
+// Editable settings never sent back by the admin-app
+var WRITE_ONLY_SETTINGS = []string{"recaptcha_secret"}
+
+// Checks the JSON value against the schema of the setting
+func ValidateSetting(name string, value []byte) error {
+	schema, exists := EDITABLE_SETTINGS[name]
+	if !exists {
+		return fmt.Errorf("setting `%s` can't be edited", name)
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewStringLoader(schema), gojsonschema.NewBytesLoader(value))
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %v", name, err)
+	}
+	if !result.Valid() {
+		errors := []string{}
+		for _, err := range result.Errors() {
+			errors = append(errors, err.String())
+		}
+		return fmt.Errorf("invalid value for %s: %s", name, strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// Target of each setting in the site
+func (site *Site) settingFields() map[string]any {
+	return map[string]any{
+		"sticky_posts":      &site.StickyPosts,
+		"navbar.links":      &site.AppNavbar.Links,
+		"navbar.dropdowns":  &site.AppNavbar.Dropdowns,
+		"recaptcha_sitekey": &site.RecaptchaSiteKey,
+		"recaptcha_secret":  &site.RecaptchaSecret,
+	}
+}
+
+// The site with the settings stored in the database, values
+// that are no longer valid are skipped
+func (site Site) WithSettings(values map[string]string) Site {
+	fields := site.settingFields()
+	for name, value := range values {
+		field, exists := fields[name]
+		if !exists || ValidateSetting(name, []byte(value)) != nil {
+			log.Warn().Msgf("ignoring invalid setting %s of site %d", name, site.Id)
+			continue
+		}
+
+		// Decoding into the slices and maps of the config
+		// would change them for every site
+		reflect.ValueOf(field).Elem().SetZero()
+		if err := json.Unmarshal([]byte(value), field); err != nil {
+			log.Warn().Msgf("could not apply setting %s of site %d: %v", name, site.Id, err)
+		}
+	}
+	return site
+}
+
+// Current value of every editable setting, as JSON
+func (site Site) Settings() map[string]json.RawMessage {
+	values := make(map[string]json.RawMessage)
+	for name, field := range site.settingFields() {
+		value, err := json.Marshal(field)
+		if err != nil {
+			log.Error().Msgf("could not encode setting %s: %v", name, err)
+			continue
+		}
+		values[name] = value
+	}
+	return values
+}
@@ -9,6 +9,12 @@
 
 package common
 
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
 func Filter[K any](inputs []K, predicate func(K) bool) []K {
 	result := make([]K, 0)
 	for _, value := range inputs {
@@ -27,3 +33,26 @@ func Map[K any, V any](inputs []K, mapper func(K) V) []V {
 	}
 	return result
 }
+
+// Lowercase link made of letters, digits and dashes, e.g.
+// for the pages created from imported content
+func Slugify(text string) string {
+	if unescaped, err := url.PathUnescape(text); err == nil {
+		text = unescaped
+	}
+
+	var builder strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && builder.Len() > 0 {
+				builder.WriteRune('-')
+			}
+			builder.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return builder.String()
+}
@@ -5,9 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	// "os"
 
@@ -15,52 +16,130 @@ import (
 	"github.com/google/uuid"
 	"github.com/rbc33/gocms/common"
 	"github.com/rs/zerolog/log"
-	"github.com/xeipuuv/gojsonschema"
 )
 
 type Database interface {
 	GetPosts(offset int, limit int) ([]common.Post, error)
+	// Same as GetPosts, with the content of the posts
+	GetPostsContent(limit int, offset int) ([]common.Post, error)
 	GetPost(post_id int) (common.Post, error)
 	AddPost(title string, excerpt string, content string) (int, error)
 	ChangePost(id int, title string, excerpt string, content string) error
 	DeletePost(id int) error
+	// Expired previews are removed when previews are added
+	AddPostPreview(preview common.PostPreview) (string, error)
+	// Only previews that haven't expired are found
+	GetPostPreview(uuid string) (common.PostPreview, error)
 	AddImage(uuid string, name string, alt string) error
 	DeleteImage(uuid string) error
 	// GetCard(uuid string) (common.Card, error)
 	GetPages(offset int, limit int) ([]common.Page, error)
-	AddPage(title string, content string, link string) (int, error)
+	// Zero `parent_id` adds the page at the top level
+	AddPage(title string, content string, link string, blocks []common.Block, parent_id int) (int, error)
+	// Links are unique under each parent, the top
+	// level page is found first
 	GetPage(link string) (common.Page, error)
-	ChangePage(id int, title string, content string, link string) error
+	GetPageById(id int) (common.Page, error)
+	GetPageTree() ([]common.Page, error)
+	GetPageRedirect(link string) (int, error)
+	MovePages(pages []common.Page) error
+	// Empty arguments are left unchanged, empty non nil
+	// blocks turn the page back into a Markdown page
+	ChangePage(id int, title string, content string, link string, blocks []common.Block) error
 	DeletePage(link string) error
 	AddCard(image string, schema string, content string) (string, error)
-	GetCards(schema_uuid string, limit int, page int) ([]common.Card, error)
-	ChangeCard(uuid string, image_location string, json_data string, schema_name string) error
+	// Returns the cards of the query and the number of
+	// cards matching its filters
+	GetCards(schema_uuid string, query common.CardQuery) ([]common.Card, int, error)
+	GetCard(uuid string) (common.Card, error)
+	// Value counts of the fields for the cards
+	// matching the filters
+	GetCardFacets(schema_uuid string, fields []common.CardField, filters []common.CardFilter) ([]common.CardFacet, error)
+	ChangeCard(uuid string, image_location *string, json_data string) error
 	DeleteCard(uuid string) error
 	AddCardSchema(json_schema string, json_title string) (string, error)
 	GetCardSchemas(offset int, limit int) ([]common.CardSchema, error)
 	GetCardSchema(uuid string) (common.CardSchema, error)
 	DeleteCardSchema(uuid string) error
+	GetCardSchemaVersions(uuid string) ([]common.CardSchemaVersion, error)
+	// Cards that would fail the proposed schema after the transform
+	CheckCardSchema(uuid string, json_schema string, transform []common.PatchOperation) ([]common.CardFailure, error)
+	// Returns the new version, cards are migrated to it
+	// only when a transform is given
+	ChangeCardSchema(uuid string, json_schema string, transform []common.PatchOperation) (int, error)
 	AddPermalink(permalink common.Permalink) (int, error)
 	GetPermalinks() ([]common.Permalink, error)
 	CreateUser(user common.User) (int, error)
 	GetUserByUsername(username string) (common.User, error)
 	GetUserById(id uint) (common.User, error)
+	GetUserSites(user_id uint) ([]int, error)
+	AddUserSite(user_id uint, site_id int) error
+	GetSettings() (map[string]string, error)
+	SetSettings(values map[string]string) error
+	DeleteSetting(name string) error
+	GetMenus() ([]common.Menu, error)
+	GetMenu(id int) (common.Menu, error)
+	AddMenu(name string, location string) (int, error)
+	ChangeMenu(id int, name string, location string) error
+	DeleteMenu(id int) error
+	AddMenuItem(menu_id int, item common.MenuItem) (int, error)
+	ChangeMenuItem(item common.MenuItem) error
+	DeleteMenuItem(id int) error
+	MoveMenuItems(menu_id int, items []common.MenuItem) error
+	// Same database with the content limited to the site
+	ForSite(site_id int) Database
 }
 
+const (
+	DRIVER_MYSQL  = "mysql"
+	DRIVER_SQLITE = "sqlite3"
+)
+
 type SqlDatabase struct {
 	MY_SQL_URL string
+	// Name of the `database/sql` driver of the connection
+	Driver     string
 	Connection *sql.DB
+	// Site the content is read from and written to,
+	// zero for the default site
+	SiteId int
+}
+
+func (db SqlDatabase) ForSite(site_id int) Database {
+	db.SiteId = site_id
+	return &db
+}
+
+func (db *SqlDatabase) siteId() int {
+	if db.SiteId == 0 {
+		return common.DEFAULT_SITE_ID
+	}
+	return db.SiteId
 }
 
 // / GetPosts gets all the posts from the current
 // / database connection.
 func (db *SqlDatabase) GetPosts(limit int, offset int) ([]common.Post, error) {
+	return db.listPosts(limit, offset, false)
+}
+
+// GetPostsContent gets the posts like GetPosts, with
+// their content, so they don't have to be read one by one.
+func (db *SqlDatabase) GetPostsContent(limit int, offset int) ([]common.Post, error) {
+	return db.listPosts(limit, offset, true)
+}
+
+func (db *SqlDatabase) listPosts(limit int, offset int, with_content bool) ([]common.Post, error) {
 	all_posts := make([]common.Post, 0)
 	var rows *sql.Rows
 	var err error
 
-	query := "SELECT title, excerpt, id FROM posts"
-	args := make([]interface{}, 0)
+	columns := "title, excerpt, id"
+	if with_content {
+		columns += ", content"
+	}
+	query := "SELECT " + columns + " FROM posts WHERE site_id = ?"
+	args := []interface{}{db.siteId()}
 
 	// A limit of 0 or less means no limit.
 	if limit > 0 {
@@ -82,7 +161,11 @@ func (db *SqlDatabase) GetPosts(limit int, offset int) ([]common.Post, error) {
 
 	for rows.Next() {
 		var post common.Post
-		if err = rows.Scan(&post.Title, &post.Excerpt, &post.Id); err != nil {
+		fields := []any{&post.Title, &post.Excerpt, &post.Id}
+		if with_content {
+			fields = append(fields, &post.Content)
+		}
+		if err = rows.Scan(fields...); err != nil {
 			return make([]common.Post, 0), err
 		}
 		all_posts = append(all_posts, post)
@@ -94,12 +177,12 @@ func (db *SqlDatabase) GetPosts(limit int, offset int) ([]common.Post, error) {
 // / This function gets a post from the database
 // / with the given ID.
 func (db SqlDatabase) GetPost(post_id int) (post common.Post, err error) {
-	rows, err := db.Connection.Query("SELECT id, title, content, excerpt FROM posts WHERE id=?;", post_id)
+	rows, err := db.Connection.Query("SELECT id, title, content, excerpt FROM posts WHERE id=? AND site_id=?;", post_id, db.siteId())
 	if err != nil {
 		return common.Post{}, err
 	}
 	defer func() {
-		err = errors.Join(rows.Close())
+		err = errors.Join(err, rows.Close())
 	}()
 
 	rows.Next()
@@ -112,7 +195,7 @@ func (db SqlDatabase) GetPost(post_id int) (post common.Post, err error) {
 
 // AddPost adds a post to the database
 func (db *SqlDatabase) AddPost(title string, excerpt string, content string) (Id int, err error) {
-	res, err := db.Connection.Exec("INSERT INTO posts(content, title, excerpt) VALUES(?, ?, ?)", content, title, excerpt)
+	res, err := db.Connection.Exec("INSERT INTO posts(content, title, excerpt, site_id) VALUES(?, ?, ?, ?)", content, title, excerpt, db.siteId())
 	if err != nil {
 		return -1, err
 	}
@@ -140,21 +223,21 @@ func (db *SqlDatabase) ChangePost(id int, title string, excerpt string, content
 	defer tx.Rollback()
 
 	if len(title) > 0 {
-		_, err := tx.Exec("UPDATE posts SET title = ? WHERE id = ?;", title, id)
+		_, err := tx.Exec("UPDATE posts SET title = ? WHERE id = ? AND site_id = ?;", title, id, db.siteId())
 		if err != nil {
 			return err
 		}
 	}
 
 	if len(excerpt) > 0 {
-		_, err := tx.Exec("UPDATE posts SET excerpt = ? WHERE id = ?;", excerpt, id)
+		_, err := tx.Exec("UPDATE posts SET excerpt = ? WHERE id = ? AND site_id = ?;", excerpt, id, db.siteId())
 		if err != nil {
 			return err
 		}
 	}
 
 	if len(content) > 0 {
-		_, err := tx.Exec("UPDATE posts SET content = ? WHERE id = ?;", content, id)
+		_, err := tx.Exec("UPDATE posts SET content = ? WHERE id = ? AND site_id = ?;", content, id, db.siteId())
 		if err != nil {
 			return err
 		}
@@ -171,13 +254,47 @@ func (db *SqlDatabase) ChangePost(id int, title string, excerpt string, content
 // provided. Note that empty strings will mean that
 // the value will not be updated.
 func (db *SqlDatabase) DeletePost(id int) error {
-	if _, err := db.Connection.Exec("DELETE FROM posts WHERE id=?;", id); err != nil {
+	if _, err := db.Connection.Exec("DELETE FROM posts WHERE id=? AND site_id=?;", id, db.siteId()); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (db *SqlDatabase) AddPostPreview(preview common.PostPreview) (string, error) {
+	now := time.Now().UTC().Format(time.DateTime)
+	if _, err := db.Connection.Exec("DELETE FROM post_previews WHERE expires_at <= ?;", now); err != nil {
+		return "", err
+	}
+
+	uuid := uuid.New().String()
+	_, err := db.Connection.Exec(
+		"INSERT INTO post_previews(uuid, site_id, title, excerpt, content, expires_at) VALUES(UuidToBin(?), ?, ?, ?, ?, ?);",
+		uuid, db.siteId(), preview.Title, preview.Excerpt, preview.Content, preview.ExpiresAt.UTC().Format(time.DateTime))
+	if err != nil {
+		return "", err
+	}
+	return uuid, nil
+}
+
+func (db *SqlDatabase) GetPostPreview(uuid string) (common.PostPreview, error) {
+	var preview common.PostPreview
+	var expires_at string
+	now := time.Now().UTC().Format(time.DateTime)
+	row := db.Connection.QueryRow(
+		"SELECT UuidFromBin(uuid), title, excerpt, content, expires_at FROM post_previews WHERE uuid = UuidToBin(?) AND site_id = ? AND expires_at > ?;",
+		uuid, db.siteId(), now)
+	if err := row.Scan(&preview.Uuid, &preview.Title, &preview.Excerpt, &preview.Content, &expires_at); err != nil {
+		return common.PostPreview{}, err
+	}
+
+	var err error
+	if preview.ExpiresAt, err = parseTimestamp(expires_at); err != nil {
+		return common.PostPreview{}, err
+	}
+	return preview, nil
+}
+
 // AddImage will add the image metadata to the db.
 // name - file name saved to disk
 // alt - alternative text
@@ -245,141 +362,307 @@ func (db *SqlDatabase) DeleteImage(uuid string) error {
 // / Returns the uuid as a string if successful, otherwise error
 // / won't be null
 func (db SqlDatabase) AddCard(image string, schema_uuid string, content string) (string, error) {
-
-	schema, err := db.GetCardSchema(schema_uuid)
+	tx, err := db.Connection.Begin()
 	if err != nil {
 		return "", err
 	}
+	defer tx.Rollback()
 
-	tx, err := db.Connection.Begin()
+	// Cards are written with the latest version of the schema
+	version := 0
+	err = tx.QueryRow("SELECT version FROM card_schemas WHERE uuid = UuidToBin(?) AND site_id = ?;", schema_uuid, db.siteId()).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("card schema %s not found", schema_uuid)
+	}
 	if err != nil {
 		return "", err
 	}
-	defer func() {
-		if commit_err := tx.Commit(); commit_err != nil {
-			err = errors.Join(err, tx.Rollback(), commit_err)
-		}
-	}()
-
-	uuid := uuid.New().String()
-
-	_, err = tx.Exec("INSERT INTO cards(uuid, image_location, json_data, json_schema) VALUES(UuidToBin(?), ?, ?, ?)", uuid, image, content, schema_uuid)
+	// and added after the other cards of the schema
+	position := 0
+	err = tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM cards WHERE schema_uuid = UuidToBin(?) AND site_id = ?;", schema_uuid, db.siteId()).Scan(&position)
 	if err != nil {
 		return "", err
 	}
 
-	schema.Cards = append(schema.Cards, uuid)
-	cards_string, err := json.Marshal(schema.Cards)
-	fmt.Printf("UPDATE card_schemas SET card_ids = %s WHERE uuid = UuidToBin(%s);", cards_string, schema_uuid)
-
-	_, err = tx.Exec("UPDATE card_schemas SET card_ids = ? WHERE uuid = UuidToBin(?);", cards_string, schema_uuid)
+	uuid := uuid.New().String()
+	_, err = tx.Exec(
+		"INSERT INTO cards(uuid, image_location, json_data, json_schema, schema_uuid, schema_version, position, site_id) VALUES(UuidToBin(?), ?, ?, ?, UuidToBin(?), ?, ?, ?)",
+		uuid, image, content, schema_uuid, schema_uuid, version, position, db.siteId())
 	if err != nil {
 		return "", err
 	}
 
-	return uuid, nil
+	return uuid, tx.Commit()
 }
 
-func (db SqlDatabase) GetCards(schema_uuid string, limit int, page int) (all_cards []common.Card, err error) {
+// Card data fields cards can be sorted and filtered by,
+// the name ends up in the JSON path of the query
+var card_sort_regex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 
-	// TODO : need to get the card within the current schema
-	schema, err := db.GetCardSchema(schema_uuid)
-	if err != nil {
-		return []common.Card{}, err
-	}
+// Timestamps are read as text, the MySQL
+// connections don't set `parseTime`
+func parseTimestamp(value string) (time.Time, error) {
+	return time.Parse(time.DateTime, value)
+}
 
-	// Some hand-rolled logic to paginate
-	// we want the first "limit" cards after the "page * limit"
-	// cards, if available.
+// Conditions of the filters on the card data, the operators
+// and values are expected to be checked against the schema
+func cardFilterClause(filters []common.CardFilter) (string, []interface{}, error) {
+	clause := ""
+	args := []interface{}{}
+	for _, filter := range filters {
+		if !card_sort_regex.MatchString(filter.Field) {
+			return "", nil, fmt.Errorf("can't filter cards by `%s`", filter.Field)
+		}
+		path := "$." + filter.Field
+
+		operator := ""
+		switch filter.Op {
+		case common.FILTER_LT:
+			operator = "<"
+		case common.FILTER_LTE:
+			operator = "<="
+		case common.FILTER_GT:
+			operator = ">"
+		case common.FILTER_GTE:
+			operator = ">="
+		case common.FILTER_EQ:
+			// Strings, numbers and booleans compare as text
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Values)), ", ")
+			clause += fmt.Sprintf(" AND JSON_UNQUOTE(JSON_EXTRACT(json_data, ?)) IN (%s)", placeholders)
+			args = append(args, path)
+			for _, value := range filter.Values {
+				args = append(args, value)
+			}
+			continue
+		default:
+			return "", nil, fmt.Errorf("unknown filter `%s`", filter.Op)
+		}
+
+		if len(filter.Values) != 1 {
+			return "", nil, fmt.Errorf("filter `%s` takes a single value", filter.Op)
+		}
+		number, err := strconv.ParseFloat(filter.Values[0], 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("`%s` is not a number", filter.Values[0])
+		}
+		clause += fmt.Sprintf(" AND JSON_EXTRACT(json_data, ?) %s ?", operator)
+		args = append(args, path, number)
+	}
+	return clause, args, nil
+}
 
-	if len(schema.Cards) <= (page * limit) {
-		return []common.Card{}, fmt.Errorf("no cards available for the pagination given")
+// GetCards gets the cards of the schema matching the filters
+// in the order of the query, with the number of cards that
+// match the filters.
+func (db SqlDatabase) GetCards(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+	if _, err := db.GetCardSchema(schema_uuid); err != nil {
+		return []common.Card{}, 0, err
 	}
 
-	window := schema.Cards[(page * limit):min(len(schema.Cards), (page+1)*limit)]
+	filter_clause, filter_args, err := cardFilterClause(query.Filters)
+	if err != nil {
+		return []common.Card{}, 0, err
+	}
+	args := append([]interface{}{schema_uuid, db.siteId()}, filter_args...)
 
-	// gets the right UuidToBin(?), UuidToBin(?), ..., UuidToBin(?) for the IN clause
-	ids_query := strings.Repeat("UuidToBin(?), ", len(window))
-	ids_query = ids_query[:len(ids_query)-2]
+	total := 0
+	err = db.Connection.QueryRow("SELECT COUNT(*) FROM cards WHERE schema_uuid = UuidToBin(?) AND site_id = ?"+filter_clause+";", args...).Scan(&total)
+	if err != nil {
+		return []common.Card{}, 0, err
+	}
 
-	// Convert slice to interface{} slice for passing to Query
-	args := make([]interface{}, len(window))
-	for i, v := range window {
-		args[i] = v
+	direction := "ASC"
+	if query.Descending {
+		direction = "DESC"
+	}
+	sql_query := "SELECT UuidFromBin(uuid), image_location, json_data, json_schema, schema_version, position, created_at, updated_at FROM cards WHERE schema_uuid = UuidToBin(?) AND site_id = ?" + filter_clause
+	if query.SortBy != "" {
+		if !card_sort_regex.MatchString(query.SortBy) {
+			return []common.Card{}, 0, fmt.Errorf("can't sort cards by `%s`", query.SortBy)
+		}
+		sql_query += fmt.Sprintf(" ORDER BY JSON_EXTRACT(json_data, ?) %s, position %s", direction, direction)
+		args = append(args, "$."+query.SortBy)
+	} else {
+		sql_query += fmt.Sprintf(" ORDER BY position %s", direction)
 	}
 
-	query := fmt.Sprintf("SELECT UuidFromBin(uuid), image_location, json_data, json_schema FROM cards WHERE uuid IN (%s);", ids_query)
-	rows, err := db.Connection.Query(query, args...)
+	// A limit of 0 or less means no limit.
+	if query.Limit > 0 {
+		sql_query += " LIMIT ?"
+		args = append(args, query.Limit)
+		// OFFSET is only valid with LIMIT
+		if query.Offset > 0 {
+			sql_query += " OFFSET ?"
+			args = append(args, query.Offset)
+		}
+	}
+	sql_query += ";"
 
+	rows, err := db.Connection.Query(sql_query, args...)
 	if err != nil {
-		return []common.Card{}, err
+		return []common.Card{}, 0, err
 	}
-	defer func() {
-		err = errors.Join(rows.Close())
-	}()
+	defer rows.Close()
 
+	all_cards := []common.Card{}
 	for rows.Next() {
 		var card common.Card
-		if err = rows.Scan(&card.Id, &card.Image, &card.Content, &card.Schema); err != nil {
-			return []common.Card{}, err
+		var created_at, updated_at string
+		if err = rows.Scan(&card.Id, &card.Image, &card.Content, &card.Schema, &card.SchemaVersion, &card.Position, &created_at, &updated_at); err != nil {
+			return []common.Card{}, 0, err
+		}
+		if card.CreatedAt, err = parseTimestamp(created_at); err != nil {
+			return []common.Card{}, 0, err
+		}
+		if card.UpdatedAt, err = parseTimestamp(updated_at); err != nil {
+			return []common.Card{}, 0, err
 		}
 		all_cards = append(all_cards, card)
 	}
 
-	return all_cards, nil
+	return all_cards, total, rows.Err()
 }
 
-func (db *SqlDatabase) ChangeCard(uuid string, image_location string, json_data string, schema_name string) error {
+// GetCard gets the card of the site by its uuid.
+func (db SqlDatabase) GetCard(uuid string) (common.Card, error) {
+	var card common.Card
+	var created_at, updated_at string
+	row := db.Connection.QueryRow("SELECT UuidFromBin(uuid), image_location, json_data, json_schema, schema_version, position, created_at, updated_at FROM cards WHERE uuid = UuidToBin(?) AND site_id = ?;", uuid, db.siteId())
+	if err := row.Scan(&card.Id, &card.Image, &card.Content, &card.Schema, &card.SchemaVersion, &card.Position, &created_at, &updated_at); err != nil {
+		return common.Card{}, err
+	}
 
-	log.Info().Msgf("changing card")
+	var err error
+	if card.CreatedAt, err = parseTimestamp(created_at); err != nil {
+		return common.Card{}, err
+	}
+	if card.UpdatedAt, err = parseTimestamp(updated_at); err != nil {
+		return common.Card{}, err
+	}
+	return card, nil
+}
 
-	tx, err := db.Connection.Begin()
-	if err != nil {
-		return err
+// GetCardFacets counts the values of each field for the cards
+// matching the filters on the other fields, so picking a
+// value doesn't hide the rest of the values of the field.
+func (db SqlDatabase) GetCardFacets(schema_uuid string, fields []common.CardField, filters []common.CardFilter) ([]common.CardFacet, error) {
+	if _, err := db.GetCardSchema(schema_uuid); err != nil {
+		return nil, err
 	}
-	defer func() {
-		if commit_err := tx.Commit(); commit_err != nil {
-			err = errors.Join(err, tx.Rollback(), commit_err)
-		}
-	}()
 
-	if image_location != "" {
-		image_stat, err := os.Stat(image_location)
-		if errors.Is(err, os.ErrNotExist) {
-			return fmt.Errorf("file does not exist: %s", image_location)
+	facets := []common.CardFacet{}
+	for _, field := range fields {
+		if !card_sort_regex.MatchString(field.Name) {
+			return nil, fmt.Errorf("can't count cards by `%s`", field.Name)
+		}
+		other_filters := []common.CardFilter{}
+		for _, filter := range filters {
+			if filter.Field != field.Name {
+				other_filters = append(other_filters, filter)
+			}
 		}
+		filter_clause, filter_args, err := cardFilterClause(other_filters)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if image_stat.IsDir() {
-			return fmt.Errorf("given path is a directory: %s", image_stat)
+		args := append([]interface{}{"$." + field.Name, schema_uuid, db.siteId()}, filter_args...)
+		facet := common.CardFacet{Field: field}
+
+		if field.Type == common.CARD_FIELD_NUMBER {
+			var min_value, max_value sql.NullFloat64
+			err = db.Connection.QueryRow(`SELECT MIN(value), MAX(value), COUNT(value) FROM (
+				SELECT JSON_EXTRACT(json_data, ?) AS value FROM cards WHERE schema_uuid = UuidToBin(?) AND site_id = ?`+filter_clause+`
+			) AS field_values;`, args...).Scan(&min_value, &max_value, &facet.Count)
+			if err != nil {
+				return nil, err
+			}
+			facet.Min = min_value.Float64
+			facet.Max = max_value.Float64
+			facets = append(facets, facet)
+			continue
 		}
-		_, err = tx.Exec("UPDATE cards SET image_location = ? WHERE uuid = UuidFromBin(?9;", image_location, uuid)
+
+		rows, err := db.Connection.Query(`SELECT JSON_UNQUOTE(JSON_EXTRACT(json_data, ?)) AS value, COUNT(*) FROM cards
+			WHERE schema_uuid = UuidToBin(?) AND site_id = ?`+filter_clause+` GROUP BY value;`, args...)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		counts := make(map[string]int)
+		for rows.Next() {
+			var value sql.NullString
+			count := 0
+			if err = rows.Scan(&value, &count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if value.Valid {
+				counts[value.String] = count
+			}
 		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// Every value is listed, in the schema order
+		values := field.Enum
+		if field.Type == common.CARD_FIELD_BOOLEAN {
+			values = []string{"true", "false"}
+		}
+		for _, value := range values {
+			facet.Values = append(facet.Values, common.FacetValue{Value: value, Count: counts[value]})
+			facet.Count += counts[value]
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+// ChangeCard changes the image and data of the card, the data
+// is validated against the schema version of the card. A nil
+// image or empty data are left as they are.
+func (db *SqlDatabase) ChangeCard(uuid string, image_location *string, json_data string) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	if json_data != "" && schema_name != "" {
+	json_schema := ""
+	err = tx.QueryRow(`SELECT card_schema_versions.json_schema FROM cards
+		JOIN card_schema_versions ON card_schema_versions.schema_uuid = cards.schema_uuid
+			AND card_schema_versions.version = cards.schema_version
+		WHERE cards.uuid = UuidToBin(?) AND cards.site_id = ?;`, uuid, db.siteId()).Scan(&json_schema)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("card %s not found", uuid)
+	}
+	if err != nil {
+		return err
+	}
 
-		err = validateJson(json_data, schema_name)
+	if image_location != nil {
+		_, err = tx.Exec("UPDATE cards SET image_location = ? WHERE uuid = UuidToBin(?) AND site_id = ?;", *image_location, uuid, db.siteId())
 		if err != nil {
 			return err
 		}
-		_, err = tx.Exec("UPDATE cards SET json_data = ?, json_schema = ? WHERE uuid = UuidFromBin(?);", json_data, schema_name, uuid)
+	}
+
+	if json_data != "" {
+		if err = common.ValidateCardData(json_data, json_schema); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE cards SET json_data = ? WHERE uuid = UuidToBin(?) AND site_id = ?;", json_data, uuid, db.siteId())
 		if err != nil {
 			return err
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-	return nil
+	return tx.Commit()
 }
 
 func (db *SqlDatabase) DeleteCard(uuid string) error {
-	if _, err := db.Connection.Exec("DELETE FROM cards WHERE uuid=UuidFromBin(?);", uuid); err != nil {
+	if _, err := db.Connection.Exec("DELETE FROM cards WHERE uuid=UuidToBin(?) AND site_id=?;", uuid, db.siteId()); err != nil {
 		return err
 	}
 
@@ -389,48 +672,44 @@ func (db *SqlDatabase) DeleteCard(uuid string) error {
 func (db SqlDatabase) AddCardSchema(json_schema string, json_title string) (string, error) {
 	uuid := uuid.New().String()
 
-	_, err := db.Connection.Exec(
-		"INSERT INTO card_schemas(uuid, json_id, json_schema, json_title, card_ids) VALUES(UuidToBin(?), ?, ?, ?, ?)",
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT INTO card_schemas(uuid, json_id, json_schema, json_title, version, site_id) VALUES(UuidToBin(?), ?, ?, ?, 1, ?)",
 		uuid,
 		"some_id",
 		json_schema,
 		json_title,
-		"[]")
-
+		db.siteId())
 	if err != nil {
 		return "", err
 	}
-
-	return uuid, nil
-}
-
-func (db SqlDatabase) GetCardSchema(id string) (schema common.CardSchema, err error) {
-	rows, err := db.Connection.Query("SELECT json_schema, json_title, card_ids FROM card_schemas WHERE uuid=UuidToBin(?);", id)
+	_, err = tx.Exec("INSERT INTO card_schema_versions(schema_uuid, version, json_schema) VALUES(UuidToBin(?), 1, ?);", uuid, json_schema)
 	if err != nil {
-		return common.CardSchema{}, err
+		return "", err
 	}
 
-	defer func() {
-		err = errors.Join(rows.Close())
-	}()
+	return uuid, tx.Commit()
+}
 
-	rows.Next()
-	var card_ids_string string
-	if err = rows.Scan(&schema.Schema, &schema.Title, &card_ids_string); err != nil {
-		return common.CardSchema{}, err
-	}
+const card_count_query = "(SELECT COUNT(*) FROM cards WHERE cards.schema_uuid = card_schemas.uuid)"
 
-	// We need to parse the schemas here
-	err = json.Unmarshal([]byte(card_ids_string), &schema.Cards)
-	if err != nil {
-		return common.CardSchema{}, fmt.Errorf("can't parse card ids json: %v", err)
+func (db SqlDatabase) GetCardSchema(id string) (schema common.CardSchema, err error) {
+	row := db.Connection.QueryRow("SELECT json_schema, json_title, version, "+card_count_query+" FROM card_schemas WHERE uuid=UuidToBin(?) AND site_id=?;", id, db.siteId())
+	if err = row.Scan(&schema.Schema, &schema.Title, &schema.Version, &schema.CardCount); err != nil {
+		return common.CardSchema{}, err
 	}
+	schema.Uuid = id
 
 	return schema, nil
 }
 
 func (db *SqlDatabase) DeleteCardSchema(uuid string) error {
-	if _, err := db.Connection.Exec("DELETE FROM card_schemas WHERE uuid=UuidFromBin(?);", uuid); err != nil {
+	if _, err := db.Connection.Exec("DELETE FROM card_schemas WHERE uuid=UuidToBin(?) AND site_id=?;", uuid, db.siteId()); err != nil {
 		return err
 	}
 
@@ -441,8 +720,8 @@ func (db SqlDatabase) GetCardSchemas(offset int, limit int) (schemas []common.Ca
 	all_schemas := []common.CardSchema{}
 	var rows *sql.Rows
 
-	query := "SELECT UuidFromBin(uuid), json_schema, json_title, card_ids FROM card_schemas"
-	args := make([]interface{}, 0)
+	query := "SELECT UuidFromBin(uuid), json_schema, json_title, version, " + card_count_query + " FROM card_schemas WHERE site_id = ?"
+	args := []interface{}{db.siteId()}
 
 	// A limit of 0 or less means no limit.
 	if limit > 0 {
@@ -464,175 +743,517 @@ func (db SqlDatabase) GetCardSchemas(offset int, limit int) (schemas []common.Ca
 
 	for rows.Next() {
 		var schema common.CardSchema
-		var cardsRaw []byte
-
-		if err = rows.Scan(&schema.Uuid, &schema.Schema, &schema.Title, &cardsRaw); err != nil {
+		if err = rows.Scan(&schema.Uuid, &schema.Schema, &schema.Title, &schema.Version, &schema.CardCount); err != nil {
 			return []common.CardSchema{}, err
 		}
-
-		// Aquí parseas el JSON de la base a tu array de Go:
-		if len(cardsRaw) > 0 {
-			if err = json.Unmarshal(cardsRaw, &schema.Cards); err != nil {
-				return []common.CardSchema{}, fmt.Errorf("error unmarshaling card_ids: %w", err)
-			}
-		}
 		all_schemas = append(all_schemas, schema)
-
 	}
 	return all_schemas, rows.Err()
 }
 
-func (db *SqlDatabase) AddPage(title string, content string, link string) (int, error) {
-	res, err := db.Connection.Exec("INSERT INTO pages(content, title, link) VALUES(?, ?, ?);", content, title, link)
-	if err != nil {
-		return -1, err
-	}
-
-	id, err := res.LastInsertId()
+// GetCardSchemaVersions gets every version of the
+// schema, the first one first.
+func (db *SqlDatabase) GetCardSchemaVersions(uuid string) ([]common.CardSchemaVersion, error) {
+	rows, err := db.Connection.Query(`SELECT card_schema_versions.version, card_schema_versions.json_schema, card_schema_versions.created_at
+		FROM card_schema_versions JOIN card_schemas ON card_schemas.uuid = card_schema_versions.schema_uuid
+		WHERE card_schemas.uuid = UuidToBin(?) AND card_schemas.site_id = ? ORDER BY card_schema_versions.version;`, uuid, db.siteId())
 	if err != nil {
-		log.Warn().Msgf("could not get last ID: %v", err)
-		return -1, nil
+		return nil, err
 	}
+	defer rows.Close()
 
-	// TODO : possibly unsafe int conv,
-	// make sure all IDs are i64 in the
-	// future
-	return int(id), nil
-}
-
-func (db *SqlDatabase) GetPages(limit int, offset int) ([]common.Page, error) {
-	all_pages := make([]common.Page, 0)
-	var rows *sql.Rows
-	var err error
-
-	query := "SELECT title, content, link, id FROM pages"
-	args := make([]interface{}, 0)
-
-	// A limit of 0 or less means no limit.
-	if limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, limit)
-		// OFFSET is only valid with LIMIT
-		if offset > 0 {
-			query += " OFFSET ?"
-			args = append(args, offset)
+	versions := []common.CardSchemaVersion{}
+	for rows.Next() {
+		var version common.CardSchemaVersion
+		var created_at string
+		if err = rows.Scan(&version.Version, &version.Schema, &created_at); err != nil {
+			return nil, err
+		}
+		if version.CreatedAt, err = parseTimestamp(created_at); err != nil {
+			return nil, err
 		}
+		versions = append(versions, version)
 	}
-	query += ";"
+	return versions, rows.Err()
+}
 
-	rows, err = db.Connection.Query(query, args...)
+// Data of every card of the schema, by card uuid
+func (db *SqlDatabase) schemaCardData(tx *sql.Tx, schema_uuid string) (map[string]string, []string, error) {
+	rows, err := tx.Query("SELECT UuidFromBin(uuid), json_data FROM cards WHERE schema_uuid = UuidToBin(?) AND site_id = ? ORDER BY position;", schema_uuid, db.siteId())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
+	data := make(map[string]string)
+	ids := []string{}
 	for rows.Next() {
-		var page common.Page
-		if err = rows.Scan(&page.Title, &page.Content, &page.Link, &page.Id); err != nil {
-			return nil, err
+		var id, json_data string
+		if err = rows.Scan(&id, &json_data); err != nil {
+			return nil, nil, err
 		}
-		all_pages = append(all_pages, page)
+		data[id] = json_data
+		ids = append(ids, id)
 	}
+	return data, ids, rows.Err()
+}
 
-	return all_pages, rows.Err()
+// Transforms the cards and checks them against the schema,
+// returns the new data of the cards and the cards that fail
+func migrateCardData(data map[string]string, ids []string, json_schema string, transform []common.PatchOperation) (map[string]string, []common.CardFailure) {
+	migrated := make(map[string]string, len(data))
+	failures := []common.CardFailure{}
+	for _, id := range ids {
+		json_data := data[id]
+		var err error
+		if len(transform) > 0 {
+			json_data, err = common.ApplyPatch(json_data, transform)
+		}
+		if err == nil {
+			err = common.ValidateCardData(json_data, json_schema)
+		}
+		if err != nil {
+			failures = append(failures, common.CardFailure{CardId: id, Error: err.Error()})
+			continue
+		}
+		migrated[id] = json_data
+	}
+	return migrated, failures
 }
 
-func (db *SqlDatabase) GetPage(link string) (common.Page, error) {
-	query := "SELECT id, title, content, link FROM pages WHERE link=?;"
-	row := db.Connection.QueryRow(query, link)
-	var page common.Page
-	if err := row.Scan(&page.Id, &page.Title, &page.Content, &page.Link); err != nil {
-		return common.Page{}, err
+// CheckCardSchema reports the cards of the schema that
+// would fail the proposed schema after the transform.
+func (db *SqlDatabase) CheckCardSchema(uuid string, json_schema string, transform []common.PatchOperation) ([]common.CardFailure, error) {
+	if _, err := db.GetCardSchema(uuid); err != nil {
+		return nil, fmt.Errorf("card schema %s not found: %v", uuid, err)
 	}
 
-	return page, nil
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Nothing is written
+	defer tx.Rollback()
+
+	data, ids, err := db.schemaCardData(tx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	_, failures := migrateCardData(data, ids, json_schema, transform)
+	return failures, nil
 }
 
-func (db *SqlDatabase) ChangePage(id int, title string, content string, link string) (err error) {
+// ChangeCardSchema stores the schema as a new version. Cards
+// are moved to it when a transform is given, all of them
+// or none, and keep their version otherwise.
+func (db *SqlDatabase) ChangeCardSchema(uuid string, json_schema string, transform []common.PatchOperation) (int, error) {
 	tx, err := db.Connection.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	if len(title) > 0 {
-		_, err := tx.Exec("UPDATE pages SET title = ? WHERE id = ?;", title, id)
-		if err != nil {
-			return err
-		}
+	version := 0
+	err = tx.QueryRow("SELECT version FROM card_schemas WHERE uuid = UuidToBin(?) AND site_id = ?;", uuid, db.siteId()).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("card schema %s not found", uuid)
+	}
+	if err != nil {
+		return 0, err
 	}
+	version++
 
-	if len(link) > 0 {
-		_, err := tx.Exec("UPDATE pages SET link = ? WHERE id = ?;", link, id)
-		if err != nil {
-			return err
-		}
+	_, err = tx.Exec("INSERT INTO card_schema_versions(schema_uuid, version, json_schema) VALUES(UuidToBin(?), ?, ?);", uuid, version, json_schema)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("UPDATE card_schemas SET json_schema = ?, version = ? WHERE uuid = UuidToBin(?) AND site_id = ?;", json_schema, version, uuid, db.siteId())
+	if err != nil {
+		return 0, err
 	}
 
-	if len(content) > 0 {
-		_, err := tx.Exec("UPDATE pages SET content = ? WHERE id = ?;", content, id)
+	if transform != nil {
+		data, ids, err := db.schemaCardData(tx, uuid)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		migrated, failures := migrateCardData(data, ids, json_schema, transform)
+		if len(failures) > 0 {
+			return 0, fmt.Errorf("%d cards can't be migrated, card %s: %s", len(failures), failures[0].CardId, failures[0].Error)
+		}
+		for _, id := range ids {
+			_, err = tx.Exec("UPDATE cards SET json_data = ?, schema_version = ? WHERE uuid = UuidToBin(?) AND site_id = ?;", migrated[id], version, id, db.siteId())
+			if err != nil {
+				return 0, err
+			}
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	return version, tx.Commit()
 }
 
-func (db *SqlDatabase) DeletePage(link string) error {
-	if _, err := db.Connection.Exec("DELETE FROM pages WHERE link=?;", link); err != nil {
-		return err
+// Blocks are stored as JSON, NULL for Markdown pages
+func blocksColumn(blocks []common.Block) (any, error) {
+	if len(blocks) == 0 {
+		return nil, nil
 	}
-
-	return nil
+	blocks_json, err := json.Marshal(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return string(blocks_json), nil
 }
 
-func validateJson(json_data string, schema_name string) error {
-	schema_data, err := os.ReadFile(filepath.Join("schemas", schema_name+".json"))
-	if err != nil {
-		return fmt.Errorf("%v, %v", schema_name, err)
+func parseBlocks(blocks_json sql.NullString) ([]common.Block, error) {
+	if !blocks_json.Valid || blocks_json.String == "" {
+		return nil, nil
 	}
+	var blocks []common.Block
+	if err := json.Unmarshal([]byte(blocks_json.String), &blocks); err != nil {
+		return nil, fmt.Errorf("can't parse page blocks: %v", err)
+	}
+	return blocks, nil
+}
 
-	schemaLoader := gojsonschema.NewBytesLoader([]byte(schema_data))
-	documentLoader := gojsonschema.NewStringLoader(json_data) // Changed from NewReferenceLoader to NewStringLoader
-	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
+// Fails unless the parent page belongs to the site, zero
+// is the top level
+func (db *SqlDatabase) checkParentPage(tx *sql.Tx, parent_id int) error {
+	if parent_id == 0 {
+		return nil
+	}
+	count := 0
+	err := tx.QueryRow("SELECT COUNT(*) FROM pages WHERE id = ? AND site_id = ?;", parent_id, db.siteId()).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("could not validate json_data: %v", err)
+		return err
 	}
-	if !result.Valid() {
-		var errors []string
-		for _, err := range result.Errors() {
-			errors = append(errors, err.String())
-		}
-		return fmt.Errorf("invalid card json: %s", strings.Join(errors, "; "))
+	if count == 0 {
+		return fmt.Errorf("parent page %d not found", parent_id)
 	}
 	return nil
 }
 
-func (db SqlDatabase) AddPermalink(permalink common.Permalink) (int, error) {
-	res, err := db.Connection.Exec("INSERT INTO post_permalinks(permalink, post_id) VALUES(?, ?)", permalink.Path, permalink.PostId)
+// AddPage adds the page after the other children
+// of its parent, zero for the top level.
+func (db *SqlDatabase) AddPage(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+	blocks_json, err := blocksColumn(blocks)
 	if err != nil {
 		return -1, err
 	}
-
-	id, err := res.LastInsertId()
+	tx, err := db.Connection.Begin()
 	if err != nil {
-		log.Warn().Msgf("could not get last ID: %v", err)
-		return -1, nil
+		return -1, err
 	}
+	defer tx.Rollback()
 
-	// TODO : possibly unsafe int conv,
+	if err = db.checkParentPage(tx, parent_id); err != nil {
+		return -1, err
+	}
+	position := 0
+	err = tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM pages WHERE parent_id = ? AND site_id = ?;", parent_id, db.siteId()).Scan(&position)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO pages(content, title, link, blocks, parent_id, position, site_id) VALUES(?, ?, ?, ?, ?, ?, ?);",
+		content, title, link, blocks_json, parent_id, position, db.siteId())
+	if err != nil {
+		return -1, err
+	}
+	// The link now belongs to this page
+	if _, err = tx.Exec("DELETE FROM page_redirects WHERE link = ? AND site_id = ?;", link, db.siteId()); err != nil {
+		return -1, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Warn().Msgf("could not get last ID: %v", err)
+		return -1, tx.Commit()
+	}
+
+	// TODO : possibly unsafe int conv,
+	// make sure all IDs are i64 in the
+	// future
+	return int(id), tx.Commit()
+}
+
+func (db *SqlDatabase) GetPages(limit int, offset int) ([]common.Page, error) {
+	all_pages := make([]common.Page, 0)
+	var rows *sql.Rows
+	var err error
+
+	query := "SELECT title, content, link, blocks, parent_id, position, id FROM pages WHERE site_id = ?"
+	args := []interface{}{db.siteId()}
+
+	// A limit of 0 or less means no limit.
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+		// OFFSET is only valid with LIMIT
+		if offset > 0 {
+			query += " OFFSET ?"
+			args = append(args, offset)
+		}
+	}
+	query += ";"
+
+	rows, err = db.Connection.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var page common.Page
+		var blocks_json sql.NullString
+		if err = rows.Scan(&page.Title, &page.Content, &page.Link, &blocks_json, &page.ParentId, &page.Position, &page.Id); err != nil {
+			return nil, err
+		}
+		if page.Blocks, err = parseBlocks(blocks_json); err != nil {
+			return nil, err
+		}
+		all_pages = append(all_pages, page)
+	}
+
+	return all_pages, rows.Err()
+}
+
+// GetPageTree gets every page of the site without
+// its content, with the path it's served at.
+func (db *SqlDatabase) GetPageTree() ([]common.Page, error) {
+	rows, err := db.Connection.Query("SELECT id, title, link, parent_id, position FROM pages WHERE site_id = ? ORDER BY parent_id, position, id;", db.siteId())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := make([]common.Page, 0)
+	for rows.Next() {
+		var page common.Page
+		if err = rows.Scan(&page.Id, &page.Title, &page.Link, &page.ParentId, &page.Position); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	paths := common.PagePaths(pages)
+	for i := range pages {
+		pages[i].Path = paths[pages[i].Id]
+	}
+	return pages, nil
+}
+
+func (db *SqlDatabase) GetPage(link string) (common.Page, error) {
+	query := "SELECT id, title, content, link, blocks, parent_id, position FROM pages WHERE link=? AND site_id=? ORDER BY parent_id, id LIMIT 1;"
+	return db.scanPage(db.Connection.QueryRow(query, link, db.siteId()))
+}
+
+func (db *SqlDatabase) GetPageById(id int) (common.Page, error) {
+	query := "SELECT id, title, content, link, blocks, parent_id, position FROM pages WHERE id=? AND site_id=?;"
+	return db.scanPage(db.Connection.QueryRow(query, id, db.siteId()))
+}
+
+func (db *SqlDatabase) scanPage(row *sql.Row) (common.Page, error) {
+	var page common.Page
+	var blocks_json sql.NullString
+	if err := row.Scan(&page.Id, &page.Title, &page.Content, &page.Link, &blocks_json, &page.ParentId, &page.Position); err != nil {
+		return common.Page{}, err
+	}
+
+	blocks, err := parseBlocks(blocks_json)
+	if err != nil {
+		return common.Page{}, err
+	}
+	page.Blocks = blocks
+	return page, nil
+}
+
+// GetPageRedirect gets the id of the page that
+// used to have the link.
+func (db *SqlDatabase) GetPageRedirect(link string) (int, error) {
+	page_id := 0
+	err := db.Connection.QueryRow("SELECT page_id FROM page_redirects WHERE link = ? AND site_id = ?;", link, db.siteId()).Scan(&page_id)
+	return page_id, err
+}
+
+func (db *SqlDatabase) ChangePage(id int, title string, content string, link string, blocks []common.Block) (err error) {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(title) > 0 {
+		_, err := tx.Exec("UPDATE pages SET title = ? WHERE id = ? AND site_id = ?;", title, id, db.siteId())
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(link) > 0 {
+		old_link := ""
+		err := tx.QueryRow("SELECT link FROM pages WHERE id = ? AND site_id = ?;", id, db.siteId()).Scan(&old_link)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		_, err = tx.Exec("UPDATE pages SET link = ? WHERE id = ? AND site_id = ?;", link, id, db.siteId())
+		if err != nil {
+			return err
+		}
+		// Requests for the old link are redirected to the page
+		if old_link != "" && old_link != link {
+			_, err = tx.Exec("DELETE FROM page_redirects WHERE link IN (?, ?) AND site_id = ?;", old_link, link, db.siteId())
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO page_redirects(site_id, link, page_id) VALUES(?, ?, ?);", db.siteId(), old_link, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(content) > 0 {
+		_, err := tx.Exec("UPDATE pages SET content = ? WHERE id = ? AND site_id = ?;", content, id, db.siteId())
+		if err != nil {
+			return err
+		}
+	}
+
+	if blocks != nil {
+		blocks_json, err := blocksColumn(blocks)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE pages SET blocks = ? WHERE id = ? AND site_id = ?;", blocks_json, id, db.siteId())
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MovePages sets the parent and position of the given
+// pages of the site, all of them or none. Their old
+// paths keep working as the pages are found by link.
+func (db *SqlDatabase) MovePages(pages []common.Page) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, parent_id FROM pages WHERE site_id = ?;", db.siteId())
+	if err != nil {
+		return err
+	}
+	parents := make(map[int]int)
+	for rows.Next() {
+		var id, parent_id int
+		if err = rows.Scan(&id, &parent_id); err != nil {
+			rows.Close()
+			return err
+		}
+		parents[id] = parent_id
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, page := range pages {
+		if _, exists := parents[page.Id]; !exists {
+			return fmt.Errorf("page %d not found", page.Id)
+		}
+		if _, exists := parents[page.ParentId]; page.ParentId != 0 && !exists {
+			return fmt.Errorf("parent page %d not found", page.ParentId)
+		}
+		parents[page.Id] = page.ParentId
+	}
+	// A page can't end up under one of its children
+	for id := range parents {
+		seen := map[int]bool{id: true}
+		for parent_id := parents[id]; parent_id != 0; parent_id = parents[parent_id] {
+			if seen[parent_id] {
+				return fmt.Errorf("page %d would be nested in itself", id)
+			}
+			seen[parent_id] = true
+		}
+	}
+
+	for _, page := range pages {
+		_, err = tx.Exec("UPDATE pages SET parent_id = ?, position = ? WHERE id = ? AND site_id = ?;", page.ParentId, page.Position, page.Id, db.siteId())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeletePage deletes the page and its redirects, pages
+// with children have to be emptied first.
+func (db *SqlDatabase) DeletePage(link string) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id := 0
+	err = tx.QueryRow("SELECT id FROM pages WHERE link = ? AND site_id = ? ORDER BY parent_id, id LIMIT 1;", link, db.siteId()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	children := 0
+	if err = tx.QueryRow("SELECT COUNT(*) FROM pages WHERE parent_id = ? AND site_id = ?;", id, db.siteId()).Scan(&children); err != nil {
+		return err
+	}
+	if children > 0 {
+		return fmt.Errorf("page `%s` has %d child pages", link, children)
+	}
+
+	if _, err = tx.Exec("DELETE FROM pages WHERE id = ?;", id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM page_redirects WHERE page_id = ? AND site_id = ?;", id, db.siteId()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db SqlDatabase) AddPermalink(permalink common.Permalink) (int, error) {
+	res, err := db.Connection.Exec("INSERT INTO post_permalinks(permalink, post_id, site_id) VALUES(?, ?, ?)", permalink.Path, permalink.PostId, db.siteId())
+	if err != nil {
+		return -1, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Warn().Msgf("could not get last ID: %v", err)
+		return -1, nil
+	}
+
+	// TODO : possibly unsafe int conv,
 	// make sure all IDs are i64 in the
 	// future
 	return int(id), nil
 }
 
 func (db SqlDatabase) GetPermalinks() ([]common.Permalink, error) {
-	rows, err := db.Connection.Query("SELECT permalink, post_id FROM post_permalinks")
+	rows, err := db.Connection.Query("SELECT permalink, post_id FROM post_permalinks WHERE site_id = ?", db.siteId())
 	if err != nil {
 		return []common.Permalink{}, err
 	}
@@ -667,6 +1288,11 @@ func (db *SqlDatabase) CreateUser(user common.User) (int, error) {
 		return -1, err
 	}
 
+	// New users can manage the site they were created from
+	if err = db.AddUserSite(uint(id), db.siteId()); err != nil {
+		return -1, err
+	}
+
 	// TODO : possibly unsafe int conv,
 	// make sure all IDs are i64 in the
 	// future
@@ -705,3 +1331,452 @@ func (db *SqlDatabase) GetUserById(id uint) (common.User, error) {
 
 	return user, nil
 }
+
+// GetUserSites gets the ids of the sites the user
+// was granted access to.
+func (db *SqlDatabase) GetUserSites(user_id uint) ([]int, error) {
+	rows, err := db.Connection.Query("SELECT site_id FROM user_sites WHERE user_id = ? ORDER BY site_id;", user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	site_ids := []int{}
+	for rows.Next() {
+		var site_id int
+		if err = rows.Scan(&site_id); err != nil {
+			return nil, err
+		}
+		site_ids = append(site_ids, site_id)
+	}
+	return site_ids, rows.Err()
+}
+
+// AddUserSite grants the user access to the site,
+// granting it twice is not an error.
+func (db *SqlDatabase) AddUserSite(user_id uint, site_id int) error {
+	count := 0
+	err := db.Connection.QueryRow("SELECT COUNT(*) FROM user_sites WHERE user_id = ? AND site_id = ?;", user_id, site_id).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.Connection.Exec("INSERT INTO user_sites(user_id, site_id) VALUES(?, ?);", user_id, site_id)
+	return err
+}
+
+// GetSettings gets the settings of the site changed
+// from the admin-app, as JSON by name.
+func (db *SqlDatabase) GetSettings() (map[string]string, error) {
+	rows, err := db.Connection.Query("SELECT name, value FROM site_settings WHERE site_id = ?;", db.siteId())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		settings[name] = value
+	}
+	return settings, rows.Err()
+}
+
+// SetSettings stores the given settings of the site,
+// all of them or none.
+func (db *SqlDatabase) SetSettings(values map[string]string) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for name, value := range values {
+		if _, err = tx.Exec("DELETE FROM site_settings WHERE site_id = ? AND name = ?;", db.siteId(), name); err != nil {
+			return err
+		}
+		if _, err = tx.Exec("INSERT INTO site_settings(site_id, name, value) VALUES(?, ?, ?);", db.siteId(), name, value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteSetting goes back to the value of the
+// config file for the setting.
+func (db *SqlDatabase) DeleteSetting(name string) error {
+	_, err := db.Connection.Exec("DELETE FROM site_settings WHERE site_id = ? AND name = ?;", db.siteId(), name)
+	return err
+}
+
+// GetMenus gets the menus of the site with their items
+// nested, the links of the items follow the content.
+func (db *SqlDatabase) GetMenus() ([]common.Menu, error) {
+	rows, err := db.Connection.Query("SELECT id, name, location FROM menus WHERE site_id = ? ORDER BY id;", db.siteId())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	menus := []common.Menu{}
+	for rows.Next() {
+		var menu common.Menu
+		if err = rows.Scan(&menu.Id, &menu.Name, &menu.Location); err != nil {
+			return nil, err
+		}
+		menus = append(menus, menu)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items, err := db.getMenuItems()
+	if err != nil {
+		return nil, err
+	}
+	for i := range menus {
+		menus[i].Items = common.MenuTree(items[menus[i].Id])
+	}
+	return menus, nil
+}
+
+// Items of every menu of the site by menu id, pages and
+// posts are joined to link to their current address
+func (db *SqlDatabase) getMenuItems() (map[int][]common.MenuItem, error) {
+	// Page items link to the path of the page in the tree
+	page_tree, err := db.GetPageTree()
+	if err != nil {
+		return nil, err
+	}
+	page_paths := make(map[string]string, len(page_tree))
+	for _, page := range page_tree {
+		page_paths[strconv.Itoa(page.Id)] = page.Path
+	}
+
+	query := `SELECT menu_items.id, menu_items.menu_id, menu_items.parent_id, menu_items.position,
+		menu_items.type, menu_items.target, menu_items.label, menu_items.title, menu_items.visible,
+		pages.link, pages.title, posts.title
+	FROM menu_items
+	JOIN menus ON menus.id = menu_items.menu_id
+	LEFT JOIN pages ON menu_items.type = 'page' AND CAST(pages.id AS CHAR) = menu_items.target AND pages.site_id = menus.site_id
+	LEFT JOIN posts ON menu_items.type = 'post' AND CAST(posts.id AS CHAR) = menu_items.target AND posts.site_id = menus.site_id
+	WHERE menus.site_id = ?;`
+	rows, err := db.Connection.Query(query, db.siteId())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[int][]common.MenuItem)
+	for rows.Next() {
+		var item common.MenuItem
+		var menu_id int
+		var page_link, page_title, post_title sql.NullString
+		err = rows.Scan(&item.Id, &menu_id, &item.ParentId, &item.Position,
+			&item.Type, &item.Target, &item.Label, &item.Title, &item.Visible,
+			&page_link, &page_title, &post_title)
+		if err != nil {
+			return nil, err
+		}
+
+		page_path := ""
+		if page_link.Valid {
+			page_path = page_paths[item.Target]
+		}
+		item.Href = common.MenuItemHref(item.Type, item.Target, page_path)
+		item.Text = item.Label
+		switch item.Type {
+		case common.MENU_ITEM_PAGE:
+			if item.Text == "" {
+				item.Text = page_title.String
+			}
+		case common.MENU_ITEM_POST:
+			if !post_title.Valid {
+				item.Href = ""
+			}
+			if item.Text == "" {
+				item.Text = post_title.String
+			}
+		}
+		if item.Text == "" {
+			item.Text = item.Target
+		}
+		items[menu_id] = append(items[menu_id], item)
+	}
+	return items, rows.Err()
+}
+
+// GetMenu gets a menu of the site by id.
+func (db *SqlDatabase) GetMenu(id int) (common.Menu, error) {
+	menus, err := db.GetMenus()
+	if err != nil {
+		return common.Menu{}, err
+	}
+	for _, menu := range menus {
+		if menu.Id == id {
+			return menu, nil
+		}
+	}
+	return common.Menu{}, fmt.Errorf("menu %d not found", id)
+}
+
+// Menus take the location from the other menus of the site
+func (db *SqlDatabase) clearMenuLocation(tx *sql.Tx, location string) error {
+	if location == "" {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE menus SET location = '' WHERE site_id = ? AND location = ?;", db.siteId(), location)
+	return err
+}
+
+func (db *SqlDatabase) AddMenu(name string, location string) (int, error) {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	if err = db.clearMenuLocation(tx, location); err != nil {
+		return -1, err
+	}
+	res, err := tx.Exec("INSERT INTO menus(site_id, name, location) VALUES(?, ?, ?);", db.siteId(), name, location)
+	if err != nil {
+		return -1, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+func (db *SqlDatabase) ChangeMenu(id int, name string, location string) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = db.checkMenu(tx, id); err != nil {
+		return err
+	}
+	if err = db.clearMenuLocation(tx, location); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("UPDATE menus SET name = ?, location = ? WHERE id = ? AND site_id = ?;", name, location, id, db.siteId()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *SqlDatabase) DeleteMenu(id int) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = db.checkMenu(tx, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM menu_items WHERE menu_id = ?;", id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM menus WHERE id = ? AND site_id = ?;", id, db.siteId()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Fails unless the menu belongs to the site
+func (db *SqlDatabase) checkMenu(tx *sql.Tx, id int) error {
+	count := 0
+	err := tx.QueryRow("SELECT COUNT(*) FROM menus WHERE id = ? AND site_id = ?;", id, db.siteId()).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("menu %d not found", id)
+	}
+	return nil
+}
+
+// Parent of every item of the menu, by item id
+func (db *SqlDatabase) menuItemParents(tx *sql.Tx, menu_id int) (map[int]int, error) {
+	rows, err := tx.Query("SELECT id, parent_id FROM menu_items WHERE menu_id = ?;", menu_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := make(map[int]int)
+	for rows.Next() {
+		var id, parent_id int
+		if err = rows.Scan(&id, &parent_id); err != nil {
+			return nil, err
+		}
+		parents[id] = parent_id
+	}
+	return parents, rows.Err()
+}
+
+// AddMenuItem adds the item after the other
+// children of its parent.
+func (db *SqlDatabase) AddMenuItem(menu_id int, item common.MenuItem) (int, error) {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return -1, err
+	}
+	defer tx.Rollback()
+
+	if err = db.checkMenu(tx, menu_id); err != nil {
+		return -1, err
+	}
+	parents, err := db.menuItemParents(tx, menu_id)
+	if err != nil {
+		return -1, err
+	}
+	if _, exists := parents[item.ParentId]; item.ParentId != 0 && !exists {
+		return -1, fmt.Errorf("parent item %d is not in menu %d", item.ParentId, menu_id)
+	}
+
+	position := 0
+	err = tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM menu_items WHERE menu_id = ? AND parent_id = ?;", menu_id, item.ParentId).Scan(&position)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO menu_items(menu_id, parent_id, position, type, target, label, title, visible) VALUES(?, ?, ?, ?, ?, ?, ?, ?);",
+		menu_id, item.ParentId, position, item.Type, item.Target, item.Label, item.Title, item.Visible)
+	if err != nil {
+		return -1, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// Menu of the item, failing unless it belongs to the site
+func (db *SqlDatabase) menuItemMenu(tx *sql.Tx, id int) (int, error) {
+	menu_id := 0
+	err := tx.QueryRow(
+		"SELECT menu_items.menu_id FROM menu_items JOIN menus ON menus.id = menu_items.menu_id WHERE menu_items.id = ? AND menus.site_id = ?;",
+		id, db.siteId()).Scan(&menu_id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("menu item %d not found", id)
+	}
+	return menu_id, err
+}
+
+// ChangeMenuItem changes what the item links to and how
+// it's shown, it's moved with MoveMenuItems.
+func (db *SqlDatabase) ChangeMenuItem(item common.MenuItem) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = db.menuItemMenu(tx, item.Id); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE menu_items SET type = ?, target = ?, label = ?, title = ?, visible = ? WHERE id = ?;",
+		item.Type, item.Target, item.Label, item.Title, item.Visible, item.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteMenuItem deletes the item with its children.
+func (db *SqlDatabase) DeleteMenuItem(id int) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	menu_id, err := db.menuItemMenu(tx, id)
+	if err != nil {
+		return err
+	}
+	parents, err := db.menuItemParents(tx, menu_id)
+	if err != nil {
+		return err
+	}
+
+	deleted := []int{id}
+	for i := 0; i < len(deleted); i++ {
+		for item_id, parent_id := range parents {
+			if parent_id == deleted[i] {
+				deleted = append(deleted, item_id)
+			}
+		}
+	}
+	for _, item_id := range deleted {
+		if _, err = tx.Exec("DELETE FROM menu_items WHERE id = ?;", item_id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MoveMenuItems sets the parent and position of the given
+// items of the menu, all of them or none.
+func (db *SqlDatabase) MoveMenuItems(menu_id int, items []common.MenuItem) error {
+	tx, err := db.Connection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = db.checkMenu(tx, menu_id); err != nil {
+		return err
+	}
+	parents, err := db.menuItemParents(tx, menu_id)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if _, exists := parents[item.Id]; !exists {
+			return fmt.Errorf("item %d is not in menu %d", item.Id, menu_id)
+		}
+		if _, exists := parents[item.ParentId]; item.ParentId != 0 && !exists {
+			return fmt.Errorf("parent item %d is not in menu %d", item.ParentId, menu_id)
+		}
+		parents[item.Id] = item.ParentId
+	}
+	// An item can't end up under one of its children
+	for id := range parents {
+		seen := map[int]bool{id: true}
+		for parent_id := parents[id]; parent_id != 0; parent_id = parents[parent_id] {
+			if seen[parent_id] {
+				return fmt.Errorf("item %d would be nested in itself", id)
+			}
+			seen[parent_id] = true
+		}
+	}
+
+	for _, item := range items {
+		_, err = tx.Exec("UPDATE menu_items SET parent_id = ?, position = ? WHERE id = ?;", item.ParentId, item.Position, item.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/ncruces/go-sqlite3"
+	"github.com/ncruces/go-sqlite3/driver"
+	"github.com/rbc33/gocms/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var test_tables = []string{
+	`CREATE TABLE posts (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, excerpt TEXT,
+		content TEXT, site_id INTEGER NOT NULL DEFAULT 1);`,
+	`CREATE TABLE card_schemas (uuid BLOB PRIMARY KEY, json_id TEXT, json_schema TEXT, json_title TEXT,
+		site_id INTEGER NOT NULL DEFAULT 1, version INTEGER NOT NULL DEFAULT 1);`,
+	`CREATE TABLE card_schema_versions (id INTEGER PRIMARY KEY AUTOINCREMENT, schema_uuid BLOB, version INTEGER,
+		json_schema TEXT, created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP, UNIQUE (schema_uuid, version));`,
+	`CREATE TABLE cards (uuid BLOB PRIMARY KEY, image_location TEXT, json_data TEXT, json_schema TEXT,
+		site_id INTEGER NOT NULL DEFAULT 1, schema_uuid BLOB, position INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP, updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		schema_version INTEGER NOT NULL DEFAULT 1);`,
+	`CREATE TABLE pages (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, content TEXT, link TEXT, blocks TEXT,
+		site_id INTEGER NOT NULL DEFAULT 1, parent_id INTEGER NOT NULL DEFAULT 0, position INTEGER NOT NULL DEFAULT 0,
+		UNIQUE (site_id, parent_id, link));`,
+	`CREATE TABLE page_redirects (id INTEGER PRIMARY KEY AUTOINCREMENT, site_id INTEGER NOT NULL DEFAULT 1,
+		link TEXT, page_id INTEGER, UNIQUE (site_id, link));`,
+}
+
+// SQLite versions of the MySQL functions the card
+// queries store their UUIDs with
+func registerUuidFunctions(connection *sqlite3.Conn) error {
+	err := connection.CreateFunction("UuidToBin", 1, sqlite3.DETERMINISTIC, func(ctx sqlite3.Context, arg ...sqlite3.Value) {
+		id, err := uuid.Parse(arg[0].Text())
+		if err != nil {
+			ctx.ResultError(err)
+			return
+		}
+		ctx.ResultBlob(id[:])
+	})
+	if err != nil {
+		return err
+	}
+	return connection.CreateFunction("UuidFromBin", 1, sqlite3.DETERMINISTIC, func(ctx sqlite3.Context, arg ...sqlite3.Value) {
+		id, err := uuid.FromBytes(arg[0].RawBlob())
+		if err != nil {
+			ctx.ResultError(err)
+			return
+		}
+		ctx.ResultText(id.String())
+	})
+}
+
+func makeTestDatabase(t *testing.T) SqlDatabase {
+	connection, err := driver.Open(filepath.Join(t.TempDir(), "gocms.db"), registerUuidFunctions)
+	require.Nil(t, err)
+	t.Cleanup(func() { connection.Close() })
+
+	for _, statement := range test_tables {
+		_, err = connection.Exec(statement)
+		require.Nil(t, err)
+	}
+	return SqlDatabase{Driver: DRIVER_SQLITE, Connection: connection}
+}
+
+const product_schema = `{"type": "object", "required": ["title"], "properties": {"title": {"type": "string"}}}`
+
+const renamed_schema = `{"type": "object", "required": ["name", "price"],
+	"properties": {"name": {"type": "string"}, "price": {"type": "number"}}}`
+
+func addProducts(t *testing.T, db SqlDatabase) (string, []string) {
+	schema_uuid, err := db.AddCardSchema(product_schema, "Product")
+	require.Nil(t, err)
+
+	ids := []string{}
+	for _, content := range []string{`{"title": "Shoe", "price": 10}`, `{"title": "Hat"}`} {
+		id, err := db.AddCard("", schema_uuid, content)
+		require.Nil(t, err)
+		ids = append(ids, id)
+	}
+	return schema_uuid, ids
+}
+
+func TestChangeCardSchemaMigratesCards(t *testing.T) {
+	db := makeTestDatabase(t)
+	schema_uuid, ids := addProducts(t, db)
+
+	transform := []common.PatchOperation{
+		{Op: common.PATCH_MOVE, From: "/title", Path: "/name"},
+		{Op: common.PATCH_ADD, Path: "/price", Value: []byte("0")},
+	}
+	version, err := db.ChangeCardSchema(schema_uuid, renamed_schema, transform)
+	require.Nil(t, err)
+	assert.Equal(t, 2, version)
+
+	schema, err := db.GetCardSchema(schema_uuid)
+	require.Nil(t, err)
+	assert.Equal(t, 2, schema.Version)
+	assert.Equal(t, renamed_schema, schema.Schema)
+
+	versions, err := db.GetCardSchemaVersions(schema_uuid)
+	require.Nil(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, product_schema, versions[0].Schema)
+	assert.Equal(t, renamed_schema, versions[1].Schema)
+
+	for i, expected := range []string{`{"name": "Shoe", "price": 0}`, `{"name": "Hat", "price": 0}`} {
+		card, err := db.GetCard(ids[i])
+		require.Nil(t, err)
+		assert.JSONEq(t, expected, card.Content)
+		assert.Equal(t, 2, card.SchemaVersion)
+	}
+
+	// New cards are written with the new version
+	id, err := db.AddCard("", schema_uuid, `{"name": "Sock", "price": 2}`)
+	require.Nil(t, err)
+	card, err := db.GetCard(id)
+	require.Nil(t, err)
+	assert.Equal(t, 2, card.SchemaVersion)
+}
+
+func TestChangeCardSchemaKeepsCardsOnFailure(t *testing.T) {
+	db := makeTestDatabase(t)
+	schema_uuid, ids := addProducts(t, db)
+
+	// The hat has no price
+	transform := []common.PatchOperation{{Op: common.PATCH_MOVE, From: "/title", Path: "/name"}}
+	failures, err := db.CheckCardSchema(schema_uuid, renamed_schema, transform)
+	require.Nil(t, err)
+	require.Len(t, failures, 1)
+	assert.Equal(t, ids[1], failures[0].CardId)
+	assert.Contains(t, failures[0].Error, "price")
+
+	_, err = db.ChangeCardSchema(schema_uuid, renamed_schema, transform)
+	assert.ErrorContains(t, err, ids[1])
+
+	// Nothing is written, neither by the check nor the change
+	schema, err := db.GetCardSchema(schema_uuid)
+	require.Nil(t, err)
+	assert.Equal(t, 1, schema.Version)
+	versions, err := db.GetCardSchemaVersions(schema_uuid)
+	require.Nil(t, err)
+	assert.Len(t, versions, 1)
+	card, err := db.GetCard(ids[0])
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"title": "Shoe", "price": 10}`, card.Content)
+	assert.Equal(t, 1, card.SchemaVersion)
+
+	// A transform that can't be applied fails the card too
+	failures, err = db.CheckCardSchema(schema_uuid, renamed_schema, []common.PatchOperation{{Op: common.PATCH_REMOVE, Path: "/price"}})
+	require.Nil(t, err)
+	require.Len(t, failures, 2)
+	assert.Contains(t, failures[1].Error, "patch operation 0")
+}
+
+func TestChangeCardSchemaWithoutTransform(t *testing.T) {
+	db := makeTestDatabase(t)
+	schema_uuid, ids := addProducts(t, db)
+
+	// The cards keep the version they were written with
+	version, err := db.ChangeCardSchema(schema_uuid, renamed_schema, nil)
+	require.Nil(t, err)
+	assert.Equal(t, 2, version)
+
+	card, err := db.GetCard(ids[1])
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"title": "Hat"}`, card.Content)
+	assert.Equal(t, 1, card.SchemaVersion)
+
+	// and are still validated against it
+	assert.Nil(t, db.ChangeCard(ids[1], nil, `{"title": "Cap"}`))
+	assert.NotNil(t, db.ChangeCard(ids[1], nil, `{"name": "Cap", "price": 1}`))
+}
+
+func TestChangeCardSchemaOfOtherSite(t *testing.T) {
+	db := makeTestDatabase(t)
+	schema_uuid, _ := addProducts(t, db)
+
+	other_site := db.ForSite(2)
+	_, err := other_site.ChangeCardSchema(schema_uuid, renamed_schema, nil)
+	assert.ErrorContains(t, err, "not found")
+	_, err = other_site.CheckCardSchema(schema_uuid, renamed_schema, nil)
+	assert.ErrorContains(t, err, "not found")
+
+	schema, err := db.GetCardSchema(schema_uuid)
+	require.Nil(t, err)
+	assert.Equal(t, 1, schema.Version)
+}
+
+func TestAddCardAfterDeletedCard(t *testing.T) {
+	db := makeTestDatabase(t)
+	schema_uuid, ids := addProducts(t, db)
+
+	// Counting the cards would give the hat's position again
+	require.Nil(t, db.DeleteCard(ids[0]))
+	id, err := db.AddCard("", schema_uuid, `{"title": "Sock"}`)
+	require.Nil(t, err)
+
+	cards, total, err := db.GetCards(schema_uuid, common.CardQuery{})
+	require.Nil(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, cards, 2)
+	assert.Equal(t, []string{ids[1], id}, []string{cards[0].Id, cards[1].Id})
+	assert.Equal(t, []int{1, 2}, []int{cards[0].Position, cards[1].Position})
+
+	_, err = db.ForSite(2).AddCard("", schema_uuid, `{"title": "Sock"}`)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestGetPostsContent(t *testing.T) {
+	db := makeTestDatabase(t)
+	var err error
+	for _, title := range []string{"First", "Second", "Third"} {
+		_, err = db.AddPost(title, "excerpt", "# "+title)
+		require.Nil(t, err)
+	}
+	_, err = db.ForSite(2).AddPost("Other", "excerpt", "# Other")
+	require.Nil(t, err)
+
+	posts, err := db.GetPostsContent(0, 0)
+	require.Nil(t, err)
+	require.Len(t, posts, 3)
+	assert.Equal(t, common.Post{Id: 1, Title: "First", Excerpt: "excerpt", Content: "# First"}, posts[0])
+
+	// Same order of the arguments as GetPosts
+	posts, err = db.GetPostsContent(2, 1)
+	require.Nil(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "# Second", posts[0].Content)
+	posts, err = db.GetPosts(2, 1)
+	require.Nil(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "Second", posts[0].Title)
+
+	// The listed posts still come without their content
+	posts, err = db.GetPosts(0, 0)
+	require.Nil(t, err)
+	require.Len(t, posts, 3)
+	assert.Empty(t, posts[0].Content)
+}
+
+func TestPageLinksUnderEachParent(t *testing.T) {
+	db := makeTestDatabase(t)
+	docs, err := db.AddPage("Docs", "docs", "docs", nil, 0)
+	require.Nil(t, err)
+	child, err := db.AddPage("Install docs", "docs install", "install", nil, docs)
+	require.Nil(t, err)
+	top, err := db.AddPage("Install", "install", "install", nil, 0)
+	require.Nil(t, err)
+
+	_, err = db.AddPage("Install again", "again", "install", nil, docs)
+	assert.NotNil(t, err)
+
+	// The top level page is found by its link
+	page, err := db.GetPage("install")
+	require.Nil(t, err)
+	assert.Equal(t, top, page.Id)
+
+	page, err = db.GetPageById(child)
+	require.Nil(t, err)
+	assert.Equal(t, common.Page{Id: child, Title: "Install docs", Content: "docs install", Link: "install", ParentId: docs}, page)
+
+	tree, err := db.GetPageTree()
+	require.Nil(t, err)
+	found, exists := common.PageAtPath(tree, "docs/install")
+	assert.True(t, exists)
+	assert.Equal(t, child, found.Id)
+
+	_, err = db.ForSite(2).GetPageById(child)
+	assert.NotNil(t, err)
+}
@@ -15,7 +15,7 @@ func MakeSqlConnection(appSettings common.AppSettings) (database SqlDatabase, er
 	// 	return SqlDatabase{}, err
 	// }
 	connection_str := appSettings.DatabaseUri
-	db, err := sql.Open("mysql", connection_str)
+	db, err := sql.Open(DRIVER_MYSQL, connection_str)
 	if err != nil {
 		return SqlDatabase{}, err
 	}
@@ -28,6 +28,7 @@ func MakeSqlConnection(appSettings common.AppSettings) (database SqlDatabase, er
 
 	return SqlDatabase{
 		MY_SQL_URL: connection_str,
+		Driver:     DRIVER_MYSQL,
 		Connection: db,
 	}, nil
 }
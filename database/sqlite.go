@@ -11,7 +11,7 @@ import (
 func MakeSqliteConnection(databaseFile string) (SqlDatabase, error) {
 
 	/// TODO : let user specify the DB
-	db, err := sql.Open("sqlite3", databaseFile)
+	db, err := sql.Open(DRIVER_SQLITE, databaseFile)
 	if err != nil {
 		return SqlDatabase{}, err
 	}
@@ -26,6 +26,7 @@ func MakeSqliteConnection(databaseFile string) (SqlDatabase, error) {
 
 	return SqlDatabase{
 		MY_SQL_URL: "",
+		Driver:     DRIVER_SQLITE,
 		Connection: db,
 	}, nil
 }
@@ -21,6 +21,88 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/backup": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns a zip archive with a JSON-lines dump of the content of the site, the media files, the galleries and a manifest with checksums. The user accounts and the other sites are left out. Restore it with ` + "`" + `gocms-admin restore` + "`" + `.",
+                "produces": [
+                    "application/zip"
+                ],
+                "tags": [
+                    "backup"
+                ],
+                "summary": "Download a site backup",
+                "responses": {
+                    "200": {
+                        "description": "Backup archive",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "500": {
+                        "description": "The backup could not be created",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/cache/purge": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Purges cached pages in the app by tag, by path or all of them.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cache"
+                ],
+                "summary": "Purge the app cache",
+                "parameters": [
+                    {
+                        "description": "Tags and paths to purge",
+                        "name": "purge",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/common.CacheInvalidationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/common.CacheInvalidationRequest"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "The app could not be reached",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/card-schemas": {
             "get": {
                 "security": [
@@ -207,6 +289,154 @@ const docTemplate = `{
                         }
                     }
                 }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Stores the schema as a new version. Cards are validated against the version they\nwere written with, unless a transform is given: it's applied to every card and the\ncards move to the new version. Nothing changes if one of them fails.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "card_schema"
+                ],
+                "summary": "Update a card schema",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New schema and card transform",
+                        "name": "schema",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.ChangeCardSchemaRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.CardSchemaVersionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid schema or cards that can't be migrated",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/card-schemas/{id}/check": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Dry run of a schema update with a transform, lists the cards that would fail the new schema.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "card_schema"
+                ],
+                "summary": "Check a card schema change",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New schema and card transform",
+                        "name": "schema",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.ChangeCardSchemaRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.CheckCardSchemaResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid schema",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/card-schemas/{id}/versions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists every version of the card schema, the first one first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "card_schema"
+                ],
+                "summary": "Get the versions of a card schema",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetSchemaVersionsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid schema ID",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
             }
         },
         "/cards": {
@@ -365,13 +595,37 @@ const docTemplate = `{
                         "name": "schema",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Cards per page",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Top level field of the card data to sort by",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Sort in descending order",
+                        "name": "desc",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.GetCardRequest"
+                            "$ref": "#/definitions/admin_app.GetCardsResponse"
                         }
                     },
                     "400": {
@@ -435,6 +689,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     },
+                    "422": {
+                        "description": "A plugin refused the image",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PluginErrorsResponse"
+                        }
+                    },
                     "500": {
                         "description": "Server error while saving file",
                         "schema": {
@@ -483,43 +743,58 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
+                    },
+                    "404": {
+                        "description": "Image not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
                     }
                 }
             }
         },
-        "/login": {
+        "/import": {
             "post": {
-                "description": "Authenticates user and returns a JWT token.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Imports posts and pages from a WordPress WXR export or a zip archive of markdown files with YAML or TOML front-matter. Referenced images are stored in the media directory and old post URLs become permalinks.",
                 "consumes": [
-                    "application/json"
+                    "multipart/form-data"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "import"
                 ],
-                "summary": "Login user",
+                "summary": "Import content",
                 "parameters": [
                     {
-                        "description": "User credentials",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/auth.LoginInput"
-                        }
+                        "type": "file",
+                        "description": "WXR (.xml) file or zip archive with markdown files",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep the original image references",
+                        "name": "skip_images",
+                        "in": "formData"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/auth.TokenResponse"
+                            "$ref": "#/definitions/admin_app.ImportResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid file",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -527,56 +802,78 @@ const docTemplate = `{
                 }
             }
         },
-        "/pages": {
-            "get": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "Retrieves a paginated list of pages.",
-                "consumes": [
-                    "application/json"
+        "/login": {
+            "post": {
+                "description": "Authenticates user and returns a JWT token.",
+                "consumes": [
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "pages"
+                    "auth"
                 ],
-                "summary": "Get a list of pages",
+                "summary": "Login user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "default": 0,
-                        "description": "Pagination offset",
-                        "name": "offset",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "default": 0,
-                        "description": "Pagination limit (0 means no limit)",
-                        "name": "limit",
-                        "in": "query"
+                        "description": "User credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.LoginInput"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "List of pages",
+                        "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/auth.TokenResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid offset or limit parameter",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
+                    }
+                }
+            }
+        },
+        "/menus": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the menus of the site with their items nested, including the hidden ones.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "menus"
+                ],
+                "summary": "Get the menus",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Site ID, the host is used without it",
+                        "name": "X-GoCMS-Site",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetMenusResponse"
+                        }
                     },
                     "500": {
-                        "description": "Server error",
+                        "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -589,7 +886,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Updates an existing page with new data.",
+                "description": "Renames the menu or moves it to another location.",
                 "consumes": [
                     "application/json"
                 ],
@@ -597,17 +894,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "pages"
+                    "menus"
                 ],
-                "summary": "Update an existing page",
+                "summary": "Change a menu",
                 "parameters": [
                     {
-                        "description": "Page data to update",
-                        "name": "post",
+                        "description": "New menu data",
+                        "name": "menu",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/admin_app.ChangePageRequest"
+                            "$ref": "#/definitions/admin_app.ChangeMenuRequest"
                         }
                     }
                 ],
@@ -615,11 +912,11 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                            "$ref": "#/definitions/admin_app.MenuResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body or could not change page",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -632,7 +929,7 @@ const docTemplate = `{
                         "BearerAuth": []
                     }
                 ],
-                "description": "Adds a new page to the database.",
+                "description": "Creates an empty menu, placed in the header or footer when a location is given.",
                 "consumes": [
                     "application/json"
                 ],
@@ -640,29 +937,29 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "pages"
+                    "menus"
                 ],
-                "summary": "Add a new page",
+                "summary": "Add a menu",
                 "parameters": [
                     {
-                        "description": "Page to add",
-                        "name": "page",
+                        "description": "Menu to add",
+                        "name": "menu",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/admin_app.AddPageRequest"
+                            "$ref": "#/definitions/admin_app.AddMenuRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.PageResponse"
+                            "$ref": "#/definitions/admin_app.MenuResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body or data",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -670,26 +967,26 @@ const docTemplate = `{
                 }
             }
         },
-        "/pages/{link}": {
-            "delete": {
+        "/menus/{id}": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Deletes a page by its Link.",
+                "description": "Gets a menu of the site with its items nested.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "pages"
+                    "menus"
                 ],
-                "summary": "Delete a page",
+                "summary": "Get a menu",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Page Link",
-                        "name": "link",
+                        "type": "integer",
+                        "description": "Menu ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -698,54 +995,42 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.DeletePageRequest"
+                            "$ref": "#/definitions/common.Menu"
                         }
                     },
                     "400": {
-                        "description": "Invalid link provided",
+                        "description": "Invalid menu ID",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "Page not found",
+                        "description": "Menu not found",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/permalinks/{permalink}/{post_id}": {
-            "post": {
+            },
+            "delete": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Adds a new permalink to the database.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Deletes the menu with all its items.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "permalink"
+                    "menus"
                 ],
-                "summary": "Add a new permalink",
+                "summary": "Delete a menu",
                 "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Permalink",
-                        "name": "permalink",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "type": "integer",
-                        "description": "Post ID",
-                        "name": "post_id",
+                        "description": "Menu ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -754,11 +1039,11 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.PermalinkIdResponse"
+                            "$ref": "#/definitions/admin_app.MenuResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body or missing data",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -766,14 +1051,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/post": {
+        "/menus/{id}/items": {
             "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Adds a new post to the database.",
+                "description": "Adds an item after the other children of its parent. Page and post items keep linking to the content when its link changes.",
                 "consumes": [
                     "application/json"
                 ],
@@ -781,17 +1066,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "menus"
                 ],
-                "summary": "Add a new post",
+                "summary": "Add a menu item",
                 "parameters": [
                     {
-                        "description": "Post to add",
-                        "name": "post",
+                        "type": "integer",
+                        "description": "Menu ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Item to add",
+                        "name": "item",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/admin_app.AddPostRequest"
+                            "$ref": "#/definitions/admin_app.MenuItemRequest"
                         }
                     }
                 ],
@@ -799,11 +1091,11 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                            "$ref": "#/definitions/admin_app.MenuResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body or missing data",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -811,123 +1103,143 @@ const docTemplate = `{
                 }
             }
         },
-        "/posts": {
-            "get": {
+        "/menus/{id}/items/{item_id}": {
+            "put": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieves a paginated list of posts.",
+                "description": "Changes what the item links to and how it's shown.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "menus"
                 ],
-                "summary": "Get a list of posts",
+                "summary": "Change a menu item",
                 "parameters": [
                     {
                         "type": "integer",
-                        "default": 0,
-                        "description": "Offset for pagination",
-                        "name": "offset",
-                        "in": "query"
+                        "description": "Menu ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     },
                     {
                         "type": "integer",
-                        "default": 0,
-                        "description": "Limit for pagination. 0 means no limit.",
-                        "name": "limit",
-                        "in": "query"
+                        "description": "Item ID",
+                        "name": "item_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New item data",
+                        "name": "item",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.MenuItemRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.GetPostsResponse"
+                            "$ref": "#/definitions/admin_app.MenuResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid offset or limit parameter",
-                        "schema": {
-                            "$ref": "#/definitions/common.ErrorResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     }
                 }
             },
-            "put": {
+            "delete": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Updates an existing post with new data.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Deletes the item with its children.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "menus"
                 ],
-                "summary": "Update an existing post",
+                "summary": "Delete a menu item",
                 "parameters": [
                     {
-                        "description": "Post data to update",
-                        "name": "post",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/admin_app.ChangePostRequest"
-                        }
+                        "type": "integer",
+                        "description": "Menu ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Item ID",
+                        "name": "item_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                            "$ref": "#/definitions/admin_app.MenuResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body or could not change post",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/menus/{id}/order": {
+            "put": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Deletes a post by its ID.",
+                "description": "Sets the parent and position of the dragged items, all of them or none. Items can't be nested under their own children.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "menus"
                 ],
-                "summary": "Delete a post",
+                "summary": "Reorder menu items",
                 "parameters": [
                     {
-                        "description": "Post ID to delete",
+                        "type": "integer",
+                        "description": "Menu ID",
                         "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New parents and positions",
+                        "name": "order",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/admin_app.DeletePostRequest"
+                            "$ref": "#/definitions/admin_app.MoveMenuItemsRequest"
                         }
                     }
                 ],
@@ -935,17 +1247,11 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                            "$ref": "#/definitions/common.Menu"
                         }
                     },
                     "400": {
-                        "description": "Invalid ID provided",
-                        "schema": {
-                            "$ref": "#/definitions/common.ErrorResponse"
-                        }
-                    },
-                    "404": {
-                        "description": "Post not found",
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
@@ -953,55 +1259,69 @@ const docTemplate = `{
                 }
             }
         },
-        "/posts/{id}": {
+        "/pages": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieves a single post by its ID.",
+                "description": "Retrieves a paginated list of pages.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "posts"
+                    "pages"
                 ],
-                "summary": "Get a single post",
+                "summary": "Get a list of pages",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Post ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "default": 0,
+                        "description": "Pagination offset",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Pagination limit (0 means no limit)",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "List of pages",
                         "schema": {
-                            "$ref": "#/definitions/admin_app.GetPostResponse"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     },
                     "400": {
-                        "description": "Invalid post ID",
+                        "description": "Invalid offset or limit parameter",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Post not found",
+                    "500": {
+                        "description": "Server error",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
                     }
                 }
-            }
-        },
-        "/register": {
-            "post": {
-                "description": "Adds a new User to the database.",
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates an existing page with new data.",
                 "consumes": [
                     "application/json"
                 ],
@@ -1009,130 +1329,2139 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "pages"
                 ],
-                "summary": "Create new User",
+                "summary": "Update an existing page",
                 "parameters": [
                     {
-                        "description": "User to create",
+                        "description": "Page data to update",
                         "name": "post",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/auth.RegisterInput"
+                            "$ref": "#/definitions/admin_app.ChangePageRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/auth.RegisterResponse"
+                            "$ref": "#/definitions/admin_app.PostIdResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid request body or could not change page",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
+                    },
+                    "422": {
+                        "description": "A plugin refused the page",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PluginErrorsResponse"
+                        }
                     }
                 }
-            }
-        },
-        "/user": {
-            "get": {
+            },
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Returns the currently authenticated user based on JWT token.",
+                "description": "Adds a new page to the database.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "pages"
+                ],
+                "summary": "Add a new page",
+                "parameters": [
+                    {
+                        "description": "Page to add",
+                        "name": "page",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.AddPageRequest"
+                        }
+                    }
                 ],
-                "summary": "Get current user",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/common.User"
+                            "$ref": "#/definitions/admin_app.PageResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid request body or data",
                         "schema": {
                             "$ref": "#/definitions/common.ErrorResponse"
                         }
+                    },
+                    "422": {
+                        "description": "A plugin refused the page",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PluginErrorsResponse"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "admin_app.AddCardRequest": {
-            "type": "object",
-            "properties": {
-                "data": {
-                    "description": "Content data of the card\nin: body",
-                    "type": "string"
-                },
-                "image_location": {
-                    "description": "Image location URL\nin: body",
-                    "type": "string"
-                },
-                "schema": {
-                    "description": "Schema name\nin: body",
-                    "type": "string"
-                }
-            }
         },
-        "admin_app.AddCardSchemaRequest": {
-            "type": "object",
-            "properties": {
-                "schema": {
-                    "description": "JSON schema string\nin: body\nrequired: true",
-                    "type": "string"
-                },
-                "title": {
-                    "description": "Title of the card schema\nin: body\nrequired: true",
-                    "type": "string"
+        "/pages/order": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Sets the parent and position of the moved pages, all of them or none. Pages can't be nested under their own children. Old paths of the moved pages redirect to the new ones.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pages"
+                ],
+                "summary": "Reorder pages",
+                "parameters": [
+                    {
+                        "description": "New parents and positions",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.MovePagesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetPagesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
                 }
             }
         },
-        "admin_app.AddPageRequest": {
-            "type": "object",
-            "properties": {
-                "content": {
-                    "description": "Content of the page\nin: body",
-                    "type": "string"
-                },
-                "link": {
-                    "description": "Link of the page\nin: body",
-                    "type": "string"
-                },
-                "title": {
-                    "description": "Title of the page\nin: body\nrequired: true",
-                    "type": "string"
+        "/pages/{link}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a page by its Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pages"
+                ],
+                "summary": "Delete a page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Page Link",
+                        "name": "link",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.DeletePageRequest"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid link provided",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Page not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
                 }
             }
         },
-        "admin_app.AddPostRequest": {
-            "type": "object",
-            "properties": {
-                "content": {
-                    "description": "Content of the post\nin: body",
-                    "type": "string"
-                },
-                "excerpt": {
-                    "description": "Excerpt of the post\nin: body",
-                    "type": "string"
-                },
-                "title": {
-                    "description": "Title of the post\nin: body\nrequired: true",
-                    "type": "string"
+        "/permalinks/{permalink}/{post_id}": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds a new permalink to the database.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "permalink"
+                ],
+                "summary": "Add a new permalink",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Permalink",
+                        "name": "permalink",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "post_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PermalinkIdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or missing data",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/post": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Adds a new post to the database.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Add a new post",
+                "parameters": [
+                    {
+                        "description": "Post to add",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.AddPostRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or missing data",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "A plugin refused the post",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PluginErrorsResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieves a paginated list of posts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get a list of posts",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Offset for pagination",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Limit for pagination. 0 means no limit.",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetPostsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid offset or limit parameter",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Updates an existing post with new data.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Update an existing post",
+                "parameters": [
+                    {
+                        "description": "Post data to update",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.ChangePostRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or could not change post",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "A plugin refused the post",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PluginErrorsResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Deletes a post by its ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Delete a post",
+                "parameters": [
+                    {
+                        "description": "Post ID to delete",
+                        "name": "id",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.DeletePostRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PostIdResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID provided",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/posts/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieves a single post by its ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Get a single post",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetPostResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/preview": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Expands the shortcodes and renders the Markdown of the post, answering with the public post page.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Preview a post",
+                "parameters": [
+                    {
+                        "description": "Post to preview",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PreviewRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML post page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Shortcodes failed",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PluginErrorsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Could not render the page",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/previews": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Stores the draft of a post and answers with the path of its preview on the public site.\nThe link works for ` + "`" + `hours` + "`" + `, up to a week, without saving the post.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "posts"
+                ],
+                "summary": "Share a preview link",
+                "parameters": [
+                    {
+                        "description": "Draft to share",
+                        "name": "draft",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.AddPreviewRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.PreviewLinkResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Could not store the draft",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/register": {
+            "post": {
+                "description": "Adds a new User to the database.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Create new User",
+                "parameters": [
+                    {
+                        "description": "User to create",
+                        "name": "post",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.RegisterInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/auth.RegisterResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/settings": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the editable settings of the site, with the changes made from the admin-app.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Get the site settings",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Site ID, the host is used without it",
+                        "name": "X-GoCMS-Site",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.SettingsResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Stores the given settings, which win over the config file. Every value is validated against its schema and nothing is stored if one is invalid.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Change the site settings",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Site ID, the host is used without it",
+                        "name": "X-GoCMS-Site",
+                        "in": "header"
+                    },
+                    {
+                        "description": "New values by setting name",
+                        "name": "settings",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.SettingsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Unknown setting or invalid value",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/settings/schema": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the JSON schema of every editable setting.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Get the settings schema",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/settings/{name}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Drops the change made from the admin-app, the value of the config file is used again.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "settings"
+                ],
+                "summary": "Reset a site setting",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Site ID, the host is used without it",
+                        "name": "X-GoCMS-Site",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Setting name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.SettingsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Unknown setting",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/shortcodes": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the shortcodes of the config and the ones found in the content, with the posts,\npages and cards using each of them. Shortcodes are expanded when the content is shown.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "shortcodes"
+                ],
+                "summary": "Get the shortcode usage",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetShortcodesResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Could not read the content",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/sites": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lists the sites the current user can manage.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "site"
+                ],
+                "summary": "Get the sites of the user",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GetSitesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/sites/users": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Lets another user manage the site of the request.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "site"
+                ],
+                "summary": "Grant access to the site",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Site ID, the host is used without it",
+                        "name": "X-GoCMS-Site",
+                        "in": "header"
+                    },
+                    {
+                        "description": "User to grant access to",
+                        "name": "grant",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.GrantSiteRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin_app.SiteResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui": {
+            "get": {
+                "description": "Latest posts, pages and links to the editors.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Admin dashboard",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "303": {
+                        "description": "Redirect to the login page without a session",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/card-schemas": {
+            "get": {
+                "description": "Lists the card schemas with links to their cards.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Card schemas page",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/cards/{schema}": {
+            "get": {
+                "description": "Lists the cards of a schema with links to edit and delete them.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Cards page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds the card of the form, or changes the card of the ` + "`" + `id` + "`" + ` param. The card is checked against its schema\nand the form comes back with the errors, otherwise htmx is redirected to the card list.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Save a card form",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML form with the errors, or an ` + "`" + `HX-Redirect` + "`" + ` header",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema or card not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/cards/{schema}/form": {
+            "post": {
+                "description": "Renders the submitted card form again, adding the array item named by ` + "`" + `_add` + "`" + ` or removing the one named by ` + "`" + `_remove` + "`" + `.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Card form",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML form",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema or card not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/cards/{schema}/new": {
+            "get": {
+                "description": "Form made from the card schema, empty for new cards or with the values of the card being edited.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Card form page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema or card not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/cards/{schema}/{id}": {
+            "post": {
+                "description": "Adds the card of the form, or changes the card of the ` + "`" + `id` + "`" + ` param. The card is checked against its schema\nand the form comes back with the errors, otherwise htmx is redirected to the card list.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Save a card form",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Card UUID",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML form with the errors, or an ` + "`" + `HX-Redirect` + "`" + ` header",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema or card not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the card, htmx removes its row with the empty response.",
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Delete a card from the card list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Card UUID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Empty response",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema or card not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/cards/{schema}/{id}/edit": {
+            "get": {
+                "description": "Form made from the card schema, empty for new cards or with the values of the card being edited.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Card form page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Card schema UUID",
+                        "name": "schema",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Card UUID",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schema or card not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/images/data/{filepath}": {
+            "get": {
+                "description": "Image of the media directory shown in the admin pages.",
+                "produces": [
+                    "image/png",
+                    "image/jpeg",
+                    "image/webp"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Media file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filepath",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Image file",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "404": {
+                        "description": "Image not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/login": {
+            "get": {
+                "description": "Form to log in to the admin pages.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Login page",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Checks the credentials and starts a session kept in a cookie, then redirects to the dashboard.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Log in to the admin pages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Username",
+                        "name": "username",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Password",
+                        "name": "password",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "303": {
+                        "description": "Redirect to the dashboard",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "HTML login page with the error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/logout": {
+            "post": {
+                "description": "Removes the session cookie and redirects to the login page.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Log out of the admin pages",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "CSRF token of the session",
+                        "name": "_csrf",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "303": {
+                        "description": "Redirect to the login page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/media": {
+            "get": {
+                "description": "Images of the media directory with a form to upload more.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Media library page",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Saves the image like ` + "`" + `POST /images` + "`" + ` and answers with the media grid, showing the error of rejected uploads.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Upload an image to the media library",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "The image file to upload",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "A brief description of the image",
+                        "name": "excerpt",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML media grid",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/media/{name}": {
+            "delete": {
+                "description": "Deletes the image and its metadata, htmx removes it from the grid with the empty response.",
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Delete an image from the media library",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Empty response",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Image not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/pages": {
+            "get": {
+                "description": "Lists the pages with their paths and links to edit and delete them.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Pages page",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds the page of the editor, or changes the page of the ` + "`" + `link` + "`" + ` param keeping its blocks. Pages with\ninvalid data come back with the error, otherwise htmx is redirected to the page list.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Save a page editor",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Title",
+                        "name": "title",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "New link of the page",
+                        "name": "link",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Markdown content",
+                        "name": "content",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Parent of a new page",
+                        "name": "parent_id",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML editor with the error, or an ` + "`" + `HX-Redirect` + "`" + ` header",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Page not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/pages/new": {
+            "get": {
+                "description": "Editor of a new page, or of the page being edited, with the preview of its Markdown.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Page editor page",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Page not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/pages/{link}": {
+            "post": {
+                "description": "Adds the page of the editor, or changes the page of the ` + "`" + `link` + "`" + ` param keeping its blocks. Pages with\ninvalid data come back with the error, otherwise htmx is redirected to the page list.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Save a page editor",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Link of the page being edited",
+                        "name": "link",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Title",
+                        "name": "title",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "New link of the page",
+                        "name": "link",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Markdown content",
+                        "name": "content",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Parent of a new page",
+                        "name": "parent_id",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML editor with the error, or an ` + "`" + `HX-Redirect` + "`" + ` header",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Page not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the page, htmx removes its row with the empty response.",
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Delete a page from the page list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Page link",
+                        "name": "link",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Empty response",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Could not delete the page",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/pages/{link}/edit": {
+            "get": {
+                "description": "Editor of a new page, or of the page being edited, with the preview of its Markdown.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Page editor page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Page link",
+                        "name": "link",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Page not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/posts": {
+            "get": {
+                "description": "Lists the posts with links to edit and delete them.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Posts page",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, starting at 1",
+                        "name": "page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid page",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds the post of the editor, or changes the post of the ` + "`" + `id` + "`" + ` param. Posts missing data come back\nwith the error, otherwise htmx is redirected to the post list.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Save a post editor",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Title",
+                        "name": "title",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Excerpt",
+                        "name": "excerpt",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Markdown content",
+                        "name": "content",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML editor with the error, or an ` + "`" + `HX-Redirect` + "`" + ` header",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/posts/new": {
+            "get": {
+                "description": "Editor of a new post, or of the post being edited, with the preview of its Markdown.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Post editor page",
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/posts/{id}": {
+            "post": {
+                "description": "Adds the post of the editor, or changes the post of the ` + "`" + `id` + "`" + ` param. Posts missing data come back\nwith the error, otherwise htmx is redirected to the post list.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Save a post editor",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Title",
+                        "name": "title",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Excerpt",
+                        "name": "excerpt",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Markdown content",
+                        "name": "content",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML editor with the error, or an ` + "`" + `HX-Redirect` + "`" + ` header",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the post, htmx removes its row with the empty response.",
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Delete a post from the post list",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Empty response",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid post ID",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/posts/{id}/edit": {
+            "get": {
+                "description": "Editor of a new post, or of the post being edited, with the preview of its Markdown.",
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Post editor page",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Post ID",
+                        "name": "id",
+                        "in": "path"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Post not found",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ui/preview": {
+            "post": {
+                "description": "Renders the Markdown ` + "`" + `content` + "`" + ` the way the site renders posts, shortcodes included.",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "text/html"
+                ],
+                "tags": [
+                    "admin_ui"
+                ],
+                "summary": "Markdown preview",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Markdown content",
+                        "name": "content",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "HTML of the content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Invalid CSRF token",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/user": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns the currently authenticated user based on JWT token.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Get current user",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/common.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/common.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "admin_app.AddCardRequest": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "description": "Content data of the card\nin: body",
+                    "type": "string"
+                },
+                "image_location": {
+                    "description": "File name of the image in the media directory\nin: body",
+                    "type": "string"
+                },
+                "schema": {
+                    "description": "Schema name\nin: body",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.AddCardSchemaRequest": {
+            "type": "object",
+            "properties": {
+                "schema": {
+                    "description": "JSON schema string\nin: body\nrequired: true",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of the card schema\nin: body\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.AddMenuRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "location": {
+                    "description": "` + "`" + `header` + "`" + `, ` + "`" + `footer` + "`" + ` or empty to not show the menu,\nthe menu placed there before is unplaced\nin: body",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "in: body\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.AddPageRequest": {
+            "type": "object",
+            "properties": {
+                "blocks": {
+                    "description": "Blocks the page is built from, the page is\nrendered from the Markdown content without them\nin: body",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.Block"
+                    }
+                },
+                "content": {
+                    "description": "Content of the page\nin: body",
+                    "type": "string"
+                },
+                "link": {
+                    "description": "Link of the page\nin: body",
+                    "type": "string"
+                },
+                "parent_id": {
+                    "description": "Id of the parent page, the page is added\nat the top level without it\nin: body",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Title of the page\nin: body\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.AddPostRequest": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "Content of the post\nin: body",
+                    "type": "string"
+                },
+                "excerpt": {
+                    "description": "Excerpt of the post\nin: body",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of the post\nin: body\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.AddPreviewRequest": {
+            "type": "object",
+            "required": [
+                "content",
+                "title"
+            ],
+            "properties": {
+                "content": {
+                    "description": "Markdown content of the draft, shortcodes included\nin: body\nrequired: true",
+                    "type": "string"
+                },
+                "excerpt": {
+                    "description": "Excerpt of the draft\nin: body",
+                    "type": "string"
+                },
+                "hours": {
+                    "description": "Hours the link works for, 24 by default\nin: body",
+                    "type": "integer",
+                    "maximum": 168,
+                    "minimum": 0
+                },
+                "title": {
+                    "description": "Title of the draft\nin: body\nrequired: true",
+                    "type": "string"
                 }
             }
         },
@@ -1140,285 +3469,882 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "id": {
-                    "description": "ID of the card",
+                    "description": "ID of the card",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.CardSchemaVersionResponse": {
+            "type": "object",
+            "properties": {
+                "migrated": {
+                    "description": "Whether the cards were moved to the new version",
+                    "type": "boolean"
+                },
+                "uuid": {
+                    "description": "UUID of the card schema",
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Version created by the change",
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.ChangeCardRequest": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID of the card\nin: body",
+                    "type": "string"
+                },
+                "image_location": {
+                    "description": "File name of the image in the media directory,\nthe image is left as is when empty\nin: body",
+                    "type": "string"
+                },
+                "json_data": {
+                    "description": "JSON data of the card\nin: body",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.ChangeCardSchemaRequest": {
+            "type": "object",
+            "properties": {
+                "schema": {
+                    "description": "New JSON schema, stored as the next version\nin: body\nrequired: true",
+                    "type": "object"
+                },
+                "transform": {
+                    "description": "JSON patch applied to every card of the schema. When\ngiven, even empty, the cards move to the new version\nin: body",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.PatchOperation"
+                    }
+                }
+            }
+        },
+        "admin_app.ChangeMenuRequest": {
+            "type": "object",
+            "required": [
+                "id",
+                "name"
+            ],
+            "properties": {
+                "id": {
+                    "description": "in: body\nrequired: true",
+                    "type": "integer"
+                },
+                "location": {
+                    "description": "in: body",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "in: body\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.ChangePageRequest": {
+            "type": "object",
+            "properties": {
+                "blocks": {
+                    "description": "New blocks of the page, left unchanged when missing\nand removed when empty\nin: body",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.Block"
+                    }
+                },
+                "content": {
+                    "description": "Content of the page\nin: body",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID of the page\nin: body\nrequired: true",
+                    "type": "integer"
+                },
+                "link": {
+                    "description": "Link of the page\nin: body",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of the page\nin: body",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.ChangePostRequest": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "Content of the post\nin: body",
+                    "type": "string"
+                },
+                "excerpt": {
+                    "description": "Excerpt of the post\nin: body",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID of the post\nin: body\nrequired: true",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Title of the post\nin: body",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.CheckCardSchemaResponse": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "description": "Cards that would fail the new schema",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.CardFailure"
+                    }
+                }
+            }
+        },
+        "admin_app.DeletePageRequest": {
+            "type": "object",
+            "properties": {
+                "link": {
+                    "description": "Link of the page to delete\nin: body\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.DeletePostRequest": {
+            "type": "object",
+            "required": [
+                "id"
+            ],
+            "properties": {
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.DeleteSchemaBinding": {
+            "type": "object",
+            "required": [
+                "id"
+            ],
+            "properties": {
+                "id": {
+                    "description": "UUID of the schema to delete\nin: path\nrequired: true",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.GetCardsResponse": {
+            "type": "object",
+            "properties": {
+                "cards": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.Card"
+                    }
+                },
+                "total": {
+                    "description": "Number of cards of the schema",
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.GetMenusResponse": {
+            "type": "object",
+            "properties": {
+                "menus": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.Menu"
+                    }
+                }
+            }
+        },
+        "admin_app.GetPagesResponse": {
+            "type": "object",
+            "properties": {
+                "pages": {
+                    "description": "List of pages",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.Page"
+                    }
+                }
+            }
+        },
+        "admin_app.GetPostResponse": {
+            "type": "object",
+            "properties": {
+                "content": {
+                    "description": "Content of the post",
+                    "type": "string"
+                },
+                "excerpt": {
+                    "description": "Excerpt of the post",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID of the post",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Title of the post",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.GetPostsResponse": {
+            "type": "object",
+            "properties": {
+                "posts": {
+                    "description": "List of posts",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.Post"
+                    }
+                }
+            }
+        },
+        "admin_app.GetSchemaVersionsResponse": {
+            "type": "object",
+            "properties": {
+                "versions": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.CardSchemaVersion"
+                    }
+                }
+            }
+        },
+        "admin_app.GetSchemaasResponse": {
+            "type": "object",
+            "properties": {
+                "schemas": {
+                    "description": "List of card schemas",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.CardSchema"
+                    }
+                }
+            }
+        },
+        "admin_app.GetShortcodesResponse": {
+            "type": "object",
+            "properties": {
+                "shortcodes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/admin_app.ShortcodeUsage"
+                    }
+                }
+            }
+        },
+        "admin_app.GetSitesResponse": {
+            "type": "object",
+            "properties": {
+                "sites": {
+                    "description": "Sites the user can manage",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/admin_app.SiteResponse"
+                    }
+                }
+            }
+        },
+        "admin_app.GrantSiteRequest": {
+            "type": "object",
+            "required": [
+                "user_id"
+            ],
+            "properties": {
+                "user_id": {
+                    "description": "ID of the user getting access to the site\nin: body\nrequired: true",
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.ImageIdResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID of the image",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.ImportResponse": {
+            "type": "object",
+            "properties": {
+                "failed": {
+                    "description": "Items or images that could not be imported",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "images": {
+                    "description": "Number of images stored in the media directory",
+                    "type": "integer"
+                },
+                "pages": {
+                    "description": "Number of pages created",
+                    "type": "integer"
+                },
+                "permalinks": {
+                    "description": "Number of permalinks created for the old URLs",
+                    "type": "integer"
+                },
+                "posts": {
+                    "description": "Number of posts created",
+                    "type": "integer"
+                },
+                "skipped": {
+                    "description": "Drafts and pages that already existed",
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.MenuItemPosition": {
+            "type": "object",
+            "required": [
+                "id"
+            ],
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "parent_id": {
+                    "type": "integer"
+                },
+                "position": {
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.MenuItemRequest": {
+            "type": "object",
+            "required": [
+                "target",
+                "type"
+            ],
+            "properties": {
+                "label": {
+                    "description": "Empty to show the title of the linked content\nin: body",
+                    "type": "string"
+                },
+                "parent_id": {
+                    "description": "Item the new item goes under, zero for the top level.\nIgnored when changing an item, it's moved with the\norder endpoint.\nin: body",
+                    "type": "integer"
+                },
+                "target": {
+                    "description": "URL, page or post id, gallery name or schema uuid\nin: body\nrequired: true",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "in: body",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "` + "`" + `url` + "`" + `, ` + "`" + `page` + "`" + `, ` + "`" + `post` + "`" + `, ` + "`" + `gallery` + "`" + ` or ` + "`" + `schema` + "`" + `\nin: body\nrequired: true",
+                    "type": "string"
+                },
+                "visible": {
+                    "description": "Shown unless set to false\nin: body",
+                    "type": "boolean"
+                }
+            }
+        },
+        "admin_app.MenuResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.MoveMenuItemsRequest": {
+            "type": "object",
+            "required": [
+                "items"
+            ],
+            "properties": {
+                "items": {
+                    "description": "New parent and position of the moved items\nin: body\nrequired: true",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/admin_app.MenuItemPosition"
+                    }
+                }
+            }
+        },
+        "admin_app.MovePagesRequest": {
+            "type": "object",
+            "required": [
+                "pages"
+            ],
+            "properties": {
+                "pages": {
+                    "description": "New parent and position of the moved pages\nin: body\nrequired: true",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/admin_app.PagePosition"
+                    }
+                }
+            }
+        },
+        "admin_app.PagePosition": {
+            "type": "object",
+            "required": [
+                "id"
+            ],
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "parent_id": {
+                    "type": "integer"
+                },
+                "position": {
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.PageResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID of the page",
+                    "type": "integer"
+                },
+                "link": {
+                    "description": "Link of the page",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.PermalinkIdResponse": {
+            "type": "object",
+            "properties": {
+                "post_id": {
+                    "description": "ID of the post",
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.PluginErrorsResponse": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "description": "What went wrong with each plugin call",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/plugins.PluginError"
+                    }
+                },
+                "msg": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.PostIdResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID of the post",
+                    "type": "integer"
+                }
+            }
+        },
+        "admin_app.PreviewLinkResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "url": {
+                    "description": "Path of the preview on the public site",
+                    "type": "string"
+                },
+                "uuid": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.PreviewRequest": {
+            "type": "object",
+            "required": [
+                "content"
+            ],
+            "properties": {
+                "content": {
+                    "description": "Markdown content of the post, shortcodes included\nin: body\nrequired: true",
                     "type": "string"
+                },
+                "title": {
+                    "description": "Title of the post\nin: body",
+                    "type": "string"
+                }
+            }
+        },
+        "admin_app.SettingsResponse": {
+            "type": "object",
+            "properties": {
+                "overridden": {
+                    "description": "Settings changed from the admin-app, the rest\ncome from the config file",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "settings": {
+                    "description": "Value of every editable setting of the site,\nbut the write-only ones",
+                    "type": "object"
                 }
             }
         },
-        "admin_app.ChangeCardRequest": {
+        "admin_app.ShortcodeContent": {
             "type": "object",
             "properties": {
                 "id": {
-                    "description": "ID of the card\nin: body",
+                    "description": "Id of the post, link of the page or uuid of the card",
                     "type": "string"
                 },
-                "image_location": {
-                    "description": "Image location URL\nin: body",
-                    "type": "string"
-                },
-                "json_data": {
-                    "description": "JSON data of the card\nin: body",
+                "title": {
+                    "description": "Title of the post or page, title of the schema for cards",
                     "type": "string"
                 },
-                "json_schema": {
-                    "description": "JSON schema name\nin: body",
+                "type": {
+                    "description": "` + "`" + `post` + "`" + `, ` + "`" + `page` + "`" + ` or ` + "`" + `card` + "`" + `",
                     "type": "string"
                 }
             }
         },
-        "admin_app.ChangePageRequest": {
+        "admin_app.ShortcodeUsage": {
             "type": "object",
             "properties": {
                 "content": {
-                    "description": "Content of the page\nin: body",
-                    "type": "string"
-                },
-                "id": {
-                    "description": "ID of the page\nin: body\nrequired: true",
-                    "type": "integer"
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/admin_app.ShortcodeContent"
+                    }
                 },
-                "link": {
-                    "description": "Link of the page\nin: body",
+                "name": {
                     "type": "string"
                 },
-                "title": {
-                    "description": "Title of the page\nin: body",
+                "plugin": {
+                    "description": "Lua plugin of the shortcode, empty when the\ncontent uses a shortcode missing in the config",
                     "type": "string"
                 }
             }
         },
-        "admin_app.ChangePostRequest": {
+        "admin_app.SiteResponse": {
             "type": "object",
             "properties": {
-                "content": {
-                    "description": "Content of the post\nin: body",
-                    "type": "string"
-                },
-                "excerpt": {
-                    "description": "Excerpt of the post\nin: body",
-                    "type": "string"
+                "hosts": {
+                    "description": "Hosts the site is served from",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
                 "id": {
-                    "description": "ID of the post\nin: body\nrequired: true",
+                    "description": "ID of the site",
                     "type": "integer"
                 },
-                "title": {
-                    "description": "Title of the post\nin: body",
+                "name": {
+                    "description": "Name of the site",
                     "type": "string"
                 }
             }
         },
-        "admin_app.DeletePageRequest": {
+        "auth.LoginInput": {
             "type": "object",
+            "required": [
+                "password",
+                "username"
+            ],
             "properties": {
-                "link": {
-                    "description": "Link of the page to delete\nin: body\nrequired: true",
+                "password": {
+                    "type": "string"
+                },
+                "username": {
                     "type": "string"
                 }
             }
         },
-        "admin_app.DeletePostRequest": {
+        "auth.RegisterInput": {
             "type": "object",
             "required": [
-                "id"
+                "password",
+                "username"
             ],
             "properties": {
-                "id": {
-                    "type": "integer"
+                "password": {
+                    "type": "string"
+                },
+                "username": {
+                    "type": "string"
                 }
             }
         },
-        "admin_app.DeleteSchemaBinding": {
+        "auth.RegisterResponse": {
             "type": "object",
-            "required": [
-                "id"
-            ],
             "properties": {
-                "id": {
-                    "description": "UUID of the schema to delete\nin: path\nrequired: true",
-                    "type": "string"
+                "user_id": {
+                    "type": "integer"
                 }
             }
         },
-        "admin_app.GetCardRequest": {
+        "auth.TokenResponse": {
             "type": "object",
-            "required": [
-                "schema"
-            ],
             "properties": {
-                "limit": {
-                    "description": "Limit number of cards to return\nin: query",
-                    "type": "integer"
-                },
-                "page": {
-                    "description": "Page number for pagination\nin: query",
-                    "type": "integer"
-                },
-                "schema": {
-                    "description": "Schema name to filter cards\nin: path\nrequired: true",
+                "token": {
                     "type": "string"
                 }
             }
         },
-        "admin_app.GetPostResponse": {
+        "common.Block": {
             "type": "object",
             "properties": {
-                "content": {
-                    "description": "Content of the post",
-                    "type": "string"
-                },
-                "excerpt": {
-                    "description": "Excerpt of the post",
-                    "type": "string"
-                },
-                "id": {
-                    "description": "ID of the post",
-                    "type": "integer"
+                "data": {
+                    "type": "object"
                 },
-                "title": {
-                    "description": "Title of the post",
+                "type": {
                     "type": "string"
                 }
             }
         },
-        "admin_app.GetPostsResponse": {
+        "common.CacheInvalidationRequest": {
             "type": "object",
             "properties": {
-                "posts": {
-                    "description": "List of posts",
+                "all": {
+                    "type": "boolean"
+                },
+                "paths": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/common.Post"
+                        "type": "string"
                     }
-                }
-            }
-        },
-        "admin_app.GetSchemaasResponse": {
-            "type": "object",
-            "properties": {
-                "schemas": {
-                    "description": "List of card schemas",
+                },
+                "tags": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/common.CardSchema"
+                        "type": "string"
                     }
                 }
             }
         },
-        "admin_app.ImageIdResponse": {
+        "common.Card": {
             "type": "object",
             "properties": {
-                "id": {
-                    "description": "ID of the image",
+                "content": {
                     "type": "string"
-                }
-            }
-        },
-        "admin_app.PageResponse": {
-            "type": "object",
-            "properties": {
+                },
+                "created_at": {
+                    "type": "string"
+                },
                 "id": {
-                    "description": "ID of the page",
+                    "type": "string"
+                },
+                "image": {
+                    "type": "string"
+                },
+                "position": {
+                    "description": "Order of the card within its schema",
                     "type": "integer"
                 },
-                "link": {
-                    "description": "Link of the page",
+                "schema": {
+                    "type": "string"
+                },
+                "schema_version": {
+                    "description": "Version of the schema the card was written with",
+                    "type": "integer"
+                },
+                "updated_at": {
                     "type": "string"
                 }
             }
         },
-        "admin_app.PermalinkIdResponse": {
+        "common.CardFailure": {
             "type": "object",
             "properties": {
-                "post_id": {
-                    "description": "ID of the post",
-                    "type": "integer"
+                "card_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
                 }
             }
         },
-        "admin_app.PostIdResponse": {
+        "common.CardSchema": {
             "type": "object",
             "properties": {
-                "id": {
-                    "description": "ID of the post",
+                "card_count": {
+                    "description": "Number of cards of the schema",
+                    "type": "integer"
+                },
+                "schema": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "uuid": {
+                    "type": "string"
+                },
+                "version": {
+                    "description": "Latest version of the schema, new\ncards are written with it",
                     "type": "integer"
                 }
             }
         },
-        "auth.LoginInput": {
+        "common.CardSchemaVersion": {
             "type": "object",
-            "required": [
-                "password",
-                "username"
-            ],
             "properties": {
-                "password": {
+                "created_at": {
                     "type": "string"
                 },
-                "username": {
+                "schema": {
                     "type": "string"
+                },
+                "version": {
+                    "type": "integer"
                 }
             }
         },
-        "auth.RegisterInput": {
+        "common.ErrorResponse": {
             "type": "object",
-            "required": [
-                "password",
-                "username"
-            ],
             "properties": {
-                "password": {
+                "error": {
                     "type": "string"
                 },
-                "username": {
+                "msg": {
                     "type": "string"
                 }
             }
         },
-        "auth.RegisterResponse": {
+        "common.Menu": {
             "type": "object",
             "properties": {
-                "user_id": {
+                "id": {
                     "type": "integer"
+                },
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.MenuItem"
+                    }
+                },
+                "location": {
+                    "description": "Empty for menus not shown anywhere",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
                 }
             }
         },
-        "auth.TokenResponse": {
+        "common.MenuItem": {
             "type": "object",
             "properties": {
-                "token": {
+                "children": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/common.MenuItem"
+                    }
+                },
+                "href": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "label": {
+                    "description": "Shown in the menu, the title of the linked\ncontent is used when empty",
                     "type": "string"
+                },
+                "parent_id": {
+                    "description": "Zero for the top level items",
+                    "type": "integer"
+                },
+                "position": {
+                    "description": "Order between the items with the same parent",
+                    "type": "integer"
+                },
+                "target": {
+                    "description": "The URL of ` + "`" + `url` + "`" + ` items, the id of ` + "`" + `page` + "`" + ` and ` + "`" + `post` + "`" + `\nitems, the gallery name or the schema uuid",
+                    "type": "string"
+                },
+                "text": {
+                    "description": "Resolved when the menu is read so they follow the\nlinked content, ` + "`" + `Href` + "`" + ` is empty when it's gone",
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                },
+                "visible": {
+                    "type": "boolean"
                 }
             }
         },
-        "common.CardSchema": {
+        "common.Page": {
             "type": "object",
             "properties": {
-                "cards": {
+                "blocks": {
+                    "description": "Pages with blocks are rendered from them,\nthe Markdown content is used otherwise",
                     "type": "array",
                     "items": {
-                        "type": "string"
+                        "$ref": "#/definitions/common.Block"
                     }
                 },
-                "schema": {
+                "content": {
                     "type": "string"
                 },
-                "title": {
+                "id": {
+                    "type": "integer"
+                },
+                "link": {
                     "type": "string"
                 },
-                "uuid": {
+                "parent_id": {
+                    "description": "Zero for the top level pages",
+                    "type": "integer"
+                },
+                "path": {
+                    "description": "Links of the ancestors and the page joined by ` + "`" + `/` + "`" + `,\nthe page is served at ` + "`" + `/page/\u003cpath\u003e` + "`" + `",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "Order between the pages with the same parent",
+                    "type": "integer"
+                },
+                "title": {
                     "type": "string"
                 }
             }
         },
-        "common.ErrorResponse": {
+        "common.PatchOperation": {
             "type": "object",
             "properties": {
-                "error": {
+                "from": {
                     "type": "string"
                 },
-                "msg": {
+                "op": {
+                    "type": "string"
+                },
+                "path": {
+                    "description": "JSON pointers, ` + "`" + `From` + "`" + ` is only used by ` + "`" + `move` + "`" + ` and ` + "`" + `copy` + "`" + `",
                     "type": "string"
+                },
+                "value": {
+                    "type": "object"
                 }
             }
         },
@@ -1452,6 +4378,21 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "plugins.PluginError": {
+            "type": "object",
+            "properties": {
+                "kind": {
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Message of the error, with the script line if\nthe script raised it",
+                    "type": "string"
+                },
+                "plugin": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
@@ -7,7 +7,10 @@ toolchain go1.24.4
 require (
 	cloud.google.com/go/recaptchaenterprise/v2 v2.20.4
 	github.com/a-h/templ v0.3.906
+	github.com/andybalholm/brotli v1.2.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gin-gonic/gin v1.10.1
+	github.com/redis/go-redis/v9 v9.7.0
 	github.com/swaggo/swag v1.16.4
 	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
 )
@@ -17,9 +20,12 @@ require (
 	cloud.google.com/go/auth/oauth2adapt v0.2.8 // indirect
 	cloud.google.com/go/compute/metadata v0.6.0 // indirect
 	github.com/KyleBanks/depth v1.2.1 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/cloudwego/base64x v0.1.4 // indirect
 	github.com/cloudwego/iasm v0.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/go-logr/logr v1.4.2 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-openapi/jsonpointer v0.21.1 // indirect
@@ -48,7 +54,6 @@ require (
 	go.opentelemetry.io/otel/metric v1.35.0 // indirect
 	go.opentelemetry.io/otel/trace v1.35.0 // indirect
 	golang.org/x/oauth2 v0.29.0 // indirect
-	golang.org/x/sync v0.15.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
 	golang.org/x/tools v0.34.0 // indirect
 	google.golang.org/api v0.229.0 // indirect
@@ -74,6 +79,7 @@ require (
 
 require (
 	github.com/BurntSushi/toml v1.5.0
+	github.com/alicebob/miniredis/v2 v2.33.0
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/evanoberholster/imagemeta v0.3.1
@@ -105,15 +111,15 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	github.com/yuin/gopher-lua v1.1.1
-	github.com/zutto/shardedmap v0.0.0-20180201164343-415202d0910e
 	golang.org/x/arch v0.11.0 // indirect
 	golang.org/x/crypto v0.39.0
 	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sync v0.15.0
 	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.26.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 // replace google.golang.org/genproto => google.golang.org/genproto v0.0.0-20230913181813-007df8e322eb
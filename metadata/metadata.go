@@ -13,7 +13,6 @@ import (
 
 	"github.com/evanoberholster/imagemeta"
 	"github.com/evanoberholster/imagemeta/exif2"
-	"github.com/rbc33/gocms/common"
 	"github.com/rs/zerolog/log"
 )
 
@@ -178,9 +177,10 @@ func writeJSONToFile(data interface{}, outputPath string) error {
 	return nil
 }
 
-func GenerateJson(filename string, name string, excerpt string) {
+// Writes the metadata of the image next to it in the directory
+func GenerateJson(directory string, filename string, name string, excerpt string) {
 	// Ejemplo de uso
-	imagePath := path.Join(common.Settings.ImageDirectory, filename)
+	imagePath := path.Join(directory, filename)
 
 	// Extraer metadata
 	metadata, err := extractPhotoMetadata(imagePath, filename, name, excerpt)
@@ -197,7 +197,7 @@ func GenerateJson(filename string, name string, excerpt string) {
 	// Escribir a archivo
 	outputFilename := fmt.Sprintf("%s.json",
 		strings.TrimSuffix(filename, filepath.Ext(filename)))
-	outputPath := path.Join(common.Settings.ImageDirectory, outputFilename)
+	outputPath := path.Join(directory, outputFilename)
 
 	if err := writeJSONToFile(metadata, outputPath); err != nil {
 		log.Error().Msgf("Error escribiendo archivo: %v\n", err)
@@ -0,0 +1,53 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts ADD COLUMN site_id INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE pages ADD COLUMN site_id INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE pages DROP INDEX link, ADD UNIQUE INDEX pages_site_link (site_id, link);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE cards ADD COLUMN site_id INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE card_schemas ADD COLUMN site_id INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE post_permalinks ADD COLUMN site_id INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE post_permalinks DROP INDEX permalink, ADD UNIQUE INDEX post_permalinks_site_permalink (site_id, permalink);
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TABLE user_sites (
+  user_id INT NOT NULL,
+  site_id INT NOT NULL,
+  PRIMARY KEY (user_id, site_id)
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+-- Existing users keep managing the default site
+INSERT INTO user_sites(user_id, site_id) SELECT id, 1 FROM users;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_sites;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE post_permalinks DROP INDEX post_permalinks_site_permalink, DROP COLUMN site_id, ADD UNIQUE INDEX permalink (permalink);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE card_schemas DROP COLUMN site_id;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE cards DROP COLUMN site_id;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE pages DROP INDEX pages_site_link, DROP COLUMN site_id, ADD UNIQUE INDEX link (link);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE posts DROP COLUMN site_id;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE site_settings (
+  site_id INT NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  value JSON NOT NULL,
+  PRIMARY KEY (site_id, name)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE site_settings;
+-- +goose StatementEnd
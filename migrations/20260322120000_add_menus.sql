@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE menus (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  site_id INT NOT NULL DEFAULT 1,
+  name VARCHAR(255) NOT NULL,
+  location VARCHAR(64) NOT NULL DEFAULT ''
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TABLE menu_items (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  menu_id INT NOT NULL,
+  parent_id INT NOT NULL DEFAULT 0,
+  position INT NOT NULL DEFAULT 0,
+  type VARCHAR(16) NOT NULL,
+  target VARCHAR(512) NOT NULL,
+  label VARCHAR(255) NOT NULL DEFAULT '',
+  title VARCHAR(255) NOT NULL DEFAULT '',
+  visible INT NOT NULL DEFAULT 1,
+  INDEX menu_items_menu (menu_id),
+  FOREIGN KEY (menu_id) REFERENCES menus(id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE menu_items;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TABLE menus;
+-- +goose StatementEnd
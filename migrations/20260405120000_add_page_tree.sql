@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE pages ADD COLUMN parent_id INT NOT NULL DEFAULT 0, ADD COLUMN position INT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE TABLE page_redirects (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  site_id INT NOT NULL DEFAULT 1,
+  link VARCHAR(255) NOT NULL,
+  page_id INT NOT NULL,
+  UNIQUE INDEX page_redirects_site_link (site_id, link)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE page_redirects;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE pages DROP COLUMN parent_id, DROP COLUMN position;
+-- +goose StatementEnd
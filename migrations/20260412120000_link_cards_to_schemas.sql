@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE cards
+  ADD COLUMN schema_uuid BINARY(16) NULL,
+  ADD COLUMN position INT NOT NULL DEFAULT 0,
+  ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+-- +goose StatementBegin
+-- Cards belong to the schema whose card_ids array lists them,
+-- in the order of the array. Cards missing from every array
+-- were never listed and keep a NULL schema.
+UPDATE cards JOIN card_schemas
+  ON cards.site_id = card_schemas.site_id
+  AND JSON_CONTAINS(card_schemas.card_ids, JSON_QUOTE(CONVERT(UuidFromBin(cards.uuid) USING utf8mb4)))
+SET cards.schema_uuid = card_schemas.uuid,
+  cards.position = CAST(REGEXP_SUBSTR(
+    JSON_UNQUOTE(JSON_SEARCH(card_schemas.card_ids, 'one', CONVERT(UuidFromBin(cards.uuid) USING utf8mb4))),
+    '[0-9]+') AS UNSIGNED);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE cards
+  ADD INDEX cards_schema_position (schema_uuid, position),
+  ADD CONSTRAINT cards_schema FOREIGN KEY (schema_uuid) REFERENCES card_schemas(uuid) ON DELETE CASCADE;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE card_schemas DROP COLUMN card_ids;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE card_schemas ADD COLUMN card_ids JSON;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE card_schemas SET card_ids = (
+  SELECT COALESCE(JSON_ARRAYAGG(CONVERT(UuidFromBin(cards.uuid) USING utf8mb4)), JSON_ARRAY())
+  FROM cards WHERE cards.schema_uuid = card_schemas.uuid
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE cards
+  DROP FOREIGN KEY cards_schema,
+  DROP INDEX cards_schema_position,
+  DROP COLUMN schema_uuid,
+  DROP COLUMN position,
+  DROP COLUMN created_at,
+  DROP COLUMN updated_at;
+-- +goose StatementEnd
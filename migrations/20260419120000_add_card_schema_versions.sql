@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE card_schema_versions (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  schema_uuid BINARY(16) NOT NULL,
+  version INT NOT NULL,
+  json_schema JSON NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE INDEX card_schema_versions_version (schema_uuid, version),
+  FOREIGN KEY (schema_uuid) REFERENCES card_schemas(uuid) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE card_schemas ADD COLUMN version INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE cards ADD COLUMN schema_version INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+-- The stored schemas become the first version
+INSERT INTO card_schema_versions(schema_uuid, version, json_schema) SELECT uuid, 1, json_schema FROM card_schemas;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE cards DROP COLUMN schema_version;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE card_schemas DROP COLUMN version;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP TABLE card_schema_versions;
+-- +goose StatementEnd
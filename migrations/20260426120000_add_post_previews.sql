@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE post_previews (
+  uuid BINARY(16) PRIMARY KEY,
+  site_id INT NOT NULL DEFAULT 1,
+  title VARCHAR(255) NOT NULL,
+  excerpt TEXT NOT NULL,
+  content MEDIUMTEXT NOT NULL,
+  expires_at DATETIME NOT NULL,
+  INDEX post_previews_expires_at (expires_at)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE post_previews;
+-- +goose StatementEnd
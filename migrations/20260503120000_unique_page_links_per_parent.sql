@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE pages DROP INDEX pages_site_link, ADD UNIQUE INDEX pages_site_parent_link (site_id, parent_id, link);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE pages DROP INDEX pages_site_parent_link, ADD UNIQUE INDEX pages_site_link (site_id, link);
+-- +goose StatementEnd
@@ -0,0 +1,329 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+)
+
+// Globals the `..` operators, the writes to table fields and
+// the table constructors of the scripts are compiled to,
+// scripts can't name them
+const (
+	CONCAT_FUNCTION    = "(concat)"
+	SET_INDEX_FUNCTION = "(setindex)"
+	NEW_TABLE_FUNCTION = "(newtable)"
+)
+
+// Bytes counted for each table and each entry added to one,
+// the strings they hold are counted when they are made
+const TABLE_ENTRY_SIZE = 32
+
+type allocated_key struct{}
+
+// Bytes of the strings and tables built by the call so far
+func withAllocationBudget(ctx context.Context, allocated *int) context.Context {
+	return context.WithValue(ctx, allocated_key{}, allocated)
+}
+
+// Counts `size` more bytes against the call, raising
+// the error before the string is made
+func (pool *LuaPool) allocate(state *lua.LState, size int) {
+	if size > pool.limits.MaxOutputSize {
+		state.RaiseError("string of %d bytes over the output limit of %d bytes", size, pool.limits.MaxOutputSize)
+	}
+	allocated, counted := state.Context().Value(allocated_key{}).(*int)
+	if !counted {
+		return
+	}
+	*allocated += size
+	if *allocated > pool.limits.MaxAllocSize {
+		state.RaiseError("over the allocation limit of %d bytes", pool.limits.MaxAllocSize)
+	}
+}
+
+// Same as the `..` operator of the VM, `a .. b .. c` is
+// a single call joining the three values
+func (pool *LuaPool) boundedConcat(state *lua.LState) int {
+	top := state.GetTop()
+	result := state.Get(top)
+	for i := top - 1; i >= 1; i-- {
+		lhs := state.Get(i)
+		if lua.LVCanConvToString(lhs) && lua.LVCanConvToString(result) {
+			// Joins the strings and numbers next to each other at once
+			first := i
+			for first > 1 && lua.LVCanConvToString(state.Get(first-1)) {
+				first--
+			}
+			parts := make([]string, 0, i-first+2)
+			size := 0
+			for j := first; j <= i; j++ {
+				parts = append(parts, lua.LVAsString(state.Get(j)))
+				size += len(parts[len(parts)-1])
+			}
+			parts = append(parts, lua.LVAsString(result))
+			pool.allocate(state, size+len(parts[len(parts)-1]))
+			result = lua.LString(strings.Join(parts, ""))
+			i = first
+			continue
+		}
+
+		operator := state.GetMetaField(lhs, "__concat")
+		if operator == lua.LNil {
+			operator = state.GetMetaField(result, "__concat")
+		}
+		if operator.Type() != lua.LTFunction {
+			state.RaiseError("cannot perform concat operation between %v and %v", lhs.Type().String(), result.Type().String())
+		}
+		state.Push(operator)
+		state.Push(lhs)
+		state.Push(result)
+		state.Call(2, 1)
+		result = state.Get(-1)
+		state.Pop(1)
+	}
+	state.Push(result)
+	return 1
+}
+
+// Same as `object[key] = value`, the entries added
+// to tables are counted, metamethods included
+func (pool *LuaPool) boundedSetIndex(state *lua.LState) int {
+	object, key, value := state.Get(1), state.Get(2), state.Get(3)
+	if table, is_table := object.(*lua.LTable); is_table && value != lua.LNil && table.RawGet(key) == lua.LNil {
+		pool.allocate(state, TABLE_ENTRY_SIZE)
+	}
+	state.SetTable(object, key, value)
+	return 0
+}
+
+// Counts the table made by a constructor with its entries
+func (pool *LuaPool) countedTable(state *lua.LState) int {
+	table := state.CheckTable(1)
+	entries := 1
+	table.ForEach(func(lua.LValue, lua.LValue) { entries++ })
+	pool.allocate(state, entries*TABLE_ENTRY_SIZE)
+	state.Push(table)
+	return 1
+}
+
+// Wraps a library function adding an entry to a table,
+// like table.insert and rawset
+func (pool *LuaPool) countingEntry(function lua.LValue) lua.LGFunction {
+	return func(state *lua.LState) int {
+		arguments := state.GetTop()
+		pool.allocate(state, TABLE_ENTRY_SIZE)
+		state.Push(function)
+		for i := 1; i <= arguments; i++ {
+			state.Push(state.Get(i))
+		}
+		state.Call(arguments, lua.MultRet)
+		return state.GetTop() - arguments
+	}
+}
+
+// table.concat with the size of the string checked first
+func (pool *LuaPool) boundedTableConcat(state *lua.LState) int {
+	table := state.CheckTable(1)
+	separator := state.OptString(2, "")
+	first := state.OptInt(3, 1)
+	last := state.OptInt(4, table.Len())
+	if first > last {
+		state.Push(lua.LString(""))
+		return 1
+	}
+
+	parts := make([]string, 0, min(last-first+1, table.Len()))
+	size := 0
+	for i := first; i <= last; i++ {
+		value := table.RawGetInt(i)
+		if !lua.LVCanConvToString(value) {
+			state.RaiseError("invalid value (%s) at index %d in table for concat", value.Type().String(), i)
+		}
+		parts = append(parts, lua.LVAsString(value))
+		size += len(parts[len(parts)-1]) + len(separator)
+	}
+	pool.allocate(state, size-len(separator))
+	state.Push(lua.LString(strings.Join(parts, separator)))
+	return 1
+}
+
+// Wraps a library function counting the strings it returns,
+// for the ones the size can't be known before
+func (pool *LuaPool) countingResults(function lua.LValue) lua.LGFunction {
+	return func(state *lua.LState) int {
+		arguments := state.GetTop()
+		state.Push(function)
+		for i := 1; i <= arguments; i++ {
+			state.Push(state.Get(i))
+		}
+		state.Call(arguments, lua.MultRet)
+		for i := arguments + 1; i <= state.GetTop(); i++ {
+			if text, is_string := state.Get(i).(lua.LString); is_string {
+				pool.allocate(state, len(text))
+			}
+		}
+		return state.GetTop() - arguments
+	}
+}
+
+// Compiles every `..` of the chunk to a call of CONCAT_FUNCTION,
+// the writes to table fields to SET_INDEX_FUNCTION and the table
+// constructors to NEW_TABLE_FUNCTION, the VM has no hook to
+// count the strings and tables the scripts make
+func boundAllocations(statements []ast.Stmt) {
+	for i, statement := range statements {
+		statements[i] = boundStatement(statement)
+	}
+}
+
+func boundStatement(statement ast.Stmt) ast.Stmt {
+	switch statement := statement.(type) {
+	case *ast.AssignStmt:
+		boundExpressions(statement.Lhs)
+		boundExpressions(statement.Rhs)
+		return boundAssignment(statement)
+	case *ast.LocalAssignStmt:
+		boundExpressions(statement.Exprs)
+	case *ast.FuncCallStmt:
+		statement.Expr = boundExpression(statement.Expr)
+	case *ast.DoBlockStmt:
+		boundAllocations(statement.Stmts)
+	case *ast.WhileStmt:
+		statement.Condition = boundExpression(statement.Condition)
+		boundAllocations(statement.Stmts)
+	case *ast.RepeatStmt:
+		statement.Condition = boundExpression(statement.Condition)
+		boundAllocations(statement.Stmts)
+	case *ast.IfStmt:
+		statement.Condition = boundExpression(statement.Condition)
+		boundAllocations(statement.Then)
+		boundAllocations(statement.Else)
+	case *ast.NumberForStmt:
+		statement.Init = boundExpression(statement.Init)
+		statement.Limit = boundExpression(statement.Limit)
+		statement.Step = boundExpression(statement.Step)
+		boundAllocations(statement.Stmts)
+	case *ast.GenericForStmt:
+		boundExpressions(statement.Exprs)
+		boundAllocations(statement.Stmts)
+	case *ast.FuncDefStmt:
+		statement.Name.Func = boundExpression(statement.Name.Func)
+		statement.Name.Receiver = boundExpression(statement.Name.Receiver)
+		boundAllocations(statement.Func.Stmts)
+	case *ast.ReturnStmt:
+		boundExpressions(statement.Exprs)
+	}
+	return statement
+}
+
+// Assignments to table fields become a block evaluating
+// every value first, like the VM does, and then setting
+// them one by one: `a[k], b = x, y` is
+// `do local v1, v2 = x, y; (setindex)(a, k, v1); b = v2 end`
+func boundAssignment(statement *ast.AssignStmt) ast.Stmt {
+	has_fields := false
+	for _, target := range statement.Lhs {
+		if _, is_field := target.(*ast.AttrGetExpr); is_field {
+			has_fields = true
+		}
+	}
+	if !has_fields {
+		return statement
+	}
+
+	values := &ast.LocalAssignStmt{Exprs: statement.Rhs}
+	block := &ast.DoBlockStmt{Stmts: []ast.Stmt{values}}
+	for i, target := range statement.Lhs {
+		name := fmt.Sprintf("(value %d)", i)
+		values.Names = append(values.Names, name)
+		value := &ast.IdentExpr{Value: name}
+		value.SetLine(statement.Line())
+
+		var assignment ast.Stmt
+		if field, is_field := target.(*ast.AttrGetExpr); is_field {
+			call := &ast.FuncCallExpr{Func: &ast.IdentExpr{Value: SET_INDEX_FUNCTION}, Args: []ast.Expr{field.Object, field.Key, value}}
+			call.Func.SetLine(statement.Line())
+			call.SetLine(statement.Line())
+			call.SetLastLine(statement.LastLine())
+			assignment = &ast.FuncCallStmt{Expr: call}
+		} else {
+			assignment = &ast.AssignStmt{Lhs: []ast.Expr{target}, Rhs: []ast.Expr{value}}
+		}
+		assignment.SetLine(statement.Line())
+		assignment.SetLastLine(statement.LastLine())
+		block.Stmts = append(block.Stmts, assignment)
+	}
+	values.SetLine(statement.Line())
+	values.SetLastLine(statement.LastLine())
+	block.SetLine(statement.Line())
+	block.SetLastLine(statement.LastLine())
+	return block
+}
+
+func boundExpressions(expressions []ast.Expr) {
+	for i, expression := range expressions {
+		expressions[i] = boundExpression(expression)
+	}
+}
+
+func boundExpression(expression ast.Expr) ast.Expr {
+	switch expression := expression.(type) {
+	case *ast.StringConcatOpExpr:
+		// The operator is right associative, `a .. b .. c`
+		// is `a .. (b .. c)`
+		call := &ast.FuncCallExpr{Func: &ast.IdentExpr{Value: CONCAT_FUNCTION}}
+		var current ast.Expr = expression
+		for {
+			concat, is_concat := current.(*ast.StringConcatOpExpr)
+			if !is_concat {
+				call.Args = append(call.Args, boundExpression(current))
+				break
+			}
+			call.Args = append(call.Args, boundExpression(concat.Lhs))
+			current = concat.Rhs
+		}
+		call.Func.SetLine(expression.Line())
+		call.SetLine(expression.Line())
+		call.SetLastLine(expression.LastLine())
+		return call
+	case *ast.AttrGetExpr:
+		expression.Object = boundExpression(expression.Object)
+		expression.Key = boundExpression(expression.Key)
+	case *ast.TableExpr:
+		for _, field := range expression.Fields {
+			field.Key = boundExpression(field.Key)
+			field.Value = boundExpression(field.Value)
+		}
+		call := &ast.FuncCallExpr{Func: &ast.IdentExpr{Value: NEW_TABLE_FUNCTION}, Args: []ast.Expr{expression}}
+		call.Func.SetLine(expression.Line())
+		call.SetLine(expression.Line())
+		call.SetLastLine(expression.LastLine())
+		return call
+	case *ast.FuncCallExpr:
+		expression.Func = boundExpression(expression.Func)
+		expression.Receiver = boundExpression(expression.Receiver)
+		boundExpressions(expression.Args)
+	case *ast.LogicalOpExpr:
+		expression.Lhs = boundExpression(expression.Lhs)
+		expression.Rhs = boundExpression(expression.Rhs)
+	case *ast.RelationalOpExpr:
+		expression.Lhs = boundExpression(expression.Lhs)
+		expression.Rhs = boundExpression(expression.Rhs)
+	case *ast.ArithmeticOpExpr:
+		expression.Lhs = boundExpression(expression.Lhs)
+		expression.Rhs = boundExpression(expression.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		expression.Expr = boundExpression(expression.Expr)
+	case *ast.UnaryNotOpExpr:
+		expression.Expr = boundExpression(expression.Expr)
+	case *ast.UnaryLenOpExpr:
+		expression.Expr = boundExpression(expression.Expr)
+	case *ast.FunctionExpr:
+		boundAllocations(expression.Stmts)
+	}
+	return expression
+}
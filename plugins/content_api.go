@@ -0,0 +1,266 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Name of the global table with the content functions
+const CONTENT_MODULE = "gocms"
+
+// Items given when the plugin asks for no limit, and
+// the most it can ask for at once
+const (
+	DEFAULT_CONTENT_LIMIT = 10
+	MAX_CONTENT_LIMIT     = 100
+)
+
+// Content of the site the plugins can read through the `gocms`
+// module, set for each request with WithContentSource
+type ContentSource struct {
+	// Only its getters are called
+	Database database.Database
+	// Site the images, galleries and settings are read from
+	Site common.Site
+	// Called with the cache tags of the content read, so the
+	// pages showing it are purged when it changes. May be nil.
+	Tag func(tags ...string)
+}
+
+type content_source_key struct{}
+type content_reads_key struct{}
+
+func WithContentSource(ctx context.Context, source *ContentSource) context.Context {
+	return context.WithValue(ctx, content_source_key{}, source)
+}
+
+// The returned flag is set when the plugins called with the
+// context read any content, their results depend on more than
+// their arguments then
+func trackContentReads(ctx context.Context) (context.Context, *bool) {
+	read := false
+	return context.WithValue(ctx, content_reads_key{}, &read), &read
+}
+
+var content_functions = map[string]func(*ContentSource, *lua.LState) int{
+	"posts":    contentPosts,
+	"post":     contentPost,
+	"pages":    contentPages,
+	"page":     contentPage,
+	"cards":    contentCards,
+	"images":   contentImages,
+	"gallery":  contentGallery,
+	"settings": contentSettings,
+}
+
+// Adds the `gocms` table to the state. The functions read the
+// source of the context the state is running with, the call
+// fails when there is none.
+func openContentModule(state *lua.LState) {
+	module := state.NewTable()
+	for name, function := range content_functions {
+		module.RawSetString(name, state.NewFunction(func(state *lua.LState) int {
+			ctx := state.Context()
+			source, _ := ctx.Value(content_source_key{}).(*ContentSource)
+			if source == nil || source.Database == nil {
+				state.RaiseError("gocms.%s can't read content here", name)
+			}
+			if read, tracked := ctx.Value(content_reads_key{}).(*bool); tracked {
+				*read = true
+			}
+			return function(source, state)
+		}))
+	}
+	state.SetGlobal(CONTENT_MODULE, module)
+}
+
+func (source *ContentSource) tag(tags ...string) {
+	if source.Tag != nil {
+		source.Tag(tags...)
+	}
+}
+
+// Pushes the value as the tables a JSON decoder would give
+func pushContent(state *lua.LState, value any) int {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		state.RaiseError("could not convert the content: %v", err)
+	}
+	var decoded any
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		state.RaiseError("could not convert the content: %v", err)
+	}
+	state.Push(toLuaValue(state, decoded))
+	return 1
+}
+
+// Lookups give nil and the error, like io.open
+func pushNotFound(state *lua.LState, err error) int {
+	state.Push(lua.LNil)
+	state.Push(lua.LString(err.Error()))
+	return 2
+}
+
+// Optional limit argument, zero or less for the default
+func checkLimit(state *lua.LState, index int) int {
+	limit := state.OptInt(index, DEFAULT_CONTENT_LIMIT)
+	if limit <= 0 {
+		return DEFAULT_CONTENT_LIMIT
+	}
+	return min(limit, MAX_CONTENT_LIMIT)
+}
+
+// gocms.posts([limit[, offset]]) lists the posts without their
+// content, in the order of the home page
+func contentPosts(source *ContentSource, state *lua.LState) int {
+	limit := checkLimit(state, 1)
+	offset := max(state.OptInt(2, 0), 0)
+	source.tag(common.CACHE_TAG_POSTS)
+	posts, err := source.Database.GetPosts(limit, offset)
+	if err != nil {
+		state.RaiseError("could not get posts: %v", err)
+	}
+	return pushContent(state, posts)
+}
+
+// gocms.post(id) gives the post with its Markdown content
+func contentPost(source *ContentSource, state *lua.LState) int {
+	id := state.CheckInt(1)
+	source.tag(common.PostCacheTag(id))
+	post, err := source.Database.GetPost(id)
+	if err != nil {
+		return pushNotFound(state, fmt.Errorf("post %d not found", id))
+	}
+	return pushContent(state, post)
+}
+
+// gocms.pages([limit[, offset]]) lists the pages
+func contentPages(source *ContentSource, state *lua.LState) int {
+	limit := checkLimit(state, 1)
+	offset := max(state.OptInt(2, 0), 0)
+	source.tag(common.CACHE_TAG_PAGES)
+	pages, err := source.Database.GetPages(limit, offset)
+	if err != nil {
+		state.RaiseError("could not get pages: %v", err)
+	}
+	return pushContent(state, pages)
+}
+
+// gocms.page(link) gives the page with its content and blocks
+func contentPage(source *ContentSource, state *lua.LState) int {
+	link := state.CheckString(1)
+	source.tag(common.PageCacheTag(link))
+	page, err := source.Database.GetPage(link)
+	if err != nil {
+		return pushNotFound(state, fmt.Errorf("page `%s` not found", link))
+	}
+	return pushContent(state, page)
+}
+
+// Card with its data decoded, the JSON text is left out
+type contentCard struct {
+	Id       string `json:"id"`
+	Image    string `json:"image"`
+	Schema   string `json:"schema"`
+	Position int    `json:"position"`
+	Data     any    `json:"data"`
+}
+
+// gocms.cards(schema[, limit[, offset]]) lists the cards of the
+// schema in their order, with the data of each one
+func contentCards(source *ContentSource, state *lua.LState) int {
+	schema := state.CheckString(1)
+	limit := checkLimit(state, 2)
+	offset := max(state.OptInt(3, 0), 0)
+	source.tag(common.SchemaCacheTag(schema), common.CACHE_TAG_CARDS)
+	cards, _, err := source.Database.GetCards(schema, common.CardQuery{Limit: limit, Offset: offset})
+	if err != nil {
+		state.RaiseError("could not get the cards of %s: %v", schema, err)
+	}
+
+	content_cards := make([]contentCard, 0, len(cards))
+	for _, card := range cards {
+		content_card := contentCard{Id: card.Id, Image: card.Image, Schema: card.Schema, Position: card.Position}
+		if err = json.Unmarshal([]byte(card.Content), &content_card.Data); err != nil {
+			state.RaiseError("card %s has invalid data: %v", card.Id, err)
+		}
+		content_cards = append(content_cards, content_card)
+	}
+	return pushContent(state, content_cards)
+}
+
+// gocms.images([limit[, offset]]) lists the uploaded images
+// with their metadata
+func contentImages(source *ContentSource, state *lua.LState) int {
+	limit := checkLimit(state, 1)
+	offset := max(state.OptInt(2, 0), 0)
+	source.tag(common.CACHE_TAG_IMAGES)
+	paths, err := common.GetImageMetadataPaths(source.Site.Id)
+	if err != nil {
+		state.RaiseError("could not get images: %v", err)
+	}
+	paths = paths[min(offset, len(paths)):min(offset+limit, len(paths))]
+	images, err := common.GetImages(source.Site.Id, paths, max(len(paths), 1), 1)
+	if err != nil {
+		state.RaiseError("could not get images: %v", err)
+	}
+	return pushContent(state, images)
+}
+
+// gocms.gallery(name) gives the gallery of the settings with
+// its images in `images`
+func contentGallery(source *ContentSource, state *lua.LState) int {
+	name := state.CheckString(1)
+	source.tag(common.GalleryCacheTag(name), common.CACHE_TAG_IMAGES)
+	gallery, exists := source.Site.Galleries[name]
+	if !exists {
+		return pushNotFound(state, fmt.Errorf("gallery `%s` does not exist", name))
+	}
+	images, err := common.GetImages(source.Site.Id, gallery.Images, max(len(gallery.Images), 1), 1)
+	if err != nil {
+		state.RaiseError("could not get the images of %s: %v", name, err)
+	}
+	return pushContent(state, map[string]any{
+		"name":        gallery.Name,
+		"description": gallery.Description,
+		"link":        gallery.Link,
+		"thumbnail":   gallery.Thumbnail,
+		"images":      images,
+	})
+}
+
+// gocms.settings() gives the settings of the site shown on its
+// pages: `name`, `navbar`, `sticky_posts` and the `galleries`
+// without their images. Secrets like the reCAPTCHA keys are left out.
+func contentSettings(source *ContentSource, state *lua.LState) int {
+	source.tag(common.SettingsCacheTag(source.Site.Id))
+	galleries := make(map[string]any, len(source.Site.Galleries))
+	for name, gallery := range source.Site.Galleries {
+		galleries[name] = map[string]any{
+			"name":        gallery.Name,
+			"description": gallery.Description,
+			"link":        gallery.Link,
+			"thumbnail":   gallery.Thumbnail,
+		}
+	}
+	// Empty tables instead of nil when they aren't set
+	dropdowns := make(map[string][]common.Link, len(source.Site.AppNavbar.Dropdowns))
+	for name, links := range source.Site.AppNavbar.Dropdowns {
+		dropdowns[name] = append([]common.Link{}, links...)
+	}
+	return pushContent(state, map[string]any{
+		"id":   source.Site.Id,
+		"name": source.Site.Name,
+		"navbar": map[string]any{
+			"links":     append([]common.Link{}, source.Site.AppNavbar.Links...),
+			"dropdowns": dropdowns,
+		},
+		"sticky_posts": append([]int{}, source.Site.StickyPosts...),
+		"galleries":    galleries,
+	})
+}
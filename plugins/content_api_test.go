@@ -0,0 +1,157 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const content_test_plugin = `
+function HandleShortcode(arguments)
+	local query = arguments[1]
+	if query == "post" then
+		local post, err = gocms.post(tonumber(arguments[2]))
+		if post == nil then
+			return err
+		end
+		return post.title .. ": " .. post.content
+	elseif query == "page" then
+		local page = gocms.page(arguments[2])
+		return page.title .. " " .. page.blocks[1].data.content
+	elseif query == "pages" then
+		return tostring(#gocms.pages(0))
+	elseif query == "cards" then
+		local names = {}
+		for _, card in ipairs(gocms.cards(arguments[2], 2)) do
+			table.insert(names, card.data.title .. "=" .. card.data.price)
+		end
+		return table.concat(names, ",")
+	elseif query == "images" then
+		local images = gocms.images()
+		return #images .. " " .. images[1].filepath .. " " .. images[1].excerpt
+	elseif query == "gallery" then
+		local gallery, err = gocms.gallery(arguments[2])
+		if gallery == nil then
+			return err
+		end
+		return gallery.description .. " " .. #gallery.images
+	elseif query == "settings" then
+		local settings = gocms.settings()
+		local links = {}
+		for _, link in ipairs(settings.navbar.links) do
+			table.insert(links, link.name .. "=" .. link.href)
+		end
+		return settings.name .. " " .. table.concat(links, ",") .. " " .. #settings.navbar.dropdowns.more ..
+			" " .. table.concat(settings.sticky_posts, ",") .. " " .. settings.galleries.trip.description ..
+			" " .. tostring(settings.galleries.trip.images) .. " " .. tostring(settings.recaptcha_secret)
+	end
+end
+`
+
+func TestContentModule(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.ImageDirectory = image_directory })
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "sky.json"), []byte(`{"name": "sky", "filename": "sky.png", "excerpt": "Blue sky"}`), 0644))
+
+	tags := []string{}
+	source := &ContentSource{
+		Database: mocks.DatabaseMock{
+			GetPostHandler: func(id int) (common.Post, error) {
+				if id != 1 {
+					return common.Post{}, fmt.Errorf("no post")
+				}
+				return common.Post{Id: 1, Title: "Hello", Content: "World"}, nil
+			},
+			GetPageHandler: func(link string) (common.Page, error) {
+				return common.Page{Id: 2, Title: "Landing", Link: link, Blocks: []common.Block{{Type: common.BLOCK_MARKDOWN, Data: []byte(`{"content": "Hi"}`)}}}, nil
+			},
+			GetPagesHandler: func(limit int, offset int) ([]common.Page, error) {
+				assert.Equal(t, DEFAULT_CONTENT_LIMIT, limit)
+				return []common.Page{{Id: 1}, {Id: 2}}, nil
+			},
+			GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+				assert.Equal(t, common.CardQuery{Limit: 2}, query)
+				return []common.Card{
+					{Id: "a", Schema: schema_uuid, Content: `{"title": "Shoe", "price": 10}`},
+					{Id: "b", Schema: schema_uuid, Content: `{"title": "Hat", "price": 5.5}`},
+				}, 2, nil
+			},
+		},
+		Site: common.Site{
+			Id:   common.DEFAULT_SITE_ID,
+			Name: "Shop",
+			AppNavbar: common.Navbar{
+				Links:     []common.Link{{Name: "Home", Href: "/"}, {Name: "Blog", Href: "/blog"}},
+				Dropdowns: map[string][]common.Link{"more": {{Name: "About", Href: "/about"}}},
+			},
+			Galleries:       map[string]common.Gallery{"trip": {Name: "trip", Description: "Our trip", Images: []string{"sky.json"}}},
+			StickyPosts:     []int{3, 1},
+			RecaptchaSecret: "secret",
+		},
+		Tag: func(new_tags ...string) { tags = append(tags, new_tags...) },
+	}
+	pool := loadTestPool(t, content_test_plugin, DEFAULT_PLUGIN_LIMITS)
+	ctx := WithContentSource(context.Background(), source)
+	call := func(arguments ...string) string {
+		result, err := pool.Call(ctx, "HandleShortcode", arguments)
+		require.Nil(t, err)
+		return result
+	}
+
+	assert.Equal(t, "Hello: World", call("post", "1"))
+	assert.Equal(t, "post 2 not found", call("post", "2"))
+	assert.Equal(t, "Landing Hi", call("page", "landing"))
+	assert.Equal(t, "2", call("pages"))
+	assert.Equal(t, "Shoe=10,Hat=5.5", call("cards", "products"))
+	assert.Equal(t, "1 /images/data/sky.png Blue sky", call("images"))
+	assert.Equal(t, "Our trip 1", call("gallery", "trip"))
+	assert.Equal(t, "gallery `beach` does not exist", call("gallery", "beach"))
+	assert.Equal(t, "Shop Home=/,Blog=/blog 1 3,1 Our trip nil nil", call("settings"))
+	assert.Equal(t, []string{
+		common.PostCacheTag(1),
+		common.PostCacheTag(2),
+		common.PageCacheTag("landing"),
+		common.CACHE_TAG_PAGES,
+		common.SchemaCacheTag("products"), common.CACHE_TAG_CARDS,
+		common.CACHE_TAG_IMAGES,
+		common.GalleryCacheTag("trip"), common.CACHE_TAG_IMAGES,
+		common.GalleryCacheTag("beach"), common.CACHE_TAG_IMAGES,
+		common.SettingsCacheTag(common.DEFAULT_SITE_ID),
+	}, tags)
+
+	// Calls without a source, like the ones loading the script, read nothing
+	_, err := pool.Call(context.Background(), "HandleShortcode", []string{"post", "1"})
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.ErrorContains(t, err, "gocms.post can't read content here")
+}
+
+func TestRendererRunsContentShortcodes(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.Shortcodes = []common.Shortcode{{Name: "latest", Plugin: "latest_posts_shortcode.lua"}}
+	})
+	renderer := &ShortcodeRenderer{}
+	defer renderer.Reset()
+
+	posts := []common.Post{{Id: 1, Title: "First"}}
+	source := &ContentSource{Database: mocks.DatabaseMock{
+		GetPostsHandler: func(limit int, offset int) ([]common.Post, error) {
+			assert.Equal(t, 2, limit)
+			return posts, nil
+		},
+	}}
+	ctx := WithContentSource(context.Background(), source)
+
+	assert.Equal(t, "- [First](/post/1)", renderer.Expand(ctx, "{{latest:2}}"))
+	// The result isn't kept, new posts are listed right away
+	posts = append(posts, common.Post{Id: 2, Title: "Second"})
+	assert.Equal(t, "- [First](/post/1)\n- [Second](/post/2)", renderer.Expand(ctx, "{{latest:2}}"))
+}
@@ -0,0 +1,184 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/rbc33/gocms/common"
+)
+
+// Events the plugins can subscribe to, the function of the
+// script named after the event gets the data as a table
+const (
+	// common.Post before it is added or changed, an error
+	// raised by the plugin stops the save
+	EVENT_BEFORE_POST_SAVE = "before_post_save"
+	// common.Post once saved, with its id
+	EVENT_AFTER_POST_SAVE = "after_post_save"
+	// common.Page before it is added or changed, an error
+	// raised by the plugin stops the save
+	EVENT_BEFORE_PAGE_SAVE = "before_page_save"
+	// common.Page once saved, with its id
+	EVENT_AFTER_PAGE_SAVE = "after_page_save"
+	// ImageUpload once the image is stored, an error raised
+	// by the plugin removes it again
+	EVENT_IMAGE_UPLOAD = "image_upload"
+	// RenderedContent of a post or Markdown page before it is put in
+	// the layout, plugins that fail leave it unchanged
+	EVENT_RENDER = "render"
+	// ContactSubmission before it is sent, an error raised by
+	// the plugin is shown to the visitor instead
+	EVENT_CONTACT_SUBMIT = "contact_submit"
+)
+
+var EVENTS = []string{
+	EVENT_BEFORE_POST_SAVE,
+	EVENT_AFTER_POST_SAVE,
+	EVENT_BEFORE_PAGE_SAVE,
+	EVENT_AFTER_PAGE_SAVE,
+	EVENT_IMAGE_UPLOAD,
+	EVENT_RENDER,
+	EVENT_CONTACT_SUBMIT,
+}
+
+type ImageUpload struct {
+	// File in the image directory
+	Name string `json:"name"`
+	// Name of the uploaded file, without the extension
+	Title       string `json:"title"`
+	Excerpt     string `json:"excerpt"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type RenderedContent struct {
+	// Request path of the page
+	Path  string `json:"path"`
+	Title string `json:"title"`
+	// HTML of the Markdown content
+	Html string `json:"html"`
+}
+
+type ContactSubmission struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+type hookRegistry struct {
+	pools []*LuaPool
+	// Pools of each event in the order of the config
+	events map[string][]*LuaPool
+}
+
+func loadHookRegistry(plugins []common.Plugin) (*hookRegistry, error) {
+	registry := &hookRegistry{events: make(map[string][]*LuaPool)}
+	for _, plugin := range plugins {
+		for _, event := range plugin.Events {
+			if !slices.Contains(EVENTS, event) {
+				registry.close()
+				return nil, fmt.Errorf("plugin %s subscribes to the unknown event `%s`", plugin.Name, event)
+			}
+		}
+
+		pool, err := LoadLuaPool(plugin.Name, plugin.Script, DEFAULT_PLUGIN_LIMITS)
+		if err != nil {
+			registry.close()
+			return nil, fmt.Errorf("could not load plugin %s: %w", plugin.Name, err)
+		}
+		registry.pools = append(registry.pools, pool)
+		for _, event := range plugin.Events {
+			if !pool.Defines(event) {
+				registry.close()
+				return nil, fmt.Errorf("plugin %s has no `%s` function", plugin.Name, event)
+			}
+			registry.events[event] = append(registry.events[event], pool)
+		}
+	}
+	return registry, nil
+}
+
+func (registry *hookRegistry) close() {
+	for _, pool := range registry.pools {
+		pool.Close()
+	}
+}
+
+// Plugins by the events they subscribe to. The zero value
+// has no plugins, and so does a nil one.
+type Hooks struct {
+	registry atomic.Pointer[hookRegistry]
+}
+
+func LoadHooks(plugins []common.Plugin) (*Hooks, error) {
+	hooks := &Hooks{}
+	if err := hooks.Reload(plugins); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// Loads the plugins again, the previous ones are kept when
+// any of them fails. Events running on the previous plugins
+// finish before they are closed.
+func (hooks *Hooks) Reload(plugins []common.Plugin) error {
+	registry, err := loadHookRegistry(plugins)
+	if err != nil {
+		return err
+	}
+	if previous := hooks.registry.Swap(registry); previous != nil {
+		previous.close()
+	}
+	return nil
+}
+
+func (hooks *Hooks) Subscribed(event string) bool {
+	if hooks == nil {
+		return false
+	}
+	registry := hooks.registry.Load()
+	return registry != nil && len(registry.events[event]) > 0
+}
+
+// Runs the plugins of the event in the order of the config, each
+// one gets the data as the previous ones left it. `data` points to
+// the struct of the event, the fields of the table returned by a
+// plugin are written to it and returning nothing leaves it as is.
+func (hooks *Hooks) Run(ctx context.Context, event string, data any) error {
+	if !hooks.Subscribed(event) {
+		return nil
+	}
+
+	for _, pool := range hooks.registry.Load().events[event] {
+		var table any
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(encoded, &table); err != nil {
+			return err
+		}
+
+		result, err := pool.CallData(ctx, event, table)
+		if err != nil {
+			return err
+		}
+		// Nothing or an empty table leaves the data as is,
+		// `{}` can't be told from an empty list
+		if items, is_list := result.([]any); result == nil || (is_list && len(items) == 0) {
+			continue
+		}
+		encoded, err = json.Marshal(result)
+		if err == nil {
+			err = json.Unmarshal(encoded, data)
+		}
+		if err != nil {
+			return &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_RESULT, Message: fmt.Sprintf("%s returned %v", event, err)}
+		}
+	}
+	return nil
+}
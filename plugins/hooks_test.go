@@ -0,0 +1,106 @@
+package plugins
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestScript(t *testing.T, name string, script string) string {
+	path := filepath.Join(t.TempDir(), name+".lua")
+	require.Nil(t, os.WriteFile(path, []byte(script), 0644))
+	return path
+}
+
+func TestHooksRunInOrder(t *testing.T) {
+	first := writeTestScript(t, "first", `
+function before_post_save(post)
+	post.title = post.title .. " first"
+	-- Fields the event doesn't have are dropped
+	post.tags = {"a", "b"}
+	return post
+end
+`)
+	second := writeTestScript(t, "second", `
+function before_post_save(post)
+	return {title = post.title .. " second", excerpt = type(post.tags)}
+end
+
+function after_post_save(post)
+end
+`)
+	hooks, err := LoadHooks([]common.Plugin{
+		{Name: "first", Script: first, Events: []string{EVENT_BEFORE_POST_SAVE}},
+		{Name: "second", Script: second, Events: []string{EVENT_BEFORE_POST_SAVE, EVENT_AFTER_POST_SAVE}},
+	})
+	require.Nil(t, err)
+	assert.True(t, hooks.Subscribed(EVENT_AFTER_POST_SAVE))
+	assert.False(t, hooks.Subscribed(EVENT_RENDER))
+
+	post := common.Post{Id: 3, Title: "Post", Excerpt: "Excerpt", Content: "Content"}
+	require.Nil(t, hooks.Run(context.Background(), EVENT_BEFORE_POST_SAVE, &post))
+	assert.Equal(t, common.Post{Id: 3, Title: "Post first second", Excerpt: "nil", Content: "Content"}, post)
+
+	// Returning nothing leaves the data as is
+	require.Nil(t, hooks.Run(context.Background(), EVENT_AFTER_POST_SAVE, &post))
+	assert.Equal(t, "Post first second", post.Title)
+
+	// Events without plugins, and nil hooks, do nothing
+	require.Nil(t, hooks.Run(context.Background(), EVENT_RENDER, &post))
+	var no_hooks *Hooks
+	require.Nil(t, no_hooks.Run(context.Background(), EVENT_RENDER, &post))
+}
+
+func TestHooksErrors(t *testing.T) {
+	script := writeTestScript(t, "test", `
+function before_page_save(page)
+	if page.title == "" then
+		error("pages need a title")
+	elseif page.title == "number" then
+		return {title = 42}
+	elseif page.title == "mixed" then
+		return {1, title = "mixed"}
+	elseif page.title == "empty" then
+		return {}
+	end
+end
+`)
+	_, err := LoadHooks([]common.Plugin{{Name: "test", Script: script, Events: []string{"on_save"}}})
+	assert.ErrorContains(t, err, "unknown event `on_save`")
+
+	_, err = LoadHooks([]common.Plugin{{Name: "test", Script: script, Events: []string{EVENT_RENDER}}})
+	assert.ErrorContains(t, err, "has no `render` function")
+
+	_, err = LoadHooks([]common.Plugin{{Name: "test", Script: script + ".missing", Events: []string{EVENT_RENDER}}})
+	assert.Equal(t, PLUGIN_ERROR_LOAD, pluginErrorKind(t, err))
+
+	hooks, err := LoadHooks([]common.Plugin{{Name: "test", Script: script, Events: []string{EVENT_BEFORE_PAGE_SAVE}}})
+	require.Nil(t, err)
+	run := func(title string) error {
+		return hooks.Run(context.Background(), EVENT_BEFORE_PAGE_SAVE, &common.Page{Title: title})
+	}
+
+	err = run("")
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.ErrorContains(t, err, "pages need a title")
+	assert.Equal(t, "pages need a title", err.(*PluginError).Public())
+
+	assert.Equal(t, PLUGIN_ERROR_RESULT, pluginErrorKind(t, run("number")))
+	assert.Equal(t, "the request could not be processed", run("number").(*PluginError).Public())
+	assert.Equal(t, PLUGIN_ERROR_RESULT, pluginErrorKind(t, run("mixed")))
+	assert.Nil(t, run("Page"))
+	page := common.Page{Title: "empty", Link: "kept"}
+	require.Nil(t, hooks.Run(context.Background(), EVENT_BEFORE_PAGE_SAVE, &page))
+	assert.Equal(t, common.Page{Title: "empty", Link: "kept"}, page)
+
+	// Plugins failing to load keep the previous ones
+	assert.NotNil(t, hooks.Reload([]common.Plugin{{Name: "test", Script: script, Events: []string{EVENT_RENDER}}}))
+	assert.True(t, hooks.Subscribed(EVENT_BEFORE_PAGE_SAVE))
+	require.Nil(t, hooks.Reload(nil))
+	assert.False(t, hooks.Subscribed(EVENT_BEFORE_PAGE_SAVE))
+}
@@ -0,0 +1,9 @@
+-- {{latest:5}} lists the links of the first posts of the site
+function HandleShortcode(arguments)
+    local limit = tonumber(arguments[1]) or 5
+    local lines = {}
+    for _, post in ipairs(gocms.posts(limit)) do
+        table.insert(lines, string.format("- [%s](/post/%d)", post.title, post.id))
+    end
+    return table.concat(lines, "\n")
+end
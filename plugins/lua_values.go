@@ -0,0 +1,101 @@
+package plugins
+
+import (
+	"fmt"
+	"math"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Tables nested deeper are refused, they may refer to themselves
+const MAX_TABLE_DEPTH = 32
+
+// Lua value of data decoded from JSON: maps, slices, strings,
+// numbers, booleans and nil
+func toLuaValue(state *lua.LState, value any) lua.LValue {
+	switch typed := value.(type) {
+	case nil:
+		return lua.LNil
+	case string:
+		return lua.LString(typed)
+	case bool:
+		return lua.LBool(typed)
+	case float64:
+		return lua.LNumber(typed)
+	case int:
+		return lua.LNumber(typed)
+	case map[string]any:
+		table := state.NewTable()
+		for key, item := range typed {
+			table.RawSetString(key, toLuaValue(state, item))
+		}
+		return table
+	case []any:
+		table := state.NewTable()
+		for _, item := range typed {
+			table.Append(toLuaValue(state, item))
+		}
+		return table
+	}
+	return lua.LString(fmt.Sprint(value))
+}
+
+// Tables with the keys 1..n become slices, the other ones maps
+// with string keys. Empty tables are taken as empty slices.
+func fromLuaValue(value lua.LValue, depth int) (any, error) {
+	switch typed := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LString:
+		return string(typed), nil
+	case lua.LBool:
+		return bool(typed), nil
+	case lua.LNumber:
+		number := float64(typed)
+		if math.IsInf(number, 0) || math.IsNaN(number) {
+			return nil, fmt.Errorf("a number out of range")
+		}
+		return number, nil
+	case *lua.LTable:
+		if depth >= MAX_TABLE_DEPTH {
+			return nil, fmt.Errorf("tables nested more than %d times", MAX_TABLE_DEPTH)
+		}
+		length := typed.Len()
+		items := make([]any, length)
+		fields := map[string]any{}
+		var err error
+		typed.ForEach(func(key lua.LValue, item lua.LValue) {
+			if err != nil {
+				return
+			}
+			var converted any
+			if converted, err = fromLuaValue(item, depth+1); err != nil {
+				return
+			}
+			switch typed_key := key.(type) {
+			case lua.LNumber:
+				index := int(typed_key)
+				if float64(index) != float64(typed_key) || index < 1 || index > length {
+					err = fmt.Errorf("a table with the number key %v", typed_key)
+					return
+				}
+				items[index-1] = converted
+			case lua.LString:
+				fields[string(typed_key)] = converted
+			default:
+				err = fmt.Errorf("a table with a %s key", key.Type())
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			return items, nil
+		}
+		if length > 0 {
+			return nil, fmt.Errorf("a table mixing a list and fields")
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("a %s value", value.Type())
+}
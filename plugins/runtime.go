@@ -0,0 +1,388 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Kinds of plugin errors
+const (
+	// The script could not be read or run when loaded
+	PLUGIN_ERROR_LOAD = "load"
+	// No plugin with that name
+	PLUGIN_ERROR_MISSING = "missing"
+	// The call took longer than PluginLimits.Timeout
+	PLUGIN_ERROR_TIMEOUT = "timeout"
+	// The request was cancelled before the call finished
+	PLUGIN_ERROR_CANCELED = "canceled"
+	// The call went over the stack, output or allocation limits
+	PLUGIN_ERROR_LIMIT = "limit"
+	// The script raised an error
+	PLUGIN_ERROR_RUNTIME = "runtime"
+	// The script returned something other than a string
+	PLUGIN_ERROR_RESULT = "result"
+)
+
+// Libraries the scripts can use, without `os`, `io`,
+// `package`, `coroutine` or `debug`
+var sandbox_libraries = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// Functions of the base library that read files, load
+// code or reach the runtime
+var sandbox_removed = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "print", "getfenv", "setfenv", "newproxy"}
+
+type PluginLimits struct {
+	// Longest a call can run, the script is stopped
+	// at the next instruction after it
+	Timeout time.Duration
+	// Nested function calls
+	CallStackSize int
+	// Values on the Lua stack of the state
+	RegistryMaxSize int
+	// Longest string returned or built by the script
+	MaxOutputSize int
+	// Bytes of all the strings and tables a call can build,
+	// strings grown in a loop copy the whole string each time.
+	// States are made again once their calls built this much,
+	// so what the scripts keep in their globals is bounded too.
+	MaxAllocSize int
+	// States kept for each plugin, calls wait for
+	// a free one when all of them are running
+	PoolSize int
+}
+
+var DEFAULT_PLUGIN_LIMITS = PluginLimits{
+	Timeout:         200 * time.Millisecond,
+	CallStackSize:   200,
+	RegistryMaxSize: 64 * 1024,
+	MaxOutputSize:   1024 * 1024,
+	MaxAllocSize:    64 * 1024 * 1024,
+	PoolSize:        runtime.GOMAXPROCS(0),
+}
+
+// Error of a plugin call, answered as is by the admin API
+type PluginError struct {
+	Plugin string `json:"plugin"`
+	Kind   string `json:"kind"`
+	// Message of the error, with the script line if
+	// the script raised it
+	Message string `json:"message"`
+}
+
+func (err *PluginError) Error() string {
+	return fmt.Sprintf("%s plugin %s error: %s", err.Plugin, err.Kind, err.Message)
+}
+
+// Errors raised by the scripts start with `script.lua:line: `
+var script_position_regex = regexp.MustCompile(`^[^\n]*?:[0-9]+: `)
+
+// Message that can be shown to visitors: what the script raised,
+// without the script path and the traceback. Other kinds of errors
+// only say the plugin failed.
+func (err *PluginError) Public() string {
+	if err.Kind != PLUGIN_ERROR_RUNTIME {
+		return "the request could not be processed"
+	}
+	message, _, _ := strings.Cut(err.Message, "\nstack traceback:")
+	return script_position_regex.ReplaceAllString(message, "")
+}
+
+// States running the same compiled script, each one is used
+// by one call at a time since Lua states aren't goroutine safe
+type LuaPool struct {
+	name   string
+	proto  *lua.FunctionProto
+	limits PluginLimits
+
+	mutex  sync.Mutex
+	idle   []*luaState
+	closed bool
+	// Holds a value for each state running a call
+	slots chan struct{}
+}
+
+type luaState struct {
+	*lua.LState
+	// Bytes built by every call of the state
+	allocated int
+}
+
+// Compiles the script once, the states of the pool run it
+// when they are made. The first state is made right away
+// so errors at the top level of the script are found.
+func LoadLuaPool(name string, script_path string, limits PluginLimits) (*LuaPool, error) {
+	script, err := os.ReadFile(script_path)
+	if err != nil {
+		return nil, &PluginError{Plugin: name, Kind: PLUGIN_ERROR_LOAD, Message: err.Error()}
+	}
+	chunk, err := parse.Parse(strings.NewReader(string(script)), script_path)
+	if err != nil {
+		return nil, &PluginError{Plugin: name, Kind: PLUGIN_ERROR_LOAD, Message: err.Error()}
+	}
+	boundAllocations(chunk)
+	proto, err := lua.Compile(chunk, script_path)
+	if err != nil {
+		return nil, &PluginError{Plugin: name, Kind: PLUGIN_ERROR_LOAD, Message: err.Error()}
+	}
+
+	pool := &LuaPool{
+		name:   name,
+		proto:  proto,
+		limits: limits,
+		slots:  make(chan struct{}, max(limits.PoolSize, 1)),
+	}
+	state, err := pool.makeState()
+	if err != nil {
+		return nil, err
+	}
+	pool.idle = append(pool.idle, state)
+	return pool, nil
+}
+
+func (pool *LuaPool) makeState() (*luaState, error) {
+	state := &luaState{LState: lua.NewState(lua.Options{
+		SkipOpenLibs:        true,
+		CallStackSize:       pool.limits.CallStackSize,
+		RegistrySize:        min(1024, pool.limits.RegistryMaxSize),
+		RegistryMaxSize:     pool.limits.RegistryMaxSize,
+		MinimizeStackMemory: true,
+	})}
+	for _, library := range sandbox_libraries {
+		state.Push(state.NewFunction(library.open))
+		state.Push(lua.LString(library.name))
+		state.Call(1, 0)
+	}
+	for _, name := range sandbox_removed {
+		state.SetGlobal(name, lua.LNil)
+	}
+	string_library := state.GetGlobal(lua.StringLibName).(*lua.LTable)
+	string_library.RawSetString("rep", state.NewFunction(pool.boundedRep))
+	for _, name := range []string{"format", "gsub"} {
+		string_library.RawSetString(name, state.NewFunction(pool.countingResults(string_library.RawGetString(name))))
+	}
+	table_library := state.GetGlobal(lua.TabLibName).(*lua.LTable)
+	table_library.RawSetString("concat", state.NewFunction(pool.boundedTableConcat))
+	table_library.RawSetString("insert", state.NewFunction(pool.countingEntry(table_library.RawGetString("insert"))))
+	state.SetGlobal("rawset", state.NewFunction(pool.countingEntry(state.GetGlobal("rawset"))))
+	state.SetGlobal(CONCAT_FUNCTION, state.NewFunction(pool.boundedConcat))
+	state.SetGlobal(SET_INDEX_FUNCTION, state.NewFunction(pool.boundedSetIndex))
+	state.SetGlobal(NEW_TABLE_FUNCTION, state.NewFunction(pool.countedTable))
+	openContentModule(state.LState)
+
+	err := pool.protect(context.Background(), state, func() error {
+		state.Push(state.NewFunctionFromProto(pool.proto))
+		return state.PCall(0, 0, nil)
+	})
+	if err != nil {
+		state.Close()
+		err.(*PluginError).Kind = PLUGIN_ERROR_LOAD
+		return nil, err
+	}
+	return state, nil
+}
+
+// string.rep is the easy way to fill the memory
+func (pool *LuaPool) boundedRep(state *lua.LState) int {
+	text := state.CheckString(1)
+	count := state.CheckInt(2)
+	separator := state.OptString(3, "")
+	if count > 0 && (len(text)+len(separator))*count > pool.limits.MaxOutputSize {
+		state.RaiseError("string.rep over the output limit of %d bytes", pool.limits.MaxOutputSize)
+	}
+	if count <= 0 {
+		state.Push(lua.LString(""))
+		return 1
+	}
+	pool.allocate(state, (len(text)+len(separator))*count-len(separator))
+	state.Push(lua.LString(strings.Repeat(text+separator, count-1) + text))
+	return 1
+}
+
+// Runs `run` with the call limits, turning what went
+// wrong into a PluginError
+func (pool *LuaPool) protect(ctx context.Context, state *luaState, run func() error) (err error) {
+	allocated := 0
+	call_context, cancel := context.WithTimeout(withAllocationBudget(ctx, &allocated), pool.limits.Timeout)
+	defer cancel()
+	defer func() { state.allocated += allocated }()
+	state.SetContext(call_context)
+	defer state.RemoveContext()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_LIMIT, Message: fmt.Sprint(recovered)}
+		}
+	}()
+
+	err = run()
+	if err == nil {
+		return nil
+	}
+	if plugin_error, is_plugin_error := err.(*PluginError); is_plugin_error {
+		return plugin_error
+	}
+	plugin_error := &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_RUNTIME, Message: err.Error()}
+	switch {
+	case errors.Is(call_context.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		plugin_error.Kind = PLUGIN_ERROR_TIMEOUT
+		plugin_error.Message = fmt.Sprintf("did not finish in %v", pool.limits.Timeout)
+	case ctx.Err() != nil:
+		plugin_error.Kind = PLUGIN_ERROR_CANCELED
+		plugin_error.Message = ctx.Err().Error()
+	case strings.Contains(err.Error(), "stack overflow") || strings.Contains(err.Error(), "registry overflow") ||
+		strings.Contains(err.Error(), "over the allocation limit"):
+		plugin_error.Kind = PLUGIN_ERROR_LIMIT
+	}
+	return plugin_error
+}
+
+// Waits for a free slot of the pool, idle states are
+// used first and new ones are made when there are none
+func (pool *LuaPool) acquire(ctx context.Context) (*luaState, error) {
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_CANCELED, Message: ctx.Err().Error()}
+	}
+
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		<-pool.slots
+		return nil, &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_MISSING, Message: "the plugin was unloaded"}
+	}
+	if len(pool.idle) > 0 {
+		state := pool.idle[len(pool.idle)-1]
+		pool.idle = pool.idle[:len(pool.idle)-1]
+		pool.mutex.Unlock()
+		return state, nil
+	}
+	pool.mutex.Unlock()
+
+	state, err := pool.makeState()
+	if err != nil {
+		<-pool.slots
+		return nil, err
+	}
+	return state, nil
+}
+
+// States that failed a call may be left in the middle
+// of it, they are closed instead of given back. So are
+// the ones that built more than the allocation limit,
+// they could be keeping all of it.
+func (pool *LuaPool) release(state *luaState, broken bool) {
+	pool.mutex.Lock()
+	if broken || pool.closed || state.allocated > pool.limits.MaxAllocSize {
+		state.Close()
+	} else {
+		pool.idle = append(pool.idle, state)
+	}
+	pool.mutex.Unlock()
+	<-pool.slots
+}
+
+// Calls the global function of the script with the argument
+// made by `argument`, `read` gets the returned value before
+// the state is given back to the pool
+func (pool *LuaPool) call(ctx context.Context, function string, argument func(*lua.LState) lua.LValue, read func(lua.LValue) error) error {
+	state, err := pool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = pool.protect(ctx, state, func() error {
+		err := state.CallByParam(lua.P{Fn: state.GetGlobal(function), NRet: 1, Protect: true}, argument(state.LState))
+		if err != nil {
+			return err
+		}
+		result := state.Get(-1)
+		state.Pop(1)
+		return read(result)
+	})
+	pool.release(state, err != nil)
+	return err
+}
+
+// Calls the global function of the script with the arguments
+// in a table, it must return a string
+func (pool *LuaPool) Call(ctx context.Context, function string, arguments []string) (string, error) {
+	var text lua.LString
+	err := pool.call(ctx, function, func(state *lua.LState) lua.LValue {
+		table := state.NewTable()
+		for _, argument := range arguments {
+			table.Append(lua.LString(argument))
+		}
+		return table
+	}, func(result lua.LValue) error {
+		var is_string bool
+		if text, is_string = result.(lua.LString); !is_string {
+			return &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_RESULT, Message: fmt.Sprintf("%s returned %s instead of a string", function, result.Type())}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(text) > pool.limits.MaxOutputSize {
+		return "", &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_LIMIT, Message: fmt.Sprintf("returned %d bytes, over the output limit of %d", len(text), pool.limits.MaxOutputSize)}
+	}
+	return string(text), nil
+}
+
+// Calls the global function of the script with the data as a
+// table, JSON like values are passed both ways. Nil is returned
+// when the function returns nothing.
+func (pool *LuaPool) CallData(ctx context.Context, function string, data any) (any, error) {
+	var result any
+	err := pool.call(ctx, function, func(state *lua.LState) lua.LValue {
+		return toLuaValue(state, data)
+	}, func(value lua.LValue) (err error) {
+		result, err = fromLuaValue(value, 0)
+		if err != nil {
+			return &PluginError{Plugin: pool.name, Kind: PLUGIN_ERROR_RESULT, Message: fmt.Sprintf("%s returned %v", function, err)}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Whether the script has a global function with the name
+func (pool *LuaPool) Defines(function string) bool {
+	state, err := pool.acquire(context.Background())
+	if err != nil {
+		return false
+	}
+	defer pool.release(state, false)
+	return state.GetGlobal(function).Type() == lua.LTFunction
+}
+
+// Closes the idle states, the ones running a call
+// are closed when it finishes
+func (pool *LuaPool) Close() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.closed = true
+	for _, state := range pool.idle {
+		state.Close()
+	}
+	pool.idle = nil
+}
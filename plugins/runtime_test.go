@@ -0,0 +1,303 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const test_plugin = `
+calls = 0
+
+function HandleShortcode(arguments)
+	calls = calls + 1
+	local mode = arguments[1]
+	if mode == "echo" then
+		return arguments[2]
+	elseif mode == "globals" then
+		return string.format("%s %s %s %s", type(os), type(io), type(dofile), type(require))
+	elseif mode == "loop" then
+		while true do end
+	elseif mode == "recurse" then
+		local function down(n) return down(n + 1) + 1 end
+		return down(0)
+	elseif mode == "rep" then
+		return string.rep("x", 10 * 1024 * 1024)
+	elseif mode == "number" then
+		return 42
+	elseif mode == "raise" then
+		error("bad arguments")
+	elseif mode == "calls" then
+		return tostring(calls)
+	end
+	return ""
+end
+`
+
+func loadTestPool(t *testing.T, script string, limits PluginLimits) *LuaPool {
+	path := filepath.Join(t.TempDir(), "plugin.lua")
+	require.Nil(t, os.WriteFile(path, []byte(script), 0644))
+	pool, err := LoadLuaPool("test", path, limits)
+	require.Nil(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func pluginErrorKind(t *testing.T, err error) string {
+	var plugin_error *PluginError
+	require.True(t, errors.As(err, &plugin_error), "expected a plugin error, got %v", err)
+	assert.Equal(t, "test", plugin_error.Plugin)
+	return plugin_error.Kind
+}
+
+func TestLuaPoolSandbox(t *testing.T) {
+	limits := DEFAULT_PLUGIN_LIMITS
+	limits.Timeout = 50 * time.Millisecond
+	pool := loadTestPool(t, test_plugin, limits)
+	call := func(arguments ...string) (string, error) {
+		return pool.Call(context.Background(), "HandleShortcode", arguments)
+	}
+
+	result, err := call("echo", "hello")
+	require.Nil(t, err)
+	assert.Equal(t, "hello", result)
+
+	result, err = call("globals")
+	require.Nil(t, err)
+	assert.Equal(t, "nil nil nil nil", result)
+
+	started := time.Now()
+	_, err = call("loop")
+	assert.Equal(t, PLUGIN_ERROR_TIMEOUT, pluginErrorKind(t, err))
+	assert.Less(t, time.Since(started), time.Second)
+
+	_, err = call("recurse")
+	assert.Equal(t, PLUGIN_ERROR_LIMIT, pluginErrorKind(t, err))
+
+	_, err = call("rep")
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "output limit")
+
+	_, err = call("number")
+	assert.Equal(t, PLUGIN_ERROR_RESULT, pluginErrorKind(t, err))
+
+	_, err = call("raise")
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "bad arguments")
+
+	// The states that failed were closed, the pool still works
+	result, err = call("echo", "again")
+	require.Nil(t, err)
+	assert.Equal(t, "again", result)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pool.Call(ctx, "HandleShortcode", []string{"echo", "late"})
+	assert.Equal(t, PLUGIN_ERROR_CANCELED, pluginErrorKind(t, err))
+}
+
+const allocations_test_plugin = `
+CACHE = {}
+
+local Name = {}
+Name.__concat = function(lhs, rhs)
+	return "<" .. tostring(type(lhs) == "table" and lhs.name or lhs) .. tostring(type(rhs) == "table" and rhs.name or rhs) .. ">"
+end
+
+function HandleShortcode(arguments)
+	local mode = arguments[1]
+	if mode == "join" then
+		local name = setmetatable({name = "ann"}, Name)
+		return "a" .. 1 .. ("b" .. 2.5) .. " " .. name .. "!"
+	elseif mode == "grow" then
+		-- Each step copies the whole string
+		local text = ""
+		for i = 1, 100000 do
+			text = text .. "xxxxxxxxxx"
+		end
+		return "done"
+	elseif mode == "double" then
+		local text = "x"
+		while true do
+			text = text .. text
+		end
+	elseif mode == "table" then
+		local parts = {}
+		for i = 1, 2000 do
+			parts[i] = string.format("%05d", i)
+		end
+		for i = 1, 1000 do
+			local joined = table.concat(parts, ",")
+		end
+		return "done"
+	elseif mode == "nil" then
+		return "a" .. nil
+	elseif mode == "assign" then
+		local a, b = {}, {}
+		a.x, b[1], a.y = 1, 2
+		local t = {1, 2}
+		t[1], t[2] = t[2], t[1]
+		local log = {}
+		local proxy = setmetatable({}, {__newindex = function(t, k, v) rawset(log, k, v) end})
+		proxy.name = "ann"
+		return a.x .. b[1] .. tostring(a.y) .. t[1] .. t[2] .. log.name
+	elseif mode == "index nil" then
+		local missing
+		missing.x = 1
+	elseif mode == "fill" then
+		local t = {}
+		for i = 1, 1e9 do
+			t[i] = i
+		end
+	elseif mode == "keep" then
+		for i = 1, 10000 do
+			CACHE[#CACHE + 1] = i
+		end
+		return tostring(#CACHE)
+	end
+end
+`
+
+func TestLuaPoolAllocationLimits(t *testing.T) {
+	limits := DEFAULT_PLUGIN_LIMITS
+	limits.Timeout = time.Second
+	limits.MaxAllocSize = 8 * 1024 * 1024
+	pool := loadTestPool(t, allocations_test_plugin, limits)
+	call := func(mode string) (string, error) {
+		return pool.Call(context.Background(), "HandleShortcode", []string{mode})
+	}
+
+	// `..` works as usual, metamethods included
+	result, err := call("join")
+	require.Nil(t, err)
+	assert.Equal(t, "a1b2.5 <ann!>", result)
+
+	_, err = call("nil")
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "cannot perform concat operation between string and nil")
+
+	// Strings grown in a loop stop at the budget of the call
+	// long before the timeout
+	started := time.Now()
+	_, err = call("grow")
+	assert.Equal(t, PLUGIN_ERROR_LIMIT, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "allocation limit")
+	assert.Less(t, time.Since(started), limits.Timeout)
+
+	_, err = call("double")
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "output limit")
+
+	_, err = call("table")
+	assert.Equal(t, PLUGIN_ERROR_LIMIT, pluginErrorKind(t, err))
+
+	// Writes to table fields work as usual
+	result, err = call("assign")
+	require.Nil(t, err)
+	assert.Equal(t, "12nil21ann", result)
+
+	_, err = call("index nil")
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "attempt to index a non-table object(nil)")
+
+	// Tables filled in a loop stop at the budget too
+	started = time.Now()
+	_, err = call("fill")
+	assert.Equal(t, PLUGIN_ERROR_LIMIT, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "allocation limit")
+	assert.Less(t, time.Since(started), limits.Timeout)
+
+	// What the calls keep in the globals goes away with the
+	// state once they built more than the limit together
+	kept := 0
+	recycled := false
+	for range 100 {
+		result, err = call("keep")
+		require.Nil(t, err)
+		count, err := strconv.Atoi(result)
+		require.Nil(t, err)
+		// The limit was not reached before the last call
+		assert.LessOrEqual(t, (count-10000)*TABLE_ENTRY_SIZE, limits.MaxAllocSize)
+		recycled = recycled || count < kept
+		kept = count
+	}
+	assert.True(t, recycled)
+
+	// Each call has its own budget
+	result, err = call("join")
+	require.Nil(t, err)
+	assert.Equal(t, "a1b2.5 <ann!>", result)
+}
+
+func TestLuaPoolConcurrentCalls(t *testing.T) {
+	limits := DEFAULT_PLUGIN_LIMITS
+	limits.PoolSize = 2
+	pool := loadTestPool(t, test_plugin, limits)
+
+	var group sync.WaitGroup
+	results := make([]string, 50)
+	for i := range results {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			result, err := pool.Call(context.Background(), "HandleShortcode", []string{"echo", fmt.Sprint(i)})
+			assert.Nil(t, err)
+			results[i] = result
+		}()
+	}
+	group.Wait()
+	for i, result := range results {
+		assert.Equal(t, fmt.Sprint(i), result)
+	}
+
+	// No more states than the pool size were made
+	pool.mutex.Lock()
+	assert.LessOrEqual(t, len(pool.idle), 2)
+	pool.mutex.Unlock()
+
+	pool.Close()
+	_, err := pool.Call(context.Background(), "HandleShortcode", []string{"echo", "closed"})
+	assert.Equal(t, PLUGIN_ERROR_MISSING, pluginErrorKind(t, err))
+}
+
+func TestLuaPoolLoadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plugin.lua")
+
+	_, err := LoadLuaPool("test", path, DEFAULT_PLUGIN_LIMITS)
+	assert.Equal(t, PLUGIN_ERROR_LOAD, pluginErrorKind(t, err))
+
+	require.Nil(t, os.WriteFile(path, []byte("function HandleShortcode("), 0644))
+	_, err = LoadLuaPool("test", path, DEFAULT_PLUGIN_LIMITS)
+	assert.Equal(t, PLUGIN_ERROR_LOAD, pluginErrorKind(t, err))
+
+	// Scripts can't read files when they are loaded either
+	require.Nil(t, os.WriteFile(path, []byte(`local file = io.open("/etc/passwd")`), 0644))
+	_, err = LoadLuaPool("test", path, DEFAULT_PLUGIN_LIMITS)
+	assert.Equal(t, PLUGIN_ERROR_LOAD, pluginErrorKind(t, err))
+
+	require.Nil(t, os.WriteFile(path, []byte("while true do end"), 0644))
+	limits := DEFAULT_PLUGIN_LIMITS
+	limits.Timeout = 20 * time.Millisecond
+	_, err = LoadLuaPool("test", path, limits)
+	assert.Equal(t, PLUGIN_ERROR_LOAD, pluginErrorKind(t, err))
+	assert.Contains(t, err.Error(), "did not finish")
+}
+
+func TestExpandShortcodesErrors(t *testing.T) {
+	handlers := ShortcodeHandlers{"test": loadTestPool(t, test_plugin, DEFAULT_PLUGIN_LIMITS)}
+
+	expanded, plugin_errors := ExpandShortcodes(context.Background(), "a {{test:echo:b}} {{test:raise}} {{other:x}} c", handlers)
+	assert.Equal(t, "a b   c", expanded)
+	require.Len(t, plugin_errors, 2)
+	assert.Equal(t, PLUGIN_ERROR_RUNTIME, plugin_errors[0].Kind)
+	assert.Equal(t, PluginError{Plugin: "other", Kind: PLUGIN_ERROR_MISSING, Message: "unsupported shortcode: other"}, *plugin_errors[1])
+}
@@ -0,0 +1,224 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rs/zerolog/log"
+)
+
+// Results of the shortcodes kept by the renderer, they
+// are dropped all at once when there are more
+const MAX_SHORTCODE_RESULTS = 1024
+
+// Shortcodes look like {{name:value:value}}
+var shortcode_regex = regexp.MustCompile(`{{[\w.-]+(:[\w.-]+)+}}`)
+
+// Lua pools of the shortcodes by name
+type ShortcodeHandlers map[string]*LuaPool
+
+func LoadShortcodeHandlers(shortcodes []common.Shortcode) (ShortcodeHandlers, error) {
+	shortcode_handlers := make(ShortcodeHandlers, 0)
+	for _, shortcode := range shortcodes {
+		pool, err := LoadLuaPool(shortcode.Name, shortcode.Plugin, DEFAULT_PLUGIN_LIMITS)
+		if err != nil {
+			shortcode_handlers.Close()
+			return ShortcodeHandlers{}, fmt.Errorf("could not load %s: %w", shortcode.Name, err)
+		}
+		shortcode_handlers[shortcode.Name] = pool
+	}
+	return shortcode_handlers, nil
+}
+
+func (shortcode_handlers ShortcodeHandlers) Close() {
+	for _, pool := range shortcode_handlers {
+		pool.Close()
+	}
+}
+
+// Names of the shortcodes used in the content, once each
+func FindShortcodes(content string) []string {
+	names := []string{}
+	for _, shortcode := range shortcode_regex.FindAllString(content, -1) {
+		name, _, _ := strings.Cut(shortcode[2:len(shortcode)-2], ":")
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// partitionString will partition the strings by
+// removing the given ranges
+func partitionString(text string, indexes [][]int) []string {
+
+	if len(text) == 0 {
+		return []string{}
+	}
+
+	partitions := make([]string, 0)
+	start := 0
+	for _, window := range indexes {
+		partitions = append(partitions, text[start:window[0]])
+		start = window[1]
+	}
+
+	partitions = append(partitions, text[start:])
+	return partitions
+}
+
+func shortcodeToMarkdown(ctx context.Context, shortcode string, shortcode_handlers ShortcodeHandlers) (string, error) {
+	key_value := strings.Split(shortcode, ":")
+
+	key := key_value[0]
+	values := key_value[1:]
+
+	handler, found := shortcode_handlers[key]
+	if !found {
+		return "", &PluginError{Plugin: key, Kind: PLUGIN_ERROR_MISSING, Message: fmt.Sprintf("unsupported shortcode: %s", key)}
+	}
+	return handler.Call(ctx, "HandleShortcode", values)
+}
+
+// Replaces the shortcodes of the content by the Markdown
+// of their plugins, `expand` is called for each of them
+func replaceShortcodes(content string, expand func(shortcode string) string) string {
+	shortcodes := shortcode_regex.FindAllStringIndex(content, -1)
+	if len(shortcodes) == 0 {
+		return content
+	}
+
+	partitions := partitionString(content, shortcodes)
+
+	builder := strings.Builder{}
+
+	for i, shortcode := range shortcodes {
+		builder.WriteString(partitions[i])
+		builder.WriteString(expand(content[shortcode[0]+2 : shortcode[1]-2]))
+	}
+
+	// Guaranteed to have +1 than the number of
+	// shortcodes by algorithm
+	builder.WriteString(partitions[len(shortcodes)])
+
+	return builder.String()
+}
+
+// Shortcodes that fail are left out, their errors
+// are returned in the order of the content
+func ExpandShortcodes(ctx context.Context, content string, shortcode_handlers ShortcodeHandlers) (string, []*PluginError) {
+	plugin_errors := []*PluginError{}
+	expanded := replaceShortcodes(content, func(shortcode string) string {
+		markdown, err := shortcodeToMarkdown(ctx, shortcode, shortcode_handlers)
+		if err != nil {
+			log.Error().Msgf("%v", err)
+			plugin_errors = append(plugin_errors, err.(*PluginError))
+		}
+		return markdown
+	})
+	return expanded, plugin_errors
+}
+
+type shortcode_failures_key struct{}
+
+// The returned flag is set when a shortcode expanded with the
+// context failed, timed out or was canceled. The content is
+// rendered without it then and shouldn't be kept.
+func TrackShortcodeFailures(ctx context.Context) (context.Context, *bool) {
+	failed := false
+	return context.WithValue(ctx, shortcode_failures_key{}, &failed), &failed
+}
+
+// Expands the shortcodes when the content is rendered. The plugins
+// of the current settings are loaded on first use and again after
+// the settings change.
+type ShortcodeRenderer struct {
+	mutex      sync.Mutex
+	loaded     bool
+	shortcodes []common.Shortcode
+	handlers   ShortcodeHandlers
+	results    map[string]string
+}
+
+// Loads the plugins again on the next use, even if the
+// settings did not change their scripts may have
+func (renderer *ShortcodeRenderer) Reset() {
+	renderer.mutex.Lock()
+	defer renderer.mutex.Unlock()
+	renderer.close()
+}
+
+// Calls running on the closed pools finish first
+func (renderer *ShortcodeRenderer) close() {
+	renderer.handlers.Close()
+	renderer.loaded = false
+	renderer.handlers = nil
+	renderer.results = nil
+}
+
+func (renderer *ShortcodeRenderer) load() (ShortcodeHandlers, map[string]string) {
+	renderer.mutex.Lock()
+	defer renderer.mutex.Unlock()
+
+	shortcodes := common.CurrentSettings().Shortcodes
+	if renderer.loaded && slices.Equal(shortcodes, renderer.shortcodes) {
+		return renderer.handlers, renderer.results
+	}
+	renderer.close()
+
+	handlers, err := LoadShortcodeHandlers(shortcodes)
+	if err != nil {
+		log.Error().Msgf("could not load shortcodes, content will be shown without them: %v", err)
+	}
+	renderer.loaded = true
+	renderer.shortcodes = shortcodes
+	renderer.handlers = handlers
+	renderer.results = make(map[string]string)
+	return renderer.handlers, renderer.results
+}
+
+// Shortcodes give the same Markdown for the same values, so
+// their results are kept until the plugins are loaded again.
+// The ones reading content with the `gocms` module are run each
+// time, and so are failed shortcodes after they are logged and
+// reported to TrackShortcodeFailures.
+func (renderer *ShortcodeRenderer) Expand(ctx context.Context, content string) string {
+	if !shortcode_regex.MatchString(content) {
+		return content
+	}
+
+	handlers, results := renderer.load()
+	return replaceShortcodes(content, func(shortcode string) string {
+		renderer.mutex.Lock()
+		markdown, exists := results[shortcode]
+		renderer.mutex.Unlock()
+		if exists {
+			return markdown
+		}
+
+		call_context, read_content := trackContentReads(ctx)
+		markdown, err := shortcodeToMarkdown(call_context, shortcode, handlers)
+		if err != nil {
+			log.Error().Msgf("%v", err)
+			if failed, tracked := ctx.Value(shortcode_failures_key{}).(*bool); tracked {
+				*failed = true
+			}
+			return ""
+		}
+		if *read_content {
+			return markdown
+		}
+		renderer.mutex.Lock()
+		if len(results) >= MAX_SHORTCODE_RESULTS {
+			clear(results)
+		}
+		results[shortcode] = markdown
+		renderer.mutex.Unlock()
+		return markdown
+	})
+}
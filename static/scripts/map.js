@@ -0,0 +1,104 @@
+// MARK: Image Map
+
+/**
+ * Builds the popup shown when clicking on a single image marker
+ *
+ * @param {object} properties GeoJSON feature properties for an image
+ */
+function makeImagePopup(properties) {
+	const container = document.createElement("div");
+
+	const link = document.createElement("a");
+	link.href = properties.link;
+
+	const thumbnail = document.createElement("img");
+	thumbnail.src = properties.thumbnail;
+	thumbnail.alt = properties.name;
+	thumbnail.className = "w-48 h-32 object-cover rounded";
+	link.appendChild(thumbnail);
+	container.appendChild(link);
+
+	const title = document.createElement("strong");
+	title.textContent = properties.name;
+	container.appendChild(title);
+
+	const place = document.createElement("p");
+	place.textContent = `${properties.place} (${properties.date})`;
+	container.appendChild(place);
+
+	return container;
+}
+
+/**
+ * Clusters are drawn as a circle with the amount of
+ * images inside, clicking zooms the map into the cluster
+ *
+ * @param {object} feature GeoJSON cluster feature
+ * @param {L.LatLng} latlng position of the cluster
+ * @param {L.Map} map the leaflet map
+ */
+function makeClusterMarker(feature, latlng, map) {
+	const count = feature.properties.point_count;
+	const icon = L.divIcon({
+		html: `<span>${count}</span>`,
+		className:
+			"flex items-center justify-center rounded-full bg-indigo-900 text-white font-bold border-2 border-white",
+		iconSize: [40, 40],
+	});
+
+	const marker = L.marker(latlng, { icon: icon });
+	marker.on("click", () => map.setView(latlng, map.getZoom() + 2));
+	return marker;
+}
+
+function initImageMap() {
+	const mapElem = document.getElementById("image-map");
+	if (!mapElem) {
+		return;
+	}
+
+	const map = L.map(mapElem).setView([20, 0], 2);
+	L.tileLayer("https://tile.openstreetmap.org/{z}/{x}/{y}.png", {
+		maxZoom: 19,
+		attribution:
+			'&copy; <a href="http://www.openstreetmap.org/copyright">OpenStreetMap</a>',
+	}).addTo(map);
+
+	const markers = L.geoJSON(null, {
+		pointToLayer: (feature, latlng) => {
+			if (feature.properties.cluster) {
+				return makeClusterMarker(feature, latlng, map);
+			}
+			return L.marker(latlng).bindPopup(makeImagePopup(feature.properties));
+		},
+	}).addTo(map);
+
+	const refreshMarkers = async () => {
+		const bounds = map.getBounds();
+		const endpoint = new URL(mapElem.dataset.geoEndpoint, window.location.origin);
+		endpoint.searchParams.set(
+			"bbox",
+			[
+				bounds.getWest(),
+				bounds.getSouth(),
+				bounds.getEast(),
+				bounds.getNorth(),
+			].join(","),
+		);
+		endpoint.searchParams.set("zoom", map.getZoom());
+
+		const response = await fetch(endpoint);
+		if (!response.ok) {
+			console.error(`could not load geotagged images: ${response.status}`);
+			return;
+		}
+
+		markers.clearLayers();
+		markers.addData(await response.json());
+	};
+
+	map.on("moveend", refreshMarkers);
+	refreshMarkers();
+}
+
+window.addEventListener("load", initImageMap);
@@ -0,0 +1,313 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var csrf_regex = regexp.MustCompile(`X-CSRF-Token&#34;:&#34;([0-9a-f]+)&#34;`)
+
+// Session cookie of user 1 and the CSRF token of the admin pages
+func adminSession(t *testing.T, router *gin.Engine) (*http.Cookie, string) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	session, err := token.GenerateToken(1)
+	require.Nil(t, err)
+	cookie := &http.Cookie{Name: admin_app.SESSION_COOKIE, Value: session}
+
+	req, _ := http.NewRequest(http.MethodGet, "/ui/posts/new", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	match := csrf_regex.FindStringSubmatch(w.Body.String())
+	require.NotNil(t, match)
+	return cookie, match[1]
+}
+
+// Sends the form with the session and the CSRF header of htmx
+func adminFormRequest(router *gin.Engine, cookie *http.Cookie, csrf string, method string, path string, form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Add("content-type", "application/x-www-form-urlencoded")
+	req.Header.Add("HX-Request", "true")
+	req.Header.Add("X-CSRF-Token", csrf)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func adminRouter(database_mock mocks.DatabaseMock) *gin.Engine {
+	hooks := &plugins.Hooks{}
+	return admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+}
+
+func TestAdminLogin(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.DefaultCost)
+	require.Nil(t, err)
+	router := adminRouter(mocks.DatabaseMock{
+		GetUserByUsernameHandler: func(username string) (common.User, error) {
+			return common.User{Id: 1, Username: username, Password: string(hashed)}, nil
+		},
+	})
+
+	// Pages without a session send the browser to the login page
+	req, _ := http.NewRequest(http.MethodGet, "/ui", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/ui/login", w.Header().Get("Location"))
+
+	req, _ = http.NewRequest(http.MethodGet, "/ui/posts", nil)
+	req.Header.Add("HX-Request", "true")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "/ui/login", w.Header().Get("HX-Redirect"))
+
+	// Tokens of the JSON API don't open the admin pages
+	api_token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+	req, _ = http.NewRequest(http.MethodGet, "/ui/posts/new?token="+api_token, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/ui/login", strings.NewReader(url.Values{"username": {"editor"}, "password": {"wrong"}}.Encode()))
+	req.Header.Add("content-type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "username or password is incorrect.")
+	assert.Contains(t, w.Body.String(), `value="editor"`)
+
+	// The session lasts as long as the API tokens
+	t.Setenv("TOKEN_HOUR_LIFESPAN", "12")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/ui/login", strings.NewReader(url.Values{"username": {"editor"}, "password": {"secret"}}.Encode()))
+	req.Header.Add("content-type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/ui", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, admin_app.SESSION_COOKIE, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, "/ui", cookies[0].Path)
+	assert.Equal(t, 12*3600, cookies[0].MaxAge)
+
+	// The session cookie opens the admin pages
+	cookie, csrf := adminSession(t, router)
+	req, _ = http.NewRequest(http.MethodGet, "/ui/posts/new", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Logging out needs the CSRF token as well
+	w = adminFormRequest(router, cookie, "", http.MethodPost, "/ui/logout", url.Values{})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	req, _ = http.NewRequest(http.MethodPost, "/ui/logout", strings.NewReader(url.Values{"_csrf": {csrf}}.Encode()))
+	req.Header.Add("content-type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/ui/login", w.Header().Get("Location"))
+	cookies = w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "", cookies[0].Value)
+	assert.True(t, cookies[0].MaxAge < 0)
+}
+
+func TestAdminPostEditor(t *testing.T) {
+	added := common.Post{}
+	changed := common.Post{}
+	deleted := 0
+	router := adminRouter(mocks.DatabaseMock{
+		GetPostHandler: func(id int) (common.Post, error) {
+			return common.Post{Id: id, Title: "First", Excerpt: "The first post", Content: "# Hello\n\nSome *words*"}, nil
+		},
+		GetPostsHandler: func(limit int, offset int) ([]common.Post, error) {
+			return []common.Post{{Id: 3, Title: "First", Excerpt: "The first post"}}, nil
+		},
+		AddPostHandler: func(title string, excerpt string, content string) (int, error) {
+			added = common.Post{Title: title, Excerpt: excerpt, Content: content}
+			return 4, nil
+		},
+		ChangePostHandler: func(id int, title string, excerpt string, content string) error {
+			changed = common.Post{Id: id, Title: title, Excerpt: excerpt, Content: content}
+			return nil
+		},
+		DeletePostHandler: func(id int) error {
+			deleted = id
+			return nil
+		},
+	})
+	cookie, csrf := adminSession(t, router)
+
+	// The preview renders the Markdown the way the site does
+	w := adminFormRequest(router, cookie, "", http.MethodPost, "/ui/preview", url.Values{"content": {"# Title"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = adminFormRequest(router, cookie, "bad", http.MethodPost, "/ui/preview", url.Values{"content": {"# Title"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/preview", url.Values{"content": {"# Title\n\n[link](https://example.com)"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, string(common.MdToHTML([]byte("# Title\n\n[link](https://example.com)"))), w.Body.String())
+	assert.Contains(t, w.Body.String(), `<h1 id="title">Title</h1>`)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodGet, "/ui/posts", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `hx-delete="/ui/posts/3"`)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodGet, "/ui/posts/3/edit", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `hx-post="/ui/posts/3"`)
+	assert.Contains(t, w.Body.String(), `<em>words</em>`)
+
+	// Posts missing data come back with the error
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/posts", url.Values{"title": {"Second"}, "content": {"Text"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("HX-Redirect"))
+	assert.Contains(t, w.Body.String(), "missing required data &#39;Excerpt&#39;")
+	assert.Contains(t, w.Body.String(), `value="Second"`)
+	assert.Empty(t, added.Title)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/posts", url.Values{"title": {"Second"}, "excerpt": {"Short"}, "content": {"Text"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/ui/posts", w.Header().Get("HX-Redirect"))
+	assert.Equal(t, common.Post{Title: "Second", Excerpt: "Short", Content: "Text"}, added)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/posts/3", url.Values{"title": {"First"}, "excerpt": {"Changed"}, "content": {"More"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, common.Post{Id: 3, Title: "First", Excerpt: "Changed", Content: "More"}, changed)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodDelete, "/ui/posts/3", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, deleted)
+}
+
+func TestAdminPageEditor(t *testing.T) {
+	added := common.Page{}
+	changed := common.Page{}
+	blocks := []common.Block{{Type: common.BLOCK_MARKDOWN, Data: []byte(`{"content": "Block"}`)}}
+	router := adminRouter(mocks.DatabaseMock{
+		GetPageHandler: func(link string) (common.Page, error) {
+			return common.Page{Id: 2, Title: "About", Link: link, Content: "About *us*", Blocks: blocks}, nil
+		},
+		GetPageTreeHandler: func() ([]common.Page, error) {
+			return []common.Page{{Id: 2, Title: "About", Link: "about", Path: "about"}}, nil
+		},
+		AddPageHandler: func(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+			added = common.Page{Title: title, Content: content, Link: link, ParentId: parent_id}
+			return 5, nil
+		},
+		ChangePageHandler: func(id int, title string, content string, link string, blocks []common.Block) error {
+			changed = common.Page{Id: id, Title: title, Content: content, Link: link, Blocks: blocks}
+			return nil
+		},
+	})
+	cookie, csrf := adminSession(t, router)
+
+	w := adminFormRequest(router, cookie, csrf, http.MethodGet, "/ui/pages/new", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<option value="2">/page/about</option>`)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/pages", url.Values{"title": {"Team"}, "link": {"bad link"}, "content": {"Text"}, "parent_id": {"2"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("HX-Redirect"))
+	assert.Contains(t, w.Body.String(), "could not save page")
+	assert.Contains(t, w.Body.String(), `<option value="2" selected>/page/about</option>`)
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/pages", url.Values{"title": {"Team"}, "link": {"team"}, "content": {"Text"}, "parent_id": {"2"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/ui/pages", w.Header().Get("HX-Redirect"))
+	assert.Equal(t, common.Page{Title: "Team", Content: "Text", Link: "team", ParentId: 2}, added)
+
+	// Pages keep their blocks
+	w = adminFormRequest(router, cookie, csrf, http.MethodGet, "/ui/pages/about/edit", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "rendered from its 1 blocks")
+	assert.Contains(t, w.Body.String(), "<em>us</em>")
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/pages/about", url.Values{"title": {"About us"}, "link": {"about-us"}, "content": {""}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, common.Page{Id: 2, Title: "About us", Link: "about-us", Blocks: blocks}, changed)
+}
+
+func TestAdminMediaLibrary(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.ImageDirectory = image_directory })
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "notes.txt"), []byte("notes"), 0644))
+
+	router := adminRouter(mocks.DatabaseMock{})
+	cookie, csrf := adminSession(t, router)
+
+	var png_data bytes.Buffer
+	require.Nil(t, png.Encode(&png_data, image.NewRGBA(image.Rect(0, 0, 600, 300))))
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="sky.png"`)
+	header.Set("Content-Type", "image/png")
+	part, err := writer.CreatePart(header)
+	require.Nil(t, err)
+	part.Write(png_data.Bytes())
+	writer.WriteField("excerpt", "Blue sky")
+	writer.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "/ui/media", &body)
+	req.Header.Add("content-type", writer.FormDataContentType())
+	req.Header.Add("X-CSRF-Token", csrf)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `id="media-grid"`)
+
+	matches, _ := filepath.Glob(filepath.Join(image_directory, "*.png"))
+	require.Len(t, matches, 1)
+	name := filepath.Base(matches[0])
+	assert.Contains(t, w.Body.String(), "/images/data/"+name)
+	assert.NotContains(t, w.Body.String(), "notes.txt")
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodGet, "/ui/media", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `hx-delete="/ui/media/`+name+`"`)
+
+	// Only images of the library are deleted
+	w = adminFormRequest(router, cookie, csrf, http.MethodDelete, "/ui/media/notes.txt", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.FileExists(t, filepath.Join(image_directory, "notes.txt"))
+
+	w = adminFormRequest(router, cookie, csrf, http.MethodDelete, "/ui/media/"+name, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NoFileExists(t, matches[0])
+}
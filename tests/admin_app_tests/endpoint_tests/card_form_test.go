@@ -0,0 +1,156 @@
+package endpoint_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const product_form_schema = `{
+	"type": "object",
+	"required": ["title", "price"],
+	"properties": {
+		"title": {"type": "string", "title": "Title", "minLength": 2},
+		"price": {"type": "number", "minimum": 0},
+		"color": {"type": "string", "enum": ["red", "blue"]},
+		"in_stock": {"type": "boolean"},
+		"photo": {"type": "string", "format": "image"},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"size": {"type": "object", "properties": {"width": {"type": "integer"}}}
+	}
+}`
+
+func TestCardForms(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	require.Nil(t, os.WriteFile(image_directory+"/shoe.jpg", []byte("jpeg"), 0644))
+	require.Nil(t, os.WriteFile(image_directory+"/shoe.json", []byte("{}"), 0644))
+	common.UpdateSettings(func(settings *common.AppSettings) { settings.ImageDirectory = image_directory })
+
+	added := ""
+	changed := ""
+	var changed_image *string
+	deleted := ""
+	database_mock := mocks.DatabaseMock{
+		GetCardSchemaHandler: func(uuid string) (common.CardSchema, error) {
+			return common.CardSchema{Title: "Products", Schema: product_form_schema, Version: 1}, nil
+		},
+		GetCardHandler: func(uuid string) (common.Card, error) {
+			return common.Card{Id: uuid, Schema: "products", SchemaVersion: 1, Image: "shoe.jpg", Content: `{"title": "Shoe", "price": 10, "tags": ["a", "b"]}`}, nil
+		},
+		GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+			return []common.Card{{Id: "shoe", Content: `{"price": 10, "title": "Shoe"}`}}, 1, nil
+		},
+		AddCardHandler: func(image string, schema string, content string) (string, error) {
+			added = content
+			return "new", nil
+		},
+		ChangeCardHandler: func(uuid string, image_location *string, json_data string) error {
+			changed = json_data
+			changed_image = image_location
+			return nil
+		},
+		DeleteCardHandler: func(uuid string) error {
+			deleted = uuid
+			return nil
+		},
+	}
+	router := adminRouter(database_mock)
+	cookie, csrf := adminSession(t, router)
+
+	request := func(method string, path string, form url.Values) *httptest.ResponseRecorder {
+		return adminFormRequest(router, cookie, csrf, method, path, form)
+	}
+
+	w := request(http.MethodGet, "/ui/cards/products/new", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	html := w.Body.String()
+	assert.Contains(t, html, `name="/title"`)
+	assert.Contains(t, html, `minlength="2"`)
+	assert.Contains(t, html, `name="/price" value="" step="any" min="0" required`)
+	assert.Contains(t, html, `<option value="blue">blue</option>`)
+	assert.Contains(t, html, `type="checkbox" name="/in_stock"`)
+	assert.Contains(t, html, `<option value="shoe.jpg">shoe.jpg</option>`)
+	assert.NotContains(t, html, "shoe.json")
+	assert.Contains(t, html, `name="/size/width" value="" step="1"`)
+	assert.Contains(t, html, `name="_add" value="/tags"`)
+
+	// The card being edited fills the form
+	w = request(http.MethodGet, "/ui/cards/products/shoe/edit", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="/tags/1" value="b"`)
+	assert.Contains(t, w.Body.String(), `hx-post="/ui/cards/products/shoe"`)
+
+	// Array items are added and removed by the server
+	w = request(http.MethodPost, "/ui/cards/products/form", url.Values{"/title": {"Hat"}, "/tags/0": {"a"}, "_add": {"/tags"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="/title" value="Hat"`)
+	assert.Contains(t, w.Body.String(), `name="/tags/1" value=""`)
+	w = request(http.MethodPost, "/ui/cards/products/form", url.Values{"/tags/0": {"a"}, "/tags/1": {"b"}, "_remove": {"/tags/0"}})
+	assert.Contains(t, w.Body.String(), `name="/tags/0" value="b"`)
+	assert.NotContains(t, w.Body.String(), `name="/tags/1"`)
+
+	// The server checks the card against the schema
+	w = request(http.MethodPost, "/ui/cards/products", url.Values{"/title": {"H"}, "/price": {"-1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, added)
+	assert.Empty(t, w.Header().Get("HX-Redirect"))
+	assert.Contains(t, w.Body.String(), `name="/title" value="H"`)
+	assert.Contains(t, w.Body.String(), `text-red-700">`)
+
+	w = request(http.MethodPost, "/ui/cards/products", url.Values{
+		"image_location": {"shoe.jpg"}, "/title": {"Hat"}, "/price": {"12.5"}, "/color": {"blue"},
+		"/in_stock": {"false", "true"}, "/tags/0": {"summer"}, "/tags/1": {""}, "/size/width": {"3"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/ui/cards/products", w.Header().Get("HX-Redirect"))
+	assert.JSONEq(t, `{"title": "Hat", "price": 12.5, "color": "blue", "in_stock": true, "tags": ["summer"], "size": {"width": 3}}`, added)
+
+	w = request(http.MethodPost, "/ui/cards/products/shoe", url.Values{"/title": {"Shoe"}, "/price": {"11"}, "/in_stock": {"false"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"title": "Shoe", "price": 11, "in_stock": false, "size": {}}`, changed)
+	// "No image" clears the image
+	require.NotNil(t, changed_image)
+	assert.Equal(t, "", *changed_image)
+
+	// Images are file names of the media directory
+	w = request(http.MethodPost, "/ui/cards/products/shoe", url.Values{"image_location": {"shoe.jpg"}, "/title": {"Shoe"}, "/price": {"11"}})
+	assert.Equal(t, "/ui/cards/products", w.Header().Get("HX-Redirect"))
+	assert.Equal(t, "shoe.jpg", *changed_image)
+	changed = ""
+	for _, image := range []string{"hat.jpg", "../shoe.jpg", image_directory + "/shoe.jpg"} {
+		w = request(http.MethodPost, "/ui/cards/products/shoe", url.Values{"image_location": {image}, "/title": {"Shoe"}, "/price": {"11"}})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("HX-Redirect"), image)
+		assert.Contains(t, w.Body.String(), "text-red-700", image)
+		assert.Empty(t, changed)
+	}
+
+	// The images are only served to the admin session
+	w = request(http.MethodGet, "/ui/images/data/shoe.jpg", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "jpeg", w.Body.String())
+	req, _ := http.NewRequest(http.MethodGet, "/ui/images/data/shoe.jpg", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	req, _ = http.NewRequest(http.MethodGet, "/images/data/shoe.jpg", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request(http.MethodGet, "/ui/cards/products", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<td class=\"p-2\">Shoe</td>")
+
+	w = request(http.MethodDelete, "/ui/cards/products/shoe", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "shoe", deleted)
+}
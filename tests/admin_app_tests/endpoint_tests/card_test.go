@@ -0,0 +1,134 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCards(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	var queries []common.CardQuery
+	database_mock := mocks.DatabaseMock{
+		GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+			queries = append(queries, query)
+			return []common.Card{{Id: "card", Schema: schema_uuid, Position: 4}}, 25, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	request := func(url string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/cards/products?limit=5&page=3&sort=price&desc=true")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response admin_app.GetCardsResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 25, response.Total)
+	require.Len(t, response.Cards, 1)
+	assert.Equal(t, 4, response.Cards[0].Position)
+
+	assert.Equal(t, http.StatusOK, request("/cards/products").Code)
+	assert.Equal(t, http.StatusOK, request("/cards/products/20/2").Code)
+	assert.Equal(t, http.StatusBadRequest, request("/cards/products?page=2").Code)
+	assert.Equal(t, []common.CardQuery{
+		{Limit: 5, Offset: 10, SortBy: "price", Descending: true},
+		{Limit: 10},
+		{Limit: 20, Offset: 20},
+	}, queries)
+}
+
+func TestChangeCardSchema(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	var changed_transform []common.PatchOperation
+	database_mock := mocks.DatabaseMock{
+		// The migration itself is checked by the database tests,
+		// only the transform adding the price fixes the hat
+		CheckCardSchemaHandler: func(uuid string, json_schema string, transform []common.PatchOperation) ([]common.CardFailure, error) {
+			if len(transform) < 2 {
+				return []common.CardFailure{{CardId: "hat", Error: "invalid card data: /: Required property 'price' is missing"}}, nil
+			}
+			return []common.CardFailure{}, nil
+		},
+		ChangeCardSchemaHandler: func(uuid string, json_schema string, transform []common.PatchOperation) (int, error) {
+			changed_transform = transform
+			return 2, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	request := func(method string, url string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Add("content-type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	schema := `{"type": "object", "required": ["name", "price"], "properties": {"name": {"type": "string"}, "price": {"type": "number"}}}`
+	transform := `[{"op": "move", "from": "/title", "path": "/name"}]`
+
+	// The hat has no price
+	w := request(http.MethodPost, "/card-schemas/products/check", `{"schema": `+schema+`, "transform": `+transform+`}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var check_response admin_app.CheckCardSchemaResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &check_response))
+	require.Len(t, check_response.Failures, 1)
+	assert.Equal(t, "hat", check_response.Failures[0].CardId)
+
+	transform = `[{"op": "move", "from": "/title", "path": "/name"}, {"op": "add", "path": "/price", "value": 0}]`
+	w = request(http.MethodPost, "/card-schemas/products/check", `{"schema": `+schema+`, "transform": `+transform+`}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &check_response))
+	assert.Empty(t, check_response.Failures)
+
+	w = request(http.MethodPut, "/card-schemas/products", `{"schema": `+schema+`, "transform": `+transform+`}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var version_response admin_app.CardSchemaVersionResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &version_response))
+	assert.Equal(t, admin_app.CardSchemaVersionResponse{Id: "products", Version: 2, Migrated: true}, version_response)
+	require.Len(t, changed_transform, 2)
+	assert.Equal(t, common.PATCH_ADD, changed_transform[1].Op)
+
+	// Without a transform the cards keep their version
+	w = request(http.MethodPut, "/card-schemas/products", `{"schema": `+schema+`}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &version_response))
+	assert.False(t, version_response.Migrated)
+	assert.Nil(t, changed_transform)
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/card-schemas/products", `{"schema": {"type": 12}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/card-schemas/products", `{"transform": []}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/card-schemas/products", `{"schema": `+schema+`, "transform": [{"op": "test", "path": "/name"}]}`).Code)
+}
@@ -0,0 +1,241 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const hooks_test_plugin = `
+last_saved = 0
+
+function before_post_save(post)
+	if post.title == "Refused" then
+		error("no refused posts")
+	elseif post.title == "Last" then
+		post.title = "Last " .. last_saved
+	end
+	post.content = post.content .. "\n\nSigned"
+	return post
+end
+
+function after_post_save(post)
+	last_saved = post.id
+end
+
+function before_page_save(page)
+	if string.find(page.content, "TODO") then
+		error("pages can't have a TODO")
+	end
+	return {link = string.lower(page.link)}
+end
+
+function after_page_save(page)
+	last_saved = page.id
+	error("only logged")
+end
+
+function image_upload(upload)
+	if upload.title == "secret" then
+		error("no secret images")
+	elseif upload.content_type ~= "image/png" or upload.size <= 0 or upload.excerpt ~= "Blue sky" then
+		error("unexpected upload")
+	end
+	return {excerpt = upload.excerpt .. " (" .. upload.content_type .. ")"}
+end
+`
+
+// The settings listeners of the other routers reload their
+// hooks too, so the plugin is put in the settings
+func loadTestHooks(t *testing.T, image_directory string) *plugins.Hooks {
+	script := filepath.Join(t.TempDir(), "hooks.lua")
+	require.Nil(t, os.WriteFile(script, []byte(hooks_test_plugin), 0644))
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.ImageDirectory = image_directory
+		settings.Plugins = []common.Plugin{{Name: "hooks", Script: script, Events: []string{
+			plugins.EVENT_BEFORE_POST_SAVE,
+			plugins.EVENT_AFTER_POST_SAVE,
+			plugins.EVENT_BEFORE_PAGE_SAVE,
+			plugins.EVENT_AFTER_PAGE_SAVE,
+			plugins.EVENT_IMAGE_UPLOAD,
+		}}}
+	})
+	hooks, err := plugins.LoadHooks(common.CurrentSettings().Plugins)
+	require.Nil(t, err)
+	return hooks
+}
+
+func apiToken(t *testing.T) string {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	api_token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+	return api_token
+}
+
+func apiRequest(t *testing.T, router http.Handler, method string, path string, data any) *httptest.ResponseRecorder {
+	api_token := apiToken(t)
+	body, err := json.Marshal(data)
+	require.Nil(t, err)
+	req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+api_token)
+	req.Header.Add("content-type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPostSaveHooks(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	hooks := loadTestHooks(t, t.TempDir())
+
+	var saved common.Post
+	database_mock := mocks.DatabaseMock{
+		AddPostHandler: func(title string, excerpt string, content string) (int, error) {
+			saved = common.Post{Id: 7, Title: title, Excerpt: excerpt, Content: content}
+			return 7, nil
+		},
+		ChangePostHandler: func(id int, title string, excerpt string, content string) error {
+			saved = common.Post{Id: id, Title: title, Excerpt: excerpt, Content: content}
+			return nil
+		},
+	}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	w := apiRequest(t, router, http.MethodPost, "/posts", postRequest{Title: "Post", Excerpt: "Excerpt", Content: "Hello"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, common.Post{Id: 7, Title: "Post", Excerpt: "Excerpt", Content: "Hello\n\nSigned"}, saved)
+
+	// The after event got the id of the new post
+	w = apiRequest(t, router, http.MethodPut, "/posts", admin_app.ChangePostRequest{Id: 3, Title: "Last", Excerpt: "Excerpt", Content: "Hello"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, common.Post{Id: 3, Title: "Last 7", Excerpt: "Excerpt", Content: "Hello\n\nSigned"}, saved)
+
+	saved = common.Post{}
+	w = apiRequest(t, router, http.MethodPost, "/posts", postRequest{Title: "Refused", Excerpt: "Excerpt", Content: "Hello"})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var errors_response admin_app.PluginErrorsResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &errors_response))
+	require.Len(t, errors_response.Errors, 1)
+	assert.Equal(t, "hooks", errors_response.Errors[0].Plugin)
+	assert.Equal(t, plugins.PLUGIN_ERROR_RUNTIME, errors_response.Errors[0].Kind)
+	assert.Contains(t, errors_response.Errors[0].Message, "no refused posts")
+	assert.Equal(t, common.Post{}, saved)
+
+	// Requests missing data stop before the plugins and the database
+	w = apiRequest(t, router, http.MethodPost, "/posts", postRequest{Title: "Post", Excerpt: "Excerpt"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, common.Post{}, saved)
+
+	// The editor keeps what was typed
+	cookie, csrf := adminSession(t, router)
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/posts", url.Values{"title": {"Refused"}, "excerpt": {"Excerpt"}, "content": {"Typed"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "no refused posts")
+	assert.Contains(t, w.Body.String(), "Typed</textarea>")
+	assert.Equal(t, common.Post{}, saved)
+}
+
+func TestPageSaveHooks(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	hooks := loadTestHooks(t, t.TempDir())
+
+	var saved common.Page
+	database_mock := mocks.DatabaseMock{
+		AddPageHandler: func(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+			saved = common.Page{Id: 4, Title: title, Content: content, Link: link, Blocks: blocks, ParentId: parent_id}
+			return 4, nil
+		},
+		ChangePageHandler: func(id int, title string, content string, link string, blocks []common.Block) error {
+			saved = common.Page{Id: id, Title: title, Content: content, Link: link, Blocks: blocks}
+			return nil
+		},
+	}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	w := apiRequest(t, router, http.MethodPost, "/pages", admin_app.AddPageRequest{Title: "About", Content: "Hello", Link: "About-Us"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, common.Page{Id: 4, Title: "About", Content: "Hello", Link: "about-us"}, saved)
+	var page_response admin_app.PageResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &page_response))
+	assert.Equal(t, "about-us", page_response.Link)
+
+	// Blocks go through the plugin and come back the same
+	blocks := []common.Block{{Type: common.BLOCK_MARKDOWN, Data: json.RawMessage(`{"content":"Hi"}`)}}
+	w = apiRequest(t, router, http.MethodPut, "/pages", admin_app.ChangePageRequest{Id: 4, Title: "About", Link: "About", Blocks: blocks})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, common.Page{Id: 4, Title: "About", Link: "about", Blocks: blocks}, saved)
+
+	saved = common.Page{}
+	w = apiRequest(t, router, http.MethodPost, "/pages", admin_app.AddPageRequest{Title: "About", Content: "TODO", Link: "about"})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "pages can't have a TODO")
+	assert.Equal(t, common.Page{}, saved)
+
+	cookie, csrf := adminSession(t, router)
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/pages", url.Values{"title": {"Notes"}, "link": {"Notes"}, "content": {"Hello"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/ui/pages", w.Header().Get("HX-Redirect"))
+	assert.Equal(t, "notes", saved.Link)
+}
+
+func TestImageUploadHooks(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	hooks := loadTestHooks(t, image_directory)
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, mocks.DatabaseMock{}, hooks)
+
+	upload := func(filename string) *httptest.ResponseRecorder {
+		var png_data bytes.Buffer
+		require.Nil(t, png.Encode(&png_data, image.NewRGBA(image.Rect(0, 0, 600, 300))))
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="file"; filename="`+filename+`"`)
+		header.Set("Content-Type", "image/png")
+		part, err := writer.CreatePart(header)
+		require.Nil(t, err)
+		part.Write(png_data.Bytes())
+		writer.WriteField("excerpt", "Blue sky")
+		writer.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, "/images", &body)
+		req.Header.Set("Authorization", "Bearer "+apiToken(t))
+		req.Header.Add("content-type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload("sky.png")
+	require.Equal(t, http.StatusOK, w.Code)
+	var image_response admin_app.ImageIdResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &image_response))
+	assert.FileExists(t, filepath.Join(image_directory, image_response.Id+".png"))
+
+	// Refused images are not kept
+	w = upload("secret.png")
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "no secret images")
+	matches, _ := filepath.Glob(filepath.Join(image_directory, "*.png"))
+	assert.Len(t, matches, 1)
+}
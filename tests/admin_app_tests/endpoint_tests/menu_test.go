@@ -0,0 +1,77 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMenuEndpoints(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.Galleries = map[string]common.Gallery{"cats": {Name: "Cats"}}
+	})
+
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	added_items := []common.MenuItem{}
+	moved_items := []common.MenuItem{}
+	database_mock := mocks.DatabaseMock{
+		AddMenuItemHandler: func(menu_id int, item common.MenuItem) (int, error) {
+			added_items = append(added_items, item)
+			return len(added_items), nil
+		},
+		MoveMenuItemsHandler: func(menu_id int, items []common.MenuItem) error {
+			moved_items = items
+			return nil
+		},
+		GetMenusHandler: func() ([]common.Menu, error) {
+			return []common.Menu{{Id: 1, Name: "Main"}}, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	request := func(method string, url string, body string) int {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Add("content-type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/menus", `{"name": "Main", "location": "header"}`))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/menus", `{"name": "Main", "location": "sidebar"}`))
+
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/menus/1/items", `{"type": "page", "target": "3"}`))
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/menus/1/items", `{"type": "gallery", "target": "cats", "parent_id": 1, "visible": false}`))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/menus/1/items", `{"type": "page", "target": "about"}`))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/menus/1/items", `{"type": "gallery", "target": "dogs"}`))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/menus/1/items", `{"type": "video", "target": "x"}`))
+	assert.Equal(t, []common.MenuItem{
+		{Type: common.MENU_ITEM_PAGE, Target: "3", Visible: true},
+		{ParentId: 1, Type: common.MENU_ITEM_GALLERY, Target: "cats", Visible: false},
+	}, added_items)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPut, "/menus/1/order", `{"items": [{"id": 2, "parent_id": 0, "position": 0}, {"id": 1, "position": 1}]}`))
+	assert.Equal(t, []common.MenuItem{{Id: 2, Position: 0}, {Id: 1, Position: 1}}, moved_items)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/menus/1", ""))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/menus/2", ""))
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/rbc33/gocms/utils/token"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAddPageHappyPath(t *testing.T) {
@@ -28,7 +29,7 @@ func TestAddPageHappyPath(t *testing.T) {
 	}
 
 	databaseMock := mocks.DatabaseMock{
-		AddPageHandler: func(string, string, string) (int, error) {
+		AddPageHandler: func(string, string, string, []common.Block, int) (int, error) {
 			return 0, nil
 		},
 	}
@@ -39,23 +40,14 @@ func TestAddPageHappyPath(t *testing.T) {
 		Link:    "Link",
 	}
 
-	shortcode_handlers, err := admin_app.LoadShortcodesHandlers(common.Settings.Shortcodes)
+	shortcode_handlers, err := admin_app.LoadShortcodesHandlers(common.CurrentSettings().Shortcodes)
 	if err != nil {
 		log.Error().Msgf("%s", err)
 		os.Exit(-1)
 	}
 
-	post_hook := &plugins.PostHook{}
-	image_plugin := plugins.Plugin{
-		ScriptName: "img",
-		Id:         "img-plugin",
-	}
-	post_hook.Register(image_plugin)
-	// img, _ := shortcode_handlers["img"]
-	hooks_map := map[string]plugins.Hook{
-		"add_post": post_hook,
-	}
-	router := admin_app.SetupRoutes(app_settings, shortcode_handlers, databaseMock, hooks_map)
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, shortcode_handlers, databaseMock, hooks)
 	responseRecorder := httptest.NewRecorder()
 
 	body, _ := json.Marshal(page_data)
@@ -74,3 +66,90 @@ func TestAddPageHappyPath(t *testing.T) {
 	assert.NotEmpty(t, response.Link)
 	assert.Equal(t, page_data.Link, response.Link)
 }
+
+func TestAddBlockPage(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	var added_blocks []common.Block
+	database_mock := mocks.DatabaseMock{
+		AddPageHandler: func(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+			added_blocks = blocks
+			return 1, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	add_page := func(blocks string) int {
+		body := `{"title": "Landing", "link": "landing", "blocks": ` + blocks + `}`
+		req, _ := http.NewRequest(http.MethodPost, "/pages", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Add("content-type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Block pages don't need Markdown content
+	assert.Equal(t, http.StatusCreated, add_page(`[
+		{"type": "hero", "data": {"title": "Welcome", "button_text": "Shop", "button_href": "/products/"}},
+		{"type": "markdown", "data": {"content": "# Hello"}},
+		{"type": "contact_form"}
+	]`))
+	require.Len(t, added_blocks, 3)
+	assert.Equal(t, common.BLOCK_HERO, added_blocks[0].Type)
+	assert.JSONEq(t, `{"content": "# Hello"}`, string(added_blocks[1].Data))
+
+	assert.Equal(t, http.StatusBadRequest, add_page(`[]`))
+	assert.Equal(t, http.StatusBadRequest, add_page(`[{"type": "video", "data": {}}]`))
+	assert.Equal(t, http.StatusBadRequest, add_page(`[{"type": "cta", "data": {"title": "Buy now"}}]`))
+	assert.Equal(t, http.StatusBadRequest, add_page(`[{"type": "image", "data": {"image": "cat.jpg", "width": 10}}]`))
+}
+
+func TestMovePages(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	added_parent := -1
+	moved_pages := []common.Page{}
+	database_mock := mocks.DatabaseMock{
+		AddPageHandler: func(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+			added_parent = parent_id
+			return 2, nil
+		},
+		MovePagesHandler: func(pages []common.Page) error {
+			moved_pages = pages
+			return nil
+		},
+		GetPageTreeHandler: func() ([]common.Page, error) {
+			return []common.Page{{Id: 1, Link: "docs", Path: "docs"}}, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	request := func(method string, url string, body string) int {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Add("content-type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusCreated, request(http.MethodPost, "/pages", `{"title": "Install", "content": "# Install", "link": "install", "parent_id": 1}`))
+	assert.Equal(t, 1, added_parent)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPut, "/pages/order", `{"pages": [{"id": 2, "position": 0}, {"id": 3, "parent_id": 2, "position": 1}]}`))
+	assert.Equal(t, []common.Page{{Id: 2}, {Id: 3, ParentId: 2, Position: 1}}, moved_pages)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/pages/order", `{"pages": [{"position": 1}]}`))
+}
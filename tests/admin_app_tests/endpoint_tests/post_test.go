@@ -41,25 +41,16 @@ func TestCreatePost_Success(t *testing.T) {
 		t.Fatalf("failed to generate token: %v", err)
 	}
 
-	shortcode_handlers, err := admin_app.LoadShortcodesHandlers(common.Settings.Shortcodes)
+	shortcode_handlers, err := admin_app.LoadShortcodesHandlers(common.CurrentSettings().Shortcodes)
 	if err != nil {
 		log.Error().Msgf("%s", err)
 		os.Exit(-1)
 	}
 
 	database_mock := mocks.DatabaseMock{}
-	post_hook := &plugins.PostHook{}
-	image_plugin := plugins.Plugin{
-		ScriptName: "img",
-		Id:         "img-plugin",
-	}
-	post_hook.Register(image_plugin)
-	// img, _ := shortcode_handlers["img"]
-	hooks_map := map[string]plugins.Hook{
-		"add_post": post_hook,
-	}
+	hooks := &plugins.Hooks{}
 
-	r := admin_app.SetupRoutes(app_settings, shortcode_handlers, database_mock, hooks_map)
+	r := admin_app.SetupRoutes(app_settings, shortcode_handlers, database_mock, hooks)
 
 	w := httptest.NewRecorder()
 
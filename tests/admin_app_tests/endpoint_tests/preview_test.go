@@ -0,0 +1,120 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostPreview(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	shortcode_handlers, err := admin_app.LoadShortcodesHandlers([]common.Shortcode{
+		{Name: "img", Plugin: "../../../plugins/image_shortcode.lua"},
+	})
+	require.Nil(t, err)
+
+	var added common.PostPreview
+	database_mock := mocks.DatabaseMock{
+		AddPostPreviewHandler: func(preview common.PostPreview) (string, error) {
+			added = preview
+			return "3f1e", nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, shortcode_handlers, database_mock, hooks)
+
+	request := func(path string, body any) *httptest.ResponseRecorder {
+		body_json, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(body_json))
+		req.Header.Add("content-type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Every shortcode is expanded and the text around them is kept
+	content := "# Trip\n\n{{img:sky.png:Sky}}\n\n{{img:sea.png:Sea}}\n\nThe end."
+	w := request("/preview", admin_app.PreviewRequest{Title: "Holidays", Content: content})
+	require.Equal(t, http.StatusOK, w.Code)
+	html := w.Body.String()
+	assert.Contains(t, html, "<!doctype html>")
+	assert.Contains(t, html, "Holidays")
+	assert.Contains(t, html, `<img src="/images/data/sky.png" alt="Sky"`)
+	assert.Contains(t, html, `<img src="/images/data/sea.png" alt="Sea"`)
+	assert.Contains(t, html, "<p>The end.</p>")
+	assert.NotContains(t, html, "{{")
+
+	assert.Equal(t, http.StatusBadRequest, request("/preview", admin_app.PreviewRequest{Title: "Empty"}).Code)
+
+	// Plugins that fail are reported instead of the page
+	w = request("/preview", admin_app.PreviewRequest{Title: "Broken", Content: "{{img:sky.png:Sky}} {{video:trip.mp4}}"})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var errors_response admin_app.PluginErrorsResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &errors_response))
+	require.Len(t, errors_response.Errors, 1)
+	assert.Equal(t, plugins.PluginError{Plugin: "video", Kind: plugins.PLUGIN_ERROR_MISSING, Message: "unsupported shortcode: video"}, *errors_response.Errors[0])
+
+	w = request("/previews", admin_app.AddPreviewRequest{Title: "Holidays", Excerpt: "Trip", Content: content, Hours: 2})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var response admin_app.PreviewLinkResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "3f1e", response.Uuid)
+	assert.Equal(t, "/preview/3f1e", response.Url)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), response.ExpiresAt, time.Minute)
+	assert.Equal(t, "Holidays", added.Title)
+	// The app expands the shortcodes when showing it
+	assert.Equal(t, content, added.Content)
+	assert.True(t, response.ExpiresAt.Equal(added.ExpiresAt))
+
+	// Links last a day unless told otherwise, a week at most
+	w = request("/previews", admin_app.AddPreviewRequest{Title: "Holidays", Content: content})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.WithinDuration(t, time.Now().Add(admin_app.PREVIEW_HOURS*time.Hour), added.ExpiresAt, time.Minute)
+	assert.Equal(t, http.StatusBadRequest, request("/previews", admin_app.AddPreviewRequest{Title: "Holidays", Content: content, Hours: 24 * 30}).Code)
+}
+
+func TestPreviewReadsContent(t *testing.T) {
+	shortcode_handlers, err := admin_app.LoadShortcodesHandlers([]common.Shortcode{
+		{Name: "latest", Plugin: "../../../plugins/latest_posts_shortcode.lua"},
+	})
+	require.Nil(t, err)
+
+	database_mock := mocks.DatabaseMock{
+		GetPostsHandler: func(limit int, offset int) ([]common.Post, error) {
+			assert.Equal(t, 2, limit)
+			return []common.Post{{Id: 1, Title: "First"}, {Id: 2, Title: "Second"}}, nil
+		},
+	}
+	router := admin_app.SetupRoutes(app_settings, shortcode_handlers, database_mock, &plugins.Hooks{})
+
+	// The shortcodes read the posts of the site of the request
+	w := apiRequest(t, router, http.MethodPost, "/preview", admin_app.PreviewRequest{Title: "News", Content: "{{latest:2}}"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `<a href="/post/2">Second</a>`)
+
+	cookie, csrf := adminSession(t, router)
+	w = adminFormRequest(router, cookie, csrf, http.MethodPost, "/ui/preview", url.Values{"content": {"{{latest:2}}"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "can't read content here")
+	assert.Contains(t, w.Body.String(), `<a href="/post/1">First</a>`)
+}
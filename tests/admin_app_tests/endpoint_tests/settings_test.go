@@ -0,0 +1,91 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditSettings(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.StickyPosts = []int{1}
+		settings.RecaptchaSecret = "secret"
+	})
+
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	stored := map[string]string{}
+	database_mock := mocks.DatabaseMock{
+		GetSettingsHandler: func() (map[string]string, error) {
+			return stored, nil
+		},
+		SetSettingsHandler: func(values map[string]string) error {
+			for name, value := range values {
+				stored[name] = value
+			}
+			return nil
+		},
+		DeleteSettingHandler: func(name string) error {
+			delete(stored, name)
+			return nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	request := func(method string, url string, body string) (int, admin_app.SettingsResponse) {
+		req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Add("content-type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response admin_app.SettingsResponse
+		if w.Code == http.StatusOK {
+			require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w.Code, response
+	}
+
+	code, response := request(http.MethodGet, "/settings", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[1]`, string(response.Settings["sticky_posts"]))
+	assert.NotContains(t, response.Settings, "recaptcha_secret")
+	assert.Empty(t, response.Overridden)
+
+	code, _ = request(http.MethodPut, "/settings", `{"sticky_posts": ["one"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = request(http.MethodPut, "/settings", `{"database_uri": "root@/db"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Empty(t, stored)
+
+	code, response = request(http.MethodPut, "/settings", `{"sticky_posts": [2, 3], "recaptcha_secret": "new secret"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[2, 3]`, string(response.Settings["sticky_posts"]))
+	assert.Equal(t, []string{"recaptcha_secret", "sticky_posts"}, response.Overridden)
+
+	code, response = request(http.MethodDelete, "/settings/sticky_posts", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[1]`, string(response.Settings["sticky_posts"]))
+	assert.Equal(t, []string{"recaptcha_secret"}, response.Overridden)
+
+	code, _ = request(http.MethodDelete, "/settings/unknown", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
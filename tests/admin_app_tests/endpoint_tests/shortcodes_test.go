@@ -0,0 +1,82 @@
+package endpoint_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortcodeUsage(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.Shortcodes = []common.Shortcode{
+			{Name: "img", Plugin: "../../../plugins/image_shortcode.lua"},
+			{Name: "table", Plugin: "../../../plugins/table_shortcode.lua"},
+		}
+	})
+
+	markdown_block, _ := json.Marshal(common.MarkdownBlock{Content: "{{img:a.png}} and {{img:b.png}}"})
+	database_mock := mocks.DatabaseMock{
+		GetPostsContentHandler: func(limit int, offset int) ([]common.Post, error) {
+			return []common.Post{
+				{Id: 1, Title: "Trip", Content: "{{img:sky.png:Sky}} {{video:trip.mp4}}"},
+				{Id: 2, Title: "Plain", Content: "No shortcodes {{here}}"},
+			}, nil
+		},
+		GetPagesHandler: func(offset int, limit int) ([]common.Page, error) {
+			return []common.Page{{Id: 3, Title: "Landing", Link: "landing", Blocks: []common.Block{{Type: common.BLOCK_MARKDOWN, Data: markdown_block}}}}, nil
+		},
+		GetCardSchemasHandler: func(offset int, limit int) ([]common.CardSchema, error) {
+			return []common.CardSchema{{Uuid: "products", Title: "Products"}}, nil
+		},
+		GetCardsHandler: func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+			return []common.Card{{Id: "shoe", Content: `{"title": "Shoe", "gallery": ["{{img:shoe.png}}", "{{img:side.png}}"]}`}}, 1, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	req, _ := http.NewRequest(http.MethodGet, "/shortcodes", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response admin_app.GetShortcodesResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Shortcodes, 3)
+	assert.Equal(t, admin_app.ShortcodeUsage{
+		Name:   "img",
+		Plugin: "../../../plugins/image_shortcode.lua",
+		Content: []admin_app.ShortcodeContent{
+			{Type: "post", Id: "1", Title: "Trip"},
+			{Type: "page", Id: "landing", Title: "Landing"},
+			{Type: "card", Id: "shoe", Title: "Products"},
+		},
+	}, response.Shortcodes[0])
+	// Configured shortcodes are listed even when unused
+	assert.Equal(t, "table", response.Shortcodes[1].Name)
+	assert.Empty(t, response.Shortcodes[1].Content)
+	// Shortcodes missing in the config have no plugin
+	assert.Equal(t, admin_app.ShortcodeUsage{
+		Name:    "video",
+		Content: []admin_app.ShortcodeContent{{Type: "post", Id: "1", Title: "Trip"}},
+	}, response.Shortcodes[2])
+}
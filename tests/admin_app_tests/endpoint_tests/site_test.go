@@ -0,0 +1,117 @@
+package endpoint_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	admin_app "github.com/rbc33/gocms/admin-app"
+	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/plugins"
+	"github.com/rbc33/gocms/tests/mocks"
+	"github.com/rbc33/gocms/utils/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteAccess(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	defer common.GetSettings(*common.CurrentSettings())
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.Sites = []common.Site{{Id: 2, Name: "shop", Hosts: []string{"shop.example.com"}}}
+	})
+
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+
+	added_pages := 0
+	database_mock := mocks.DatabaseMock{
+		AddPageHandler: func(string, string, string, []common.Block, int) (int, error) {
+			added_pages++
+			return 1, nil
+		},
+		GetUserSitesHandler: func(user_id uint) ([]int, error) {
+			return []int{2}, nil
+		},
+	}
+	hooks := &plugins.Hooks{}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, hooks)
+
+	add_page := func(configure func(*http.Request)) int {
+		body, _ := json.Marshal(admin_app.AddPageRequest{Title: "Title", Content: "Content", Link: "link"})
+		req, _ := http.NewRequest(http.MethodPost, "/pages", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Add("content-type", "application/json")
+		configure(req)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The default site was not granted
+	assert.Equal(t, http.StatusForbidden, add_page(func(req *http.Request) {}))
+	assert.Equal(t, http.StatusCreated, add_page(func(req *http.Request) { req.Host = "shop.example.com" }))
+	assert.Equal(t, http.StatusCreated, add_page(func(req *http.Request) { req.Header.Set(common.SITE_HEADER, "2") }))
+	assert.Equal(t, http.StatusBadRequest, add_page(func(req *http.Request) { req.Header.Set(common.SITE_HEADER, "3") }))
+	assert.Equal(t, 2, added_pages)
+
+	req, _ := http.NewRequest(http.MethodGet, "/sites", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response admin_app.GetSitesResponse
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []admin_app.SiteResponse{{Id: 2, Name: "shop", Hosts: []string{"shop.example.com"}}}, response.Sites)
+}
+
+func TestSiteMedia(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		os.Setenv("API_SECRET", "fake_api_secret_for_tests")
+		os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
+	}
+	defer common.GetSettings(*common.CurrentSettings())
+	image_directory := t.TempDir()
+	common.UpdateSettings(func(settings *common.AppSettings) {
+		settings.ImageDirectory = image_directory
+		settings.Sites = []common.Site{{Id: 2, Name: "shop", Hosts: []string{"shop.example.com"}}}
+	})
+	require.Nil(t, os.WriteFile(filepath.Join(image_directory, "sky.png"), []byte("sky"), 0644))
+	shop_directory := common.SiteImageDirectory(2)
+	require.Nil(t, os.MkdirAll(shop_directory, 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(shop_directory, "shoe.png"), []byte("shoe"), 0644))
+
+	token, err := token.GenerateToken(1)
+	require.Nil(t, err)
+	database_mock := mocks.DatabaseMock{
+		GetUserSitesHandler: func(user_id uint) ([]int, error) {
+			return []int{2}, nil
+		},
+	}
+	router := admin_app.SetupRoutes(app_settings, plugins.ShortcodeHandlers{}, database_mock, &plugins.Hooks{})
+
+	delete_image := func(name string) int {
+		req, _ := http.NewRequest(http.MethodDelete, "/images/"+name, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Host = "shop.example.com"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The images of the default site are out of reach
+	assert.Equal(t, http.StatusNotFound, delete_image("sky.png"))
+	assert.FileExists(t, filepath.Join(image_directory, "sky.png"))
+
+	assert.Equal(t, http.StatusOK, delete_image("shoe.png"))
+	assert.NoFileExists(t, filepath.Join(shop_directory, "shoe.png"))
+}
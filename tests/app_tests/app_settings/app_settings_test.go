@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"testing"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 	"github.com/rbc33/gocms/common"
@@ -97,3 +99,137 @@ func TestWrongwebserverPortValueType(t *testing.T) {
 	_, err = common.ReadConfigToml(filepath)
 	assert.NotNil(t, err)
 }
+
+func TestSitesToml(t *testing.T) {
+	filepath, err := writeToml([]byte(`
+MY_SQL_URL = "test_database_uri"
+PORT = "99999"
+theme = "light"
+sticky_posts = [1]
+
+[navbar]
+links = [{ name = "Home", href = "/", title = "Home" }]
+
+[[site]]
+id = 2
+name = "Shop"
+hosts = ["shop.example.com", "*.shop.example.com"]
+theme = "dark"
+sticky_posts = [7]
+`))
+	require.Nil(t, err)
+
+	settings, err := common.ReadConfigToml(filepath)
+	require.Nil(t, err)
+
+	site := settings.SiteForHost("SHOP.example.com:8080")
+	assert.Equal(t, 2, site.Id)
+	assert.Equal(t, "dark", site.Theme)
+	assert.Equal(t, []int{7}, site.StickyPosts)
+	// The navbar is inherited
+	assert.Equal(t, settings.AppNavbar, site.AppNavbar)
+
+	assert.Equal(t, 2, settings.SiteForHost("eu.shop.example.com").Id)
+	default_site := settings.SiteForHost("example.com")
+	assert.Equal(t, common.DEFAULT_SITE_ID, default_site.Id)
+	assert.Equal(t, "light", default_site.Theme)
+	assert.Equal(t, []int{1}, default_site.StickyPosts)
+
+	_, exists := settings.SiteById(3)
+	assert.False(t, exists)
+}
+
+func TestDuplicateSiteHost(t *testing.T) {
+	filepath, err := writeToml([]byte(`
+MY_SQL_URL = "test_database_uri"
+PORT = "99999"
+
+[[site]]
+id = 2
+hosts = ["example.com"]
+
+[[site]]
+id = 3
+hosts = ["Example.com"]
+`))
+	require.Nil(t, err)
+
+	_, err = common.ReadConfigToml(filepath)
+	assert.ErrorContains(t, err, "host `example.com` is used by sites 2 and 3")
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer common.GetSettings(*common.CurrentSettings())
+
+	config_path := path.Join(t.TempDir(), "gocms_config.toml")
+	write_config := func(contents string) {
+		require.Nil(t, os.WriteFile(config_path, []byte(contents), 0644))
+	}
+	write_config(`
+MY_SQL_URL = "test_database_uri"
+PORT = "99999"
+sticky_posts = [1]
+`)
+	settings, err := common.ReadConfigToml(config_path)
+	require.Nil(t, err)
+	common.GetSettings(settings)
+
+	reloads := make(chan []int, 10)
+	common.OnSettingsReload(func(previous *common.AppSettings, settings *common.AppSettings) {
+		reloads <- settings.StickyPosts
+	})
+
+	watcher, err := common.WatchConfig(config_path)
+	require.Nil(t, err)
+	defer watcher.Close()
+
+	write_config(`
+MY_SQL_URL = "test_database_uri"
+PORT = "11111"
+sticky_posts = [1, 2]
+`)
+	select {
+	case sticky_posts := <-reloads:
+		assert.Equal(t, []int{1, 2}, sticky_posts)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the config was not reloaded")
+	}
+	assert.Equal(t, []int{1, 2}, common.CurrentSettings().StickyPosts)
+	// The port only changes on restart
+	assert.Equal(t, "99999", common.CurrentSettings().WebserverPort)
+
+	// Invalid configs are reported and the running one is kept
+	write_config(`
+MY_SQL_URL = "test_database_uri"
+PORT = "99999"
+sticky_posts = "nope"
+`)
+	assert.NotNil(t, common.ReloadConfig(config_path))
+	assert.Equal(t, []int{1, 2}, common.CurrentSettings().StickyPosts)
+}
+
+func TestSiteWithSettings(t *testing.T) {
+	site := common.Site{
+		Id:          2,
+		StickyPosts: []int{1},
+		AppNavbar:   common.Navbar{Links: []common.Link{{Name: "Home", Href: "/"}}},
+	}
+
+	assert.Nil(t, common.ValidateSetting("sticky_posts", []byte(`[2, 3]`)))
+	assert.NotNil(t, common.ValidateSetting("sticky_posts", []byte(`"2"`)))
+	assert.NotNil(t, common.ValidateSetting("navbar.links", []byte(`[{"name": "Home"}]`)))
+	assert.NotNil(t, common.ValidateSetting("theme", []byte(`"dark"`)))
+
+	changed := site.WithSettings(map[string]string{
+		"sticky_posts":     `[2, 3]`,
+		"navbar.links":     `[{"name": "Blog", "href": "/blog"}]`,
+		"recaptcha_secret": `42`,
+	})
+	assert.Equal(t, []int{2, 3}, changed.StickyPosts)
+	assert.Equal(t, []common.Link{{Name: "Blog", Href: "/blog"}}, changed.AppNavbar.Links)
+	// Invalid values are skipped
+	assert.Equal(t, "", changed.RecaptchaSecret)
+	// The config values are untouched
+	assert.Equal(t, []int{1}, site.StickyPosts)
+	assert.Equal(t, "Home", site.AppNavbar.Links[0].Name)
+}
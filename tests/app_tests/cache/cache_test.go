@@ -64,26 +64,34 @@ func TestCacheFailure(t *testing.T) {
 
 	cache := app.MakeCache(1, 10*time.Second, &FalseTimeMockValidator{})
 
-	rolling_size := uint64(0)
 	for _, test_case := range test_data {
 
-		rolling_size += uint64(len(test_case.contents))
 		err := cache.Store(test_case.name, test_case.contents)
 		assert.Nil(t, err)
-		assert.Equal(t, cache.Size(), rolling_size)
+		assert.Equal(t, cache.Size(), uint64(len(test_case.contents)))
 
 		_, err = cache.Get(test_case.name)
 		assert.NotNil(t, err)
+		assert.Equal(t, cache.Size(), uint64(0))
 	}
 }
 
-// Tests that storing over 10MB fails
+// Tests that storing over 10MB fails, and that a full
+// cache makes room by evicting the least recently used
 func TestCacheStoreMaxBytes(t *testing.T) {
-	cache := app.MakeCache(1, 10*time.Second, &FalseTimeMockValidator{})
+	cache := app.MakeCache(1, 10*time.Second, &TrueTimeMockValidator{})
 
-	err := cache.Store("fatty", make([]byte, 10000000))
+	err := cache.Store("too-fat", make([]byte, 10000001))
+	assert.NotNil(t, err)
+
+	err = cache.Store("fatty", make([]byte, 10000000))
 	assert.Nil(t, err)
 
 	err = cache.Store("slim", make([]byte, 1000))
+	assert.Nil(t, err)
+
+	_, err = cache.Get("fatty")
 	assert.NotNil(t, err)
+	assert.Equal(t, uint64(1000), cache.Size())
+	assert.Equal(t, uint64(1), cache.Metrics().Evictions)
 }
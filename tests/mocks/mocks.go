@@ -4,22 +4,52 @@ import (
 	"fmt"
 
 	"github.com/rbc33/gocms/common"
+	"github.com/rbc33/gocms/database"
 )
 
 type DatabaseMock struct {
 	GetPostHandler           func(int) (common.Post, error)
 	GetPostsHandler          func(int, int) ([]common.Post, error)
-	AddPageHandler           func(string, string, string) (int, error)
+	GetPostsContentHandler   func(int, int) ([]common.Post, error)
+	AddPostHandler           func(string, string, string) (int, error)
+	ChangePostHandler        func(id int, title string, excerpt string, content string) error
+	DeletePostHandler        func(id int) error
+	AddPostPreviewHandler    func(preview common.PostPreview) (string, error)
+	GetPostPreviewHandler    func(uuid string) (common.PostPreview, error)
+	AddPageHandler           func(string, string, string, []common.Block, int) (int, error)
 	GetPagesHandler          func(int, int) ([]common.Page, error)
+	GetPageTreeHandler       func() ([]common.Page, error)
+	GetPageRedirectHandler   func(link string) (int, error)
+	MovePagesHandler         func(pages []common.Page) error
 	AddCardHandler           func(string, string, string) (string, error)
-	GetCardsHandler          func(schema_uuid string, limit int, page int) ([]common.Card, error)
+	GetCardHandler           func(uuid string) (common.Card, error)
+	ChangeCardHandler        func(uuid string, image_location *string, json_data string) error
+	DeleteCardHandler        func(uuid string) error
+	GetCardsHandler          func(schema_uuid string, query common.CardQuery) ([]common.Card, int, error)
+	GetCardFacetsHandler     func(schema_uuid string, fields []common.CardField, filters []common.CardFilter) ([]common.CardFacet, error)
 	AddChardSchemaHandler    func(string, string) (string, error)
 	GetCardSchemaHandler     func(uuid string) (common.CardSchema, error)
+	GetCardSchemasHandler    func(offset int, limit int) ([]common.CardSchema, error)
+	GetSchemaVersionsHandler func(uuid string) ([]common.CardSchemaVersion, error)
+	CheckCardSchemaHandler   func(uuid string, json_schema string, transform []common.PatchOperation) ([]common.CardFailure, error)
+	ChangeCardSchemaHandler  func(uuid string, json_schema string, transform []common.PatchOperation) (int, error)
+	GetPageHandler           func(link string) (common.Page, error)
+	GetPageByIdHandler       func(id int) (common.Page, error)
+	ChangePageHandler        func(id int, title string, content string, link string, blocks []common.Block) error
+	DeletePageHandler        func(link string) error
 	AddPermalinkHandler      func(common.Permalink) (int, error)
 	GetPermalinksHandler     func() ([]common.Permalink, error)
 	CreateUserHandler        func(user common.User) (int, error)
 	GetUserByUsernameHandler func(username string) (common.User, error)
 	GetUserByIdHandler       func(id uint) (common.User, error)
+	GetUserSitesHandler      func(user_id uint) ([]int, error)
+	GetSettingsHandler       func() (map[string]string, error)
+	SetSettingsHandler       func(values map[string]string) error
+	DeleteSettingHandler     func(name string) error
+	GetMenusHandler          func() ([]common.Menu, error)
+	AddMenuHandler           func(name string, location string) (int, error)
+	AddMenuItemHandler       func(menu_id int, item common.MenuItem) (int, error)
+	MoveMenuItemsHandler     func(menu_id int, items []common.MenuItem) error
 }
 
 func (db DatabaseMock) GetPosts(offset int, limit int) ([]common.Post, error) {
@@ -29,8 +59,15 @@ func (db DatabaseMock) GetPosts(offset int, limit int) ([]common.Post, error) {
 	return nil, fmt.Errorf("GetPostsHandler not set")
 }
 
+func (db DatabaseMock) GetPostsContent(limit int, offset int) ([]common.Post, error) {
+	if db.GetPostsContentHandler != nil {
+		return db.GetPostsContentHandler(limit, offset)
+	}
+	return nil, fmt.Errorf("GetPostsContentHandler not set")
+}
+
 func (db DatabaseMock) GetPages(offset int, limit int) ([]common.Page, error) {
-	if db.GetPostsHandler != nil {
+	if db.GetPagesHandler != nil {
 		return db.GetPagesHandler(offset, limit)
 	}
 	return nil, fmt.Errorf("GetPageHandler not set")
@@ -44,19 +81,42 @@ func (db DatabaseMock) GetPost(post_id int) (common.Post, error) {
 }
 
 func (db DatabaseMock) AddPost(title string, excerpt string, content string) (int, error) {
+	if db.AddPostHandler != nil {
+		return db.AddPostHandler(title, excerpt, content)
+	}
 	// Simulate successful post addition with a positive ID.
 	// This helps TestCreatePost_Success satisfy the ID check.
 	return 0, nil
 }
 
 func (db DatabaseMock) ChangePost(id int, title string, excerpt string, content string) error {
+	if db.ChangePostHandler != nil {
+		return db.ChangePostHandler(id, title, excerpt, content)
+	}
 	return nil
 }
 
 func (db DatabaseMock) DeletePost(id int) error {
+	if db.DeletePostHandler != nil {
+		return db.DeletePostHandler(id)
+	}
 	return fmt.Errorf("not implemented")
 }
 
+func (db DatabaseMock) AddPostPreview(preview common.PostPreview) (string, error) {
+	if db.AddPostPreviewHandler != nil {
+		return db.AddPostPreviewHandler(preview)
+	}
+	return "", fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) GetPostPreview(uuid string) (common.PostPreview, error) {
+	if db.GetPostPreviewHandler != nil {
+		return db.GetPostPreviewHandler(uuid)
+	}
+	return common.PostPreview{}, fmt.Errorf("not implemented")
+}
+
 func (db DatabaseMock) AddImage(postID string, imageData string, imageType string) error {
 	return fmt.Errorf("not implemented")
 }
@@ -64,48 +124,138 @@ func (db DatabaseMock) AddImage(postID string, imageData string, imageType strin
 //	func (db DatabaseMock) GetCard(uuid string) (common.Card, error) {
 //		return common.Card{}, fmt.Errorf("not implemented")
 //	}
-func (db DatabaseMock) GetCards(schema_uuid string, limit int, page int) ([]common.Card, error) {
-	return []common.Card{}, fmt.Errorf("not implemented")
+func (db DatabaseMock) GetCards(schema_uuid string, query common.CardQuery) ([]common.Card, int, error) {
+	if db.GetCardsHandler != nil {
+		return db.GetCardsHandler(schema_uuid, query)
+	}
+	return []common.Card{}, 0, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) GetCardFacets(schema_uuid string, fields []common.CardField, filters []common.CardFilter) ([]common.CardFacet, error) {
+	if db.GetCardFacetsHandler != nil {
+		return db.GetCardFacetsHandler(schema_uuid, fields, filters)
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) GetCard(uuid string) (common.Card, error) {
+	if db.GetCardHandler != nil {
+		return db.GetCardHandler(uuid)
+	}
+	return common.Card{}, fmt.Errorf("not implemented")
 }
 
 func (db DatabaseMock) AddCard(image string, schema_uuid string, content string) (string, error) {
+	if db.AddCardHandler != nil {
+		return db.AddCardHandler(image, schema_uuid, content)
+	}
 	return "", fmt.Errorf("not implemented")
 }
-func (db DatabaseMock) ChangeCard(uuid string, image_location string, json_data string, schema_data string) error {
+func (db DatabaseMock) ChangeCard(uuid string, image_location *string, json_data string) error {
+	if db.ChangeCardHandler != nil {
+		return db.ChangeCardHandler(uuid, image_location, json_data)
+	}
 	return fmt.Errorf("not implemented")
 }
 func (db DatabaseMock) DeleteCard(uuid string) error {
+	if db.DeleteCardHandler != nil {
+		return db.DeleteCardHandler(uuid)
+	}
 	return fmt.Errorf("not implemented")
 }
 func (db DatabaseMock) DeleteImage(uuid string) error {
 	return fmt.Errorf("not implemented")
 }
 
-func (db DatabaseMock) AddPage(title string, content string, link string) (int, error) {
-	return db.AddPageHandler(title, content, link)
+func (db DatabaseMock) AddPage(title string, content string, link string, blocks []common.Block, parent_id int) (int, error) {
+	return db.AddPageHandler(title, content, link, blocks, parent_id)
 }
 func (db DatabaseMock) AddCardSchema(json_schema string, json_title string) (string, error) {
 	return "", fmt.Errorf("not implemented")
 }
 func (db DatabaseMock) GetCardSchema(uuid string) (common.CardSchema, error) {
+	if db.GetCardSchemaHandler != nil {
+		return db.GetCardSchemaHandler(uuid)
+	}
 	return common.CardSchema{}, fmt.Errorf("not implemented")
 }
 func (db DatabaseMock) DeleteCardSchema(uuid string) error {
 	return fmt.Errorf("not implemented")
 }
 func (db DatabaseMock) GetCardSchemas(offset int, limit int) ([]common.CardSchema, error) {
+	if db.GetCardSchemasHandler != nil {
+		return db.GetCardSchemasHandler(offset, limit)
+	}
 	return []common.CardSchema{}, fmt.Errorf("not implemented")
 }
 
+func (db DatabaseMock) GetCardSchemaVersions(uuid string) ([]common.CardSchemaVersion, error) {
+	if db.GetSchemaVersionsHandler != nil {
+		return db.GetSchemaVersionsHandler(uuid)
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) CheckCardSchema(uuid string, json_schema string, transform []common.PatchOperation) ([]common.CardFailure, error) {
+	if db.CheckCardSchemaHandler != nil {
+		return db.CheckCardSchemaHandler(uuid, json_schema, transform)
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) ChangeCardSchema(uuid string, json_schema string, transform []common.PatchOperation) (int, error) {
+	if db.ChangeCardSchemaHandler != nil {
+		return db.ChangeCardSchemaHandler(uuid, json_schema, transform)
+	}
+	return 0, fmt.Errorf("not implemented")
+}
+
 func (db DatabaseMock) GetPage(link string) (common.Page, error) {
+	if db.GetPageHandler != nil {
+		return db.GetPageHandler(link)
+	}
+	return common.Page{}, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) GetPageById(id int) (common.Page, error) {
+	if db.GetPageByIdHandler != nil {
+		return db.GetPageByIdHandler(id)
+	}
 	return common.Page{}, fmt.Errorf("not implemented")
 }
 
-func (db DatabaseMock) ChangePage(id int, title string, content string, link string) (err error) {
+func (db DatabaseMock) GetPageTree() ([]common.Page, error) {
+	if db.GetPageTreeHandler != nil {
+		return db.GetPageTreeHandler()
+	}
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) GetPageRedirect(link string) (int, error) {
+	if db.GetPageRedirectHandler != nil {
+		return db.GetPageRedirectHandler(link)
+	}
+	return 0, fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) MovePages(pages []common.Page) error {
+	if db.MovePagesHandler != nil {
+		return db.MovePagesHandler(pages)
+	}
+	return fmt.Errorf("not implemented")
+}
+
+func (db DatabaseMock) ChangePage(id int, title string, content string, link string, blocks []common.Block) (err error) {
+	if db.ChangePageHandler != nil {
+		return db.ChangePageHandler(id, title, content, link, blocks)
+	}
 	return fmt.Errorf("not implemented")
 }
 
 func (db DatabaseMock) DeletePage(link string) error {
+	if db.DeletePageHandler != nil {
+		return db.DeletePageHandler(link)
+	}
 	return fmt.Errorf("not implemented")
 }
 
@@ -125,3 +275,82 @@ func (db DatabaseMock) GetUserByUsername(username string) (common.User, error) {
 func (db DatabaseMock) GetUserById(id uint) (common.User, error) {
 	return db.GetUserByIdHandler(id)
 }
+
+func (db DatabaseMock) GetUserSites(user_id uint) ([]int, error) {
+	if db.GetUserSitesHandler != nil {
+		return db.GetUserSitesHandler(user_id)
+	}
+	return []int{common.DEFAULT_SITE_ID}, nil
+}
+func (db DatabaseMock) AddUserSite(user_id uint, site_id int) error {
+	return nil
+}
+func (db DatabaseMock) ForSite(site_id int) database.Database {
+	return db
+}
+func (db DatabaseMock) GetSettings() (map[string]string, error) {
+	if db.GetSettingsHandler != nil {
+		return db.GetSettingsHandler()
+	}
+	return map[string]string{}, nil
+}
+func (db DatabaseMock) SetSettings(values map[string]string) error {
+	if db.SetSettingsHandler != nil {
+		return db.SetSettingsHandler(values)
+	}
+	return nil
+}
+func (db DatabaseMock) DeleteSetting(name string) error {
+	if db.DeleteSettingHandler != nil {
+		return db.DeleteSettingHandler(name)
+	}
+	return nil
+}
+func (db DatabaseMock) GetMenus() ([]common.Menu, error) {
+	if db.GetMenusHandler != nil {
+		return db.GetMenusHandler()
+	}
+	return []common.Menu{}, nil
+}
+func (db DatabaseMock) GetMenu(id int) (common.Menu, error) {
+	menus, err := db.GetMenus()
+	if err != nil {
+		return common.Menu{}, err
+	}
+	for _, menu := range menus {
+		if menu.Id == id {
+			return menu, nil
+		}
+	}
+	return common.Menu{}, fmt.Errorf("menu %d not found", id)
+}
+func (db DatabaseMock) AddMenu(name string, location string) (int, error) {
+	if db.AddMenuHandler != nil {
+		return db.AddMenuHandler(name, location)
+	}
+	return 1, nil
+}
+func (db DatabaseMock) ChangeMenu(id int, name string, location string) error {
+	return nil
+}
+func (db DatabaseMock) DeleteMenu(id int) error {
+	return nil
+}
+func (db DatabaseMock) AddMenuItem(menu_id int, item common.MenuItem) (int, error) {
+	if db.AddMenuItemHandler != nil {
+		return db.AddMenuItemHandler(menu_id, item)
+	}
+	return 1, nil
+}
+func (db DatabaseMock) ChangeMenuItem(item common.MenuItem) error {
+	return nil
+}
+func (db DatabaseMock) DeleteMenuItem(id int) error {
+	return nil
+}
+func (db DatabaseMock) MoveMenuItems(menu_id int, items []common.MenuItem) error {
+	if db.MoveMenuItemsHandler != nil {
+		return db.MoveMenuItemsHandler(menu_id, items)
+	}
+	return nil
+}
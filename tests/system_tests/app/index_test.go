@@ -25,7 +25,7 @@ func TestIndexPing(t *testing.T) {
 			}, nil
 		},
 	}
-	r := app.SetupRoutes(common.Settings, &database_mock)
+	r := app.SetupRoutes(*common.CurrentSettings(), &database_mock)
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/", nil)
 	r.ServeHTTP(w, req)